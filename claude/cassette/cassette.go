@@ -0,0 +1,158 @@
+// Package cassette records the wire traffic between the SDK and the Claude
+// CLI and replays it without a CLI. A Recorder wraps the launcher of a
+// transport and writes everything the SDK sends to the CLI's stdin and reads
+// from its stdout and stderr, with timestamps, to a JSONL cassette:
+//
+//	f, _ := os.Create("session.jsonl")
+//	recorder := cassette.NewRecorder(f, nil)
+//	client, _ := claude.NewClient(claude.WithLauncher(recorder))
+//
+// A Player launches processes that play a cassette back: it emits the
+// recorded CLI output in order, waits for each message the SDK sent during
+// the recording and answers the SDK's control requests with the recorded
+// responses. Hooks, permission callbacks and SDK MCP tools thus run against
+// real CLI behavior offline, and Player.Err reports where the SDK's messages
+// diverge from the recording:
+//
+//	c, _ := cassette.LoadFile("testdata/session.jsonl")
+//	player := cassette.NewPlayer(c)
+//	client, _ := claude.NewClient(claude.WithLauncher(player), claude.WithCanUseTool(policy))
+//	// ... drive the client as in the recorded session ...
+//	if err := player.Err(); err != nil {
+//	    t.Fatal(err)
+//	}
+//
+// Cassettes hold the prompts, responses, stderr and CLI arguments of the
+// session, but not its environment. Secret flag values in the arguments are
+// masked; message contents are recorded unless a WithRedact hook masks them.
+// Review cassettes before sharing.
+package cassette
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Kind identifies what an Entry records.
+type Kind string
+
+// Entry kinds.
+const (
+	// KindLaunch starts a process; Args holds its arguments.
+	KindLaunch Kind = "launch"
+	// KindSend is a line the SDK wrote to the CLI's stdin.
+	KindSend Kind = "send"
+	// KindClose is the SDK closing the CLI's stdin.
+	KindClose Kind = "close"
+	// KindReceive is a line the CLI wrote to stdout.
+	KindReceive Kind = "receive"
+	// KindStderr is a line the CLI wrote to stderr.
+	KindStderr Kind = "stderr"
+	// KindExit ends a process; Code and Signal describe how.
+	KindExit Kind = "exit"
+)
+
+// Entry is one line of a cassette.
+type Entry struct {
+	// Time is when the traffic was seen.
+	Time time.Time `json:"time"`
+	// Process numbers the launches of the recording, from 1.
+	Process int `json:"process"`
+	// Kind is what the entry records.
+	Kind Kind `json:"kind"`
+
+	// Message is the JSON line of a send or receive entry.
+	Message json.RawMessage `json:"message,omitempty"`
+	// Text is a stderr line, or a stdout line that is not JSON.
+	Text string `json:"text,omitempty"`
+
+	// Args are the CLI arguments of a launch entry.
+	Args []string `json:"args,omitempty"`
+	// Code is the exit code of an exit entry, -1 after a signal.
+	Code int `json:"code,omitempty"`
+	// Signal names the signal that ended the process, if any.
+	Signal string `json:"signal,omitempty"`
+}
+
+// Cassette is a recorded session.
+type Cassette struct {
+	Entries []Entry
+}
+
+// Load reads a cassette from r.
+func Load(r io.Reader) (*Cassette, error) {
+	c := &Cassette{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %w", line, err)
+		}
+		c.Entries = append(c.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	return c, nil
+}
+
+// LoadFile reads the cassette at path.
+func LoadFile(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Processes returns the number of processes launched in the recording.
+func (c *Cassette) Processes() int {
+	n := 0
+	for _, entry := range c.Entries {
+		if entry.Kind == KindLaunch {
+			n++
+		}
+	}
+	return n
+}
+
+// process returns the entries of the n-th process after its launch entry.
+func (c *Cassette) process(n int) []Entry {
+	var entries []Entry
+	for _, entry := range c.Entries {
+		if entry.Process == n && entry.Kind != KindLaunch {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// signalName returns a portable name for sig.
+func signalName(sig os.Signal) string {
+	if sig == nil {
+		return ""
+	}
+	switch sig {
+	case os.Interrupt:
+		return "interrupt"
+	case os.Kill:
+		return "kill"
+	default:
+		return sig.String()
+	}
+}
+
+// recordedSignal is a signal read from a cassette.
+type recordedSignal string
+
+func (s recordedSignal) String() string { return string(s) }
+func (s recordedSignal) Signal()        {}
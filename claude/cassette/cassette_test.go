@@ -0,0 +1,254 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// permissionCLI answers the initialize request, asks permission for a Bash
+// call on the first user message and reports the decision as the session ID.
+func permissionCLI(_ context.Context, _ subprocess.LaunchSpec, stdin io.Reader, stdout, stderr io.Writer) int {
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		var msg map[string]any
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		switch msg["type"] {
+		case subprocess.MessageTypeControlRequest:
+			fmt.Fprintf(stdout, `{"type":"control_response","response":{"subtype":"success","request_id":%q,"response":{}}}`+"\n", msg["request_id"])
+		case "user":
+			fmt.Fprintln(stderr, "asking permission")
+			fmt.Fprintln(stdout, `{"type":"control_request","request_id":"cli_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"},"tool_use_id":"toolu_1"}}`)
+			if !scanner.Scan() {
+				return 1
+			}
+			behavior := "unknown"
+			var response struct {
+				Response struct {
+					Response struct {
+						Behavior string `json:"behavior"`
+					} `json:"response"`
+				} `json:"response"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &response) == nil {
+				behavior = response.Response.Response.Behavior
+			}
+			fmt.Fprintf(stdout, `{"type":"result","subtype":"success","session_id":%q}`+"\n", behavior)
+		}
+	}
+	return 0
+}
+
+func allow(context.Context, string, map[string]any, shared.CanUseToolOptions) (shared.PermissionResult, error) {
+	return shared.NewPermissionResultAllow(), nil
+}
+
+func deny(context.Context, string, map[string]any, shared.CanUseToolOptions) (shared.PermissionResult, error) {
+	return shared.NewPermissionResultDeny("no"), nil
+}
+
+// runSession asks for one turn through launcher and returns the session ID
+// of its result.
+func runSession(t *testing.T, launcher subprocess.Launcher, canUseTool shared.CanUseToolCallback) string {
+	t.Helper()
+
+	transport, err := subprocess.NewTransport(&subprocess.TransportConfig{
+		CLIPath:    "claude",
+		CanUseTool: canUseTool,
+		Launcher:   launcher,
+		// Keeps the CLI's stderr out of the error channel
+		StderrCallback: func(string) {},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "list the files"))
+
+	for {
+		select {
+		case msg, ok := <-msgChan:
+			require.True(t, ok, "stream closed before the result")
+			if result, ok := msg.(*shared.ResultMessage); ok {
+				require.NoError(t, transport.Close())
+				return result.SessionID
+			}
+		case err := <-errChan:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the result")
+		}
+	}
+}
+
+// record records a session with the permission CLI.
+func record(t *testing.T) *Cassette {
+	t.Helper()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf, subprocess.FuncLauncher(permissionCLI))
+	require.Equal(t, "allow", runSession(t, recorder, allow))
+	require.NoError(t, recorder.Err())
+
+	c, err := Load(&buf)
+	require.NoError(t, err)
+	return c
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	c := record(t)
+	require.Equal(t, 1, c.Processes())
+
+	var kinds []Kind
+	var stderr []string
+	for _, entry := range c.Entries {
+		assert.Equal(t, 1, entry.Process)
+		assert.False(t, entry.Time.IsZero())
+		kinds = append(kinds, entry.Kind)
+		if entry.Kind == KindStderr {
+			stderr = append(stderr, entry.Text)
+		}
+	}
+	assert.Equal(t, KindLaunch, kinds[0])
+	assert.Contains(t, kinds, KindSend)
+	assert.Contains(t, kinds, KindReceive)
+	assert.Contains(t, kinds, KindClose)
+	assert.Contains(t, kinds, KindExit)
+	assert.Equal(t, []string{"asking permission"}, stderr)
+}
+
+func TestRecorder_RedactsArgs(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf, subprocess.FuncLauncher(func(context.Context, subprocess.LaunchSpec, io.Reader, io.Writer, io.Writer) int {
+		return 0
+	}))
+	proc, err := recorder.Launch(context.Background(), subprocess.LaunchSpec{
+		Path: "claude",
+		Args: []string{"--mcp-config", `{"mcpServers":{"db":{"env":{"PASSWORD":"x"}}}}`, "--system-prompt", "be terse", "--model", "m"},
+	})
+	require.NoError(t, err)
+	_, _ = proc.Wait()
+
+	c, err := Load(&buf)
+	require.NoError(t, err)
+	require.NotEmpty(t, c.Entries)
+	assert.Equal(t, []string{"--mcp-config", shared.Redacted, "--system-prompt", shared.Redacted, "--model", "m"}, c.Entries[0].Args)
+}
+
+func TestRecorder_RedactHook(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	var kinds sync.Map
+	redact := func(kind Kind, line []byte) []byte {
+		kinds.Store(kind, true)
+		line = bytes.ReplaceAll(line, []byte("list the files"), []byte(shared.Redacted))
+		return bytes.ReplaceAll(line, []byte("asking permission"), []byte(shared.Redacted))
+	}
+	recorder := NewRecorder(&buf, subprocess.FuncLauncher(permissionCLI), WithRedact(redact))
+	require.Equal(t, "allow", runSession(t, recorder, allow))
+	require.NoError(t, recorder.Err())
+	recorded := buf.String()
+	assert.NotContains(t, recorded, "list the files")
+	assert.NotContains(t, recorded, "asking permission")
+	for _, kind := range []Kind{KindSend, KindReceive, KindStderr} {
+		_, ok := kinds.Load(kind)
+		assert.True(t, ok, "no %s line passed the hook", kind)
+	}
+
+	// The redacted cassette still plays, given the same hook
+	c, err := Load(strings.NewReader(recorded))
+	require.NoError(t, err)
+	player := NewPlayer(c)
+	player.Redact = redact
+	assert.Equal(t, "allow", runSession(t, player, allow))
+	assert.NoError(t, player.Err())
+}
+
+func TestPlayer_Replays(t *testing.T) {
+	t.Parallel()
+
+	player := NewPlayer(record(t))
+	assert.Equal(t, "allow", runSession(t, player, allow))
+	assert.NoError(t, player.Err())
+
+	_, err := player.Launch(context.Background(), subprocess.LaunchSpec{})
+	assert.ErrorIs(t, err, ErrNoProcess)
+}
+
+func TestPlayer_ReportsDivergence(t *testing.T) {
+	t.Parallel()
+
+	// The recorded CLI output is replayed regardless of the new decision
+	player := NewPlayer(record(t))
+	assert.Equal(t, "allow", runSession(t, player, deny))
+
+	err := player.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"behavior":"deny"`)
+}
+
+func TestPlayer_ReportsMissingMessage(t *testing.T) {
+	t.Parallel()
+
+	c := &Cassette{Entries: []Entry{
+		{Process: 1, Kind: KindLaunch},
+		{Process: 1, Kind: KindSend, Message: json.RawMessage(`{"type":"user"}`)},
+		{Process: 1, Kind: KindExit},
+	}}
+	player := NewPlayer(c)
+	player.Timeout = 10 * time.Millisecond
+
+	proc, err := player.Launch(context.Background(), subprocess.LaunchSpec{})
+	require.NoError(t, err)
+	state, err := proc.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 0, state.Code)
+	assert.ErrorContains(t, player.Err(), "no user sent")
+}
+
+func TestPlayer_ControlTransport(t *testing.T) {
+	t.Parallel()
+
+	c := &Cassette{Entries: []Entry{
+		{Process: 1, Kind: KindLaunch},
+		{Process: 1, Kind: KindSend, Message: json.RawMessage(`{"type":"control_request","request_id":"req_1_abc","request":{"subtype":"interrupt"}}`)},
+		{Process: 1, Kind: KindReceive, Message: json.RawMessage(`{"type":"control_response","response":{"subtype":"success","request_id":"req_1_abc","response":{}}}`)},
+	}}
+	player := NewPlayer(c)
+	transport, err := player.ControlTransport()
+	require.NoError(t, err)
+	defer transport.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := transport.Read(ctx)
+
+	// Answered under the ID the SDK used, not the recorded one
+	require.NoError(t, transport.Write(ctx, []byte(`{"type":"control_request","request_id":"req_7_xyz","request":{"subtype":"interrupt"}}`+"\n")))
+	select {
+	case line := <-lines:
+		assert.Contains(t, string(line), `"request_id":"req_7_xyz"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the response")
+	}
+	assert.NoError(t, player.Err())
+}
@@ -0,0 +1,497 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+)
+
+// DefaultTimeout is how long a Player waits for a message the SDK sent in
+// the recording.
+const DefaultTimeout = 10 * time.Second
+
+// ErrNoProcess is returned by a Player launching more processes than the
+// recording did.
+var ErrNoProcess = errors.New("cassette has no more processes")
+
+// Player is a subprocess.Launcher whose processes play a cassette back, one
+// recorded process per launch. A process emits the recorded stdout and
+// stderr lines in order. At each line the SDK sent, it waits for the SDK to
+// send the matching message before going on, and rewrites the request IDs
+// of the recorded responses to those of the SDK's requests. Playback does
+// not wait out the recorded timestamps.
+//
+// Messages are matched by kind: the SDK's control requests by subtype, its
+// responses by the ID of the CLI's request, other messages by type. A
+// matching message whose content differs, one that does not arrive within
+// Timeout and one the recording lacks are reported by Err.
+type Player struct {
+	// Timeout bounds the wait for each message the SDK sent in the
+	// recording. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// Redact, if set, rewrites each message the SDK sends before it is
+	// compared with the recording. Set it to the WithRedact hook of a
+	// redacted cassette's recorder.
+	Redact func(kind Kind, line []byte) []byte
+
+	cassette *Cassette
+
+	mu        sync.Mutex
+	processes int
+	errs      []error
+}
+
+// NewPlayer returns a Player of c.
+func NewPlayer(c *Cassette) *Player {
+	return &Player{cassette: c}
+}
+
+// Launch starts playing the next recorded process.
+func (p *Player) Launch(ctx context.Context, _ subprocess.LaunchSpec) (subprocess.Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.next()
+}
+
+// ControlTransport starts playing the next recorded process and returns it
+// as a subprocess.ControlTransport, for driving a Protocol without a
+// Transport. Read delivers the recorded stdout lines; stderr is dropped.
+func (p *Player) ControlTransport() (subprocess.ControlTransport, error) {
+	proc, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	go func() { _, _ = io.Copy(io.Discard, proc.stderrR) }()
+	return &controlTransport{proc: proc}, nil
+}
+
+// Err reports how the SDK's messages diverged from the recording, or nil if
+// they did not.
+func (p *Player) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(p.errs...)
+}
+
+// next starts playing the next recorded process.
+func (p *Player) next() (*playback, error) {
+	p.mu.Lock()
+	if p.processes >= p.cassette.Processes() {
+		p.mu.Unlock()
+		return nil, ErrNoProcess
+	}
+	p.processes++
+	n := p.processes
+	p.mu.Unlock()
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	pb := &playback{
+		player:   p,
+		n:        n,
+		entries:  p.cassette.process(n),
+		timeout:  timeout,
+		ids:      make(map[string]string),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		received: make(chan struct{}, 1),
+	}
+	pb.stdoutR, pb.stdoutW = io.Pipe()
+	pb.stderrR, pb.stderrW = io.Pipe()
+	pb.stdin = &playbackStdin{pb: pb}
+	go pb.run()
+	return pb, nil
+}
+
+// diverged records a divergence of process n from the recording.
+func (p *Player) diverged(n int, format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errs = append(p.errs, fmt.Errorf("process %d: %s", n, fmt.Sprintf(format, args...)))
+}
+
+// sent is a message the SDK wrote during playback.
+type sent struct {
+	raw []byte
+	msg map[string]any
+}
+
+// playback is a recorded process being played back.
+type playback struct {
+	player  *Player
+	n       int
+	entries []Entry
+	timeout time.Duration
+
+	stdin            *playbackStdin
+	stdoutR, stderrR *io.PipeReader
+	stdoutW, stderrW *io.PipeWriter
+
+	mu       sync.Mutex
+	pending  []sent            // messages the SDK sent, not matched yet
+	closed   bool              // the SDK closed stdin
+	ids      map[string]string // recorded request ID to the SDK's
+	received chan struct{}     // signalled when pending or closed changes
+
+	stopOnce sync.Once
+	stop     chan struct{} // closed by Signal
+	signal   os.Signal
+	done     chan struct{} // closed once playback ended
+	state    subprocess.ExitState
+}
+
+func (pb *playback) Pid() int              { return 0 }
+func (pb *playback) Stdin() io.WriteCloser { return pb.stdin }
+func (pb *playback) Stdout() io.ReadCloser { return pb.stdoutR }
+func (pb *playback) Stderr() io.ReadCloser { return pb.stderrR }
+func (pb *playback) Wait() (subprocess.ExitState, error) {
+	<-pb.done
+	return pb.state, nil
+}
+
+// Signal ends the playback as if the process had been killed by sig.
+func (pb *playback) Signal(sig os.Signal) error {
+	select {
+	case <-pb.done:
+		return os.ErrProcessDone
+	default:
+	}
+	pb.stopOnce.Do(func() {
+		pb.signal = sig
+		close(pb.stop)
+	})
+	return nil
+}
+
+// run plays the entries back and exits as recorded. The exit entry is
+// applied last, since the recorder may see the exit before the last output.
+func (pb *playback) run() {
+	state := subprocess.ExitState{}
+	defer func() {
+		_ = pb.stdoutW.Close()
+		_ = pb.stderrW.Close()
+		pb.reportUnexpected()
+		pb.state = state
+		close(pb.done)
+	}()
+
+	for _, entry := range pb.entries {
+		var ok bool
+		switch entry.Kind {
+		case KindReceive:
+			ok = pb.emit(pb.stdoutW, pb.rewrite(entry))
+		case KindStderr:
+			ok = pb.emit(pb.stderrW, []byte(entry.Text))
+		case KindSend:
+			ok = pb.expect(entry)
+		case KindClose:
+			ok = pb.expectClose()
+		case KindExit:
+			state.Code = entry.Code
+			if entry.Signal != "" {
+				state.Signal = recordedSignal(entry.Signal)
+			}
+			ok = true
+		default:
+			ok = true
+		}
+		if !ok {
+			if pb.stopped() {
+				state = subprocess.ExitState{Code: -1, Signal: pb.signal}
+			}
+			return
+		}
+	}
+}
+
+// stopped reports whether Signal ended the playback.
+func (pb *playback) stopped() bool {
+	select {
+	case <-pb.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// emit writes a recorded line to w. It reports false once the playback was
+// stopped or the reader has gone.
+func (pb *playback) emit(w *io.PipeWriter, line []byte) bool {
+	if pb.stopped() {
+		return false
+	}
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.Write(append(append([]byte(nil), line...), '\n'))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		return err == nil
+	case <-pb.stop:
+		_ = w.CloseWithError(io.ErrClosedPipe)
+		<-written
+		return false
+	}
+}
+
+// rewrite returns the recorded stdout line of entry, with the request ID of
+// a response to the SDK replaced by that of the SDK's request.
+func (pb *playback) rewrite(entry Entry) []byte {
+	if entry.Message == nil {
+		return []byte(entry.Text)
+	}
+	var msg map[string]any
+	if json.Unmarshal(entry.Message, &msg) != nil || msg["type"] != subprocess.MessageTypeControlResponse {
+		return entry.Message
+	}
+	response, _ := msg["response"].(map[string]any)
+	id, _ := response["request_id"].(string)
+
+	pb.mu.Lock()
+	actual, ok := pb.ids[id]
+	pb.mu.Unlock()
+	if !ok {
+		return entry.Message
+	}
+	response["request_id"] = actual
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return entry.Message
+	}
+	return data
+}
+
+// expect waits for the SDK to send the message of entry and compares them.
+// A missing message ends the playback.
+func (pb *playback) expect(entry Entry) bool {
+	var want map[string]any
+	if err := json.Unmarshal(entry.Message, &want); err != nil {
+		pb.player.diverged(pb.n, "recorded message is not a JSON object: %s", entry.Message)
+		return true
+	}
+	key := matchKey(want)
+
+	got, ok := pb.await(func() (sent, bool) {
+		for i, s := range pb.pending {
+			if matchKey(s.msg) == key {
+				pb.pending = append(pb.pending[:i], pb.pending[i+1:]...)
+				return s, true
+			}
+		}
+		return sent{}, false
+	})
+	if !ok {
+		if !pb.stopped() {
+			pb.player.diverged(pb.n, "no %s sent within %s, recorded %s", key, pb.timeout, entry.Message)
+		}
+		return false
+	}
+
+	// The SDK numbers its requests afresh; answer them under its IDs
+	if recorded, actual := requestID(want), requestID(got.msg); recorded != "" && actual != "" {
+		pb.mu.Lock()
+		pb.ids[recorded] = actual
+		pb.mu.Unlock()
+		delete(want, "request_id")
+		delete(got.msg, "request_id")
+	}
+	if !reflect.DeepEqual(want, got.msg) {
+		pb.player.diverged(pb.n, "sent %s, recorded %s", bytes.TrimSpace(got.raw), entry.Message)
+	}
+	return true
+}
+
+// expectClose waits for the SDK to close stdin.
+func (pb *playback) expectClose() bool {
+	_, ok := pb.await(func() (sent, bool) { return sent{}, pb.closed })
+	if !ok && !pb.stopped() {
+		pb.player.diverged(pb.n, "stdin not closed within %s", pb.timeout)
+	}
+	return ok
+}
+
+// await waits until match, called under pb.mu, succeeds. It gives up after
+// the timeout or once the playback was stopped.
+func (pb *playback) await(match func() (sent, bool)) (sent, bool) {
+	timer := time.NewTimer(pb.timeout)
+	defer timer.Stop()
+	for {
+		pb.mu.Lock()
+		s, ok := match()
+		pb.mu.Unlock()
+		if ok {
+			return s, true
+		}
+		select {
+		case <-pb.received:
+		case <-timer.C:
+			return sent{}, false
+		case <-pb.stop:
+			return sent{}, false
+		}
+	}
+}
+
+// reportUnexpected reports the messages the SDK sent that the recording lacks.
+func (pb *playback) reportUnexpected() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for _, s := range pb.pending {
+		pb.player.diverged(pb.n, "unexpected message %s", bytes.TrimSpace(s.raw))
+	}
+	pb.pending = nil
+}
+
+// notify wakes up a waiting expect.
+func (pb *playback) notify() {
+	select {
+	case pb.received <- struct{}{}:
+	default:
+	}
+}
+
+// matchKey identifies what a sent message must be matched with.
+func matchKey(msg map[string]any) string {
+	msgType, _ := msg["type"].(string)
+	switch msgType {
+	case subprocess.MessageTypeControlRequest:
+		request, _ := msg["request"].(map[string]any)
+		subtype, _ := request["subtype"].(string)
+		return msgType + " " + subtype
+	case subprocess.MessageTypeControlResponse:
+		response, _ := msg["response"].(map[string]any)
+		id, _ := response["request_id"].(string)
+		return msgType + " " + id
+	default:
+		return msgType
+	}
+}
+
+// requestID returns the ID of the SDK's own control request or cancellation.
+func requestID(msg map[string]any) string {
+	switch msg["type"] {
+	case subprocess.MessageTypeControlRequest, subprocess.MessageTypeControlCancelRequest:
+		id, _ := msg["request_id"].(string)
+		return id
+	default:
+		return ""
+	}
+}
+
+// playbackStdin collects the lines the SDK writes to a played back process.
+type playbackStdin struct {
+	pb       *playback
+	mu       sync.Mutex
+	splitter *lineSplitter
+}
+
+func (w *playbackStdin) Write(data []byte) (int, error) {
+	select {
+	case <-w.pb.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.splitter == nil {
+		w.splitter = &lineSplitter{emit: w.pb.add}
+	}
+	w.splitter.write(data)
+	return len(data), nil
+}
+
+func (w *playbackStdin) Close() error {
+	w.mu.Lock()
+	if w.splitter != nil {
+		w.splitter.flush()
+	}
+	w.mu.Unlock()
+
+	w.pb.mu.Lock()
+	w.pb.closed = true
+	w.pb.mu.Unlock()
+	w.pb.notify()
+	return nil
+}
+
+// add queues a line the SDK sent for matching.
+func (pb *playback) add(line []byte) {
+	line = bytes.Clone(line)
+	if pb.player.Redact != nil {
+		line = pb.player.Redact(KindSend, line)
+	}
+	s := sent{raw: line}
+	if err := json.Unmarshal(line, &s.msg); err != nil {
+		pb.player.diverged(pb.n, "sent a line that is not a JSON object: %s", line)
+		return
+	}
+
+	pb.mu.Lock()
+	pb.pending = append(pb.pending, s)
+	pb.mu.Unlock()
+	pb.notify()
+}
+
+// controlTransport plays a recorded process back to a Protocol.
+type controlTransport struct {
+	proc     *playback
+	readOnce sync.Once
+	lines    chan []byte
+}
+
+// Write sends data to the played back process.
+func (t *controlTransport) Write(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := t.proc.stdin.Write(data)
+	return err
+}
+
+// Read returns the recorded stdout lines, closed at the end of the playback.
+func (t *controlTransport) Read(ctx context.Context) <-chan []byte {
+	t.readOnce.Do(func() {
+		t.lines = make(chan []byte)
+		go func() {
+			defer close(t.lines)
+			reader := bufio.NewReader(t.proc.stdoutR)
+			for {
+				line, err := reader.ReadBytes('\n')
+				if len(bytes.TrimSpace(line)) > 0 {
+					select {
+					case t.lines <- bytes.TrimSpace(line):
+					case <-ctx.Done():
+						_ = t.proc.Signal(os.Kill)
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return t.lines
+}
+
+// Close closes stdin of the played back process.
+func (t *controlTransport) Close() error {
+	return t.proc.stdin.Close()
+}
@@ -0,0 +1,242 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+)
+
+// Recorder is a subprocess.Launcher that records the traffic of the
+// processes it starts to a cassette. The processes themselves are started
+// by the wrapped launcher. A Recorder may be shared by several transports,
+// such as the processes of a Pool; their entries are told apart by Process.
+type Recorder struct {
+	launcher subprocess.Launcher
+	redact   func(kind Kind, line []byte) []byte
+
+	mu        sync.Mutex
+	enc       *json.Encoder
+	processes int
+	err       error
+}
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(*Recorder)
+
+// WithRedact sets a hook that rewrites each line before it is recorded: the
+// messages sent and received and the stderr lines, told apart by kind. The
+// hook may run concurrently for different kinds. To keep the cassette
+// playable, redacted messages must stay JSON objects with their type,
+// subtype and request_id intact, and the Player needs the same hook as
+// Player.Redact.
+func WithRedact(redact func(kind Kind, line []byte) []byte) RecorderOption {
+	return func(r *Recorder) {
+		r.redact = redact
+	}
+}
+
+// NewRecorder returns a Recorder that writes the cassette to w and starts
+// processes with launcher. A nil launcher runs the CLI directly.
+//
+// The values of launch arguments that may carry credentials or prompts, such
+// as --mcp-config and --system-prompt, are masked as in the transport's debug
+// log. Everything else is recorded as it is, including the prompts and tool
+// inputs and outputs in the messages and the CLI's stderr; use WithRedact to
+// mask them.
+func NewRecorder(w io.Writer, launcher subprocess.Launcher, opts ...RecorderOption) *Recorder {
+	if launcher == nil {
+		launcher = subprocess.ExecLauncher{}
+	}
+	r := &Recorder{launcher: launcher, enc: json.NewEncoder(w)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Remote reports whether the wrapped launcher runs the CLI on another host.
+func (r *Recorder) Remote() bool {
+	remote, ok := r.launcher.(subprocess.RemoteLauncher)
+	return ok && remote.Remote()
+}
+
+// Launch starts a process with the wrapped launcher and records its traffic.
+func (r *Recorder) Launch(ctx context.Context, spec subprocess.LaunchSpec) (subprocess.Process, error) {
+	proc, err := r.launcher.Launch(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.processes++
+	n := r.processes
+	r.mu.Unlock()
+	r.record(Entry{Process: n, Kind: KindLaunch, Args: subprocess.RedactArgs(spec.Args)})
+
+	p := &recordedProcess{Process: proc, recorder: r, n: n}
+	if stdin := proc.Stdin(); stdin != nil {
+		p.stdin = &recordingWriter{w: stdin, emit: p.line(KindSend), onClose: func() {
+			r.record(Entry{Process: n, Kind: KindClose})
+		}}
+	}
+	p.stdout = &recordingReader{r: proc.Stdout(), emit: p.line(KindReceive)}
+	p.stderr = &recordingReader{r: proc.Stderr(), emit: p.line(KindStderr)}
+	return p, nil
+}
+
+// Err returns the first error writing the cassette, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes entry, stamped with the current time.
+func (r *Recorder) record(entry Entry) {
+	entry.Time = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(entry)
+}
+
+// recordedProcess is a process whose traffic a Recorder records.
+type recordedProcess struct {
+	subprocess.Process
+	recorder *Recorder
+	n        int
+	stdin    io.WriteCloser
+	stdout   io.ReadCloser
+	stderr   io.ReadCloser
+}
+
+func (p *recordedProcess) Stdin() io.WriteCloser {
+	if p.stdin == nil {
+		return nil
+	}
+	return p.stdin
+}
+
+func (p *recordedProcess) Stdout() io.ReadCloser { return p.stdout }
+func (p *recordedProcess) Stderr() io.ReadCloser { return p.stderr }
+
+// Wait waits for the process and records how it exited.
+func (p *recordedProcess) Wait() (subprocess.ExitState, error) {
+	state, err := p.Process.Wait()
+	p.recorder.record(Entry{Process: p.n, Kind: KindExit, Code: state.Code, Signal: signalName(state.Signal)})
+	return state, err
+}
+
+// line returns a function that records a line of the given kind, after the
+// recorder's redact hook. JSON lines of stdin and stdout are kept as
+// messages, anything else as text.
+func (p *recordedProcess) line(kind Kind) func([]byte) {
+	return func(line []byte) {
+		if p.recorder.redact != nil {
+			line = p.recorder.redact(kind, bytes.Clone(line))
+		}
+		entry := Entry{Process: p.n, Kind: kind}
+		if kind != KindStderr && json.Valid(line) {
+			entry.Message = append(json.RawMessage(nil), line...)
+		} else {
+			entry.Text = string(line)
+		}
+		p.recorder.record(entry)
+	}
+}
+
+// lineSplitter passes the complete lines of the data written to it to emit.
+type lineSplitter struct {
+	buf  []byte
+	emit func([]byte)
+}
+
+func (s *lineSplitter) write(data []byte) {
+	s.buf = append(s.buf, data...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return
+		}
+		if line := bytes.TrimSuffix(s.buf[:i], []byte("\r")); len(line) > 0 {
+			s.emit(line)
+		}
+		s.buf = s.buf[i+1:]
+	}
+}
+
+// flush emits an unterminated last line.
+func (s *lineSplitter) flush() {
+	if len(s.buf) > 0 {
+		s.emit(s.buf)
+		s.buf = nil
+	}
+}
+
+// recordingWriter records the lines written to the CLI's stdin.
+type recordingWriter struct {
+	w       io.WriteCloser
+	emit    func([]byte)
+	onClose func()
+
+	mu       sync.Mutex
+	splitter *lineSplitter
+	closed   bool
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.w.Write(data)
+	if n > 0 {
+		if w.splitter == nil {
+			w.splitter = &lineSplitter{emit: w.emit}
+		}
+		w.splitter.write(data[:n])
+	}
+	return n, err
+}
+
+func (w *recordingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		if w.splitter != nil {
+			w.splitter.flush()
+		}
+		w.onClose()
+	}
+	return w.w.Close()
+}
+
+// recordingReader records the lines read from the CLI's stdout or stderr.
+type recordingReader struct {
+	r        io.ReadCloser
+	emit     func([]byte)
+	splitter *lineSplitter
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.splitter == nil {
+		r.splitter = &lineSplitter{emit: r.emit}
+	}
+	if n > 0 {
+		r.splitter.write(p[:n])
+	}
+	if err == io.EOF {
+		r.splitter.flush()
+	}
+	return n, err
+}
+
+func (r *recordingReader) Close() error { return r.r.Close() }
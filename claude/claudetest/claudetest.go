@@ -0,0 +1,313 @@
+// Package claudetest provides a scriptable fake Claude CLI for deterministic
+// tests of code built on the SDK, without the real CLI or a network. A CLI
+// serves an executable that is passed to the client as its CLI path; each
+// launch of it runs the script against the SDK over stream-json:
+//
+//	cli := claudetest.New(t,
+//	    claudetest.Init(),
+//	    claudetest.AwaitUser(),
+//	    claudetest.Text("Listing the files."),
+//	    claudetest.UseTool("Bash", map[string]any{"command": "ls"}, "main.go"),
+//	    claudetest.Result("Done."),
+//	)
+//	client, _ := claude.NewClient(claude.WithCLIPath(cli.Path()), claude.WithCanUseTool(policy))
+//	// ... drive the client ...
+//	assert.Equal(t, "allow", cli.Responses(claudetest.SubtypeCanUseTool)[0]["behavior"])
+//
+// The fake CLI answers the SDK's control requests, such as initialize,
+// set_model and interrupt, on its own. Script steps send the CLI's requests,
+// can_use_tool, hook_callback and mcp_message, and wait for the SDK's
+// answers. Everything the SDK sends is recorded for assertions.
+//
+// The executable is the test binary itself: Main, called from TestMain,
+// lets the binary act as the CLI when the launcher script of a CLI runs it.
+// The script is a shell script, or a batch file on Windows.
+package claudetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+)
+
+// Version is the CLI version the fake CLI reports.
+const Version = "2.0.0"
+
+// DefaultModel is the model the fake CLI reports when the SDK sets none.
+const DefaultModel = "claude-sonnet-4-5"
+
+// DefaultTimeout bounds each wait of a script for the SDK.
+const DefaultTimeout = 10 * time.Second
+
+// Control request subtypes, for looking up recorded requests and responses.
+const (
+	SubtypeInitialize        = subprocess.SubtypeInitialize
+	SubtypeInterrupt         = subprocess.SubtypeInterrupt
+	SubtypeSetModel          = subprocess.SubtypeSetModel
+	SubtypeSetPermissionMode = subprocess.SubtypeSetPermissionMode
+	SubtypeCanUseTool        = subprocess.SubtypeCanUseTool
+	SubtypeHookCallback      = subprocess.SubtypeHookCallback
+	SubtypeMcpMessage        = subprocess.SubtypeMcpMessage
+)
+
+// CLI is a fake Claude CLI. Every launch of the executable at Path runs the
+// script in a new Session. The CLI is closed, and the errors of its
+// scripts are reported to the test, when the test ends.
+type CLI struct {
+	// Timeout bounds each wait of a script for the SDK. Set it before the
+	// CLI is launched. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	t      testing.TB
+	script []Step
+	path   string
+	ln     net.Listener
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	closed    bool
+	conns     map[net.Conn]struct{}
+	launches  [][]string
+	sent      []map[string]any
+	prompts   []string
+	responses map[string][]map[string]any
+	errs      []error
+}
+
+// New starts a fake CLI that runs script on each launch. The test binary
+// must run through Main.
+func New(t testing.TB, script ...Step) *CLI {
+	t.Helper()
+
+	if !mainCalled {
+		t.Fatalf("claudetest: call claudetest.Main from TestMain")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("claudetest: listen: %v", err)
+	}
+	c := &CLI{
+		t:         t,
+		script:    script,
+		ln:        ln,
+		conns:     make(map[net.Conn]struct{}),
+		responses: make(map[string][]map[string]any),
+	}
+	t.Cleanup(c.close)
+
+	c.path, err = writeLauncher(t.TempDir(), ln.Addr().String())
+	if err != nil {
+		t.Fatalf("claudetest: write launcher: %v", err)
+	}
+
+	c.wg.Add(1)
+	go c.accept()
+	return c
+}
+
+// Path returns the path of the fake CLI executable.
+func (c *CLI) Path() string {
+	return c.path
+}
+
+// Launches returns the arguments of every launch so far.
+func (c *CLI) Launches() [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.launches)
+}
+
+// Sent returns every message the SDK sent so far, in order.
+func (c *CLI) Sent() []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.sent)
+}
+
+// Requests returns the payloads of the SDK's control requests of subtype.
+func (c *CLI) Requests(subtype string) []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var requests []map[string]any
+	for _, msg := range c.sent {
+		if msg["type"] != subprocess.MessageTypeControlRequest {
+			continue
+		}
+		if request, _ := msg["request"].(map[string]any); request["subtype"] == subtype {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// Responses returns the payloads of the SDK's answers to the CLI's control
+// requests of subtype, such as permission decisions for SubtypeCanUseTool.
+// An error response is recorded as {"error": message}.
+func (c *CLI) Responses(subtype string) []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.responses[subtype])
+}
+
+// Prompts returns the text of the user messages the SDK sent so far,
+// including the prompts of one-shot queries.
+func (c *CLI) Prompts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.prompts)
+}
+
+// Err reports the errors of the scripts run so far, or nil.
+func (c *CLI) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return errors.Join(c.errs...)
+}
+
+// accept runs a session for each launch until the CLI is closed.
+func (c *CLI) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		c.conns[conn] = struct{}{}
+		c.wg.Add(1)
+		c.mu.Unlock()
+
+		go func() {
+			defer c.wg.Done()
+			c.serve(conn)
+
+			c.mu.Lock()
+			delete(c.conns, conn)
+			c.mu.Unlock()
+		}()
+	}
+}
+
+// serve runs the script for the fake CLI process on netConn.
+func (c *CLI) serve(netConn net.Conn) {
+	conn := wire.NewLineConn(netConn)
+	defer conn.Close()
+
+	line, err := conn.ReadLine()
+	if err != nil {
+		return
+	}
+	var greeting hello
+	if err := json.Unmarshal(line, &greeting); err != nil {
+		c.fail(fmt.Errorf("launch: %w", err))
+		return
+	}
+
+	c.mu.Lock()
+	c.launches = append(c.launches, greeting.Args)
+	n := len(c.launches)
+	timeout := c.Timeout
+	c.mu.Unlock()
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	s := newSession(c, conn, n, greeting.Args, timeout)
+	go s.read()
+	s.run(c.script)
+
+	// Let the process read its exit before the connection goes
+	_ = conn.CloseWrite()
+	s.awaitClosed(time.After(timeout))
+}
+
+// close stops the CLI, ends running sessions and reports script errors.
+func (c *CLI) close() {
+	c.mu.Lock()
+	c.closed = true
+	for conn := range c.conns {
+		_ = conn.Close()
+	}
+	c.mu.Unlock()
+
+	_ = c.ln.Close()
+	c.wg.Wait()
+
+	if err := c.Err(); err != nil {
+		c.t.Errorf("claudetest: %v", err)
+	}
+}
+
+// fail records a script error.
+func (c *CLI) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+// recordSent records a message the SDK sent.
+func (c *CLI) recordSent(msg map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+}
+
+// recordPrompt records the text of a user message.
+func (c *CLI) recordPrompt(prompt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prompts = append(c.prompts, prompt)
+}
+
+// recordResponse records the SDK's answer to a request of subtype.
+func (c *CLI) recordResponse(subtype string, payload map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[subtype] = append(c.responses[subtype], payload)
+}
+
+// writeLauncher writes the script that runs the test binary as the fake CLI
+// of the server at addr into dir and returns its path.
+func writeLauncher(dir, addr string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	if runtime.GOOS == "windows" {
+		path := filepath.Join(dir, "claude.cmd")
+		script := fmt.Sprintf("@set \"%s=%s\"\r\n@\"%s\" %%*\r\n", addrEnv, addr, exe)
+		return path, os.WriteFile(path, []byte(script), 0o755)
+	}
+
+	// A race-enabled test binary otherwise lingers for a second on exit
+	path := filepath.Join(dir, "claude")
+	script := fmt.Sprintf("#!/bin/sh\nGORACE=\"${GORACE:+$GORACE }atexit_sleep_ms=0\" %s=%s exec %s \"$@\"\n",
+		addrEnv, addr, shellQuote(exe))
+	return path, os.WriteFile(path, []byte(script), 0o755)
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,192 @@
+package claudetest_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude"
+	"github.com/dotcommander/agent-sdk-go/claude/claudetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) { claudetest.Main(m) }
+
+func allowAll(context.Context, string, map[string]any, claude.CanUseToolOptions) (claude.PermissionResult, error) {
+	return claude.NewPermissionResultAllow(), nil
+}
+
+// connect returns a connected client of cli.
+func connect(t *testing.T, cli *claudetest.CLI, opts ...claude.ClientOption) claude.Client {
+	t.Helper()
+
+	client, err := claude.NewClient(append([]claude.ClientOption{claude.WithCLIPath(cli.Path())}, opts...)...)
+	require.NoError(t, err)
+	// The CLI lives as long as the Connect context
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { _ = client.Disconnect() })
+	return client
+}
+
+func TestCLI_ToolTurn(t *testing.T) {
+	t.Parallel()
+
+	cli := claudetest.New(t,
+		claudetest.Init(),
+		claudetest.AwaitUser(),
+		claudetest.Text("Listing the files."),
+		claudetest.UseTool("Bash", map[string]any{"command": "ls"}, "main.go"),
+		claudetest.Result("Done."),
+	)
+
+	var preHooks, postHooks atomic.Int32
+	client := connect(t, cli,
+		claude.WithCanUseTool(allowAll),
+		claude.WithPreToolUseHook(func(context.Context, *claude.PreToolUseHookInput) (*claude.SyncHookOutput, error) {
+			preHooks.Add(1)
+			return &claude.SyncHookOutput{Continue: true}, nil
+		}),
+		claude.WithPostToolUseHook(func(context.Context, *claude.PostToolUseHookInput) (*claude.SyncHookOutput, error) {
+			postHooks.Add(1)
+			return &claude.SyncHookOutput{Continue: true}, nil
+		}),
+	)
+
+	turn, err := client.Send(context.Background(), "list the files")
+	require.NoError(t, err)
+	require.NotNil(t, turn.Result)
+	assert.False(t, turn.IsError())
+	assert.Equal(t, "claudetest-session-1", turn.SessionID())
+	assert.Contains(t, turn.Text(), "Listing the files.")
+
+	assert.Equal(t, []string{"list the files"}, cli.Prompts())
+	assert.Len(t, cli.Requests(claudetest.SubtypeInitialize), 1)
+	decisions := cli.Responses(claudetest.SubtypeCanUseTool)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "allow", decisions[0]["behavior"])
+	assert.Equal(t, int32(1), preHooks.Load())
+	assert.Equal(t, int32(1), postHooks.Load())
+
+	caps, err := client.(claude.StreamInspector).Capabilities()
+	require.NoError(t, err)
+	assert.Equal(t, claudetest.Version, caps.CLIVersion)
+}
+
+func TestCLI_DeniedTool(t *testing.T) {
+	t.Parallel()
+
+	cli := claudetest.New(t,
+		claudetest.AwaitUser(),
+		claudetest.UseTool("Bash", map[string]any{"command": "rm -rf /"}, "gone"),
+		claudetest.Result("Stopped."),
+	)
+	client := connect(t, cli, claude.WithCanUseTool(
+		func(context.Context, string, map[string]any, claude.CanUseToolOptions) (claude.PermissionResult, error) {
+			return claude.NewPermissionResultDeny("not here"), nil
+		},
+	))
+
+	_, err := client.Send(context.Background(), "clean up")
+	require.NoError(t, err)
+
+	decisions := cli.Responses(claudetest.SubtypeCanUseTool)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "deny", decisions[0]["behavior"])
+	assert.Equal(t, "not here", decisions[0]["message"])
+}
+
+func TestCLI_OneShotQuery(t *testing.T) {
+	t.Parallel()
+
+	cli := claudetest.New(t,
+		claudetest.Init(),
+		claudetest.AwaitUser(),
+		claudetest.Text("Hello!"),
+		claudetest.Result("Hello!"),
+	)
+	client, err := claude.NewClient(claude.WithCLIPath(cli.Path()))
+	require.NoError(t, err)
+
+	text, err := client.Query(context.Background(), "say hello")
+	require.NoError(t, err)
+	assert.Contains(t, text, "Hello!")
+
+	assert.Equal(t, []string{"say hello"}, cli.Prompts())
+	launches := cli.Launches()
+	require.Len(t, launches, 1)
+	assert.Contains(t, launches[0], "-p")
+}
+
+func TestCLI_ControlRequests(t *testing.T) {
+	t.Parallel()
+
+	cli := claudetest.New(t,
+		claudetest.AwaitUser(),
+		claudetest.Text("Working on it."),
+		claudetest.AwaitInterrupt(),
+		claudetest.ErrorResult("error_during_execution", "interrupted"),
+	)
+	client := connect(t, cli, claude.WithCanUseTool(allowAll))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	msgChan, errChan := client.SendStream(ctx, "work")
+
+	model := "claude-opus-4-1"
+	var interrupted bool
+	var result *claude.ResultMessage
+	for result == nil {
+		select {
+		case msg, ok := <-msgChan:
+			require.True(t, ok, "stream closed before the result")
+			switch m := msg.(type) {
+			case *claude.AssistantMessage:
+				if !interrupted {
+					require.NoError(t, client.SetModel(ctx, &model))
+					require.NoError(t, client.InterruptGraceful(ctx))
+					interrupted = true
+				}
+			case *claude.ResultMessage:
+				result = m
+			}
+		case err := <-errChan:
+			require.NoError(t, err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the result")
+		}
+	}
+
+	assert.True(t, result.IsError)
+	assert.Equal(t, []string{"interrupted"}, result.Errors)
+	models := cli.Requests(claudetest.SubtypeSetModel)
+	require.Len(t, models, 1)
+	assert.Equal(t, model, models[0]["model"])
+	assert.Len(t, cli.Requests(claudetest.SubtypeInterrupt), 1)
+}
+
+func TestCLI_SdkMcpServer(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	tool := claude.NewTool("add", "Adds two numbers", nil, func(_ context.Context, args map[string]any) (*claude.McpToolResult, error) {
+		calls.Add(1)
+		return &claude.McpToolResult{Content: []claude.McpContent{{Type: "text", Text: "3"}}}, nil
+	})
+
+	cli := claudetest.New(t,
+		claudetest.AwaitUser(),
+		claudetest.CallMCPTool("calc", "add", map[string]any{"a": 1, "b": 2}),
+		claudetest.Result("3"),
+	)
+	client := connect(t, cli, claude.WithSdkMcpServer("calc", claude.CreateSDKMcpServer("calc", "1.0.0", tool)))
+
+	_, err := client.Send(context.Background(), "add 1 and 2")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), calls.Load())
+	responses := cli.Responses(claudetest.SubtypeMcpMessage)
+	require.Len(t, responses, 1)
+	assert.Contains(t, responses[0], "mcp_response")
+}
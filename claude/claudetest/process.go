@@ -0,0 +1,103 @@
+package claudetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+)
+
+// addrEnv carries the address of the CLI server to the fake CLI process.
+const addrEnv = "CLAUDETEST_ADDR"
+
+// relayType is the type of the lines the server sends to the fake CLI
+// process for itself rather than for its stdout.
+const relayType = "claudetest"
+
+// relayPrefix starts every encoded relay line, as encoded by json.Marshal.
+var relayPrefix = []byte(`{"type":"claudetest"`)
+
+// hello is the first line a fake CLI process sends to the server.
+type hello struct {
+	Args []string `json:"args"`
+}
+
+// relay is a line the server sends to the fake CLI process for itself.
+type relay struct {
+	Type   string  `json:"type"`
+	Stderr *string `json:"stderr,omitempty"`
+	Exit   *int    `json:"exit,omitempty"`
+}
+
+// mainCalled records that the test binary runs through Main, without which
+// a launch of the fake CLI would run the tests instead.
+var mainCalled bool
+
+// Main runs the tests of m and exits. The test binary doubles as the fake
+// CLI: when the launcher script of a CLI runs it with addrEnv set, Main
+// bridges its stdio to the server instead of running the tests. Every test
+// package that uses New must call Main from its TestMain:
+//
+//	func TestMain(m *testing.M) { claudetest.Main(m) }
+func Main(m *testing.M) {
+	if addr := os.Getenv(addrEnv); addr != "" {
+		os.Exit(runProcess(addr, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	mainCalled = true
+	os.Exit(m.Run())
+}
+
+// runProcess bridges a fake CLI process to the server at addr and returns
+// its exit code.
+func runProcess(addr string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 1 && args[0] == "--version" {
+		fmt.Fprintf(stdout, "%s (Claude Code)\n", Version)
+		return 0
+	}
+
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "claudetest: connect to %s: %v\n", addr, err)
+		return 1
+	}
+	conn := wire.NewLineConn(netConn)
+	defer conn.Close()
+
+	greeting, _ := json.Marshal(hello{Args: args})
+	if err := conn.WriteLine(greeting); err != nil {
+		fmt.Fprintf(stderr, "claudetest: %v\n", err)
+		return 1
+	}
+
+	// Stdin goes to the server unchanged; its end is passed on as a half close
+	go func() {
+		_, _ = io.Copy(netConn, stdin)
+		_ = conn.CloseWrite()
+	}()
+
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			fmt.Fprintln(stderr, "claudetest: server closed the connection")
+			return 1
+		}
+		if !bytes.HasPrefix(line, relayPrefix) {
+			_, _ = stdout.Write(append(line, '\n'))
+			continue
+		}
+		var msg relay
+		if json.Unmarshal(line, &msg) == nil {
+			if msg.Stderr != nil {
+				fmt.Fprintln(stderr, *msg.Stderr)
+			}
+			if msg.Exit != nil {
+				return *msg.Exit
+			}
+		}
+	}
+}
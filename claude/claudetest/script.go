@@ -0,0 +1,363 @@
+package claudetest
+
+import (
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// Step is a step of a fake CLI's script. A failing step ends the script:
+// the fake CLI writes the error to stderr and exits with code 1, and the
+// error is reported to the test. Custom steps are plain functions using the
+// methods of Session.
+type Step func(s *Session) error
+
+// Init emits the init system message, with the session ID, model and CLI
+// version of the fake CLI.
+func Init() Step {
+	return func(s *Session) error {
+		cwd, _ := os.Getwd()
+		s.mu.Lock()
+		mode := s.permissionMode
+		s.mu.Unlock()
+		return s.Emit(map[string]any{
+			"type":                shared.MessageTypeSystem,
+			"subtype":             "init",
+			"session_id":          s.SessionID(),
+			"model":               s.Model(),
+			"cwd":                 cwd,
+			"tools":               []string{"Bash", "Read", "Write", "Edit"},
+			"permissionMode":      mode,
+			"slash_commands":      []string{"compact"},
+			"claude_code_version": Version,
+			"output_style":        "default",
+		})
+	}
+}
+
+// AwaitUser waits for the SDK's next user message, or takes the prompt of a
+// one-shot query.
+func AwaitUser() Step {
+	return func(s *Session) error {
+		_, err := s.AwaitUser()
+		return err
+	}
+}
+
+// AwaitInterrupt waits for the SDK to interrupt the turn.
+func AwaitInterrupt() Step {
+	return func(s *Session) error {
+		return s.AwaitInterrupt()
+	}
+}
+
+// Text emits an assistant message with text.
+func Text(text string) Step {
+	return func(s *Session) error {
+		return s.assistant(map[string]any{"type": "text", "text": text})
+	}
+}
+
+// ToolUse emits an assistant message calling tool name with input. The
+// following RequestPermission, ToolResult and tool hooks refer to the call.
+func ToolUse(name string, input map[string]any) Step {
+	return func(s *Session) error {
+		s.mu.Lock()
+		s.toolUses++
+		s.lastTool = toolUse{id: fmt.Sprintf("toolu_claudetest_%d", s.toolUses), name: name, input: input}
+		s.denied = nil
+		call := s.lastTool
+		s.mu.Unlock()
+
+		return s.assistant(map[string]any{
+			"type":  "tool_use",
+			"id":    call.id,
+			"name":  call.name,
+			"input": call.input,
+		})
+	}
+}
+
+// RequestPermission asks the SDK whether the last tool call may run, with
+// a can_use_tool request. A denial is remembered for ToolResult; an allow
+// with updated input replaces the call's input.
+func RequestPermission() Step {
+	return func(s *Session) error {
+		s.mu.Lock()
+		call := s.lastTool
+		s.mu.Unlock()
+
+		decision, err := s.Request(SubtypeCanUseTool, map[string]any{
+			"tool_name":   call.name,
+			"input":       call.input,
+			"tool_use_id": call.id,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch decision["behavior"] {
+		case string(shared.PermissionBehaviorAllow):
+			if input, ok := decision["updatedInput"].(map[string]any); ok {
+				s.lastTool.input = input
+			}
+		case string(shared.PermissionBehaviorDeny):
+			message, _ := decision["message"].(string)
+			s.denied = &message
+		default:
+			return fmt.Errorf("permission decision without behavior: %v", decision)
+		}
+		return nil
+	}
+}
+
+// ToolResult emits the result of the last tool call: output, or the reason
+// it was denied as an error.
+func ToolResult(output string) Step {
+	return func(s *Session) error {
+		s.mu.Lock()
+		call, denied := s.lastTool, s.denied
+		s.mu.Unlock()
+
+		block := map[string]any{"type": "tool_result", "tool_use_id": call.id, "content": output}
+		if denied != nil {
+			block["content"] = *denied
+			block["is_error"] = true
+		}
+		return s.Emit(map[string]any{
+			"type":               shared.MessageTypeUser,
+			"message":            map[string]any{"role": "user", "content": []any{block}},
+			"parent_tool_use_id": nil,
+			"session_id":         s.SessionID(),
+		})
+	}
+}
+
+// UseTool runs a tool call the way the CLI does: it emits the call, runs
+// the PreToolUse hooks, asks for permission unless a hook decided, emits
+// the result and runs the PostToolUse hooks of a call that ran.
+func UseTool(name string, input map[string]any, output string) Step {
+	return func(s *Session) error {
+		if err := ToolUse(name, input)(s); err != nil {
+			return err
+		}
+
+		decided, err := s.preToolUse()
+		if err != nil {
+			return err
+		}
+		if !decided {
+			if err := RequestPermission()(s); err != nil {
+				return err
+			}
+		}
+		if err := ToolResult(output)(s); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		call, denied := s.lastTool, s.denied
+		s.mu.Unlock()
+		if denied != nil {
+			return nil
+		}
+		return s.hook(shared.HookEventPostToolUse, map[string]any{
+			"tool_name":     call.name,
+			"tool_input":    call.input,
+			"tool_response": output,
+			"tool_use_id":   call.id,
+		})
+	}
+}
+
+// preToolUse runs the PreToolUse hooks of the last tool call and reports
+// whether one of them allowed or denied it.
+func (s *Session) preToolUse() (bool, error) {
+	s.mu.Lock()
+	call := s.lastTool
+	s.mu.Unlock()
+
+	decided := false
+	for _, id := range s.HookCallbacks(shared.HookEventPreToolUse, call.name) {
+		output, err := s.callHook(id, shared.HookEventPreToolUse, map[string]any{
+			"tool_name":   call.name,
+			"tool_input":  call.input,
+			"tool_use_id": call.id,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		specific, _ := output["hookSpecificOutput"].(map[string]any)
+		reason, _ := output["reason"].(string)
+		if r, ok := specific["permissionDecisionReason"].(string); ok {
+			reason = r
+		}
+		switch {
+		case output["decision"] == "block" || specific["permissionDecision"] == "deny":
+			s.mu.Lock()
+			s.denied = &reason
+			s.mu.Unlock()
+			return true, nil
+		case output["decision"] == "approve" || specific["permissionDecision"] == "allow":
+			decided = true
+		}
+	}
+	return decided, nil
+}
+
+// Hook runs the SDK's callbacks for event with input, through hook_callback
+// requests. A tool_name in input selects the callbacks whose matcher
+// matches it; hook_event_name and session_id are filled in.
+func Hook(event shared.HookEvent, input map[string]any) Step {
+	return func(s *Session) error {
+		return s.hook(event, input)
+	}
+}
+
+// hook runs the callbacks for event that match the tool in input.
+func (s *Session) hook(event shared.HookEvent, input map[string]any) error {
+	toolName, _ := input["tool_name"].(string)
+	for _, id := range s.HookCallbacks(event, toolName) {
+		if _, err := s.callHook(id, event, input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callHook sends a hook_callback request for callback id and returns the
+// hook's output.
+func (s *Session) callHook(id string, event shared.HookEvent, input map[string]any) (map[string]any, error) {
+	fields := map[string]any{
+		"hook_event_name": string(event),
+		"session_id":      s.SessionID(),
+		"transcript_path": "",
+		"cwd":             "",
+	}
+	maps.Copy(fields, input)
+
+	request := map[string]any{"callback_id": id, "input": fields}
+	if toolUseID, ok := input["tool_use_id"].(string); ok {
+		request["tool_use_id"] = toolUseID
+	}
+	return s.Request(SubtypeHookCallback, request)
+}
+
+// MCPMessage sends the JSON-RPC message to the SDK MCP server named server,
+// through an mcp_message request. A JSON-RPC error in the answer fails the
+// step.
+func MCPMessage(server string, message map[string]any) Step {
+	return func(s *Session) error {
+		response, err := s.Request(SubtypeMcpMessage, map[string]any{
+			"server_name": server,
+			"message":     message,
+		})
+		if err != nil {
+			return err
+		}
+		if reply, _ := response["mcp_response"].(map[string]any); reply["error"] != nil {
+			return fmt.Errorf("MCP server %s: %v", server, reply["error"])
+		}
+		return nil
+	}
+}
+
+// CallMCPTool calls tool of the SDK MCP server named server with args.
+func CallMCPTool(server, tool string, args map[string]any) Step {
+	return func(s *Session) error {
+		s.mu.Lock()
+		s.requests++
+		id := s.requests
+		s.mu.Unlock()
+
+		return MCPMessage(server, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "tools/call",
+			"params":  map[string]any{"name": tool, "arguments": args},
+		})(s)
+	}
+}
+
+// Result ends the turn with a success result carrying text.
+func Result(text string) Step {
+	return func(s *Session) error {
+		return s.result("success", false, text)
+	}
+}
+
+// ErrorResult ends the turn with an error result of subtype, such as
+// "error_during_execution" or "error_max_turns".
+func ErrorResult(subtype string, errs ...string) Step {
+	return func(s *Session) error {
+		return s.result(subtype, true, "", errs...)
+	}
+}
+
+// Stderr writes line to the CLI's stderr.
+func Stderr(line string) Step {
+	return func(s *Session) error {
+		return s.Stderr(line)
+	}
+}
+
+// Emit writes msg to the SDK unchanged.
+func Emit(msg any) Step {
+	return func(s *Session) error {
+		return s.Emit(msg)
+	}
+}
+
+// Exit ends the fake CLI process with code at once, skipping the rest of
+// the script.
+func Exit(code int) Step {
+	return func(s *Session) error {
+		s.exit(code)
+		return errExited
+	}
+}
+
+// assistant emits an assistant message with one content block.
+func (s *Session) assistant(block map[string]any) error {
+	return s.Emit(map[string]any{
+		"type": shared.MessageTypeAssistant,
+		"message": map[string]any{
+			"type":    "message",
+			"role":    "assistant",
+			"model":   s.Model(),
+			"content": []any{block},
+		},
+		"parent_tool_use_id": nil,
+		"session_id":         s.SessionID(),
+	})
+}
+
+// result emits a result message.
+func (s *Session) result(subtype string, isError bool, text string, errs ...string) error {
+	s.mu.Lock()
+	turns := s.turns
+	s.mu.Unlock()
+
+	msg := map[string]any{
+		"type":            shared.MessageTypeResult,
+		"subtype":         subtype,
+		"is_error":        isError,
+		"duration_ms":     1,
+		"duration_api_ms": 1,
+		"num_turns":       turns,
+		"session_id":      s.SessionID(),
+		"total_cost_usd":  0,
+	}
+	if !isError {
+		msg["result"] = text
+	}
+	if len(errs) > 0 {
+		msg["errors"] = errs
+	}
+	return s.Emit(msg)
+}
@@ -0,0 +1,432 @@
+package claudetest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+)
+
+// errExited stops a script after an Exit step.
+var errExited = errors.New("exited")
+
+// Session is one launch of a fake CLI, as seen by the steps of its script.
+// Its methods let custom steps talk to the SDK.
+type Session struct {
+	cli     *CLI
+	conn    *wire.LineConn
+	n       int
+	args    []string
+	timeout time.Duration
+
+	mu             sync.Mutex
+	wake           chan struct{} // closed and replaced on every change
+	stdinClosed    bool
+	inbox          []map[string]any          // user messages not awaited yet
+	prompt         *string                   // one-shot prompt not awaited yet
+	responses      map[string]map[string]any // the SDK's answers by request ID
+	hooks          map[string][]subprocess.HookMatcherConfig
+	model          string
+	permissionMode string
+	interrupts     int
+	requests       int
+	toolUses       int
+	turns          int
+	lastTool       toolUse
+	denied         *string // why the last tool use was denied, if it was
+}
+
+// toolUse is a tool call of the fake assistant.
+type toolUse struct {
+	id    string
+	name  string
+	input map[string]any
+}
+
+// newSession returns the session of launch n with args.
+func newSession(c *CLI, conn *wire.LineConn, n int, args []string, timeout time.Duration) *Session {
+	s := &Session{
+		cli:       c,
+		conn:      conn,
+		n:         n,
+		args:      args,
+		timeout:   timeout,
+		wake:      make(chan struct{}),
+		responses: make(map[string]map[string]any),
+		model:     flagValue(args, "--model"),
+	}
+	if s.model == "" {
+		s.model = DefaultModel
+	}
+	s.permissionMode = flagValue(args, "--permission-mode")
+	if s.permissionMode == "" {
+		s.permissionMode = string(shared.PermissionModeDefault)
+	}
+	if s.OneShot() && len(args) > 0 {
+		prompt := args[len(args)-1]
+		s.prompt = &prompt
+		c.recordPrompt(prompt)
+	}
+	return s
+}
+
+// Args returns the CLI arguments of the launch.
+func (s *Session) Args() []string {
+	return slices.Clone(s.args)
+}
+
+// OneShot reports whether the CLI was launched for a one-shot query, with
+// the prompt as its last argument and no stdin.
+func (s *Session) OneShot() bool {
+	return slices.Contains(s.args, "-p")
+}
+
+// SessionID returns the session ID the fake CLI reports.
+func (s *Session) SessionID() string {
+	return fmt.Sprintf("claudetest-session-%d", s.n)
+}
+
+// Model returns the current model, as set by --model or set_model.
+func (s *Session) Model() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.model
+}
+
+// Emit writes msg to the SDK as a stream-json line.
+func (s *Session) Emit(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	return s.conn.WriteLine(data)
+}
+
+// Stderr writes line to the CLI's stderr.
+func (s *Session) Stderr(line string) error {
+	data, _ := json.Marshal(relay{Type: relayType, Stderr: &line})
+	return s.conn.WriteLine(data)
+}
+
+// AwaitUser waits for the next user message of the SDK and returns it. In a
+// one-shot query the first call returns the prompt as a user message.
+func (s *Session) AwaitUser() (map[string]any, error) {
+	var msg map[string]any
+	err := s.await("a user message", func() bool {
+		switch {
+		case s.prompt != nil:
+			msg = map[string]any{
+				"type":    shared.MessageTypeUser,
+				"message": map[string]any{"role": "user", "content": *s.prompt},
+			}
+			s.prompt = nil
+		case len(s.inbox) > 0:
+			msg = s.inbox[0]
+			s.inbox = s.inbox[1:]
+		default:
+			return false
+		}
+		s.turns++
+		return true
+	})
+	return msg, err
+}
+
+// AwaitInterrupt waits for the SDK to interrupt the turn. The interrupt
+// request itself is answered as soon as it arrives.
+func (s *Session) AwaitInterrupt() error {
+	return s.await("an interrupt", func() bool {
+		if s.interrupts == 0 {
+			return false
+		}
+		s.interrupts--
+		return true
+	})
+}
+
+// Request sends a control request of subtype with fields to the SDK, waits
+// for the answer and returns its payload. An error response is returned as
+// an error.
+func (s *Session) Request(subtype string, fields map[string]any) (map[string]any, error) {
+	s.mu.Lock()
+	s.requests++
+	id := fmt.Sprintf("claudetest_req_%d", s.requests)
+	s.mu.Unlock()
+
+	request := map[string]any{"subtype": subtype}
+	maps.Copy(request, fields)
+	if err := s.Emit(map[string]any{
+		"type":       subprocess.MessageTypeControlRequest,
+		"request_id": id,
+		"request":    request,
+	}); err != nil {
+		return nil, err
+	}
+
+	var response map[string]any
+	if err := s.await(fmt.Sprintf("the answer to %s %s", subtype, id), func() bool {
+		response = s.responses[id]
+		delete(s.responses, id)
+		return response != nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if response["subtype"] == subprocess.ResponseSubtypeError {
+		message, _ := response["error"].(string)
+		s.cli.recordResponse(subtype, map[string]any{"error": message})
+		return nil, fmt.Errorf("%s request failed: %s", subtype, message)
+	}
+	payload, _ := response["response"].(map[string]any)
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	s.cli.recordResponse(subtype, payload)
+	return payload, nil
+}
+
+// HookCallbacks returns the IDs of the callbacks the SDK registered for
+// event whose matcher matches toolName. An empty toolName matches every
+// matcher.
+func (s *Session) HookCallbacks(event shared.HookEvent, toolName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for _, matcher := range s.hooks[string(event)] {
+		if toolName == "" || matches(matcher.Matcher, toolName) {
+			ids = append(ids, matcher.HookCallbackIDs...)
+		}
+	}
+	return ids
+}
+
+// matches reports whether a hook matcher matches toolName, like the CLI: an
+// empty matcher and "*" match everything, anything else is a regular
+// expression that must match the whole name.
+func matches(matcher, toolName string) bool {
+	if matcher == "" || matcher == "*" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + matcher + ")$")
+	return err == nil && re.MatchString(toolName)
+}
+
+// run runs script and exits the process. An interactive CLI waits for the
+// SDK to close stdin first, as the real one does.
+func (s *Session) run(script []Step) {
+	for i, step := range script {
+		if err := step(s); err != nil {
+			if errors.Is(err, errExited) {
+				return
+			}
+			s.cli.fail(fmt.Errorf("launch %d, step %d: %w", s.n, i+1, err))
+			_ = s.Stderr("claudetest: " + err.Error())
+			s.exit(1)
+			return
+		}
+	}
+
+	if !s.OneShot() {
+		s.awaitClosed(nil)
+	}
+	s.exit(0)
+}
+
+// awaitClosed waits for the SDK to close stdin, or for the process to close
+// the connection, until timeout fires. A nil timeout waits indefinitely.
+func (s *Session) awaitClosed(timeout <-chan time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.stdinClosed {
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-wake:
+		case <-timeout:
+			s.mu.Lock()
+			return
+		}
+		s.mu.Lock()
+	}
+}
+
+// exit ends the fake CLI process with code.
+func (s *Session) exit(code int) {
+	data, _ := json.Marshal(relay{Type: relayType, Exit: &code})
+	_ = s.conn.WriteLine(data)
+}
+
+// await waits until ready, called with s.mu held, reports true. It fails
+// after the timeout or once the SDK closed stdin.
+func (s *Session) await(what string, ready func() bool) error {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if ready() {
+			s.mu.Unlock()
+			return nil
+		}
+		if s.stdinClosed {
+			s.mu.Unlock()
+			return fmt.Errorf("stdin closed while waiting for %s", what)
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return fmt.Errorf("timed out after %s waiting for %s", s.timeout, what)
+		}
+	}
+}
+
+// changed wakes up the waiting steps. The caller must hold s.mu.
+func (s *Session) changed() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// read handles the lines the SDK writes until stdin is closed.
+func (s *Session) read() {
+	defer func() {
+		s.mu.Lock()
+		s.stdinClosed = true
+		s.changed()
+		s.mu.Unlock()
+	}()
+
+	for {
+		line, err := s.conn.ReadLine()
+		if err != nil {
+			return
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			s.receive(line)
+		}
+	}
+}
+
+// receive handles a line the SDK wrote.
+func (s *Session) receive(line []byte) {
+	var msg map[string]any
+	if err := json.Unmarshal(line, &msg); err != nil {
+		s.cli.fail(fmt.Errorf("launch %d: SDK sent a line that is not a JSON object: %s", s.n, line))
+		return
+	}
+	s.cli.recordSent(msg)
+
+	switch msg["type"] {
+	case subprocess.MessageTypeControlRequest:
+		s.answer(msg)
+	case subprocess.MessageTypeControlResponse:
+		response, _ := msg["response"].(map[string]any)
+		id, _ := response["request_id"].(string)
+		s.mu.Lock()
+		s.responses[id] = response
+		s.changed()
+		s.mu.Unlock()
+	case shared.MessageTypeUser:
+		s.cli.recordPrompt(promptText(msg))
+		s.mu.Lock()
+		s.inbox = append(s.inbox, msg)
+		s.changed()
+		s.mu.Unlock()
+	}
+}
+
+// answer answers a control request of the SDK.
+func (s *Session) answer(msg map[string]any) {
+	id, _ := msg["request_id"].(string)
+	request, _ := msg["request"].(map[string]any)
+	subtype, _ := request["subtype"].(string)
+
+	var payload any = map[string]any{}
+	s.mu.Lock()
+	switch subtype {
+	case subprocess.SubtypeInitialize:
+		s.hooks = nil
+		if data, err := json.Marshal(request["hooks"]); err == nil {
+			_ = json.Unmarshal(data, &s.hooks)
+		}
+		payload = initializeResponse
+	case subprocess.SubtypeSetModel:
+		model, _ := request["model"].(string)
+		s.model = cmp.Or(model, DefaultModel)
+	case subprocess.SubtypeSetPermissionMode:
+		mode, _ := request["mode"].(string)
+		s.permissionMode = mode
+	case subprocess.SubtypeInterrupt:
+		s.interrupts++
+		s.changed()
+	}
+	s.mu.Unlock()
+
+	_ = s.Emit(subprocess.SDKControlResponse{
+		Type: subprocess.MessageTypeControlResponse,
+		Response: subprocess.ControlResponse{
+			Subtype:   subprocess.ResponseSubtypeSuccess,
+			RequestID: id,
+			Response:  payload,
+		},
+	})
+}
+
+// initializeResponse is the fake CLI's answer to the initialize handshake.
+var initializeResponse = subprocess.InitializeResponse{
+	Commands: []shared.SlashCommand{
+		{Name: "compact", Description: "Clear conversation history but keep a summary in context"},
+	},
+	Models: []shared.ModelInfo{
+		{Value: DefaultModel, DisplayName: "Sonnet", Description: "The fake CLI's default model"},
+	},
+	OutputStyle:           "default",
+	AvailableOutputStyles: []string{"default"},
+}
+
+// promptText returns the text of a user message.
+func promptText(msg map[string]any) string {
+	message, _ := msg["message"].(map[string]any)
+	switch content := message["content"].(type) {
+	case string:
+		return content
+	case []any:
+		var texts []string
+		for _, block := range content {
+			if b, ok := block.(map[string]any); ok && b["type"] == "text" {
+				text, _ := b["text"].(string)
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	default:
+		return ""
+	}
+}
+
+// flagValue returns the value of flag in args, or "".
+func flagValue(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
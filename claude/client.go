@@ -4,6 +4,7 @@ package claude
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -19,8 +20,16 @@ type ClientImpl struct {
 	sessionID string
 	validator *shared.StreamValidator
 	mu        sync.RWMutex
+
+	// turns holds a token while a turn started with Send or SendStream
+	// runs, serializing turns without ignoring the caller's context.
+	turns     chan struct{}
+	turnsOnce sync.Once
 }
 
+// turnInterruptTimeout bounds the interrupt sent for a cancelled turn.
+const turnInterruptTimeout = 5 * time.Second
+
 // NewClient creates a new Client with the given options.
 func NewClient(opts ...ClientOption) (Client, error) {
 	options := DefaultClientOptions()
@@ -49,32 +58,8 @@ func (c *ClientImpl) Connect(ctx context.Context) error {
 		return fmt.Errorf("already connected")
 	}
 
-	// Create transport config
-	transportConfig := &subprocess.TransportConfig{
-		CLIPath:      c.options.CLIPath,
-		CLICommand:   c.options.CLICommand,
-		Model:        c.options.Model,
-		Timeout:      parseTimeout(c.options.Timeout),
-		SystemPrompt: "", // Can be added from options if needed
-		CustomArgs:   c.options.CustomArgs,
-		Env:          c.options.Env,
-		McpServers:   c.options.McpServers,
-		CanUseTool:   c.options.CanUseTool,
-	}
-
-	// Convert hooks from shared.HookConfig to transport's ProtocolHookMatcher
-	if len(c.options.Hooks) > 0 {
-		transportConfig.ProtocolHooks = convertHooksToProtocolFormat(c.options.Hooks)
-		transportConfig.EnableControlProtocol = true
-	}
-
-	// Enable control protocol if permission callback is set
-	if c.options.CanUseTool != nil {
-		transportConfig.EnableControlProtocol = true
-	}
-
 	var err error
-	c.transport, err = subprocess.NewTransport(transportConfig)
+	c.transport, err = subprocess.NewTransport(interactiveConfig(c.options))
 	if err != nil {
 		return fmt.Errorf("create transport: %w", err)
 	}
@@ -90,6 +75,61 @@ func (c *ClientImpl) Connect(ctx context.Context) error {
 	return nil
 }
 
+// interactiveConfig returns the transport configuration of an interactive
+// session with options o, enabling the control protocol where needed.
+func interactiveConfig(o *ClientOptions) *subprocess.TransportConfig {
+	transportConfig := &subprocess.TransportConfig{
+		CLIPath:         o.CLIPath,
+		CLICommand:      o.CLICommand,
+		Model:           o.Model,
+		Timeout:         parseTimeout(o.Timeout),
+		SystemPrompt:    "", // Can be added from options if needed
+		CustomArgs:      o.CustomArgs,
+		Env:             o.Env,
+		EnvPolicy:       o.EnvPolicy,
+		Cwd:             o.Cwd,
+		McpServers:      o.McpServers,
+		CanUseTool:      o.CanUseTool,
+		StderrCallback:  o.StderrCallback,
+		DebugWriter:     o.DebugWriter,
+		CLIOptions:      cliOptions(o),
+		RetryPolicy:     o.RetryPolicy,
+		CircuitBreaker:  o.CircuitBreaker,
+		Shutdown:        o.Shutdown,
+		Buffer:          o.BufferOptions,
+		Deadlines:       o.Deadlines,
+		ResourceLimits:  o.ResourceLimits,
+		Launcher:        o.Launcher,
+		Logger:          shared.NewLogger(o.Slog, o.Logger),
+		Recovery:        o.Recovery,
+		ControlDispatch: o.ControlDispatch,
+		ControlHandlers: o.ControlHandlers,
+	}
+
+	// Convert hooks from shared.HookConfig to transport's ProtocolHookMatcher
+	if len(o.Hooks) > 0 {
+		transportConfig.ProtocolHooks = convertHooksToProtocolFormat(o.Hooks)
+		transportConfig.EnableControlProtocol = true
+	}
+
+	// Enable control protocol if permission callback is set, and have the
+	// CLI ask it over stdio unless another permission prompt tool is set
+	if o.CanUseTool != nil {
+		transportConfig.EnableControlProtocol = true
+		if !slices.Contains(o.CustomArgs, "--permission-prompt-tool") {
+			transportConfig.CustomArgs = append(slices.Clone(o.CustomArgs), "--permission-prompt-tool", "stdio")
+		}
+	}
+
+	// Route mcp_message requests for in-process servers through the control protocol
+	if sdkServers := extractSdkMcpServers(o.McpServers); len(sdkServers) > 0 {
+		transportConfig.SdkMcpServers = sdkServers
+		transportConfig.EnableControlProtocol = true
+	}
+
+	return transportConfig
+}
+
 // convertHooksToProtocolFormat converts shared.HookConfig to subprocess.ProtocolHookMatcher.
 // This bridges the client-level hook API to the transport-level protocol format.
 func convertHooksToProtocolFormat(hooks map[shared.HookEvent][]shared.HookConfig) map[shared.HookEvent][]subprocess.ProtocolHookMatcher {
@@ -148,7 +188,13 @@ func (c *ClientImpl) Disconnect() error {
 // Query sends a one-shot query to Claude CLI and returns the response.
 func (c *ClientImpl) Query(ctx context.Context, prompt string) (string, error) {
 	msgChan, errChan := c.QueryStream(ctx, prompt)
+	return collectText(ctx, msgChan, errChan)
+}
 
+// collectText concatenates the text of the messages of a query stream until
+// the message channel closes or an error is reported. Messages may still be
+// buffered when the error channel closes, so that alone does not end it.
+func collectText(ctx context.Context, msgChan <-chan Message, errChan <-chan error) (string, error) {
 	var result strings.Builder
 	for {
 		select {
@@ -161,7 +207,8 @@ func (c *ClientImpl) Query(ctx context.Context, prompt string) (string, error) {
 			}
 		case err, ok := <-errChan:
 			if !ok {
-				return result.String(), nil
+				errChan = nil
+				continue
 			}
 			return result.String(), err
 		case <-ctx.Done():
@@ -179,41 +226,168 @@ func (c *ClientImpl) QueryWithSession(ctx context.Context, sessionID string, pro
 
 // QueryStream sends a one-shot query and streams the response.
 // Each call creates a new subprocess for isolation. For repeated queries
-// to the same session, use Session.SendMessage() instead which reuses the connection.
+// to the same session, use SendMessage() instead which reuses the connection.
 func (c *ClientImpl) QueryStream(ctx context.Context, prompt string) (<-chan Message, <-chan error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	// Create a new transport for one-shot query
 	transportConfig := &subprocess.TransportConfig{
-		CLIPath:      c.options.CLIPath,
-		CLICommand:   c.options.CLICommand,
-		Model:        c.options.Model,
-		Timeout:      parseTimeout(c.options.Timeout),
-		SystemPrompt: "",
-		CustomArgs:   c.options.CustomArgs,
-		Env:          c.options.Env,
-		PromptArg:    &prompt,
+		CLIPath:        c.options.CLIPath,
+		CLICommand:     c.options.CLICommand,
+		Model:          c.options.Model,
+		Timeout:        parseTimeout(c.options.Timeout),
+		SystemPrompt:   "",
+		CustomArgs:     c.options.CustomArgs,
+		Env:            c.options.Env,
+		EnvPolicy:      c.options.EnvPolicy,
+		Cwd:            c.options.Cwd,
+		StderrCallback: c.options.StderrCallback,
+		DebugWriter:    c.options.DebugWriter,
+		CLIOptions:     cliOptions(c.options),
+		RetryPolicy:    c.options.RetryPolicy,
+		CircuitBreaker: c.options.CircuitBreaker,
+		Shutdown:       c.options.Shutdown,
+		Buffer:         c.options.BufferOptions,
+		Deadlines:      c.options.Deadlines,
+		ResourceLimits: c.options.ResourceLimits,
+		Launcher:       c.options.Launcher,
+		Logger:         shared.NewLogger(c.options.Slog, c.options.Logger),
+		PromptArg:      &prompt,
+	}
+
+	start := func(ctx context.Context) (*subprocess.Transport, error) {
+		transport, err := subprocess.NewTransportWithPrompt(transportConfig, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("create one-shot transport: %w", err)
+		}
+		if err := transport.Connect(ctx); err != nil {
+			return nil, fmt.Errorf("connect one-shot transport: %w", err)
+		}
+		return transport, nil
 	}
 
-	transport, err := subprocess.NewTransportWithPrompt(transportConfig, prompt)
+	transport, err := start(ctx)
 	if err != nil {
-		return errorChannels(fmt.Errorf("create one-shot transport: %w", err))
+		return errorChannels(err)
 	}
 
-	if err := transport.Connect(ctx); err != nil {
-		return errorChannels(fmt.Errorf("connect one-shot transport: %w", err))
+	// The stream closes the transport once the query ends or ctx is done
+	msgChan, errChan, _ := streamWithRetry(ctx, retryPolicy(c.options), c.options.BufferSize, transport, start)
+	return msgChan, errChan
+}
+
+// retryPolicy returns the configured retry policy or the default one.
+func retryPolicy(o *ClientOptions) *shared.RetryPolicy {
+	if o.RetryPolicy != nil {
+		return o.RetryPolicy
 	}
+	return shared.DefaultRetryPolicy()
+}
 
-	msgChan, errChan := transport.ReceiveMessages(ctx)
+// cliOptions collects the client options that are passed to the CLI as dedicated flags.
+func cliOptions(o *ClientOptions) subprocess.CLIOptions {
+	return subprocess.CLIOptions{
+		PermissionMode:         cliPermissionMode(o.PermissionMode),
+		ContextFiles:           o.ContextFiles,
+		IncludePartialMessages: o.IncludePartialMessages,
+		OutputFormat:           o.OutputFormat,
+		Agents:                 o.Agents,
+		SettingSources:         o.SettingSources,
+		Sandbox:                o.Sandbox,
+		SdkPluginConfig:        o.SdkPluginConfig,
+	}
+}
 
-	// Start cleanup goroutine
-	go func() {
-		<-ctx.Done()
-		transport.Close()
-	}()
+// cliPermissionMode maps the permission mode to the CLI's --permission-mode value.
+// Validate has already rejected unknown modes.
+func cliPermissionMode(mode string) string {
+	cliMode, _ := shared.CLIPermissionMode(mode)
+	return cliMode
+}
 
-	return msgChan, errChan
+// SendMessage sends a user message on the connected interactive transport.
+// Unlike QueryStream, the message is delivered to the same CLI process, so the
+// conversation context from earlier turns is preserved. Responses are read
+// with ReceiveMessages.
+func (c *ClientImpl) SendMessage(ctx context.Context, message string) error {
+	c.mu.RLock()
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if transport == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	return transport.SendMessage(ctx, message)
+}
+
+// Send sends a prompt on the connected interactive transport and waits for the
+// turn to complete. The returned Turn holds every message up to and including
+// the ResultMessage. A turn that ends with an error result is returned without
+// an error; check Turn.IsError. On failure the partial turn is returned as well.
+func (c *ClientImpl) Send(ctx context.Context, prompt string) (*Turn, error) {
+	msgChan, errChan := c.SendStream(ctx, prompt)
+	return collectTurn(ctx, msgChan, errChan)
+}
+
+// SendStream sends a prompt on the connected interactive transport and streams
+// the messages of the resulting turn. Both channels are closed after the
+// ResultMessage has been delivered; errors reported before it, such as CLI
+// stderr lines, do not end the turn. Turns are serialized: a second call waits
+// until the previous turn has ended or ctx is done, so callers must drain the
+// stream or cancel ctx. A cancelled turn is interrupted through the control
+// protocol, where active, and its rest is read and discarded before the next
+// turn starts.
+func (c *ClientImpl) SendStream(ctx context.Context, prompt string) (<-chan Message, <-chan error) {
+	c.turnsOnce.Do(func() { c.turns = make(chan struct{}, 1) })
+	select {
+	case c.turns <- struct{}{}:
+	case <-ctx.Done():
+		return errorChannels(ctx.Err())
+	}
+	release := func() { <-c.turns }
+
+	c.mu.RLock()
+	transport := c.transport
+	bufferSize := c.options.BufferSize
+	c.mu.RUnlock()
+
+	if transport == nil {
+		release()
+		return errorChannels(fmt.Errorf("not connected"))
+	}
+
+	src, srcErr := transport.ReceiveMessages(ctx)
+	if err := transport.SendMessage(ctx, prompt); err != nil {
+		release()
+		return errorChannels(fmt.Errorf("send message: %w", err))
+	}
+
+	return streamTurn(ctx, bufferSize, src, srcErr, c.trackTurnMessage, interruptTurn(ctx, transport), release)
+}
+
+// interruptTurn returns a function that asks the CLI to stop the turn
+// started with ctx, once ctx is done.
+func interruptTurn(ctx context.Context, transport *subprocess.Transport) func() {
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), turnInterruptTimeout)
+		defer cancel()
+		_ = transport.InterruptProtocol(ctx)
+	}
+}
+
+// trackTurnMessage records stream statistics and the session ID for a turn message.
+func (c *ClientImpl) trackTurnMessage(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.validator != nil {
+		c.validator.TrackMessage(msg)
+	}
+	if result, ok := msg.(*ResultMessage); ok && result.SessionID != "" {
+		c.sessionID = result.SessionID
+	}
 }
 
 // ReceiveMessages receives messages from Claude CLI.
@@ -228,6 +402,20 @@ func (c *ClientImpl) ReceiveMessages(ctx context.Context) (<-chan Message, <-cha
 	return c.transport.ReceiveMessages(ctx)
 }
 
+// Subscribe registers an independent subscriber on the connected transport.
+// Each subscription receives its own copy of every message, so metrics, logging
+// and rendering can observe one session alongside ReceiveMessages.
+func (c *ClientImpl) Subscribe(opts ...subprocess.SubscribeOption) (*subprocess.Subscription, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.transport == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	return c.transport.Subscribe(opts...)
+}
+
 // ReceiveResponse receives a single response from Claude CLI.
 func (c *ClientImpl) ReceiveResponse(ctx context.Context) (Message, error) {
 	msgChan, errChan := c.ReceiveMessages(ctx)
@@ -447,6 +635,36 @@ func (c *ClientImpl) IsProtocolActive() bool {
 	return transport.IsProtocolActive()
 }
 
+// ControlStats reports the handling of control requests from the CLI, or
+// zero stats when not connected.
+func (c *ClientImpl) ControlStats() subprocess.ControlStats {
+	c.mu.RLock()
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if transport == nil {
+		return subprocess.ControlStats{}
+	}
+
+	return transport.ControlStats()
+}
+
+// Capabilities reports what the connected CLI supports: its version, slash
+// commands, models, output styles, betas and control request subtypes.
+// The version and betas are known once the first turn has started. Control
+// requests the CLI does not support fail with an UnsupportedError.
+func (c *ClientImpl) Capabilities() (Capabilities, error) {
+	c.mu.RLock()
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if transport == nil {
+		return Capabilities{}, fmt.Errorf("not connected")
+	}
+
+	return transport.Capabilities(), nil
+}
+
 // SetSessionID sets the session ID for this client.
 // This is used by V2 session resume functionality.
 func (c *ClientImpl) SetSessionID(sessionID string) {
@@ -463,6 +681,7 @@ func (c *ClientImpl) GetSessionID() string {
 }
 
 // AddContextFiles adds files to the context for the next query.
+// Their directories are granted with --add-dir when the next CLI process starts.
 func (c *ClientImpl) AddContextFiles(ctx context.Context, files []string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
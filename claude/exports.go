@@ -77,6 +77,9 @@ var IsDeltaStreamEvent = shared.IsDeltaStreamEvent
 // StreamEventTypeToString converts a stream event type to a human-readable string.
 var StreamEventTypeToString = shared.StreamEventTypeToString
 
+// Capabilities describes what the connected CLI supports.
+type Capabilities = shared.Capabilities
+
 // Re-export error types from shared for convenience.
 // These implement the SDKError interface.
 
@@ -101,12 +104,18 @@ type JSONDecodeError = shared.JSONDecodeError
 // MessageParseError represents message structure parsing failures.
 type MessageParseError = shared.MessageParseError
 
+// LineTooLongError indicates a line of CLI output exceeded the maximum line size.
+type LineTooLongError = shared.LineTooLongError
+
 // PermissionError indicates a tool or file access was denied.
 type PermissionError = shared.PermissionError
 
 // ModelError indicates a model is unavailable or invalid.
 type ModelError = shared.ModelError
 
+// UnsupportedError indicates the connected CLI does not support a control request.
+type UnsupportedError = shared.UnsupportedError
+
 // Re-export As*Error helpers for error extraction from wrapped chains.
 
 // AsCLINotFoundError extracts a CLINotFoundError from the error chain.
@@ -133,24 +142,36 @@ var AsJSONDecodeError = shared.AsJSONDecodeError
 // AsMessageParseError extracts a MessageParseError from the error chain.
 var AsMessageParseError = shared.AsMessageParseError
 
+// AsLineTooLongError extracts a LineTooLongError from the error chain.
+var AsLineTooLongError = shared.AsLineTooLongError
+
 // AsPermissionError extracts a PermissionError from the error chain.
 var AsPermissionError = shared.AsPermissionError
 
 // AsModelError extracts a ModelError from the error chain.
 var AsModelError = shared.AsModelError
 
+// AsUnsupportedError extracts an UnsupportedError from the error chain.
+var AsUnsupportedError = shared.AsUnsupportedError
+
 // IsJSONDecodeError checks if an error is a JSONDecodeError.
 var IsJSONDecodeError = shared.IsJSONDecodeError
 
 // IsMessageParseError checks if an error is a MessageParseError.
 var IsMessageParseError = shared.IsMessageParseError
 
+// IsLineTooLongError checks if an error is a LineTooLongError.
+var IsLineTooLongError = shared.IsLineTooLongError
+
 // IsPermissionError checks if an error is a PermissionError.
 var IsPermissionError = shared.IsPermissionError
 
 // IsModelError checks if an error is a ModelError.
 var IsModelError = shared.IsModelError
 
+// IsUnsupportedError checks if an error is an UnsupportedError.
+var IsUnsupportedError = shared.IsUnsupportedError
+
 // NewJSONDecodeError creates a new JSONDecodeError.
 var NewJSONDecodeError = shared.NewJSONDecodeError
 
@@ -381,6 +402,84 @@ type HookResponseMessage = shared.HookResponseMessage
 // RawControlMessage wraps raw control protocol messages.
 type RawControlMessage = shared.RawControlMessage
 
+// ReconnectEvent reports a recovery attempt after the CLI process crashed.
+type ReconnectEvent = shared.ReconnectEvent
+
+// ReconnectStatus is the stage of a session recovery.
+type ReconnectStatus = shared.ReconnectStatus
+
+// Reconnect status constants.
+const (
+	ReconnectAttempting = shared.ReconnectAttempting
+	ReconnectSucceeded  = shared.ReconnectSucceeded
+	ReconnectFailed     = shared.ReconnectFailed
+)
+
+// RecoveryOptions configures automatic recovery of crashed interactive sessions.
+type RecoveryOptions = shared.RecoveryOptions
+
+// ShutdownOptions sets the grace periods of the staged CLI shutdown.
+type ShutdownOptions = shared.ShutdownOptions
+
+// DeadlineOptions bounds idle time, turn time and session lifetime.
+type DeadlineOptions = shared.DeadlineOptions
+
+// ControlDispatchOptions sets how control requests from the CLI are dispatched.
+type ControlDispatchOptions = shared.ControlDispatchOptions
+
+// DefaultControlWorkers is the number of control requests handled at once by default.
+const DefaultControlWorkers = shared.DefaultControlWorkers
+
+// TimeoutAction decides how work whose deadline expired is ended.
+type TimeoutAction = shared.TimeoutAction
+
+// Timeout action constants.
+const (
+	TimeoutActionInterrupt = shared.TimeoutActionInterrupt
+	TimeoutActionKill      = shared.TimeoutActionKill
+)
+
+// TimeoutLimit names the deadline reported by a TimeoutError.
+type TimeoutLimit = shared.TimeoutLimit
+
+// Timeout limit constants.
+const (
+	TimeoutLimitIdle    = shared.TimeoutLimitIdle
+	TimeoutLimitTurn    = shared.TimeoutLimitTurn
+	TimeoutLimitSession = shared.TimeoutLimitSession
+)
+
+// OverflowPolicy decides what happens when the message queue is full.
+type OverflowPolicy = shared.OverflowPolicy
+
+// Overflow policy constants.
+const (
+	OverflowBlock      = shared.OverflowBlock
+	OverflowDropDeltas = shared.OverflowDropDeltas
+	OverflowSpill      = shared.OverflowSpill
+)
+
+// RetryPolicy controls how transient failures are retried.
+type RetryPolicy = shared.RetryPolicy
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+var DefaultRetryPolicy = shared.DefaultRetryPolicy
+
+// IsRetryableError is the default retry classifier.
+var IsRetryableError = shared.IsRetryableError
+
+// APIError is an error the CLI reported in an assistant message.
+type APIError = shared.APIError
+
+// IsAPIError checks if an error is an APIError.
+var IsAPIError = shared.IsAPIError
+
+// AsAPIError extracts an APIError from an error chain.
+var AsAPIError = shared.AsAPIError
+
+// IsRateLimitError checks if an error is a rate-limit APIError.
+var IsRateLimitError = shared.IsRateLimitError
+
 // =============================================================================
 // Session Options (TypeScript SDK Parity)
 // =============================================================================
@@ -530,11 +629,40 @@ var ResolveModelName = shared.ResolveModelName
 type CircuitBreakerConfig = shared.CircuitBreakerConfig
 
 // StubCircuitBreaker is a simple circuit breaker for demonstration.
+//
+// Deprecated: Use NewCircuitBreaker.
 type StubCircuitBreaker = shared.StubCircuitBreaker
 
 // NewStubCircuitBreaker creates a new stub circuit breaker.
+//
+// Deprecated: Use NewCircuitBreaker.
 var NewStubCircuitBreaker = shared.NewStubCircuitBreaker
 
+// CircuitBreaker is the contract shared by circuit breaker implementations.
+type CircuitBreaker = shared.CircuitBreaker
+
+// Breaker is a concurrency-safe circuit breaker for CLI process launches.
+type Breaker = shared.Breaker
+
+// NewCircuitBreaker creates a Breaker to pass to WithCircuitBreaker.
+var NewCircuitBreaker = shared.NewCircuitBreaker
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState = shared.State
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = shared.Closed
+	CircuitOpen     = shared.Open
+	CircuitHalfOpen = shared.HalfOpen
+)
+
+// ErrCircuitOpen is returned when a circuit breaker rejects a launch.
+var ErrCircuitOpen = shared.ErrCircuitOpen
+
+// IsLaunchFailure is the default failure classifier of a Breaker.
+var IsLaunchFailure = shared.IsLaunchFailure
+
 // =============================================================================
 // Process Error Type
 // =============================================================================
@@ -548,3 +676,67 @@ var NewStubCircuitBreaker = shared.NewStubCircuitBreaker
 
 // IsProcessError checks if an error is a ProcessError.
 var IsProcessError = shared.IsProcessError
+
+// ExitCause classifies why the CLI process failed, as recognized in its stderr.
+type ExitCause = shared.ExitCause
+
+// Exit cause constants, reported in ProcessError.Cause.
+const (
+	ExitCauseUnknown            = shared.ExitCauseUnknown
+	ExitCauseAuth               = shared.ExitCauseAuth
+	ExitCauseInvalidModel       = shared.ExitCauseInvalidModel
+	ExitCauseBadFlag            = shared.ExitCauseBadFlag
+	ExitCauseUnsupportedVersion = shared.ExitCauseUnsupportedVersion
+)
+
+// ClassifyStderr recognizes the cause of a CLI failure in its stderr lines.
+var ClassifyStderr = shared.ClassifyStderr
+
+// ResourceLimits bounds the resources of the CLI process tree (Linux only).
+type ResourceLimits = shared.ResourceLimits
+
+// CgroupLimits configures the cgroup v2 created for each CLI process.
+type CgroupLimits = shared.CgroupLimits
+
+// Resource names a limit reported by a ResourceLimitError.
+type Resource = shared.Resource
+
+// Resource constants, reported in ResourceLimitError.Resource.
+const (
+	ResourceCPUTime      = shared.ResourceCPUTime
+	ResourceAddressSpace = shared.ResourceAddressSpace
+	ResourceOpenFiles    = shared.ResourceOpenFiles
+	ResourceProcesses    = shared.ResourceProcesses
+	ResourceMemory       = shared.ResourceMemory
+)
+
+// ResourceLimitError reports that the CLI process tree hit a resource limit.
+type ResourceLimitError = shared.ResourceLimitError
+
+// IsResourceLimitError checks if an error is a ResourceLimitError.
+var IsResourceLimitError = shared.IsResourceLimitError
+
+// AsResourceLimitError extracts a ResourceLimitError from the error chain.
+var AsResourceLimitError = shared.AsResourceLimitError
+
+// EnvPolicy controls the environment of the CLI process.
+type EnvPolicy = shared.EnvPolicy
+
+// EnvMode selects which variables of the SDK process's environment the CLI inherits.
+type EnvMode = shared.EnvMode
+
+// Environment modes, set in EnvPolicy.Mode.
+const (
+	EnvInheritAll = shared.EnvInheritAll
+	EnvAllowlist  = shared.EnvAllowlist
+	EnvExplicit   = shared.EnvExplicit
+)
+
+// DefaultEnvAllowlist returns the variables EnvAllowlist always passes.
+var DefaultEnvAllowlist = shared.DefaultEnvAllowlist
+
+// RedactEnv lists the names of KEY=value pairs with their values redacted.
+var RedactEnv = shared.RedactEnv
+
+// Logger is the printf-style logger accepted by WithLogger.
+type Logger = shared.Logger
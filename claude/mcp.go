@@ -4,10 +4,11 @@ package claude
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
-	"sync"
 
+	"github.com/dotcommander/agent-sdk-go/claude/mcp"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
@@ -42,12 +43,8 @@ type McpContent struct {
 }
 
 // McpToolDefinition describes a tool exposed by an MCP server.
-// Re-exported for convenience from the root claude package.
-type McpToolDefinition struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	InputSchema map[string]any `json:"inputSchema"`
-}
+// Re-exported for convenience from the claude/mcp package.
+type McpToolDefinition = mcp.ToolDefinition
 
 // McpTool represents a tool for SDK MCP servers.
 // This is the Go alternative to Python's @tool decorator.
@@ -119,17 +116,71 @@ func (t *McpTool) Call(ctx context.Context, args map[string]any) (*McpToolResult
 	return t.handler(ctx, args)
 }
 
+// sdkTool converts the tool into the mcp.SdkMcpTool that serves it,
+// with results in the MCP wire format.
+func (t *McpTool) sdkTool() *mcp.SdkMcpTool {
+	var schema any
+	if t.inputSchema != nil {
+		schema = t.inputSchema
+	}
+
+	var handler func(context.Context, map[string]any) (map[string]any, error)
+	if t.handler != nil {
+		handler = func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			result, err := t.Call(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			return result.toMap()
+		}
+	}
+
+	return mcp.Tool(t.name, t.description, schema, handler)
+}
+
+// toMap converts the typed result into the MCP wire format used by mcp.SdkMcpServer.
+func (r *McpToolResult) toMap() (map[string]any, error) {
+	if r == nil {
+		return map[string]any{"content": []any{}}, nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("marshal tool result: %w", err)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal tool result: %w", err)
+	}
+	return result, nil
+}
+
+// toolResultFromMap converts an MCP wire format result back into the typed result.
+func toolResultFromMap(m map[string]any) (*McpToolResult, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal tool result: %w", err)
+	}
+
+	var result McpToolResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal tool result: %w", err)
+	}
+	return &result, nil
+}
+
 // SdkMcpServer implements an in-process MCP server.
-// It is thread-safe and can handle concurrent tool calls.
+// It is thread-safe and can handle concurrent tool calls. Tools are held by
+// the mcp.SdkMcpServer it wraps, so servers built with either package are
+// routed identically by the control protocol.
 type SdkMcpServer struct {
-	name    string
-	version string
-	mu      sync.RWMutex
-	tools   map[string]*McpTool
+	server *mcp.SdkMcpServer
 }
 
 // CreateSDKMcpServer creates an in-process MCP server with the given tools.
 // This is the Go equivalent of Python's create_sdk_mcp_server().
+// Nil tools are ignored.
 //
 // Example:
 //
@@ -141,14 +192,10 @@ type SdkMcpServer struct {
 //	)
 func CreateSDKMcpServer(name, version string, tools ...*McpTool) *shared.McpSdkServerConfig {
 	server := &SdkMcpServer{
-		name:    name,
-		version: version,
-		tools:   make(map[string]*McpTool),
+		server: mcp.CreateSdkMcpServer(name, version, nil),
 	}
 	for _, tool := range tools {
-		if tool != nil {
-			server.tools[tool.Name()] = tool
-		}
+		server.AddTool(tool)
 	}
 	return &shared.McpSdkServerConfig{
 		Type:     "sdk",
@@ -159,44 +206,29 @@ func CreateSDKMcpServer(name, version string, tools ...*McpTool) *shared.McpSdkS
 
 // Name returns the server name.
 func (s *SdkMcpServer) Name() string {
-	return s.name
+	return s.server.Name
 }
 
 // Version returns the server version.
 func (s *SdkMcpServer) Version() string {
-	return s.version
+	return s.server.Version
 }
 
 // ListTools returns all registered tools.
 // This method is thread-safe.
-func (s *SdkMcpServer) ListTools(_ context.Context) ([]McpToolDefinition, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	defs := make([]McpToolDefinition, 0, len(s.tools))
-	for _, tool := range s.tools {
-		defs = append(defs, McpToolDefinition{
-			Name:        tool.Name(),
-			Description: tool.Description(),
-			InputSchema: tool.InputSchema(),
-		})
-	}
-	return defs, nil
+func (s *SdkMcpServer) ListTools(ctx context.Context) ([]McpToolDefinition, error) {
+	return s.server.ListTools(ctx)
 }
 
 // CallTool executes a tool by name with the given arguments.
 // Returns an error if the tool is not found.
 // This method is thread-safe.
 func (s *SdkMcpServer) CallTool(ctx context.Context, name string, args map[string]any) (*McpToolResult, error) {
-	s.mu.RLock()
-	tool, exists := s.tools[name]
-	s.mu.RUnlock()
-
-	if !exists {
-		return nil, fmt.Errorf("tool '%s' not found", name)
+	result, err := s.server.CallTool(ctx, name, args)
+	if err != nil {
+		return nil, err
 	}
-
-	return tool.Call(ctx, args)
+	return toolResultFromMap(result)
 }
 
 // AddTool adds a tool to the server.
@@ -205,21 +237,18 @@ func (s *SdkMcpServer) AddTool(tool *McpTool) {
 	if tool == nil {
 		return
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.tools[tool.Name()] = tool
+	s.server.AddTool(tool.sdkTool())
 }
 
 // RemoveTool removes a tool from the server.
 // This method is thread-safe.
 func (s *SdkMcpServer) RemoveTool(name string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, exists := s.tools[name]; exists {
-		delete(s.tools, name)
-		return true
-	}
-	return false
+	return s.server.RemoveTool(name)
+}
+
+// HandleRequest handles MCP JSON-RPC requests from the CLI.
+func (s *SdkMcpServer) HandleRequest(ctx context.Context, message map[string]any) map[string]any {
+	return s.server.HandleRequest(ctx, message)
 }
 
 // WithSdkMcpServer adds an in-process SDK MCP server by name.
@@ -6,6 +6,8 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
+	"sync"
 
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
@@ -45,12 +47,21 @@ func Tool(
 	}
 }
 
+// ToolDefinition describes a tool exposed by an SDK MCP server.
+type ToolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
 // SdkMcpServer represents an in-process MCP server.
+// It is safe for concurrent use; tools may be added or removed while
+// requests are being handled.
 type SdkMcpServer struct {
 	Name    string
 	Version string
-	Tools   []*SdkMcpTool
-	toolMap map[string]*SdkMcpTool
+	tools   []*SdkMcpTool
+	mu      sync.RWMutex
 }
 
 // CreateSdkMcpServer creates an in-process MCP server.
@@ -87,17 +98,102 @@ func CreateSdkMcpServer(name string, version string, tools []*SdkMcpTool) *SdkMc
 		version = "1.0.0"
 	}
 
-	toolMap := make(map[string]*SdkMcpTool)
+	// Skip nil entries so lookups never dereference a missing tool
+	registered := make([]*SdkMcpTool, 0, len(tools))
 	for _, tool := range tools {
-		toolMap[tool.Name] = tool
+		if tool != nil {
+			registered = append(registered, tool)
+		}
 	}
 
 	return &SdkMcpServer{
 		Name:    name,
 		Version: version,
-		Tools:   tools,
-		toolMap: toolMap,
+		tools:   registered,
+	}
+}
+
+// Tools returns a snapshot of the registered tools in registration order.
+func (s *SdkMcpServer) Tools() []*SdkMcpTool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.tools)
+}
+
+// ListTools returns the definitions of all registered tools.
+func (s *SdkMcpServer) ListTools(_ context.Context) ([]ToolDefinition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	defs := make([]ToolDefinition, 0, len(s.tools))
+	for _, tool := range s.tools {
+		defs = append(defs, ToolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: s.convertSchema(tool.InputSchema),
+		})
+	}
+	return defs, nil
+}
+
+// CallTool executes a tool by name with the given arguments.
+// Returns an error if the tool is not found or has no handler.
+func (s *SdkMcpServer) CallTool(ctx context.Context, name string, args map[string]any) (map[string]any, error) {
+	tool := s.lookupTool(name)
+	if tool == nil {
+		return nil, fmt.Errorf("tool '%s' not found", name)
+	}
+	if tool.Handler == nil {
+		return nil, fmt.Errorf("tool '%s' has no handler", name)
+	}
+	return tool.Handler(ctx, args)
+}
+
+// AddTool registers a tool, replacing any existing tool with the same name.
+func (s *SdkMcpServer) AddTool(tool *SdkMcpTool) {
+	if tool == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.tools {
+		if existing.Name == tool.Name {
+			s.tools[i] = tool
+			return
+		}
+	}
+	s.tools = append(s.tools, tool)
+}
+
+// RemoveTool unregisters a tool by name.
+// Returns true if the tool was registered.
+func (s *SdkMcpServer) RemoveTool(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.tools {
+		if existing.Name == name {
+			s.tools = append(s.tools[:i], s.tools[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// lookupTool finds a registered tool by name.
+func (s *SdkMcpServer) lookupTool(name string) *SdkMcpTool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, tool := range s.tools {
+		if tool.Name == name {
+			return tool
+		}
 	}
+	return nil
 }
 
 // ToConfig converts the server to a shared.McpSdkServerConfig.
@@ -158,12 +254,13 @@ func (s *SdkMcpServer) handleInitialize(msgID any) map[string]any {
 }
 
 func (s *SdkMcpServer) handleListTools(msgID any) map[string]any {
-	tools := make([]map[string]any, len(s.Tools))
-	for i, tool := range s.Tools {
+	defs, _ := s.ListTools(context.Background())
+	tools := make([]map[string]any, len(defs))
+	for i, def := range defs {
 		tools[i] = map[string]any{
-			"name":        tool.Name,
-			"description": tool.Description,
-			"inputSchema": s.convertSchema(tool.InputSchema),
+			"name":        def.Name,
+			"description": def.Description,
+			"inputSchema": def.InputSchema,
 		}
 	}
 
@@ -180,8 +277,7 @@ func (s *SdkMcpServer) handleCallTool(ctx context.Context, msgID any, params map
 	toolName, _ := params["name"].(string)
 	arguments, _ := params["arguments"].(map[string]any)
 
-	tool, exists := s.toolMap[toolName]
-	if !exists {
+	if s.lookupTool(toolName) == nil {
 		return map[string]any{
 			"jsonrpc": "2.0",
 			"id":      msgID,
@@ -193,7 +289,7 @@ func (s *SdkMcpServer) handleCallTool(ctx context.Context, msgID any, params map
 	}
 
 	// Call handler
-	result, err := tool.Handler(ctx, arguments)
+	result, err := s.CallTool(ctx, toolName, arguments)
 	if err != nil {
 		return map[string]any{
 			"jsonrpc": "2.0",
@@ -257,7 +353,7 @@ func (s *SdkMcpServer) convertSchema(schema any) map[string]any {
 	}
 
 	// If it's a struct type, use reflection
-	if reflect.TypeOf(schema).Kind() == reflect.Struct {
+	if schema != nil && reflect.TypeOf(schema).Kind() == reflect.Struct {
 		return generateSchema(reflect.TypeOf(schema))
 	}
 
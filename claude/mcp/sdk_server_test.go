@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -44,8 +45,33 @@ func TestSdkMcpServerCreation(t *testing.T) {
 	if server.Version != "1.0.0" {
 		t.Errorf("expected version '1.0.0', got %s", server.Version)
 	}
-	if len(server.Tools) != 2 {
-		t.Errorf("expected 2 tools, got %d", len(server.Tools))
+	if len(server.Tools()) != 2 {
+		t.Errorf("expected 2 tools, got %d", len(server.Tools()))
+	}
+}
+
+func TestSdkMcpServerConcurrentAddTool(t *testing.T) {
+	server := CreateSdkMcpServer("test", "1.0.0", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			server.AddTool(Tool(fmt.Sprintf("tool%d", i), "Tool", nil, nil))
+		}(i)
+		go func() {
+			defer wg.Done()
+			for _, tool := range server.Tools() {
+				_ = tool.Name
+			}
+			_, _ = server.ListTools(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if got := len(server.Tools()); got != 8 {
+		t.Errorf("expected 8 tools, got %d", got)
 	}
 }
 
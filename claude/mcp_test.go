@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/dotcommander/agent-sdk-go/claude/mcp"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -176,6 +178,37 @@ func TestSdkMcpServer(t *testing.T) {
 	})
 }
 
+// TestSdkMcpServerHandleRequest tests that CLI requests reach the server's tools.
+func TestSdkMcpServerHandleRequest(t *testing.T) {
+	t.Parallel()
+
+	echo := NewTool("echo", "Echo text", nil, func(_ context.Context, args map[string]any) (*McpToolResult, error) {
+		text, _ := args["text"].(string)
+		return &McpToolResult{Content: []McpContent{{Type: "text", Text: text}}}, nil
+	})
+	server := CreateSDKMcpServer("util", "1.0.0").Instance.(*SdkMcpServer)
+	server.AddTool(echo)
+
+	reply := server.HandleRequest(context.Background(), map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "echo", "arguments": map[string]any{"text": "hi"}},
+	})
+	result, ok := reply["result"].(map[string]any)
+	require.True(t, ok, "unexpected reply: %v", reply)
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "hi"}}, result["content"])
+
+	server.RemoveTool("echo")
+	reply = server.HandleRequest(context.Background(), map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "echo"},
+	})
+	assert.NotNil(t, reply["error"])
+}
+
 // TestMcpToolResult tests the tool result types.
 func TestMcpToolResult(t *testing.T) {
 	t.Parallel()
@@ -275,3 +308,32 @@ func TestWithAllowedTools(t *testing.T) {
 		assert.Contains(t, opts.CustomArgs, "Read")
 	})
 }
+
+// TestExtractSdkMcpServers tests that in-process servers are picked out of MCP configs.
+func TestExtractSdkMcpServers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pointer config from CreateSDKMcpServer", func(t *testing.T) {
+		config := CreateSDKMcpServer("calc", "1.0.0")
+		servers := extractSdkMcpServers(map[string]shared.McpServerConfig{"calc": config})
+
+		require.Len(t, servers, 1)
+		assert.Same(t, config.Instance.(*SdkMcpServer).server, servers["calc"])
+	})
+
+	t.Run("value config from ToConfig", func(t *testing.T) {
+		server := mcp.CreateSdkMcpServer("calc", "1.0.0", nil)
+		servers := extractSdkMcpServers(map[string]shared.McpServerConfig{"calc": server.ToConfig()})
+
+		require.Len(t, servers, 1)
+		assert.Same(t, server, servers["calc"])
+	})
+
+	t.Run("external servers are skipped", func(t *testing.T) {
+		servers := extractSdkMcpServers(map[string]shared.McpServerConfig{
+			"remote": &shared.McpStdioServerConfig{Command: "mcp-server"},
+		})
+
+		assert.Nil(t, servers)
+	})
+}
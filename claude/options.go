@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
@@ -25,8 +27,6 @@ func DefaultClientOptions() *ClientOptions {
 	}
 }
 
-var validPermissionModes = []string{"auto", "read", "write", "restricted"}
-
 // Validate validates the options and returns an error if invalid.
 // Performs comprehensive validation including conflict detection.
 func (o *ClientOptions) Validate() error {
@@ -36,9 +36,8 @@ func (o *ClientOptions) Validate() error {
 	}
 	o.Model = shared.ResolveModelName(o.Model)
 
-	if !slices.Contains(validPermissionModes, o.PermissionMode) {
-		return shared.NewConfigurationError("PermissionMode", o.PermissionMode,
-			fmt.Sprintf("invalid permission mode, must be one of: %v", validPermissionModes))
+	if _, err := shared.CLIPermissionMode(o.PermissionMode); err != nil {
+		return err
 	}
 
 	// Validate timeout format
@@ -70,6 +69,10 @@ func (o *ClientOptions) Validate() error {
 		}
 	}
 
+	if err := o.EnvPolicy.Validate(); err != nil {
+		return err
+	}
+
 	// Validate agents if set
 	for name, agent := range o.Agents {
 		if name == "" {
@@ -170,7 +173,8 @@ func WithTypedPermissionMode(mode shared.PermissionMode) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithModelPermissionMode(string(mode))(&o.ModelOptions) }
 }
 
-// WithContextFiles sets the context files option.
+// WithContextFiles sets the context files option. The CLI is granted each
+// file's directory with --add-dir; the files are not preloaded.
 func WithContextFiles(files ...string) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithModelContextFiles(files...)(&o.ModelOptions) }
 }
@@ -202,7 +206,8 @@ func WithEnv(env map[string]string) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithConnEnv(env)(&o.ConnectionOptions) }
 }
 
-// WithMaxMessages sets the maximum number of messages.
+// WithMaxMessages sets how many messages are queued ahead of slow
+// consumers before the overflow policy applies.
 func WithMaxMessages(max int) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithBufMaxMessages(max)(&o.BufferOptions) }
 }
@@ -212,6 +217,23 @@ func WithBufferSize(size int) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithBufBufferSize(size)(&o.BufferOptions) }
 }
 
+// WithOverflowPolicy sets what happens when MaxMessages messages are queued:
+// block the CLI output, drop partial stream deltas, or spill to disk.
+func WithOverflowPolicy(policy OverflowPolicy) func(*ClientOptions) {
+	return func(o *ClientOptions) { shared.WithBufOverflow(policy)(&o.BufferOptions) }
+}
+
+// WithSpillDir sets the directory used by OverflowSpill.
+func WithSpillDir(dir string) func(*ClientOptions) {
+	return func(o *ClientOptions) { shared.WithBufSpillDir(dir)(&o.BufferOptions) }
+}
+
+// WithMaxLineSize sets the longest line of CLI output, in bytes, that is
+// read. Longer lines are skipped and reported as a LineTooLongError.
+func WithMaxLineSize(size int) func(*ClientOptions) {
+	return func(o *ClientOptions) { shared.WithBufMaxLineSize(size)(&o.BufferOptions) }
+}
+
 // WithTrace enables detailed tracing.
 func WithTrace(trace bool) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithDebugTrace(trace)(&o.DebugOptions) }
@@ -227,11 +249,25 @@ func WithCacheTTL(ttl string) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithDebugCacheTTL(ttl)(&o.DebugOptions) }
 }
 
-// WithLogger sets the logger interface.
+// WithLogger sets a printf-style logger for transport, control protocol,
+// hook and MCP routing diagnostics. Secrets in env vars and prompts are redacted.
 func WithLogger(logger shared.Logger) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithDebugLogger(logger)(&o.DebugOptions) }
 }
 
+// WithSlog sets a structured logger for transport, control protocol, hook and
+// MCP routing diagnostics. Records carry fields such as pid, session_id,
+// request_id and subtype; secrets in env vars and prompts are redacted.
+// It takes precedence over WithLogger.
+//
+// Example:
+//
+//	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+//	client, _ := claude.NewClient(claude.WithSlog(logger))
+func WithSlog(logger *slog.Logger) func(*ClientOptions) {
+	return func(o *ClientOptions) { shared.WithDebugSlog(logger)(&o.DebugOptions) }
+}
+
 // WithEnableMetrics enables performance metrics.
 func WithEnableMetrics(enable bool) func(*ClientOptions) {
 	return func(o *ClientOptions) { shared.WithDebugEnableMetrics(enable)(&o.DebugOptions) }
@@ -875,3 +911,334 @@ func WithPluginConfig(config *shared.SdkPluginConfig) ClientOption {
 		o.SdkPluginConfig = config
 	}
 }
+
+// =============================================================================
+// P2 Options: V2 Parity
+// =============================================================================
+
+// WithResumeSessionAt resumes the session at a specific message UUID.
+// Use together with WithResume.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithResume("session-uuid-here"),
+//	    claude.WithResumeSessionAt("message-uuid-here"),
+//	)
+func WithResumeSessionAt(messageUUID string) ClientOption {
+	return func(o *ClientOptions) {
+		o.CustomArgs = append(o.CustomArgs, "--resume-session-at", messageUUID)
+	}
+}
+
+// WithPersistSession controls whether the CLI saves the session to disk.
+// Sessions are persisted by default; passing false disables persistence.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithPersistSession(false),
+//	)
+func WithPersistSession(persist bool) ClientOption {
+	return func(o *ClientOptions) {
+		if !persist {
+			o.CustomArgs = append(o.CustomArgs, "--no-session-persistence")
+		}
+	}
+}
+
+// WithStrictMcpConfig only uses MCP servers from the SDK configuration,
+// ignoring all other MCP configurations.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithStrictMcpConfig(),
+//	)
+func WithStrictMcpConfig() ClientOption {
+	return func(o *ClientOptions) {
+		o.CustomArgs = append(o.CustomArgs, "--strict-mcp-config")
+	}
+}
+
+// WithAllowDangerouslySkipPermissions allows the bypassPermissions mode to be enabled.
+// Required by the CLI before permission checks can be bypassed.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithAllowDangerouslySkipPermissions(),
+//	)
+func WithAllowDangerouslySkipPermissions() ClientOption {
+	return func(o *ClientOptions) {
+		o.CustomArgs = append(o.CustomArgs, "--allow-dangerously-skip-permissions")
+	}
+}
+
+// WithPermissionPromptToolName sets the MCP tool that handles permission prompts.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithPermissionPromptToolName("mcp__auth__approve"),
+//	)
+func WithPermissionPromptToolName(toolName string) ClientOption {
+	return func(o *ClientOptions) {
+		o.CustomArgs = append(o.CustomArgs, "--permission-prompt-tool", toolName)
+	}
+}
+
+// WithPlugins loads plugins from local directories.
+// Only plugins of type "local" are supported by the CLI.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithPlugins(shared.PluginConfig{Type: "local", Path: "./my-plugin"}),
+//	)
+func WithPlugins(plugins ...shared.PluginConfig) ClientOption {
+	return func(o *ClientOptions) {
+		for _, plugin := range plugins {
+			if plugin.Type == "local" && plugin.Path != "" {
+				o.CustomArgs = append(o.CustomArgs, "--plugin-dir", plugin.Path)
+			}
+		}
+	}
+}
+
+// WithExtraArgs passes arbitrary CLI flags.
+// Each key becomes "--key"; a non-empty value is passed as the flag's argument.
+// Flags are added in sorted key order so the command line is deterministic.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithExtraArgs(map[string]string{"verbose": "", "output-style": "concise"}),
+//	)
+func WithExtraArgs(args map[string]string) ClientOption {
+	return func(o *ClientOptions) {
+		keys := make([]string, 0, len(args))
+		for key := range args {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			o.CustomArgs = append(o.CustomArgs, "--"+strings.TrimPrefix(key, "--"))
+			if value := args[key]; value != "" {
+				o.CustomArgs = append(o.CustomArgs, value)
+			}
+		}
+	}
+}
+
+// WithProcessCwd sets the working directory of the CLI subprocess.
+// Unlike WithWorkingDirectory, no CLI flag is passed; the process is started
+// in the directory. The path must be absolute.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithProcessCwd("/path/to/project"),
+//	)
+func WithProcessCwd(path string) ClientOption {
+	return func(o *ClientOptions) {
+		o.Cwd = path
+	}
+}
+
+// WithRecovery enables automatic recovery of the interactive session when the
+// CLI process exits unexpectedly. The CLI is respawned with --resume, hooks and
+// SDK MCP servers are registered again, and each attempt is reported as a
+// ReconnectEvent on the message stream.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithRecovery(claude.RecoveryOptions{MaxAttempts: 5, ResendInFlight: true}),
+//	)
+func WithRecovery(opts RecoveryOptions) ClientOption {
+	return func(o *ClientOptions) {
+		o.Recovery = &opts
+	}
+}
+
+// WithRetryPolicy sets how CLI launches and rate-limited or overloaded queries
+// are retried. Batch jobs can afford many patient attempts, while interactive
+// callers usually prefer to fail fast.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithRetryPolicy(&claude.RetryPolicy{
+//	        MaxAttempts:    6,
+//	        InitialBackoff: time.Second,
+//	        MaxBackoff:     time.Minute,
+//	        Jitter:         0.2,
+//	        OnRetry: func(attempt int, err error, delay time.Duration) {
+//	            log.Printf("attempt %d failed: %v; retrying in %s", attempt, err, delay)
+//	        },
+//	    }),
+//	)
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(o *ClientOptions) {
+		o.RetryPolicy = policy
+	}
+}
+
+// WithCircuitBreaker guards every CLI launch with a circuit breaker. After the
+// configured number of consecutive launch failures, connects and queries fail
+// fast with ErrCircuitOpen until a half-open probe succeeds. Pass the same
+// breaker to every client of a worker to protect the whole fleet.
+//
+// Example:
+//
+//	breaker := claude.NewCircuitBreaker(claude.CircuitBreakerConfig{
+//	    FailureThreshold: 5,
+//	    RecoveryTimeout:  time.Minute,
+//	    OnStateChange: func(from, to claude.CircuitState) {
+//	        log.Printf("claude CLI circuit %s -> %s", from, to)
+//	    },
+//	})
+//	client, _ := claude.NewClient(claude.WithCircuitBreaker(breaker))
+func WithCircuitBreaker(breaker *Breaker) ClientOption {
+	return func(o *ClientOptions) {
+		o.CircuitBreaker = breaker
+	}
+}
+
+// WithShutdown sets the grace periods used when the CLI is stopped. Shutdown
+// closes stdin first, then sends SIGINT, SIGTERM and SIGKILL to the CLI's
+// process group, so that commands it spawned are stopped along with it.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithShutdown(claude.ShutdownOptions{
+//	        StdinGrace:     10 * time.Second,
+//	        InterruptGrace: 5 * time.Second,
+//	    }),
+//	)
+func WithShutdown(opts ShutdownOptions) ClientOption {
+	return func(o *ClientOptions) {
+		o.Shutdown = opts
+	}
+}
+
+// WithDeadlines bounds how long the client waits on the CLI: without output
+// during a turn, for a whole turn, and for the whole session. An expired
+// deadline is delivered as a TimeoutError whose Limit names it.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithDeadlines(claude.DeadlineOptions{
+//	        Idle:   2 * time.Minute,
+//	        Turn:   15 * time.Minute,
+//	        Action: claude.TimeoutActionInterrupt,
+//	    }),
+//	)
+func WithDeadlines(opts DeadlineOptions) ClientOption {
+	return func(o *ClientOptions) {
+		o.Deadlines = opts
+	}
+}
+
+// WithResourceLimits bounds the CPU time, memory, open files and processes
+// of the CLI and everything it spawns, optionally inside a cgroup v2 of its
+// own. A CLI that exits after hitting a limit is reported as a
+// ResourceLimitError. Resource limits are supported on Linux only.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithResourceLimits(claude.ResourceLimits{
+//	        CPUTime:   10 * time.Minute,
+//	        OpenFiles: 4096,
+//	        Cgroup: &claude.CgroupLimits{
+//	            Parent:    "/sys/fs/cgroup/agents",
+//	            MemoryMax: 2 << 30,
+//	            CPUs:      2,
+//	        },
+//	    }),
+//	)
+func WithResourceLimits(limits ResourceLimits) ClientOption {
+	return func(o *ClientOptions) {
+		o.ResourceLimits = &limits
+	}
+}
+
+// WithControlDispatch sets how many control requests from the CLI, such as
+// permission checks, hook callbacks and in-process MCP tool calls, are
+// handled concurrently. Requests about the same tool use are still handled
+// in order. A slow CanUseTool callback, like one waiting for a human, then
+// no longer holds up the message stream or other requests.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithCanUseTool(askUser),
+//	    claude.WithControlDispatch(claude.ControlDispatchOptions{Workers: 16}),
+//	)
+func WithControlDispatch(opts ControlDispatchOptions) ClientOption {
+	return func(o *ClientOptions) {
+		o.ControlDispatch = opts
+	}
+}
+
+// WithControlHandlers handles control requests of subtypes the SDK does not
+// handle itself, such as those added by a newer or forked CLI, with the
+// handlers of registry. Setting it enables the control protocol. Requests
+// of subtypes without a handler are answered with an error.
+//
+// Example:
+//
+//	handlers := subprocess.NewControlHandlerRegistry()
+//	handlers.Register("elicitation", func(ctx context.Context, req map[string]any) (any, error) {
+//	    return map[string]any{"action": "decline"}, nil
+//	})
+//	client, _ := claude.NewClient(claude.WithControlHandlers(handlers))
+func WithControlHandlers(registry *subprocess.ControlHandlerRegistry) ClientOption {
+	return func(o *ClientOptions) {
+		o.ControlHandlers = registry
+	}
+}
+
+// WithEnvPolicy limits the environment the CLI and the tools it runs inherit
+// from the SDK process, and can give each client its own HOME and
+// CLAUDE_CONFIG_DIR. Variables set through WithEnv are always passed.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithEnvPolicy(claude.EnvPolicy{
+//	        Mode:      claude.EnvAllowlist,
+//	        Allow:     []string{"LANG", "LC_*"},
+//	        Home:      "/srv/tenants/acme",
+//	        ConfigDir: "/srv/tenants/acme/.claude",
+//	    }),
+//	)
+func WithEnvPolicy(policy EnvPolicy) ClientOption {
+	return func(o *ClientOptions) {
+		o.EnvPolicy = policy
+	}
+}
+
+// WithLauncher sets how the CLI processes are started, for example inside a
+// container or sandbox. The launcher receives the resolved CLI path,
+// arguments, environment and working directory and returns the process's pipes.
+// A remote.Launcher runs the CLI on another host through a relay.
+//
+// Example:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithCLIPath("/usr/local/bin/claude"),
+//	    claude.WithLauncher(subprocess.PrefixLauncher{
+//	        Prefix: []string{"docker", "exec", "-i", "-w", "/work", "agent"},
+//	    }),
+//	)
+func WithLauncher(launcher subprocess.Launcher) ClientOption {
+	return func(o *ClientOptions) {
+		o.Launcher = launcher
+	}
+}
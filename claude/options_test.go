@@ -7,6 +7,7 @@ import (
 
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestWithToolsPreset tests the tools preset option.
@@ -727,6 +728,81 @@ func TestWithTypedPermissionMode(t *testing.T) {
 	})
 }
 
+// TestCLIPermissionMode tests mapping SDK permission modes to CLI modes.
+func TestCLIPermissionMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"auto", ""},
+		{"read", "plan"},
+		{"write", "acceptEdits"},
+		{"restricted", "default"},
+		{"accept_edits", "acceptEdits"},
+		{"bypassPermissions", "bypassPermissions"},
+		{"dontAsk", "dontAsk"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			opts := DefaultClientOptions()
+			WithPermissionMode(tt.mode)(opts)
+
+			assert.NoError(t, opts.Validate())
+			assert.Equal(t, tt.want, cliOptions(opts).PermissionMode)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		opts := DefaultClientOptions()
+		WithPermissionMode("acceptedits")(opts)
+
+		assert.True(t, shared.IsConfigurationError(opts.Validate()))
+	})
+}
+
+// TestCLIOptionsFromClientOptions tests that flag-backed fields reach the transport.
+func TestCLIOptionsFromClientOptions(t *testing.T) {
+	t.Parallel()
+
+	agents := map[string]shared.AgentDefinition{"coder": {Description: "Writes code"}}
+	sandbox := &shared.SandboxSettings{Enabled: true}
+	plugin := &shared.SdkPluginConfig{Enabled: true, PluginPath: "/p"}
+
+	opts := DefaultClientOptions()
+	WithContextFiles("/repo/main.go")(opts)
+	WithIncludePartialMessages(true)(opts)
+	WithJSONSchema(map[string]any{"type": "object"})(opts)
+	WithAgents(agents)(opts)
+	WithSettingSources(shared.SettingSourceProject)(opts)
+	WithSandboxSettings(sandbox)(opts)
+	WithPluginConfig(plugin)(opts)
+
+	got := cliOptions(opts)
+
+	assert.Equal(t, []string{"/repo/main.go"}, got.ContextFiles)
+	assert.True(t, got.IncludePartialMessages)
+	assert.Equal(t, map[string]any{"type": "object"}, got.OutputFormat.Schema)
+	assert.Equal(t, agents, got.Agents)
+	assert.Equal(t, []shared.SettingSource{shared.SettingSourceProject}, got.SettingSources)
+	assert.Equal(t, sandbox, got.Sandbox)
+	assert.Equal(t, plugin, got.SdkPluginConfig)
+}
+
+// TestAddContextFiles tests that added files reach the next query's CLI options.
+func TestAddContextFiles(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(WithContextFiles("/repo/main.go"))
+	require.NoError(t, err)
+	require.NoError(t, client.AddContextFiles(context.Background(), []string{"/docs/notes.md"}))
+
+	got := client.GetOptions().ContextFiles
+	assert.Equal(t, []string{"/repo/main.go", "/docs/notes.md"}, got)
+}
+
 // TestP1OptionsComposition tests that P1 options compose correctly.
 func TestP1OptionsComposition(t *testing.T) {
 	t.Parallel()
@@ -755,3 +831,75 @@ func TestP1OptionsComposition(t *testing.T) {
 		assert.NotNil(t, opts.Sandbox)
 	})
 }
+
+// TestWithResumeSessionAt tests the resume-at option.
+func TestWithResumeSessionAt(t *testing.T) {
+	t.Parallel()
+
+	opts := &ClientOptions{}
+	WithResumeSessionAt("msg-123")(opts)
+
+	assert.Equal(t, []string{"--resume-session-at", "msg-123"}, opts.CustomArgs)
+}
+
+// TestWithPersistSession tests the session persistence option.
+func TestWithPersistSession(t *testing.T) {
+	t.Parallel()
+
+	t.Run("false disables persistence", func(t *testing.T) {
+		opts := &ClientOptions{}
+		WithPersistSession(false)(opts)
+
+		assert.Equal(t, []string{"--no-session-persistence"}, opts.CustomArgs)
+	})
+
+	t.Run("true keeps default", func(t *testing.T) {
+		opts := &ClientOptions{}
+		WithPersistSession(true)(opts)
+
+		assert.Empty(t, opts.CustomArgs)
+	})
+}
+
+// TestWithPlugins tests the plugin directory option.
+func TestWithPlugins(t *testing.T) {
+	t.Parallel()
+
+	opts := &ClientOptions{}
+	WithPlugins(
+		shared.PluginConfig{Type: "local", Path: "/plugins/a"},
+		shared.PluginConfig{Type: "remote", Path: "https://example.com"},
+	)(opts)
+
+	assert.Equal(t, []string{"--plugin-dir", "/plugins/a"}, opts.CustomArgs)
+}
+
+// TestWithExtraArgs tests arbitrary flag passthrough.
+func TestWithExtraArgs(t *testing.T) {
+	t.Parallel()
+
+	opts := &ClientOptions{}
+	WithExtraArgs(map[string]string{
+		"verbose":      "",
+		"output-style": "concise",
+	})(opts)
+
+	assert.Equal(t, []string{"--output-style", "concise", "--verbose"}, opts.CustomArgs)
+}
+
+// TestP2OptionsComposition tests that V2 parity options compose.
+func TestP2OptionsComposition(t *testing.T) {
+	t.Parallel()
+
+	opts := DefaultClientOptions()
+	WithStrictMcpConfig()(opts)
+	WithAllowDangerouslySkipPermissions()(opts)
+	WithPermissionPromptToolName("mcp__auth__approve")(opts)
+	WithProcessCwd("/project")(opts)
+
+	assert.Contains(t, opts.CustomArgs, "--strict-mcp-config")
+	assert.Contains(t, opts.CustomArgs, "--allow-dangerously-skip-permissions")
+	assert.Contains(t, opts.CustomArgs, "--permission-prompt-tool")
+	assert.Equal(t, "/project", opts.Cwd)
+	assert.NoError(t, opts.Validate())
+}
@@ -103,13 +103,36 @@ func parseMessage[T shared.Message](jsonStr string, lineNumber int, typeName str
 }
 
 func parseUserMessage(jsonStr string, lineNumber int) (shared.Message, error) {
-	return parseMessage[*shared.UserMessage](jsonStr, lineNumber, "UserMessage")
+	msg, err := parseMessage[*shared.UserMessage](jsonStr, lineNumber, "UserMessage")
+	if err != nil {
+		return nil, err
+	}
+
+	// Claude CLI wraps the content in a "message" field; uuid and
+	// parent_tool_use_id stay on the root
+	var wrapper struct {
+		Message *struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &wrapper); err != nil || wrapper.Message == nil || wrapper.Message.Content == nil {
+		return msg, nil
+	}
+
+	var inner shared.UserMessage
+	if err := json.Unmarshal([]byte(`{"content":`+string(wrapper.Message.Content)+`}`), &inner); err != nil {
+		return nil, shared.NewParserError(lineNumber, 0, jsonStr, fmt.Sprintf("failed to parse UserMessage content: %v", err))
+	}
+	userMsg := msg.(*shared.UserMessage)
+	userMsg.Content = inner.Content
+	return userMsg, nil
 }
 
 func parseAssistantMessage(jsonStr string, lineNumber int) (shared.Message, error) {
 	// Claude CLI wraps the message in a "message" field, extract it first
 	var wrapper struct {
-		Message json.RawMessage `json:"message"`
+		Message json.RawMessage               `json:"message"`
+		Error   *shared.AssistantMessageError `json:"error"`
 	}
 	if err := json.Unmarshal([]byte(jsonStr), &wrapper); err != nil {
 		return nil, shared.NewParserError(lineNumber, 0, jsonStr, fmt.Sprintf("failed to parse AssistantMessage wrapper: %v", err))
@@ -125,6 +148,11 @@ func parseAssistantMessage(jsonStr string, lineNumber int) (shared.Message, erro
 	if err := json.Unmarshal(msgData, &msg); err != nil {
 		return nil, shared.NewParserError(lineNumber, 0, jsonStr, fmt.Sprintf("failed to parse AssistantMessage: %v", err))
 	}
+
+	// The CLI reports API errors such as rate limits next to the nested message
+	if msg.Error == nil {
+		msg.Error = wrapper.Error
+	}
 	return &msg, nil
 }
 
@@ -168,7 +196,7 @@ func parseSystemMessage(jsonStr string, lineNumber int) (shared.Message, error)
 			if err := json.Unmarshal(v, &data); err == nil {
 				msg.Data[k] = data
 			}
-		case "claudeCodeVersion":
+		case "claude_code_version", "claudeCodeVersion":
 			var version string
 			if err := json.Unmarshal(v, &version); err == nil {
 				msg.ClaudeCodeVersion = version
@@ -247,3 +247,51 @@ func BenchmarkRegistryParse(b *testing.B) {
 		}
 	})
 }
+
+// TestRegistryParseNestedUserMessage tests the CLI's wrapped user message format.
+func TestRegistryParseNestedUserMessage(t *testing.T) {
+	t.Parallel()
+
+	jsonStr := `{
+		"type": "user",
+		"uuid": "msg-1",
+		"parent_tool_use_id": null,
+		"message": {
+			"role": "user",
+			"content": [{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]
+		}
+	}`
+
+	msg, err := DefaultRegistry().Parse(shared.MessageTypeUser, jsonStr, 1)
+	require.NoError(t, err)
+
+	userMsg, ok := msg.(*shared.UserMessage)
+	require.True(t, ok)
+	assert.Equal(t, "msg-1", userMsg.GetUUID())
+
+	blocks, ok := userMsg.Content.([]shared.ContentBlock)
+	require.True(t, ok)
+	require.Len(t, blocks, 1)
+	result, ok := blocks[0].(*shared.ToolResultBlock)
+	require.True(t, ok)
+	assert.Equal(t, "toolu_1", result.ToolUseID)
+	assert.Equal(t, "ok", result.Content)
+}
+
+// TestRegistryParseAssistantMessageError tests that the CLI's top-level error field is kept.
+func TestRegistryParseAssistantMessageError(t *testing.T) {
+	t.Parallel()
+
+	jsonStr := `{
+		"type": "assistant",
+		"error": "rate_limit",
+		"message": {"content": [{"type":"text","text":"API Error: rate limited"}]}
+	}`
+
+	msg, err := DefaultRegistry().Parse(shared.MessageTypeAssistant, jsonStr, 1)
+	require.NoError(t, err)
+
+	assistant, ok := msg.(*shared.AssistantMessage)
+	require.True(t, ok)
+	assert.True(t, assistant.IsRateLimited())
+}
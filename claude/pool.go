@@ -0,0 +1,388 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/cli"
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// Default pool settings.
+const (
+	DefaultPoolSize                = 2
+	DefaultPoolHealthCheckInterval = 30 * time.Second
+)
+
+// ErrPoolClosed is returned by a Pool after Close.
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolOptions sizes a Pool and bounds the life of its processes.
+type PoolOptions struct {
+	// Size is the number of CLI processes kept running. Defaults to DefaultPoolSize.
+	Size int
+
+	// MaxTurns is the number of prompts a process answers before it is
+	// replaced. The default of 1 gives every prompt a fresh conversation;
+	// higher values reuse a process, and its conversation history, across
+	// prompts.
+	MaxTurns int
+
+	// MaxAge replaces processes that have been running longer, once they are
+	// idle. Zero keeps them until MaxTurns is reached.
+	MaxAge time.Duration
+
+	// HealthCheckInterval is how often idle processes are checked for exits
+	// and MaxAge. Defaults to DefaultPoolHealthCheckInterval.
+	HealthCheckInterval time.Duration
+}
+
+// PoolStats reports the processes of a Pool.
+type PoolStats struct {
+	// Idle processes are ready to take a prompt.
+	Idle int
+	// Leased processes are answering a prompt.
+	Leased int
+	// Starting processes are being spawned.
+	Starting int
+}
+
+// Pool keeps interactive CLI processes running for one option set, so that
+// prompts skip CLI discovery, process startup and the control protocol
+// handshake. Each prompt leases an idle process, is sent over its stdin, and
+// the process is returned to the pool or replaced once the ResultMessage
+// arrives. A Pool is safe for concurrent use.
+//
+// Example:
+//
+//	pool, err := claude.NewPool(claude.PoolOptions{Size: 4}, claude.WithModel("sonnet"))
+//	if err != nil {
+//	    return err
+//	}
+//	defer pool.Close()
+//
+//	turn, err := pool.Query(ctx, "What is 2+2?")
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Println(turn.Text())
+type Pool struct {
+	config    PoolOptions
+	options   *ClientOptions
+	transport *subprocess.TransportConfig
+	logger    *slog.Logger
+
+	ctx    context.Context // ends with Close; the processes run under it
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	idle     []*pooledProcess
+	leased   int
+	starting int
+	spawnErr error         // last failed spawn, reported to waiting callers
+	changed  chan struct{} // closed and replaced whenever the pool changes
+	closed   bool
+}
+
+// pooledProcess is one interactive transport of a Pool.
+type pooledProcess struct {
+	transport *subprocess.Transport
+	started   time.Time
+	turns     int
+}
+
+// NewPool validates the options, discovers the CLI once and starts spawning
+// config.Size processes in the background.
+func NewPool(config PoolOptions, opts ...ClientOption) (*Pool, error) {
+	options := DefaultClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	if config.Size <= 0 {
+		config.Size = DefaultPoolSize
+	}
+	if config.MaxTurns <= 0 {
+		config.MaxTurns = 1
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = DefaultPoolHealthCheckInterval
+	}
+
+	// Every process of the pool runs the CLI found here, unless a remote
+	// launcher runs the CLI of another host
+	transport := interactiveConfig(options)
+	remote, _ := options.Launcher.(subprocess.RemoteLauncher)
+	if transport.CLIPath == "" && (remote == nil || !remote.Remote()) {
+		result, err := cli.DiscoverCLI("", options.CLICommand)
+		if err != nil {
+			return nil, fmt.Errorf("discover CLI: %w", err)
+		}
+		transport.CLIPath = result.Path
+	}
+
+	p := &Pool{
+		config:    config,
+		options:   options,
+		transport: transport,
+		logger:    transport.Logger,
+		changed:   make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	p.mu.Lock()
+	p.fillLocked()
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.checkHealth()
+	return p, nil
+}
+
+// Query sends prompt to a pooled process and waits for the turn to complete.
+// A turn that ends with an error result is returned without an error; check
+// Turn.IsError. On failure the partial turn is returned as well.
+func (p *Pool) Query(ctx context.Context, prompt string) (*Turn, error) {
+	msgChan, errChan := p.QueryStream(ctx, prompt)
+	return collectTurn(ctx, msgChan, errChan)
+}
+
+// QueryStream sends prompt to a pooled process and streams the messages of the
+// turn. It waits for an idle process until ctx ends. Both channels are closed
+// after the ResultMessage has been delivered; errors reported before it do not
+// end the turn. Callers must drain the channels or cancel ctx; the process
+// stays leased until its turn has been read to the end. A process whose turn
+// fails is replaced.
+func (p *Pool) QueryStream(ctx context.Context, prompt string) (<-chan Message, <-chan error) {
+	proc, err := p.acquire(ctx)
+	if err != nil {
+		return errorChannels(err)
+	}
+
+	src, srcErr := proc.transport.ReceiveMessages(ctx)
+	if err := proc.transport.SendMessage(ctx, prompt); err != nil {
+		p.release(proc, false)
+		return errorChannels(fmt.Errorf("send message: %w", err))
+	}
+
+	var sawResult bool
+	track := func(msg Message) {
+		if _, ok := msg.(*ResultMessage); ok {
+			sawResult = true
+		}
+	}
+	return streamTurn(ctx, p.options.BufferSize, src, srcErr, track, interruptTurn(ctx, proc.transport), func() {
+		p.release(proc, sawResult)
+	})
+}
+
+// Stats reports the current processes of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{Idle: len(p.idle), Leased: p.leased, Starting: p.starting}
+}
+
+// Close stops every process of the pool. Leased processes are stopped as
+// well, which ends their turns with an error.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.notifyLocked()
+	p.mu.Unlock()
+
+	p.cancel()
+	for _, proc := range idle {
+		_ = proc.transport.Close()
+	}
+	p.wg.Wait()
+	return nil
+}
+
+// acquire leases an idle, healthy process, waiting until one is ready, a
+// spawn fails or ctx ends.
+func (p *Pool) acquire(ctx context.Context) (*pooledProcess, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		for len(p.idle) > 0 {
+			proc := p.idle[len(p.idle)-1]
+			p.idle = p.idle[:len(p.idle)-1]
+			if p.healthy(proc, time.Now()) {
+				p.leased++
+				p.wg.Add(1)
+				p.mu.Unlock()
+				return proc, nil
+			}
+			p.retireLocked(proc)
+			p.fillLocked()
+		}
+		if err := p.spawnErr; err != nil && p.starting == 0 {
+			p.spawnErr = nil
+			p.fillLocked()
+			p.mu.Unlock()
+			return nil, fmt.Errorf("start pooled CLI: %w", err)
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release ends the lease of proc. A process that answered its turn is
+// returned to the pool unless it has used up MaxTurns or MaxAge; any other
+// process is replaced.
+func (p *Pool) release(proc *pooledProcess, ok bool) {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.leased--
+	proc.turns++
+	if ok && !p.closed && proc.turns < p.config.MaxTurns && p.healthy(proc, time.Now()) {
+		p.idle = append(p.idle, proc)
+		p.notifyLocked()
+		return
+	}
+	p.retireLocked(proc)
+	p.fillLocked()
+}
+
+// healthy reports whether proc may take another prompt at now.
+func (p *Pool) healthy(proc *pooledProcess, now time.Time) bool {
+	if !proc.transport.IsConnected() {
+		return false
+	}
+	return p.config.MaxAge <= 0 || now.Sub(proc.started) < p.config.MaxAge
+}
+
+// retireLocked stops proc in the background. The caller must hold p.mu.
+func (p *Pool) retireLocked(proc *pooledProcess) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		_ = proc.transport.Close()
+	}()
+}
+
+// fillLocked spawns processes until the pool has Size of them.
+// The caller must hold p.mu.
+func (p *Pool) fillLocked() {
+	if p.closed {
+		return
+	}
+	for n := len(p.idle) + p.leased + p.starting; n < p.config.Size; n++ {
+		p.starting++
+		p.wg.Add(1)
+		go p.spawn()
+	}
+}
+
+// spawn starts one interactive process and adds it to the idle processes.
+func (p *Pool) spawn() {
+	defer p.wg.Done()
+
+	transport, err := subprocess.NewTransport(p.spawnConfig())
+	if err == nil {
+		err = transport.Connect(p.ctx)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.starting--
+	switch {
+	case err != nil:
+		p.logger.Warn("pooled CLI failed to start", "error", err)
+		p.spawnErr = err
+	case p.closed:
+		p.retireLocked(&pooledProcess{transport: transport})
+	default:
+		p.idle = append(p.idle, &pooledProcess{transport: transport, started: time.Now()})
+	}
+	p.notifyLocked()
+}
+
+// spawnConfig returns a copy of the pool's transport configuration for one
+// spawn. NewTransport fills in defaults, so concurrent spawns must not share
+// the configuration, nor the maps and slices it holds.
+func (p *Pool) spawnConfig() *subprocess.TransportConfig {
+	cfg := *p.transport
+	cfg.CustomArgs = slices.Clone(cfg.CustomArgs)
+	cfg.Env = maps.Clone(cfg.Env)
+	cfg.McpServers = maps.Clone(cfg.McpServers)
+	cfg.SdkMcpServers = maps.Clone(cfg.SdkMcpServers)
+	if cfg.ProtocolHooks != nil {
+		hooks := make(map[shared.HookEvent][]subprocess.ProtocolHookMatcher, len(cfg.ProtocolHooks))
+		for event, matchers := range cfg.ProtocolHooks {
+			hooks[event] = slices.Clone(matchers)
+		}
+		cfg.ProtocolHooks = hooks
+	}
+	cfg.CLIOptions.ContextFiles = slices.Clone(cfg.CLIOptions.ContextFiles)
+	cfg.CLIOptions.Agents = maps.Clone(cfg.CLIOptions.Agents)
+	cfg.CLIOptions.SettingSources = slices.Clone(cfg.CLIOptions.SettingSources)
+	return &cfg
+}
+
+// checkHealth periodically replaces idle processes that exited or outlived
+// MaxAge, and respawns processes that failed to start.
+func (p *Pool) checkHealth() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			healthy := p.idle[:0]
+			for _, proc := range p.idle {
+				if p.healthy(proc, now) {
+					healthy = append(healthy, proc)
+				} else {
+					p.retireLocked(proc)
+				}
+			}
+			clear(p.idle[len(healthy):])
+			p.idle = healthy
+			p.fillLocked()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// notifyLocked wakes the callers waiting in acquire. The caller must hold p.mu.
+func (p *Pool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
@@ -0,0 +1,165 @@
+package claude
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePoolCLI writes a fake interactive CLI that answers every user message
+// with a result whose session ID is its process ID.
+func writePoolCLI(t *testing.T) string {
+	t.Helper()
+	return writePoolScript(t, "")
+}
+
+// writePoolScript writes the fake CLI of writePoolCLI, running extra before
+// each answer.
+func writePoolScript(t *testing.T, extra string) string {
+	t.Helper()
+
+	script := `#!/bin/sh
+while read line; do
+` + extra + `
+	echo '{"type":"assistant","message":{"content":[{"type":"text","text":"pong"}]}}'
+	echo '{"type":"result","subtype":"success","session_id":"'$$'"}'
+done
+`
+	path := filepath.Join(t.TempDir(), "claude")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+// poolSessions sends n prompts one after another and returns their session IDs.
+func poolSessions(t *testing.T, pool *Pool, n int) []string {
+	t.Helper()
+
+	var sessions []string
+	for range n {
+		turn, err := pool.Query(context.Background(), "ping")
+		require.NoError(t, err)
+		assert.Equal(t, "pong", turn.Text())
+		sessions = append(sessions, turn.SessionID())
+	}
+	return sessions
+}
+
+func TestPoolReplacesProcessAfterTurn(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 1}, WithCLIPath(writePoolCLI(t)))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	sessions := poolSessions(t, pool, 3)
+	assert.NotEqual(t, sessions[0], sessions[1])
+	assert.NotEqual(t, sessions[1], sessions[2])
+}
+
+func TestPoolReusesProcessUpToMaxTurns(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 1, MaxTurns: 2}, WithCLIPath(writePoolCLI(t)))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	sessions := poolSessions(t, pool, 3)
+	assert.Equal(t, sessions[0], sessions[1])
+	assert.NotEqual(t, sessions[1], sessions[2])
+}
+
+func TestPoolKeepsProcessAfterStderr(t *testing.T) {
+	t.Parallel()
+
+	cli := writePoolScript(t, "\techo 'working' >&2")
+	pool, err := NewPool(PoolOptions{Size: 1, MaxTurns: 2}, WithCLIPath(cli))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	sessions := poolSessions(t, pool, 2)
+	assert.Equal(t, sessions[0], sessions[1])
+}
+
+func TestPoolEvictsProcessesPastMaxAge(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{
+		Size:                1,
+		MaxTurns:            10,
+		MaxAge:              50 * time.Millisecond,
+		HealthCheckInterval: 10 * time.Millisecond,
+	}, WithCLIPath(writePoolCLI(t)))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	first := poolSessions(t, pool, 1)
+	time.Sleep(150 * time.Millisecond)
+	assert.NotEqual(t, first, poolSessions(t, pool, 1))
+	assert.Equal(t, PoolStats{Idle: 1}, pool.Stats())
+}
+
+func TestPoolServesConcurrentQueries(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 2}, WithCLIPath(writePoolCLI(t)))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	errs := make(chan error, 6)
+	for range cap(errs) {
+		go func() {
+			_, err := pool.Query(context.Background(), "ping")
+			errs <- err
+		}()
+	}
+	for range cap(errs) {
+		assert.NoError(t, <-errs)
+	}
+}
+
+// TestPoolSpawnsConcurrently starts several processes at once from a
+// configuration the transport fills with defaults; run with -race.
+func TestPoolSpawnsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 4}, WithCLIPath(writePoolCLI(t)), WithCLICommand(""))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	require.Eventually(t, func() bool { return pool.Stats().Idle == 4 }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, pool.transport.CLICommand)
+}
+
+func TestPoolReportsSpawnFailure(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 1}, WithCLIPath(filepath.Join(t.TempDir(), "missing")))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = pool.Query(ctx, "ping")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "start pooled CLI")
+}
+
+func TestPoolClose(t *testing.T) {
+	t.Parallel()
+
+	pool, err := NewPool(PoolOptions{Size: 2}, WithCLIPath(writePoolCLI(t)))
+	require.NoError(t, err)
+	poolSessions(t, pool, 1)
+
+	require.NoError(t, pool.Close())
+	assert.Equal(t, PoolStats{}, pool.Stats())
+
+	_, err = pool.Query(context.Background(), "ping")
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	require.NoError(t, pool.Close())
+}
@@ -45,6 +45,7 @@ type queryIterator struct {
 	transport *subprocess.Transport
 	msgChan   <-chan shared.Message
 	errChan   <-chan error
+	stop      func() // ends a retrying query stream, if any
 	closed    bool
 	lastErr   error
 }
@@ -103,6 +104,9 @@ func (q *queryIterator) Close() error {
 	}
 	q.closed = true
 
+	if q.stop != nil {
+		q.stop()
+	}
 	if q.transport != nil {
 		return q.transport.Close()
 	}
@@ -145,33 +149,54 @@ func Query(ctx context.Context, prompt string, opts ...ClientOption) (MessageIte
 
 	// Create transport config from client options
 	transportConfig := &subprocess.TransportConfig{
-		CLIPath:      options.CLIPath,
-		CLICommand:   options.CLICommand,
-		Model:        options.Model,
-		Timeout:      parseTimeout(options.Timeout),
-		SystemPrompt: "",
-		CustomArgs:   options.CustomArgs,
-		Env:          options.Env,
+		CLIPath:        options.CLIPath,
+		CLICommand:     options.CLICommand,
+		Model:          options.Model,
+		Timeout:        parseTimeout(options.Timeout),
+		SystemPrompt:   "",
+		CustomArgs:     options.CustomArgs,
+		Env:            options.Env,
+		EnvPolicy:      options.EnvPolicy,
+		Cwd:            options.Cwd,
+		StderrCallback: options.StderrCallback,
+		DebugWriter:    options.DebugWriter,
+		CLIOptions:     cliOptions(options),
+		RetryPolicy:    options.RetryPolicy,
+		CircuitBreaker: options.CircuitBreaker,
+		Shutdown:       options.Shutdown,
+		Buffer:         options.BufferOptions,
+		Deadlines:      options.Deadlines,
+		ResourceLimits: options.ResourceLimits,
+		Launcher:       options.Launcher,
+		Logger:         shared.NewLogger(options.Slog, options.Logger),
 	}
 
-	// Create one-shot transport
-	transport, err := subprocess.NewTransportWithPrompt(transportConfig, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("create transport: %w", err)
+	start := func(ctx context.Context) (*subprocess.Transport, error) {
+		// Create one-shot transport
+		transport, err := subprocess.NewTransportWithPrompt(transportConfig, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("create transport: %w", err)
+		}
+
+		// Connect to start the subprocess
+		if err := transport.Connect(ctx); err != nil {
+			return nil, fmt.Errorf("connect: %w", err)
+		}
+		return transport, nil
 	}
 
-	// Connect to start the subprocess
-	if err := transport.Connect(ctx); err != nil {
-		return nil, fmt.Errorf("connect: %w", err)
+	transport, err := start(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get message channels
-	msgChan, errChan := transport.ReceiveMessages(ctx)
+	// Stream the messages, retrying rate-limited or overloaded attempts
+	msgChan, errChan, stop := streamWithRetry(ctx, retryPolicy(options), options.BufferSize, transport, start)
 
 	return &queryIterator{
-		transport: transport,
-		msgChan:   msgChan,
-		errChan:   errChan,
+		msgChan: msgChan,
+		errChan: errChan,
+		stop:    stop,
 	}, nil
 }
 
@@ -2,22 +2,42 @@
 package claude
 
 import (
+	"github.com/dotcommander/agent-sdk-go/claude/mcp"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
 // extractSdkMcpServers extracts SDK MCP server instances from server configurations.
 // This is used to separate SDK server instances (which cannot be JSON serialized)
-// from the configuration that gets passed to the CLI.
-func extractSdkMcpServers(servers map[string]shared.McpServerConfig) map[string]any {
+// from the configuration that gets passed to the CLI. Both value and pointer
+// forms of shared.McpSdkServerConfig are accepted, holding either an
+// SdkMcpServer or an mcp.SdkMcpServer.
+func extractSdkMcpServers(servers map[string]shared.McpServerConfig) map[string]*mcp.SdkMcpServer {
 	if servers == nil {
 		return nil
 	}
 
-	sdkMcpServers := make(map[string]any)
+	sdkMcpServers := make(map[string]*mcp.SdkMcpServer)
 	for name, config := range servers {
-		if sdkConfig, ok := config.(shared.McpSdkServerConfig); ok {
-			// Store the instance for runtime handling
-			sdkMcpServers[name] = sdkConfig.Instance
+		var instance any
+		switch sdkConfig := config.(type) {
+		case shared.McpSdkServerConfig:
+			instance = sdkConfig.Instance
+		case *shared.McpSdkServerConfig:
+			if sdkConfig != nil {
+				instance = sdkConfig.Instance
+			}
+		}
+
+		// Store the instance for runtime handling
+		switch server := instance.(type) {
+		case *mcp.SdkMcpServer:
+			if server != nil {
+				sdkMcpServers[name] = server
+			}
+		case *SdkMcpServer:
+			if server != nil {
+				sdkMcpServers[name] = server.server
+			}
 		}
 	}
 
@@ -3,6 +3,7 @@ package claude
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
@@ -204,3 +205,22 @@ func TestMessageIteratorInterface(t *testing.T) {
 	// Verify queryIterator implements MessageIterator
 	var _ MessageIterator = (*queryIterator)(nil)
 }
+
+// TestCollectTextReadsBufferedMessages tests that a query's text includes
+// messages still buffered when the error channel has closed.
+func TestCollectTextReadsBufferedMessages(t *testing.T) {
+	t.Parallel()
+
+	const lines = 100
+	msgChan := make(chan Message, lines)
+	for i := 0; i < lines; i++ {
+		msgChan <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "x"}}}
+	}
+	close(msgChan)
+	errChan := make(chan error)
+	close(errChan)
+
+	text, err := collectText(context.Background(), msgChan, errChan)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", lines), text)
+}
@@ -0,0 +1,383 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+)
+
+// Default reconnection settings of a Launcher.
+const (
+	DefaultReconnectAttempts = 5
+	DefaultReconnectBackoff  = 500 * time.Millisecond
+)
+
+// resumeTimeout bounds one attempt to resume a session.
+const resumeTimeout = 5 * time.Second
+
+// ErrConnectionLost is reported by a remote process whose relay connection
+// dropped and could not be resumed.
+var ErrConnectionLost = errors.New("relay connection lost")
+
+// Launcher starts the CLI through a Relay. It implements
+// subprocess.RemoteLauncher, so the transport neither looks for the CLI nor
+// checks the working directory on this host; the relay runs its own CLI in
+// its own directory with the transport's arguments.
+type Launcher struct {
+	// Addr is the relay address: tcp://host:port, tls://host:port,
+	// ws://host:port/path or wss://host:port/path.
+	Addr string
+
+	// Token authenticates the launcher to the relay.
+	Token string
+
+	// TLSConfig configures tls:// and wss:// connections. Nil uses the defaults.
+	TLSConfig *tls.Config
+
+	// ForwardEnv names the variables of the transport's environment that are
+	// passed to the remote CLI, on top of the relay's environment. A trailing
+	// * matches a prefix. None are forwarded by default.
+	ForwardEnv []string
+
+	// ReconnectAttempts bounds the attempts to resume a dropped connection.
+	// Defaults to DefaultReconnectAttempts; negative disables reconnection.
+	ReconnectAttempts int
+
+	// ReconnectBackoff is the delay before the first attempt, growing
+	// linearly. Defaults to DefaultReconnectBackoff.
+	ReconnectBackoff time.Duration
+
+	// ReplayLines is the number of sent lines kept for resuming.
+	// Defaults to DefaultReplayLines.
+	ReplayLines int
+}
+
+// Remote reports that the CLI runs on another host.
+func (l *Launcher) Remote() bool { return true }
+
+// Launch asks the relay to start the CLI and returns its bridged process.
+func (l *Launcher) Launch(ctx context.Context, spec subprocess.LaunchSpec) (subprocess.Process, error) {
+	conn, err := dial(ctx, l.Addr, l.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("dial relay: %w", err)
+	}
+
+	reply, err := l.request(ctx, conn, message{
+		Op:    opLaunch,
+		Token: l.Token,
+		Args:  spec.Args,
+		Env:   l.forwardedEnv(spec.Env),
+		Stdin: spec.Stdin,
+	}, opLaunched)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("launch CLI on relay: %w", err)
+	}
+
+	replayLines := l.ReplayLines
+	if replayLines <= 0 {
+		replayLines = DefaultReplayLines
+	}
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	p := &process{
+		launcher: l,
+		session:  reply.Session,
+		pid:      reply.PID,
+		conn:     conn,
+		out:      replayBuffer{max: replayLines},
+		stdoutR:  stdoutR,
+		stdoutW:  stdoutW,
+		stderrR:  stderrR,
+		stderrW:  stderrW,
+		done:     make(chan struct{}),
+	}
+	if spec.Stdin {
+		p.stdin = &stdinWriter{p: p}
+	}
+	go p.run()
+	return p, nil
+}
+
+// request sends req on conn and reads the relay's reply, which must have op want.
+// ctx bounds the exchange.
+func (l *Launcher) request(ctx context.Context, conn lineConn, req message, want string) (message, error) {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := conn.WriteLine(req.encode()); err != nil {
+		return message{}, err
+	}
+	line, err := conn.ReadLine()
+	if err != nil {
+		if ctx.Err() != nil {
+			return message{}, ctx.Err()
+		}
+		return message{}, err
+	}
+	reply, ok := decodeRelay(line)
+	switch {
+	case !ok:
+		return message{}, fmt.Errorf("unexpected reply %q", line)
+	case reply.Op == opError:
+		return message{}, errors.New(reply.Error)
+	case reply.Op != want:
+		return message{}, fmt.Errorf("unexpected %s reply", reply.Op)
+	}
+	return reply, nil
+}
+
+// forwardedEnv returns the entries of env named by ForwardEnv.
+func (l *Launcher) forwardedEnv(env []string) []string {
+	var forwarded []string
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		for _, pattern := range l.ForwardEnv {
+			prefix, isPrefix := strings.CutSuffix(pattern, "*")
+			if name == pattern || (isPrefix && strings.HasPrefix(name, prefix)) {
+				forwarded = append(forwarded, e)
+				break
+			}
+		}
+	}
+	return forwarded
+}
+
+// process is a CLI process running behind a relay. Lines written to stdin,
+// signals and the closing of stdin are sent as lines and kept until they are
+// no longer needed for a resume; lines from the relay are demultiplexed into
+// stdout, stderr and the exit status.
+type process struct {
+	launcher *Launcher
+	session  string
+	pid      int
+	stdin    *stdinWriter
+
+	stdoutR, stderrR *io.PipeReader
+	stdoutW, stderrW *io.PipeWriter
+
+	mu       sync.Mutex
+	conn     lineConn // nil while reconnecting
+	out      replayBuffer
+	received int64 // lines received from the relay
+	exited   bool
+	state    subprocess.ExitState
+	err      error
+	done     chan struct{}
+}
+
+func (p *process) Pid() int { return p.pid }
+
+func (p *process) Stdin() io.WriteCloser {
+	if p.stdin == nil {
+		return nil
+	}
+	return p.stdin
+}
+
+func (p *process) Stdout() io.ReadCloser { return p.stdoutR }
+func (p *process) Stderr() io.ReadCloser { return p.stderrR }
+
+// Signal asks the relay to signal the CLI and the processes it spawned.
+func (p *process) Signal(sig os.Signal) error {
+	return p.send(message{Op: opSignal, Signal: signalName(sig.String())}.encode())
+}
+
+// Wait waits for the relay to report the exit of the CLI, or for the
+// connection to be lost for good.
+func (p *process) Wait() (subprocess.ExitState, error) {
+	<-p.done
+	return p.state, p.err
+}
+
+// send queues line for the relay and writes it if connected. A failed write
+// closes the connection; the reader then resumes it and the line is resent.
+func (p *process) send(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.exited {
+		return os.ErrProcessDone
+	}
+	p.out.add(line)
+	if p.conn != nil {
+		if err := p.conn.WriteLine(line); err != nil {
+			_ = p.conn.Close()
+		}
+	}
+	return nil
+}
+
+// run reads the lines of the relay until the CLI exits or the connection
+// is lost for good.
+func (p *process) run() {
+	for {
+		p.mu.Lock()
+		conn := p.conn
+		p.mu.Unlock()
+
+		line, err := conn.ReadLine()
+		if err != nil {
+			if err := p.reconnect(conn); err != nil {
+				p.finish(subprocess.ExitState{Code: -1}, fmt.Errorf("%w: %w", ErrConnectionLost, err))
+				return
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		p.received++
+		p.mu.Unlock()
+
+		msg, isRelay := decodeRelay(line)
+		switch {
+		case !isRelay:
+			_, _ = p.stdoutW.Write(append(line, '\n'))
+		case msg.Op == opStderr:
+			_, _ = p.stderrW.Write([]byte(msg.Line + "\n"))
+		case msg.Op == opExit:
+			state := subprocess.ExitState{Code: msg.Code}
+			if msg.Signal != "" {
+				state.Signal = remoteSignal(msg.Signal)
+			}
+			var err error
+			if msg.Error != "" {
+				err = errors.New(msg.Error)
+			}
+			p.finish(state, err)
+			return
+		}
+	}
+}
+
+// reconnect resumes the session on a new connection after old failed.
+func (p *process) reconnect(old lineConn) error {
+	_ = old.Close()
+	p.mu.Lock()
+	p.conn = nil
+	p.mu.Unlock()
+
+	attempts := p.launcher.ReconnectAttempts
+	if attempts == 0 {
+		attempts = DefaultReconnectAttempts
+	}
+	backoff := p.launcher.ReconnectBackoff
+	if backoff <= 0 {
+		backoff = DefaultReconnectBackoff
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		time.Sleep(backoff * time.Duration(attempt))
+		if err = p.resume(); err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("reconnection disabled")
+	}
+	return err
+}
+
+// resume reattaches to the session and resends the lines the relay missed.
+func (p *process) resume() error {
+	ctx, cancel := context.WithTimeout(context.Background(), resumeTimeout)
+	defer cancel()
+
+	conn, err := dial(ctx, p.launcher.Addr, p.launcher.TLSConfig)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reply, err := p.launcher.request(ctx, conn, message{
+		Op:       opResume,
+		Token:    p.launcher.Token,
+		Session:  p.session,
+		Received: p.received,
+	}, opResumed)
+	if err == nil {
+		var missed [][]byte
+		if missed, err = p.out.since(reply.Received); err == nil {
+			for _, line := range missed {
+				if err = conn.WriteLine(line); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	p.conn = conn
+	return nil
+}
+
+// finish records how the CLI ended and closes its output.
+func (p *process) finish(state subprocess.ExitState, err error) {
+	p.mu.Lock()
+	p.exited = true
+	p.state, p.err = state, err
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+	p.mu.Unlock()
+
+	_ = p.stdoutW.Close()
+	_ = p.stderrW.Close()
+	close(p.done)
+}
+
+// stdinWriter sends the lines written to the CLI's stdin to the relay.
+type stdinWriter struct {
+	p       *process
+	mu      sync.Mutex
+	partial []byte
+}
+
+// Write sends every complete line of data and keeps the rest for later.
+func (w *stdinWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, data...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		line := bytes.Clone(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		if err := w.p.send(line); err != nil {
+			return 0, io.ErrClosedPipe
+		}
+	}
+}
+
+// Close closes the CLI's stdin on the relay.
+func (w *stdinWriter) Close() error {
+	err := w.p.send(message{Op: opCloseStdin}.encode())
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// remoteSignal is a signal reported by a relay.
+type remoteSignal string
+
+func (s remoteSignal) String() string { return string(s) }
+func (s remoteSignal) Signal()        {}
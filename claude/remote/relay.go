@@ -0,0 +1,552 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+)
+
+// DefaultReconnectGrace is how long a relay keeps a detached session.
+const DefaultReconnectGrace = 30 * time.Second
+
+// DefaultHandshakeTimeout is how long a relay waits for the first request of
+// a connection.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// DefaultMaxMessageSize caps the lines a relay reads from an authenticated
+// launcher.
+const DefaultMaxMessageSize = 64 << 20
+
+// maxRequestSize caps the first line of a connection, read before the
+// launcher is authenticated.
+const maxRequestSize = 64 << 10
+
+// ErrRelayClosed is returned by Relay.Serve after Close.
+var ErrRelayClosed = errors.New("relay closed")
+
+// Relay spawns the CLI for the launchers that connect to it and bridges its
+// stdio over their connection. It serves newline-delimited TCP connections
+// through Serve and WebSocket connections as an http.Handler.
+//
+// A session whose connection drops is kept for ReconnectGrace, with its CLI
+// running and its output buffered, so that the launcher can resume it.
+type Relay struct {
+	// CLIPath is the CLI executable run for every session.
+	CLIPath string
+
+	// Dir is the working directory of the CLI. Empty uses the relay's.
+	Dir string
+
+	// Token must be presented by launchers. Empty accepts every launcher.
+	Token string
+
+	// Launcher starts the CLI. Defaults to subprocess.ExecLauncher.
+	Launcher subprocess.Launcher
+
+	// ReconnectGrace is how long a detached session waits for its launcher
+	// before its CLI is killed. Defaults to DefaultReconnectGrace.
+	ReconnectGrace time.Duration
+
+	// ReplayLines is the number of output lines kept per session for
+	// resuming. Defaults to DefaultReplayLines.
+	ReplayLines int
+
+	// HandshakeTimeout bounds the wait for the first request of a
+	// connection. Defaults to DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+
+	// MaxMessageSize caps the lines read from an authenticated launcher;
+	// a longer line ends the connection. Defaults to DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// Logger receives session events. Nil discards them.
+	Logger *slog.Logger
+
+	once      sync.Once
+	log       *slog.Logger
+	mu        sync.Mutex
+	sessions  map[string]*session
+	listeners map[net.Listener]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// init prepares the relay on first use.
+func (r *Relay) init() {
+	r.once.Do(func() {
+		r.log = shared.NewLogger(r.Logger, nil)
+		r.sessions = make(map[string]*session)
+		r.listeners = make(map[net.Listener]struct{})
+	})
+}
+
+// Serve accepts launcher connections on ln until Close, which makes it
+// return ErrRelayClosed.
+func (r *Relay) Serve(ln net.Listener) error {
+	r.init()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRelayClosed
+	}
+	r.listeners[ln] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.listeners, ln)
+		r.mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return ErrRelayClosed
+			}
+			return err
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.handle(wire.NewLineConn(conn))
+		}()
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket and serves the launcher on it.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.init()
+
+	conn, err := upgradeWebSocket(w, req)
+	if err != nil {
+		r.log.Debug("relay upgrade failed", "remote", req.RemoteAddr, "error", err)
+		return
+	}
+	r.wg.Add(1)
+	defer r.wg.Done()
+	r.handle(conn)
+}
+
+// Close stops accepting connections, kills the CLI of every session and
+// waits for the sessions to end.
+func (r *Relay) Close() error {
+	r.init()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for ln := range r.listeners {
+		_ = ln.Close()
+	}
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.mu.Unlock()
+
+	for _, s := range sessions {
+		s.stop()
+	}
+	r.wg.Wait()
+	return nil
+}
+
+// handle authenticates the first message of conn and launches or resumes
+// the session it names. Until the launcher is authenticated, the request is
+// read with a deadline and a small size limit.
+func (r *Relay) handle(conn lineConn) {
+	timeout := r.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	conn.SetReadLimit(maxRequestSize)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	line, err := conn.ReadLine()
+	if err != nil {
+		r.log.Debug("relay dropped launcher", "error", err)
+		_ = conn.Close()
+		return
+	}
+	msg, ok := decodeRelay(line)
+	switch {
+	case !ok:
+		r.reject(conn, "expected a relay request")
+		return
+	case subtle.ConstantTimeCompare([]byte(msg.Token), []byte(r.Token)) != 1:
+		r.log.Warn("relay rejected launcher", "reason", "invalid token")
+		r.reject(conn, "invalid token")
+		return
+	}
+
+	maxSize := r.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	conn.SetReadLimit(maxSize)
+	_ = conn.SetReadDeadline(time.Time{})
+
+	switch msg.Op {
+	case opLaunch:
+		r.launch(conn, msg)
+	case opResume:
+		r.resume(conn, msg)
+	default:
+		r.reject(conn, "unexpected %s request", msg.Op)
+	}
+}
+
+// reject answers a request with an error and closes conn.
+func (r *Relay) reject(conn lineConn, format string, args ...any) {
+	_ = conn.WriteLine(errorf(format, args...))
+	_ = conn.Close()
+}
+
+// launch starts the CLI for a new session and serves it on conn.
+func (r *Relay) launch(conn lineConn, msg message) {
+	launcher := r.Launcher
+	if launcher == nil {
+		launcher = subprocess.ExecLauncher{}
+	}
+	proc, err := launcher.Launch(context.Background(), subprocess.LaunchSpec{
+		Path:  r.CLIPath,
+		Args:  msg.Args,
+		Env:   append(os.Environ(), msg.Env...),
+		Dir:   r.Dir,
+		Stdin: msg.Stdin,
+	})
+	if err != nil {
+		r.log.Warn("relay failed to launch CLI", "error", err)
+		r.reject(conn, "launch CLI: %v", err)
+		return
+	}
+
+	replayLines := r.ReplayLines
+	if replayLines <= 0 {
+		replayLines = DefaultReplayLines
+	}
+	s := &session{
+		relay: r,
+		id:    newSessionID(),
+		proc:  proc,
+		stdin: proc.Stdin(),
+		out:   replayBuffer{max: replayLines},
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = proc.Signal(os.Kill)
+		_, _ = proc.Wait()
+		r.reject(conn, "relay closed")
+		return
+	}
+	r.sessions[s.id] = s
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	r.log.Info("relay session started", "session", s.id, "pid", proc.Pid())
+
+	// The launched reply goes out before any output of the CLI
+	s.mu.Lock()
+	err = conn.WriteLine(message{Op: opLaunched, Session: s.id, PID: proc.Pid()}.encode())
+	if err == nil {
+		s.conn = conn
+	}
+	s.mu.Unlock()
+
+	go func() {
+		defer r.wg.Done()
+		s.pump()
+	}()
+	if err != nil {
+		s.stop()
+		return
+	}
+	s.serve(conn)
+}
+
+// resume reattaches conn to a detached or dropped session.
+func (r *Relay) resume(conn lineConn, msg message) {
+	r.mu.Lock()
+	s := r.sessions[msg.Session]
+	r.mu.Unlock()
+	if s == nil {
+		r.reject(conn, "unknown session %q", msg.Session)
+		return
+	}
+	if err := s.attach(conn, msg.Received); err != nil {
+		r.log.Warn("relay failed to resume session", "session", s.id, "error", err)
+		r.reject(conn, "resume session: %v", err)
+		return
+	}
+	r.log.Info("relay session resumed", "session", s.id)
+	s.serve(conn)
+}
+
+// remove forgets s.
+func (r *Relay) remove(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, s.id)
+}
+
+// newSessionID returns a random session ID.
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// session is a CLI process of a relay and the launcher connection it is
+// bridged to, if any.
+type session struct {
+	relay *Relay
+	id    string
+	proc  subprocess.Process
+	stdin io.WriteCloser
+
+	// inMu orders the lines of the launcher across reconnects
+	inMu sync.Mutex
+
+	mu       sync.Mutex
+	conn     lineConn // nil while detached
+	out      replayBuffer
+	received int64 // lines received from the launcher
+	exited   bool
+	grace    *time.Timer
+}
+
+// pump sends the output of the CLI, then its exit status.
+func (s *session) pump() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		readLines(s.proc.Stdout(), s.send)
+	}()
+	go func() {
+		defer wg.Done()
+		readLines(s.proc.Stderr(), func(line []byte) {
+			s.send(message{Op: opStderr, Line: string(line)}.encode())
+		})
+	}()
+	wg.Wait()
+
+	state, err := s.proc.Wait()
+	exit := message{Op: opExit, Code: state.Code}
+	if state.Signal != nil {
+		exit.Signal = state.Signal.String()
+	}
+	if err != nil {
+		exit.Error = err.Error()
+	}
+	s.relay.log.Info("relay session CLI exited", "session", s.id, "code", state.Code, "signal", exit.Signal)
+	s.send(exit.encode())
+
+	s.mu.Lock()
+	s.exited = true
+	s.mu.Unlock()
+}
+
+// readLines calls fn with every line of r, however long.
+func readLines(r io.Reader, fn func(line []byte)) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = line[:len(line)-1]
+		}
+		if len(line) > 0 {
+			fn(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send queues line for the launcher and writes it if attached. A failed
+// write closes the connection, which detaches the session.
+func (s *session) send(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.out.add(line)
+	if s.conn != nil {
+		if err := s.conn.WriteLine(line); err != nil {
+			_ = s.conn.Close()
+		}
+	}
+}
+
+// serve passes the lines of conn to the CLI until conn fails or is replaced.
+func (s *session) serve(conn lineConn) {
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			s.detach(conn)
+			return
+		}
+		if !s.deliver(conn, line) {
+			return
+		}
+	}
+}
+
+// deliver passes line from conn to the CLI. It reports false if conn was
+// replaced by a resume.
+func (s *session) deliver(conn lineConn, line []byte) bool {
+	s.inMu.Lock()
+	defer s.inMu.Unlock()
+
+	s.mu.Lock()
+	if s.conn != conn {
+		s.mu.Unlock()
+		return false
+	}
+	s.received++
+	s.mu.Unlock()
+
+	msg, isRelay := decodeRelay(line)
+	switch {
+	case !isRelay:
+		if s.stdin != nil {
+			_, _ = s.stdin.Write(append(line, '\n'))
+		}
+	case msg.Op == opCloseStdin:
+		if s.stdin != nil {
+			_ = s.stdin.Close()
+		}
+	case msg.Op == opSignal:
+		_ = s.proc.Signal(parseSignal(msg.Signal))
+	}
+	return true
+}
+
+// attach makes conn the connection of s, in place of the current one,
+// after replaying the output the launcher has not received.
+func (s *session) attach(conn lineConn, received int64) error {
+	s.inMu.Lock()
+	defer s.inMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	missed, err := s.out.since(received)
+	if err != nil {
+		return err
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if s.grace != nil {
+		s.grace.Stop()
+		s.grace = nil
+	}
+
+	if err := conn.WriteLine(message{Op: opResumed, Session: s.id, Received: s.received}.encode()); err != nil {
+		s.startGraceLocked()
+		return err
+	}
+	for _, line := range missed {
+		if err := conn.WriteLine(line); err != nil {
+			s.startGraceLocked()
+			return err
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+// detach drops conn from s, if it is still its connection, and gives the
+// launcher ReconnectGrace to resume the session.
+func (s *session) detach(conn lineConn) {
+	_ = conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != conn {
+		return
+	}
+	s.conn = nil
+	s.relay.log.Info("relay session detached", "session", s.id)
+	s.startGraceLocked()
+}
+
+// startGraceLocked ends the session unless it is resumed in time.
+// The caller must hold s.mu.
+func (s *session) startGraceLocked() {
+	grace := s.relay.ReconnectGrace
+	if grace <= 0 {
+		grace = DefaultReconnectGrace
+	}
+	if s.grace != nil {
+		s.grace.Stop()
+	}
+	s.grace = time.AfterFunc(grace, func() {
+		s.mu.Lock()
+		expired := s.conn == nil
+		s.mu.Unlock()
+		if expired {
+			s.relay.log.Info("relay session expired", "session", s.id)
+			s.stop()
+		}
+	})
+}
+
+// stop kills the CLI, if it is running, closes the connection and forgets
+// the session.
+func (s *session) stop() {
+	s.mu.Lock()
+	exited := s.exited
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if s.grace != nil {
+		s.grace.Stop()
+		s.grace = nil
+	}
+	s.mu.Unlock()
+
+	if !exited {
+		_ = s.proc.Signal(os.Kill)
+	}
+	s.relay.remove(s)
+}
+
+// parseSignal returns the signal with wire name name.
+func parseSignal(name string) os.Signal {
+	switch name {
+	case "interrupt":
+		return os.Interrupt
+	case "kill":
+		return os.Kill
+	default:
+		return syscall.SIGTERM
+	}
+}
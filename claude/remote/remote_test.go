@@ -0,0 +1,415 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "relay-secret"
+
+// echoCLI answers each user message with a result numbered after it, so that
+// a resumed session can be told apart from a new one.
+func echoCLI(_ context.Context, _ subprocess.LaunchSpec, stdin io.Reader, stdout, _ io.Writer) int {
+	scanner := bufio.NewScanner(stdin)
+	for n := 1; scanner.Scan(); n++ {
+		fmt.Fprintf(stdout, `{"type":"result","subtype":"success","session_id":"s%d"}`+"\n", n)
+	}
+	return 0
+}
+
+// droppingListener records the connections it accepts so that a test can
+// drop them.
+type droppingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *droppingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// drop closes every accepted connection.
+func (l *droppingListener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.conns = nil
+}
+
+// startTCPRelay serves relay on a loopback TCP listener and returns its address.
+func startTCPRelay(t *testing.T, relay *Relay) (string, *droppingListener) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dl := &droppingListener{Listener: ln}
+	go func() { _ = relay.Serve(dl) }()
+	t.Cleanup(func() { _ = relay.Close() })
+	return "tcp://" + ln.Addr().String(), dl
+}
+
+// startWebSocketRelay serves relay on a loopback HTTP server and returns its address.
+func startWebSocketRelay(t *testing.T, relay *Relay) string {
+	t.Helper()
+
+	server := httptest.NewServer(relay)
+	t.Cleanup(func() {
+		_ = relay.Close()
+		server.Close()
+	})
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/relay"
+}
+
+// receiveResult reads the next message and returns its session ID.
+func receiveResult(t *testing.T, ch <-chan shared.Message) string {
+	t.Helper()
+
+	select {
+	case msg, ok := <-ch:
+		require.True(t, ok, "message channel closed")
+		result, ok := msg.(*shared.ResultMessage)
+		require.True(t, ok, "got %T", msg)
+		return result.SessionID
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return ""
+	}
+}
+
+func TestRemote_InteractiveSession(t *testing.T) {
+	t.Parallel()
+
+	for _, scheme := range []string{"tcp", "ws"} {
+		t.Run(scheme, func(t *testing.T) {
+			t.Parallel()
+
+			relay := &Relay{CLIPath: "claude", Token: testToken, Launcher: subprocess.FuncLauncher(echoCLI)}
+			var addr string
+			if scheme == "tcp" {
+				addr, _ = startTCPRelay(t, relay)
+			} else {
+				addr = startWebSocketRelay(t, relay)
+			}
+
+			transport, err := subprocess.NewTransport(&subprocess.TransportConfig{
+				// Neither is checked on this host
+				CLIPath:  "/remote/bin/claude",
+				Cwd:      "/remote/work",
+				Launcher: &Launcher{Addr: addr, Token: testToken},
+			})
+			require.NoError(t, err)
+			require.NoError(t, transport.Connect(context.Background()))
+
+			msgChan, _ := transport.ReceiveMessages(context.Background())
+			for _, want := range []string{"s1", "s2"} {
+				require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+				assert.Equal(t, want, receiveResult(t, msgChan))
+			}
+			require.NoError(t, transport.Close())
+
+			status, ok := transport.ExitStatus()
+			require.True(t, ok)
+			assert.Equal(t, subprocess.ShutdownStdinClosed, status.Stage)
+		})
+	}
+}
+
+func TestRemote_OneShotFailure(t *testing.T) {
+	t.Parallel()
+
+	specs := make(chan subprocess.LaunchSpec, 1)
+	relay := &Relay{
+		CLIPath: "/opt/claude",
+		Token:   testToken,
+		Launcher: subprocess.FuncLauncher(func(_ context.Context, spec subprocess.LaunchSpec, _ io.Reader, _, stderr io.Writer) int {
+			specs <- spec
+			fmt.Fprintln(stderr, "Invalid API key")
+			return 1
+		}),
+	}
+	addr, _ := startTCPRelay(t, relay)
+
+	transport, err := subprocess.NewTransportWithPrompt(&subprocess.TransportConfig{
+		Env:            map[string]string{"SDK_TEST_FORWARDED": "yes", "SDK_TEST_LOCAL": "no"},
+		StderrCallback: func(string) {},
+		Launcher:       &Launcher{Addr: addr, Token: testToken, ForwardEnv: []string{"SDK_TEST_F*"}},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	var processErr *shared.ProcessError
+	for msgChan != nil || errChan != nil {
+		select {
+		case _, ok := <-msgChan:
+			if !ok {
+				msgChan = nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+			} else if pe, isProcessErr := shared.AsProcessError(err); isProcessErr {
+				processErr = pe
+			}
+		}
+	}
+
+	require.NotNil(t, processErr)
+	assert.Equal(t, 1, processErr.ExitCode)
+	assert.Equal(t, shared.ExitCauseAuth, processErr.Cause)
+	assert.Equal(t, []string{"Invalid API key"}, processErr.Stderr)
+
+	got := <-specs
+	assert.Equal(t, "/opt/claude", got.Path)
+	assert.False(t, got.Stdin)
+	assert.Contains(t, got.Env, "SDK_TEST_FORWARDED=yes")
+	assert.NotContains(t, got.Env, "SDK_TEST_LOCAL=no")
+}
+
+func TestRemote_ResumesAfterDrop(t *testing.T) {
+	t.Parallel()
+
+	relay := &Relay{CLIPath: "claude", Token: testToken, Launcher: subprocess.FuncLauncher(echoCLI)}
+	addr, ln := startTCPRelay(t, relay)
+
+	transport, err := subprocess.NewTransport(&subprocess.TransportConfig{
+		Launcher: &Launcher{Addr: addr, Token: testToken, ReconnectBackoff: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+	assert.Equal(t, "s1", receiveResult(t, msgChan))
+
+	// Messages sent while the connection is down are replayed on resume,
+	// and answered by the same CLI process
+	ln.drop()
+	for _, want := range []string{"s2", "s3"} {
+		require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+		assert.Equal(t, want, receiveResult(t, msgChan))
+	}
+	assert.True(t, transport.IsConnected())
+}
+
+func TestRemote_DetachedSessionExpires(t *testing.T) {
+	t.Parallel()
+
+	stopped := make(chan struct{})
+	relay := &Relay{
+		CLIPath:        "claude",
+		Token:          testToken,
+		ReconnectGrace: 20 * time.Millisecond,
+		Launcher: subprocess.FuncLauncher(func(ctx context.Context, _ subprocess.LaunchSpec, _ io.Reader, _, _ io.Writer) int {
+			<-ctx.Done()
+			close(stopped)
+			return 0
+		}),
+	}
+	addr, ln := startTCPRelay(t, relay)
+
+	launcher := &Launcher{Addr: addr, Token: testToken, ReconnectAttempts: -1}
+	proc, err := launcher.Launch(context.Background(), subprocess.LaunchSpec{Stdin: true})
+	require.NoError(t, err)
+
+	ln.drop()
+	state, err := proc.Wait()
+	require.ErrorIs(t, err, ErrConnectionLost)
+	assert.Equal(t, -1, state.Code)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop the CLI of the expired session")
+	}
+	assert.ErrorIs(t, proc.Signal(os.Interrupt), os.ErrProcessDone)
+}
+
+func TestRemote_RejectsInvalidToken(t *testing.T) {
+	t.Parallel()
+
+	var launched atomic.Bool
+	relay := &Relay{
+		CLIPath: "claude",
+		Token:   testToken,
+		Launcher: subprocess.FuncLauncher(func(context.Context, subprocess.LaunchSpec, io.Reader, io.Writer, io.Writer) int {
+			launched.Store(true)
+			return 0
+		}),
+	}
+	addr, _ := startTCPRelay(t, relay)
+
+	_, err := (&Launcher{Addr: addr, Token: "wrong"}).Launch(context.Background(), subprocess.LaunchSpec{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid token")
+	assert.False(t, launched.Load())
+
+	_, err = (&Launcher{Addr: addr, Token: testToken}).Launch(context.Background(), subprocess.LaunchSpec{})
+	require.NoError(t, err)
+}
+
+// rawConn connects to the relay at addr without the launcher's protocol.
+func rawConn(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(addr, "tcp://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// requireClosed waits for the relay to close conn.
+func requireClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err := io.Copy(io.Discard, conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatal("relay kept the connection open")
+	}
+}
+
+func TestRelay_HandshakeTimeout(t *testing.T) {
+	t.Parallel()
+
+	relay := &Relay{CLIPath: "claude", Token: testToken, HandshakeTimeout: 20 * time.Millisecond}
+	addr, _ := startTCPRelay(t, relay)
+
+	requireClosed(t, rawConn(t, addr))
+}
+
+func TestRelay_RejectsOversizedRequest(t *testing.T) {
+	t.Parallel()
+
+	relay := &Relay{CLIPath: "claude", Token: testToken}
+	addr, _ := startTCPRelay(t, relay)
+
+	conn := rawConn(t, addr)
+	go func() { _, _ = conn.Write(make([]byte, 2*maxRequestSize)) }()
+	requireClosed(t, conn)
+}
+
+func TestRelay_LimitsMessageSize(t *testing.T) {
+	t.Parallel()
+
+	relay := &Relay{
+		CLIPath:        "claude",
+		Token:          testToken,
+		MaxMessageSize: 1024,
+		Launcher: subprocess.FuncLauncher(func(ctx context.Context, _ subprocess.LaunchSpec, _ io.Reader, _, _ io.Writer) int {
+			<-ctx.Done()
+			return 0
+		}),
+	}
+	addr, _ := startTCPRelay(t, relay)
+
+	raw := rawConn(t, addr)
+	conn := wire.NewLineConn(raw)
+	require.NoError(t, conn.WriteLine(message{Op: opLaunch, Token: testToken, Stdin: true}.encode()))
+	line, err := conn.ReadLine()
+	require.NoError(t, err)
+	reply, ok := decodeRelay(line)
+	require.True(t, ok)
+	require.Equal(t, opLaunched, reply.Op)
+
+	require.NoError(t, conn.WriteLine([]byte(strings.Repeat("x", 2048))))
+	requireClosed(t, raw)
+}
+
+func TestRelay_WebSocketLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]func(c *wsConn) error{
+		"unmasked frame": func(c *wsConn) error {
+			// A server-side connection writes unmasked frames
+			return (&wsConn{conn: c.conn}).WriteLine(message{Op: opLaunch, Token: testToken}.encode())
+		},
+		"oversized frame": func(c *wsConn) error {
+			// The header announces a 1 GiB frame; the relay must not wait for it
+			header := []byte{0x80 | opText, 0x80 | 127}
+			header = binary.BigEndian.AppendUint64(header, 1<<30)
+			_, err := c.conn.Write(append(header, 0, 0, 0, 0))
+			return err
+		},
+		"oversized message": func(c *wsConn) error {
+			return c.WriteLine(make([]byte, maxRequestSize+1))
+		},
+	}
+	for name, send := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var launched atomic.Bool
+			relay := &Relay{
+				CLIPath: "claude",
+				Token:   testToken,
+				Launcher: subprocess.FuncLauncher(func(context.Context, subprocess.LaunchSpec, io.Reader, io.Writer, io.Writer) int {
+					launched.Store(true)
+					return 0
+				}),
+			}
+			u, err := url.Parse(startWebSocketRelay(t, relay))
+			require.NoError(t, err)
+			conn, err := dialWebSocket(context.Background(), u, nil)
+			require.NoError(t, err)
+			defer conn.conn.Close()
+
+			require.NoError(t, send(conn))
+			requireClosed(t, conn.conn)
+			assert.False(t, launched.Load())
+		})
+	}
+}
+
+func TestReplayBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := replayBuffer{max: 2}
+	for _, line := range []string{"a", "b", "c"} {
+		b.add([]byte(line))
+	}
+
+	lines, err := b.since(1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, lines)
+
+	lines, err = b.since(3)
+	require.NoError(t, err)
+	assert.Empty(t, lines)
+
+	_, err = b.since(0)
+	assert.Error(t, err, "line 1 is no longer kept")
+	_, err = b.since(4)
+	assert.Error(t, err, "line 4 was never sent")
+}
@@ -0,0 +1,179 @@
+// Package remote runs the Claude CLI on another host. A Relay on that host
+// spawns the CLI and bridges its stdio over TCP or WebSocket; a Launcher
+// plugs into the subprocess transport and connects to the relay, so that a
+// client drives the remote CLI exactly like a local one:
+//
+//	client, _ := claude.NewClient(
+//	    claude.WithLauncher(&remote.Launcher{
+//	        Addr:  "ws://sandbox-1:7878/relay",
+//	        Token: os.Getenv("CLAUDE_RELAY_TOKEN"),
+//	    }),
+//	)
+//
+// The connection carries the CLI's newline-delimited stream-json unchanged.
+// Relay messages, such as stderr lines, signals and the exit status, are
+// JSON lines of type "relay". Both ends keep their recent lines so that a
+// dropped connection can be resumed without losing output.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/wire"
+)
+
+// DefaultReplayLines is the number of lines each end keeps for resuming.
+const DefaultReplayLines = 10000
+
+// Relay message operations.
+const (
+	opLaunch     = "launch"      // client: start the CLI
+	opLaunched   = "launched"    // relay: the CLI started
+	opResume     = "resume"      // client: reattach to a session
+	opResumed    = "resumed"     // relay: the session is reattached
+	opError      = "error"       // relay: the request failed
+	opStderr     = "stderr"      // relay: a stderr line of the CLI
+	opExit       = "exit"        // relay: the CLI exited
+	opSignal     = "signal"      // client: signal the CLI
+	opCloseStdin = "close_stdin" // client: close the CLI's stdin
+)
+
+// relayType is the type of relay messages.
+const relayType = "relay"
+
+// relayPrefix starts every encoded relay message, as encoded by json.Marshal.
+var relayPrefix = []byte(`{"type":"relay"`)
+
+// message is a relay message.
+type message struct {
+	Type     string   `json:"type"`
+	Op       string   `json:"op"`
+	Token    string   `json:"token,omitempty"`
+	Session  string   `json:"session,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	Stdin    bool     `json:"stdin,omitempty"`
+	Received int64    `json:"received,omitempty"`
+	PID      int      `json:"pid,omitempty"`
+	Line     string   `json:"line,omitempty"`
+	Code     int      `json:"code,omitempty"`
+	Signal   string   `json:"signal,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// encode returns m as a relay line.
+func (m message) encode() []byte {
+	m.Type = relayType
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// decodeRelay parses line if it is a relay message.
+func decodeRelay(line []byte) (message, bool) {
+	if !bytes.HasPrefix(line, relayPrefix) {
+		return message{}, false
+	}
+	var m message
+	if err := json.Unmarshal(line, &m); err != nil || m.Type != relayType {
+		return message{}, false
+	}
+	return m, true
+}
+
+// lineConn is a connection that carries lines in both directions.
+type lineConn interface {
+	// ReadLine returns the next line, without its newline.
+	ReadLine() ([]byte, error)
+	// WriteLine sends line, which must not contain a newline.
+	WriteLine(line []byte) error
+	// SetReadLimit caps the size of the lines ReadLine returns; 0 lifts the cap.
+	SetReadLimit(n int)
+	// SetReadDeadline sets the deadline of ReadLine; the zero time clears it.
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// dial connects to a relay at addr: tcp://host:port, tls://host:port,
+// ws://host:port/path or wss://host:port/path.
+func dial(ctx context.Context, addr string, tlsConfig *tls.Config) (lineConn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse relay address: %w", err)
+	}
+
+	var d net.Dialer
+	switch u.Scheme {
+	case "tcp":
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return wire.NewLineConn(conn), nil
+	case "tls":
+		conn, err := (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return wire.NewLineConn(conn), nil
+	case "ws", "wss":
+		conn, err := dialWebSocket(ctx, u, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("unsupported relay address scheme %q", u.Scheme)
+	}
+}
+
+// replayBuffer keeps the last lines sent on a session, numbered from 1, so
+// that they can be sent again after a reconnect.
+type replayBuffer struct {
+	lines [][]byte
+	sent  int64 // number of the last line added
+	max   int
+}
+
+// add records line as sent.
+func (b *replayBuffer) add(line []byte) {
+	b.sent++
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.max {
+		b.lines[0] = nil
+		b.lines = b.lines[1:]
+	}
+}
+
+// since returns the lines after the first received ones.
+func (b *replayBuffer) since(received int64) ([][]byte, error) {
+	first := b.sent - int64(len(b.lines)) // number of the line before the kept ones
+	if received < first || received > b.sent {
+		return nil, fmt.Errorf("cannot replay from line %d: lines %d to %d are kept", received+1, first+1, b.sent)
+	}
+	return b.lines[received-first:], nil
+}
+
+// errorf returns the relay error message of a failed request.
+func errorf(format string, args ...any) []byte {
+	return message{Op: opError, Error: fmt.Sprintf(format, args...)}.encode()
+}
+
+// signalName returns the wire name of a signal, as understood by relays.
+func signalName(name string) string {
+	switch strings.ToLower(name) {
+	case "interrupt":
+		return "interrupt"
+	case "killed", "kill":
+		return "kill"
+	default:
+		return "terminate"
+	}
+}
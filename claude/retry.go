@@ -0,0 +1,150 @@
+package claude
+
+import (
+	"context"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// queryStarter starts and connects the CLI process for one attempt of a one-shot query.
+type queryStarter func(ctx context.Context) (*subprocess.Transport, error)
+
+// streamWithRetry streams a one-shot query running on transport and retries it
+// through start when its first assistant message carries an API error, such as
+// a rate limit, that the policy retries. Messages and errors that precede the
+// first assistant message are held back until it arrives, so a retried attempt
+// never delivers anything twice.
+// The returned stop function abandons the query and closes its transport.
+func streamWithRetry(ctx context.Context, policy *shared.RetryPolicy, bufferSize int, transport *subprocess.Transport, start queryStarter) (<-chan Message, <-chan error, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	msgChan := make(chan Message, bufferSize)
+	errChan := make(chan error, bufferSize)
+
+	go func() {
+		defer cancel()
+		defer close(errChan)
+		defer close(msgChan)
+
+		for attempt := 1; ; attempt++ {
+			retry := func(err *shared.APIError) bool {
+				return attempt < policy.Attempts() && policy.ShouldRetry(err)
+			}
+			apiErr := forwardQueryAttempt(ctx, transport, msgChan, errChan, retry)
+			_ = transport.Close()
+			if apiErr == nil || ctx.Err() != nil {
+				return
+			}
+
+			if err := policy.Wait(ctx, attempt, apiErr); err != nil {
+				return
+			}
+
+			var err error
+			transport, err = start(ctx)
+			if err != nil {
+				errChan <- err
+				return
+			}
+		}
+	}()
+
+	return msgChan, errChan, cancel
+}
+
+// forwardQueryAttempt forwards the messages and errors of one query attempt.
+// It returns the API error of the first assistant message if retry accepts it;
+// the attempt's remaining output is then discarded. Otherwise it returns nil
+// once the attempt's stream has ended or ctx is done.
+func forwardQueryAttempt(ctx context.Context, transport *subprocess.Transport, msgChan chan<- Message, errChan chan<- error, retry func(*shared.APIError) bool) *shared.APIError {
+	src, srcErr := transport.ReceiveMessages(ctx)
+
+	var held []Message
+	var heldErrs []error
+	holding := true
+
+	forward := func(msg Message) bool {
+		select {
+		case msgChan <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	forwardErr := func(err error) bool {
+		select {
+		case errChan <- err:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	release := func() bool {
+		holding = false
+		for _, msg := range held {
+			if !forward(msg) {
+				return false
+			}
+		}
+		for _, err := range heldErrs {
+			if !forwardErr(err) {
+				return false
+			}
+		}
+		held, heldErrs = nil, nil
+		return true
+	}
+
+	for {
+		select {
+		case msg, ok := <-src:
+			if !ok {
+				// The stream has ended; pass on the errors still buffered
+				if release() && srcErr != nil {
+					for err := range srcErr {
+						if !forwardErr(err) {
+							return nil
+						}
+					}
+				}
+				return nil
+			}
+			if !holding {
+				if !forward(msg) {
+					return nil
+				}
+				continue
+			}
+
+			switch m := msg.(type) {
+			case *AssistantMessage:
+				if m.HasError() {
+					if apiErr := shared.NewAPIError(m.GetError()); retry(apiErr) {
+						return apiErr
+					}
+				}
+			case *ResultMessage:
+			default:
+				held = append(held, msg)
+				continue
+			}
+			if !release() || !forward(msg) {
+				return nil
+			}
+		case err, ok := <-srcErr:
+			if !ok {
+				srcErr = nil
+				continue
+			}
+			if holding {
+				heldErrs = append(heldErrs, err)
+				continue
+			}
+			if !forwardErr(err) {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
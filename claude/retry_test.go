@@ -0,0 +1,111 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRateLimitedCLI writes a fake CLI whose first limited runs report a rate
+// limit before answering normally. Each run appends a line to the returned log.
+func writeRateLimitedCLI(t *testing.T, limited int) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := `#!/bin/sh
+echo run >> "` + runs + `"
+echo '{"type":"system","subtype":"init","session_id":"s1"}'
+if [ "$(wc -l < "` + runs + `")" -le ` + strconv.Itoa(limited) + ` ]; then
+	echo '{"type":"assistant","message":{"content":[{"type":"text","text":"limited"}]},"error":"rate_limit"}'
+	echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}'
+	exit 1
+fi
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"hello"}]}}'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`
+	path := filepath.Join(dir, "claude")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path, runs
+}
+
+// runCount returns the number of fake CLI runs recorded in the log.
+func runCount(t *testing.T, runs string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(runs)
+	require.NoError(t, err)
+	return len(data) / len("run\n")
+}
+
+// TestQueryRetriesRateLimit tests that a rate-limited attempt is retried without
+// delivering any of its messages.
+func TestQueryRetriesRateLimit(t *testing.T) {
+	t.Parallel()
+
+	cliPath, runs := writeRateLimitedCLI(t, 1)
+
+	var retried []error
+	iter, err := Query(context.Background(), "hi",
+		WithCLIPath(cliPath),
+		WithRetryPolicy(&RetryPolicy{
+			InitialBackoff:   time.Millisecond,
+			RateLimitBackoff: time.Millisecond,
+			OnRetry: func(_ int, err error, _ time.Duration) {
+				retried = append(retried, err)
+			},
+		}))
+	require.NoError(t, err)
+	defer iter.Close()
+
+	var types []string
+	for {
+		msg, err := iter.Next(context.Background())
+		if errors.Is(err, ErrNoMoreMessages) {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, msg.Type())
+		if assistant, ok := msg.(*AssistantMessage); ok {
+			assert.False(t, assistant.HasError())
+		}
+	}
+
+	assert.Equal(t, []string{"system", "assistant", "result"}, types)
+	require.Len(t, retried, 1)
+	assert.True(t, IsRateLimitError(retried[0]))
+	assert.Equal(t, 2, runCount(t, runs))
+}
+
+// TestQueryStreamRetryExhausted tests that the last attempt's error is delivered
+// once the policy runs out of attempts.
+func TestQueryStreamRetryExhausted(t *testing.T) {
+	t.Parallel()
+
+	cliPath, runs := writeRateLimitedCLI(t, 9)
+
+	client, err := NewClient(
+		WithCLIPath(cliPath),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 2, RateLimitBackoff: time.Millisecond}))
+	require.NoError(t, err)
+
+	msgChan, _ := client.QueryStream(context.Background(), "hi")
+
+	var last *AssistantMessage
+	for msg := range msgChan {
+		if assistant, ok := msg.(*AssistantMessage); ok {
+			last = assistant
+		}
+	}
+
+	require.NotNil(t, last)
+	assert.True(t, last.IsRateLimited())
+	assert.Equal(t, 2, runCount(t, runs))
+}
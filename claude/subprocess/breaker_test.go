@@ -0,0 +1,85 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runOneShot connects a one-shot transport and drains its stream.
+func runOneShot(t *testing.T, config *TransportConfig) error {
+	t.Helper()
+
+	transport, err := NewTransportWithPrompt(config, "hi")
+	require.NoError(t, err)
+	if err := transport.Connect(context.Background()); err != nil {
+		return err
+	}
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	for range msgChan {
+	}
+	return nil
+}
+
+func TestTransport_CircuitBreakerFailsFast(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI logs each run and exits without a result
+	runs := filepath.Join(t.TempDir(), "runs")
+	script := writeFakeCLI(t, `echo run >> "`+runs+`"
+exit 1
+`)
+
+	breaker := shared.NewCircuitBreaker(shared.CircuitBreakerConfig{FailureThreshold: 2, RecoveryTimeout: time.Hour})
+	config := &TransportConfig{CLIPath: script, CircuitBreaker: breaker}
+
+	require.NoError(t, runOneShot(t, config))
+	require.NoError(t, runOneShot(t, config))
+	assert.Eventually(t, func() bool { return breaker.State() == shared.Open }, time.Second, 10*time.Millisecond)
+
+	err := runOneShot(t, config)
+	assert.ErrorIs(t, err, shared.ErrCircuitOpen)
+
+	data, readErr := os.ReadFile(runs)
+	require.NoError(t, readErr)
+	assert.Equal(t, 2, strings.Count(string(data), "run"), "no process may start while the circuit is open")
+}
+
+func TestTransport_CircuitBreakerRecordsResults(t *testing.T) {
+	t.Parallel()
+
+	script := writeFakeCLI(t, `echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`)
+
+	breaker := shared.NewCircuitBreaker(shared.CircuitBreakerConfig{FailureThreshold: 1})
+	config := &TransportConfig{CLIPath: script, CircuitBreaker: breaker}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, runOneShot(t, config))
+	}
+	assert.Equal(t, shared.Closed, breaker.State())
+}
+
+func TestTransport_CircuitBreakerCountsStartFailures(t *testing.T) {
+	t.Parallel()
+
+	breaker := shared.NewCircuitBreaker(shared.CircuitBreakerConfig{FailureThreshold: 1, RecoveryTimeout: time.Hour})
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:        filepath.Join(t.TempDir(), "missing"),
+		CircuitBreaker: breaker,
+		RetryPolicy:    &shared.RetryPolicy{MaxAttempts: 1},
+	})
+	require.NoError(t, err)
+
+	require.Error(t, transport.Connect(context.Background()))
+	assert.Equal(t, shared.Open, breaker.State())
+}
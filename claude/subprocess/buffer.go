@@ -0,0 +1,324 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the reading of CLI output and the message queue that
+// buffers it for subscribers.
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+const (
+	// lineReaderSize is the read buffer size for CLI output.
+	lineReaderSize = 64 * 1024
+	// maxRetainedLineBuffer is the largest line buffer kept between lines.
+	// The buffer of a longer line is released once the line has been handled.
+	maxRetainedLineBuffer = 1024 * 1024
+)
+
+// BufferStats counts the messages affected by the overflow policy.
+type BufferStats struct {
+	// Dropped is the number of partial stream deltas discarded by OverflowDropDeltas.
+	Dropped uint64
+	// Spilled is the number of messages written to disk by OverflowSpill.
+	Spilled uint64
+}
+
+// bufferCounters accumulates BufferStats over the transport's lifetime.
+type bufferCounters struct {
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+}
+
+// lineReader reads newline-delimited output. Unlike bufio.Scanner, a line
+// longer than max does not end the stream: it is skipped without being
+// buffered and reported as a LineTooLongError.
+type lineReader struct {
+	r   *bufio.Reader
+	buf []byte
+	max int // longest line without its line ending; 0 means no limit
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, lineReaderSize), max: max}
+}
+
+// next returns the next line without its line ending, or io.EOF after the
+// last line. The line is valid until the following call.
+func (l *lineReader) next() ([]byte, error) {
+	if cap(l.buf) > maxRetainedLineBuffer {
+		l.buf = nil
+	}
+	l.buf = l.buf[:0]
+	size := 0
+	tooLong := false
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		size += len(chunk)
+		if !tooLong {
+			l.buf = append(l.buf, chunk...)
+			if l.max > 0 && len(l.buf) > l.max+len("\r\n") {
+				// Read the rest of the line without keeping it
+				tooLong = true
+				l.buf = l.buf[:0]
+			}
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && size > 0:
+			// Last line without a line ending
+		case err != nil:
+			return nil, err
+		}
+
+		line := bytes.TrimRight(l.buf, "\r\n")
+		if tooLong || (l.max > 0 && len(line) > l.max) {
+			return nil, shared.NewLineTooLongError(size, l.max)
+		}
+		return line, nil
+	}
+}
+
+// isPartialDelta reports whether msg is an incremental content update that
+// a consumer can lose without losing the final message.
+func isPartialDelta(msg shared.Message) bool {
+	event, ok := msg.(*shared.StreamEvent)
+	return ok && event.Event["type"] == shared.StreamEventTypeContentBlockDelta
+}
+
+// messageQueue holds parsed messages between the stdout reader and the
+// goroutine that publishes them, so that the reader keeps handling control
+// requests while subscribers catch up. At most limit messages are held in
+// memory; the overflow policy decides what happens to the rest.
+type messageQueue struct {
+	limit    int
+	policy   shared.OverflowPolicy
+	dir      string
+	decode   func(line []byte) (shared.Message, error)
+	counters *bufferCounters
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	items   []shared.Message
+	closed  bool     // no more messages will be pushed
+	full    bool     // the overflow has been logged
+	spill   *os.File // spilled lines, oldest first
+	spillR  *lineReader
+	spillAt int64 // write offset of the spill file
+	spilled int   // lines in the spill file not yet delivered
+
+	added   chan struct{}
+	removed chan struct{}
+}
+
+// newMessageQueue creates the queue for one CLI process.
+func (t *Transport) newMessageQueue(log *slog.Logger) *messageQueue {
+	return &messageQueue{
+		limit:    t.buffer.MaxMessages,
+		policy:   t.buffer.Overflow,
+		dir:      t.buffer.SpillDir,
+		decode:   t.decodeMessage,
+		counters: &t.bufferCounters,
+		log:      log,
+		added:    make(chan struct{}, 1),
+		removed:  make(chan struct{}, 1),
+	}
+}
+
+// notify wakes a goroutine waiting on ch without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push queues msg, which was parsed from line. It waits while the policy
+// allows neither queueing nor discarding, and returns false if ctx ends first.
+func (q *messageQueue) push(ctx context.Context, msg shared.Message, line []byte) bool {
+	for {
+		q.mu.Lock()
+		queued := q.enqueueLocked(msg, line)
+		q.mu.Unlock()
+		if queued {
+			notify(q.added)
+			return true
+		}
+
+		select {
+		case <-q.removed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// enqueueLocked queues msg, applying the overflow policy when the queue is
+// full. It returns false when the caller must wait for room.
+// The caller must hold q.mu.
+func (q *messageQueue) enqueueLocked(msg shared.Message, line []byte) bool {
+	// Once spilling has started, later messages follow the spilled ones
+	if q.spilled == 0 && len(q.items) < q.limit {
+		q.items = append(q.items, msg)
+		return true
+	}
+	q.logFullLocked()
+
+	switch q.policy {
+	case shared.OverflowDropDeltas:
+		if i := slices.IndexFunc(q.items, isPartialDelta); i >= 0 {
+			q.items = append(slices.Delete(q.items, i, i+1), msg)
+			q.counters.dropped.Add(1)
+			return true
+		}
+		if isPartialDelta(msg) {
+			q.counters.dropped.Add(1)
+			return true
+		}
+	case shared.OverflowSpill:
+		if err := q.spillLocked(line); err != nil {
+			q.log.Warn("spilling messages failed, blocking instead", "error", err)
+			q.policy = shared.OverflowBlock
+			return false
+		}
+		q.counters.spilled.Add(1)
+		return true
+	}
+	return false
+}
+
+// logFullLocked logs the first overflow of the queue.
+// The caller must hold q.mu.
+func (q *messageQueue) logFullLocked() {
+	if q.full {
+		return
+	}
+	q.full = true
+	q.log.Warn("message queue full", "max_messages", q.limit, "overflow", q.policy)
+}
+
+// spillLocked appends line to the spill file, creating it on first use.
+// The caller must hold q.mu.
+func (q *messageQueue) spillLocked(line []byte) error {
+	if q.spill == nil {
+		f, err := os.CreateTemp(q.dir, "claude-sdk-spill-*.jsonl")
+		if err != nil {
+			return fmt.Errorf("create spill file: %w", err)
+		}
+		q.spill = f
+		// Spilled lines have passed the stdout reader's limit
+		q.spillR = newLineReader(f, 0)
+	}
+
+	record := make([]byte, 0, len(line)+1)
+	record = append(append(record, line...), '\n')
+	if _, err := q.spill.WriteAt(record, q.spillAt); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	q.spillAt += int64(len(record))
+	q.spilled++
+	return nil
+}
+
+// unspillLocked reads the oldest spilled line. The spill file is emptied
+// once every spilled line has been read, or when it cannot be read.
+// The caller must hold q.mu.
+func (q *messageQueue) unspillLocked() ([]byte, error) {
+	line, err := q.spillR.next()
+	if err != nil {
+		lost := q.spilled
+		q.resetSpillLocked()
+		return nil, fmt.Errorf("read spill file: %w (%d messages lost)", err, lost)
+	}
+
+	q.spilled--
+	if q.spilled == 0 {
+		q.resetSpillLocked()
+	}
+	return line, nil
+}
+
+// resetSpillLocked empties the spill file for reuse.
+// The caller must hold q.mu.
+func (q *messageQueue) resetSpillLocked() {
+	q.spilled = 0
+	q.spillAt = 0
+	_ = q.spill.Truncate(0)
+	_, _ = q.spill.Seek(0, io.SeekStart)
+	q.spillR.r.Reset(q.spill)
+}
+
+// pop returns the oldest message, waiting until one is queued. It returns
+// false once the queue is closed and empty, or when ctx ends.
+func (q *messageQueue) pop(ctx context.Context) (shared.Message, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			msg := q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			notify(q.removed)
+			return msg, true
+		}
+		if q.spilled > 0 {
+			// Only pop reads the spill file, so the line stays valid after unlocking
+			line, err := q.unspillLocked()
+			q.mu.Unlock()
+			if err != nil {
+				q.log.Warn("reading spilled messages failed", "error", err)
+				continue
+			}
+			msg, err := q.decode(line)
+			if err != nil {
+				q.log.Warn("invalid spilled message", "error", err, "bytes", len(line))
+				continue
+			}
+			return msg, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-q.added:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// closeInput marks the end of the pushes. pop keeps returning the queued
+// messages and reports false once they have all been delivered.
+func (q *messageQueue) closeInput() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	notify(q.added)
+}
+
+// release removes the spill file.
+func (q *messageQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.spill != nil {
+		_ = q.spill.Close()
+		_ = os.Remove(q.spill.Name())
+		q.spill = nil
+	}
+}
@@ -0,0 +1,319 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineReader(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 3*lineReaderSize+17)
+	input := "first\r\n\n" + long + "\nlast"
+
+	reader := newLineReader(strings.NewReader(input), 0)
+	var lines []string
+	for {
+		line, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line))
+	}
+
+	assert.Equal(t, []string{"first", "", long, "last"}, lines)
+}
+
+func TestLineReaderMaxLineSize(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 3*lineReaderSize+17)
+	input := "first\r\n" + strings.Repeat("y", 11) + "\n" + long + "\n" + strings.Repeat("z", 10) + "\r\nlast"
+
+	reader := newLineReader(strings.NewReader(input), 10)
+	var lines []string
+	var sizes []int
+	for {
+		line, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if tooLong, ok := shared.AsLineTooLongError(err); ok {
+			assert.Equal(t, 10, tooLong.Limit)
+			sizes = append(sizes, tooLong.Size)
+			continue
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line))
+	}
+
+	assert.Equal(t, []string{"first", strings.Repeat("z", 10), "last"}, lines)
+	assert.Equal(t, []int{12, len(long) + 1}, sizes)
+}
+
+func TestTransport_SkipsLinesOverMaxLineSize(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath: writeFakeCLI(t, `printf '{"type":"system","subtype":"%0200d"}\n' 0
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`),
+		StderrCallback: func(string) {},
+		Buffer:         shared.BufferOptions{MaxLineSize: 100},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	var types []string
+	var errs []error
+	for msgChan != nil || errChan != nil {
+		select {
+		case msg, ok := <-msgChan:
+			if !ok {
+				msgChan = nil
+				continue
+			}
+			types = append(types, msg.Type())
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			errs = append(errs, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("stream did not end")
+		}
+	}
+
+	assert.Equal(t, []string{shared.MessageTypeResult}, types)
+	require.Len(t, errs, 1, "errors: %v", errs)
+	tooLong, ok := shared.AsLineTooLongError(errs[0])
+	require.True(t, ok, "got %v", errs[0])
+	assert.Equal(t, 100, tooLong.Limit)
+}
+
+// streamLine returns a stream event line identified by uuid. Deltas are
+// content_block_delta events; other events are content_block_stop.
+func streamLine(uuid string, delta bool) string {
+	if delta {
+		return fmt.Sprintf(`{"type":"stream_event","uuid":%q,"session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"x"}}}`, uuid)
+	}
+	return fmt.Sprintf(`{"type":"stream_event","uuid":%q,"session_id":"s1","event":{"type":"content_block_stop","index":0}}`, uuid)
+}
+
+// pushLines decodes and queues each line.
+func pushLines(t *testing.T, tr *Transport, q *messageQueue, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		msg, err := tr.decodeMessage([]byte(line))
+		require.NoError(t, err)
+		require.True(t, q.push(context.Background(), msg, []byte(line)))
+	}
+}
+
+// popUUIDs pops n stream events and returns their UUIDs.
+func popUUIDs(t *testing.T, q *messageQueue, n int) []string {
+	t.Helper()
+
+	var uuids []string
+	for len(uuids) < n {
+		msg, ok := q.pop(context.Background())
+		require.True(t, ok, "queue ended after %v", uuids)
+		uuids = append(uuids, msg.(*shared.StreamEvent).UUID)
+	}
+	return uuids
+}
+
+func TestMessageQueue_Overflow(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		streamLine("d1", true),
+		streamLine("s1", false),
+		streamLine("d2", true),
+		streamLine("s2", false),
+		streamLine("d3", true),
+	}
+
+	tests := []struct {
+		name        string
+		policy      shared.OverflowPolicy
+		want        []string
+		wantDropped uint64
+		wantSpilled uint64
+	}{
+		{
+			name:        "drop deltas",
+			policy:      shared.OverflowDropDeltas,
+			want:        []string{"s1", "s2"},
+			wantDropped: 3,
+		},
+		{
+			name:        "spill",
+			policy:      shared.OverflowSpill,
+			want:        []string{"d1", "s1", "d2", "s2", "d3"},
+			wantSpilled: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			tr, err := NewTransport(&TransportConfig{
+				Buffer: shared.BufferOptions{MaxMessages: 2, Overflow: tt.policy, SpillDir: dir},
+			})
+			require.NoError(t, err)
+			q := tr.newMessageQueue(tr.logger)
+
+			pushLines(t, tr, q, lines...)
+			q.closeInput()
+			assert.Equal(t, tt.want, popUUIDs(t, q, len(tt.want)))
+			_, ok := q.pop(context.Background())
+			assert.False(t, ok)
+			assert.Equal(t, BufferStats{Dropped: tt.wantDropped, Spilled: tt.wantSpilled}, tr.BufferStats())
+
+			q.release()
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestMessageQueue_SpillKeepsOrderAcrossRefills(t *testing.T) {
+	t.Parallel()
+
+	tr, err := NewTransport(&TransportConfig{
+		Buffer: shared.BufferOptions{MaxMessages: 2, Overflow: shared.OverflowSpill, SpillDir: t.TempDir()},
+	})
+	require.NoError(t, err)
+	q := tr.newMessageQueue(tr.logger)
+	defer q.release()
+
+	pushLines(t, tr, q, streamLine("m1", false), streamLine("m2", false), streamLine("m3", false), streamLine("m4", false))
+	assert.Equal(t, []string{"m1", "m2", "m3"}, popUUIDs(t, q, 3))
+
+	// m4 is still spilled, so m5 must follow it through the file
+	pushLines(t, tr, q, streamLine("m5", false))
+	assert.Equal(t, []string{"m4", "m5"}, popUUIDs(t, q, 2))
+
+	// The drained spill file is reused from the start
+	pushLines(t, tr, q, streamLine("m6", false), streamLine("m7", false), streamLine("m8", false))
+	assert.Equal(t, []string{"m6", "m7", "m8"}, popUUIDs(t, q, 3))
+}
+
+func TestMessageQueue_BlockWaitsForRoom(t *testing.T) {
+	t.Parallel()
+
+	tr, err := NewTransport(&TransportConfig{Buffer: shared.BufferOptions{MaxMessages: 1}})
+	require.NoError(t, err)
+	q := tr.newMessageQueue(tr.logger)
+
+	delta := streamLine("d1", true)
+	pushLines(t, tr, q, delta)
+
+	msg, err := tr.decodeMessage([]byte(delta))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, q.push(ctx, msg, []byte(delta)), "push into a full queue must block")
+
+	pushed := make(chan bool)
+	go func() { pushed <- q.push(context.Background(), msg, []byte(delta)) }()
+	assert.Equal(t, []string{"d1"}, popUUIDs(t, q, 1))
+	assert.True(t, <-pushed)
+}
+
+func TestTransport_ReadsOversizedLine(t *testing.T) {
+	t.Parallel()
+
+	// Larger than the 10MB line limit of the former scanner
+	text := strings.Repeat("a", 12*1024*1024)
+	output := filepath.Join(t.TempDir(), "output.jsonl")
+	content := `{"type":"assistant","message":{"content":[{"type":"text","text":"` + text + `"}]}}` + "\n" +
+		`{"type":"result","subtype":"success","session_id":"s1"}` + "\n"
+	require.NoError(t, os.WriteFile(output, []byte(content), 0o600))
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        writeFakeCLI(t, "cat '"+output+"'\n"),
+		StderrCallback: func(string) {},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	var msgs []shared.Message
+	for msg := range msgChan {
+		msgs = append(msgs, msg)
+	}
+	for err := range errChan {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	require.Len(t, msgs, 2)
+	assert.Len(t, shared.GetContentText(msgs[0].(*shared.AssistantMessage)), len(text))
+	assert.Equal(t, shared.MessageTypeResult, msgs[1].Type())
+}
+
+func TestTransport_SpillsForSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	const events = 50
+	var script strings.Builder
+	for i := 0; i < events; i++ {
+		fmt.Fprintf(&script, "echo '%s'\n", streamLine(fmt.Sprintf("e%d", i), i%2 == 0))
+	}
+	script.WriteString(`echo '{"type":"result","subtype":"success","session_id":"s1"}'` + "\n")
+
+	spillDir := t.TempDir()
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        writeFakeCLI(t, script.String()),
+		StderrCallback: func(string) {},
+		Buffer: shared.BufferOptions{
+			BufferSize:  1,
+			MaxMessages: 2,
+			Overflow:    shared.OverflowSpill,
+			SpillDir:    spillDir,
+		},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	// Nothing is read until the reader has had to spill
+	require.Eventually(t, func() bool { return transport.BufferStats().Spilled > 0 },
+		5*time.Second, 10*time.Millisecond)
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	var uuids []string
+	for msg := range msgChan {
+		if event, ok := msg.(*shared.StreamEvent); ok {
+			uuids = append(uuids, event.UUID)
+		}
+	}
+	require.Len(t, uuids, events)
+	for i, uuid := range uuids {
+		assert.Equal(t, fmt.Sprintf("e%d", i), uuid)
+	}
+
+	_ = transport.Close()
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -4,11 +4,36 @@ package subprocess
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
+// CLIOptions holds the session options that map onto dedicated CLI flags.
+// The zero value adds no flags.
+type CLIOptions struct {
+	// PermissionMode is passed as --permission-mode. Empty keeps the CLI default.
+	PermissionMode string
+	// ContextFiles grant the CLI access to each file's parent directory with
+	// --add-dir. The CLI has no flag for individual files, so the files are
+	// readable by the model but not preloaded into the conversation.
+	ContextFiles []string
+	// IncludePartialMessages adds --include-partial-messages.
+	IncludePartialMessages bool
+	// OutputFormat with a JSON schema is passed as --json-schema.
+	OutputFormat *shared.OutputFormat
+	// Agents are passed as --agents JSON.
+	Agents map[string]shared.AgentDefinition
+	// SettingSources are passed as a comma-separated --setting-sources list.
+	SettingSources []shared.SettingSource
+	// Sandbox is passed as the "sandbox" key of --settings JSON.
+	Sandbox *shared.SandboxSettings
+	// SdkPluginConfig adds --plugin-dir for an enabled plugin path.
+	SdkPluginConfig *shared.SdkPluginConfig
+}
+
 // BuildArgs constructs CLI arguments from transport configuration.
 // This is a pure function for easy testing without Transport instantiation.
 //
@@ -22,6 +47,13 @@ import (
 //
 // Returns the slice of CLI arguments ready for exec.Command.
 func BuildArgs(model, systemPrompt string, customArgs []string, tools *shared.ToolsConfig, mcpServers map[string]shared.McpServerConfig, promptArg *string) []string {
+	return BuildArgsWithOptions(model, systemPrompt, customArgs, tools, mcpServers, nil, promptArg)
+}
+
+// BuildArgsWithOptions is BuildArgs with the flag-backed session options of
+// cliOpts, which are added before the one-shot prompt. A nil cliOpts adds
+// no flags.
+func BuildArgsWithOptions(model, systemPrompt string, customArgs []string, tools *shared.ToolsConfig, mcpServers map[string]shared.McpServerConfig, cliOpts *CLIOptions, promptArg *string) []string {
 	var args []string
 
 	if promptArg != nil {
@@ -64,13 +96,19 @@ func BuildArgs(model, systemPrompt string, customArgs []string, tools *shared.To
 	if len(mcpServers) > 0 {
 		serversForCLI := make(map[string]any)
 		for name, config := range mcpServers {
-			if sdkConfig, ok := config.(shared.McpSdkServerConfig); ok {
-				// For SDK servers, pass everything except instance
+			// For SDK servers, pass everything except instance
+			switch sdkConfig := config.(type) {
+			case shared.McpSdkServerConfig:
 				serversForCLI[name] = map[string]any{
 					"type": sdkConfig.Type,
 					"name": sdkConfig.Name,
 				}
-			} else {
+			case *shared.McpSdkServerConfig:
+				serversForCLI[name] = map[string]any{
+					"type": sdkConfig.Type,
+					"name": sdkConfig.Name,
+				}
+			default:
 				serversForCLI[name] = config
 			}
 		}
@@ -80,6 +118,11 @@ func BuildArgs(model, systemPrompt string, customArgs []string, tools *shared.To
 		}
 	}
 
+	// Flag-backed session options
+	if cliOpts != nil {
+		args = append(args, cliOpts.args()...)
+	}
+
 	// In one-shot mode, prompt goes last as positional argument
 	if promptArg != nil {
 		args = append(args, *promptArg)
@@ -87,3 +130,62 @@ func BuildArgs(model, systemPrompt string, customArgs []string, tools *shared.To
 
 	return args
 }
+
+// args converts the options into CLI flags in a fixed order.
+func (o *CLIOptions) args() []string {
+	var args []string
+
+	if o.PermissionMode != "" {
+		args = append(args, "--permission-mode", o.PermissionMode)
+	}
+
+	for _, dir := range contextDirs(o.ContextFiles) {
+		args = append(args, "--add-dir", dir)
+	}
+
+	if o.IncludePartialMessages {
+		args = append(args, "--include-partial-messages")
+	}
+
+	if o.OutputFormat != nil && o.OutputFormat.Schema != nil {
+		schemaJSON, _ := json.Marshal(o.OutputFormat.Schema)
+		args = append(args, "--json-schema", string(schemaJSON))
+	}
+
+	if len(o.Agents) > 0 {
+		agentsJSON, _ := json.Marshal(o.Agents)
+		args = append(args, "--agents", string(agentsJSON))
+	}
+
+	if len(o.SettingSources) > 0 {
+		sources := make([]string, len(o.SettingSources))
+		for i, source := range o.SettingSources {
+			sources[i] = string(source)
+		}
+		args = append(args, "--setting-sources", strings.Join(sources, ","))
+	}
+
+	if o.Sandbox != nil {
+		settingsJSON, _ := json.Marshal(map[string]any{"sandbox": o.Sandbox})
+		args = append(args, "--settings", string(settingsJSON))
+	}
+
+	if o.SdkPluginConfig != nil && o.SdkPluginConfig.Enabled && o.SdkPluginConfig.PluginPath != "" {
+		args = append(args, "--plugin-dir", o.SdkPluginConfig.PluginPath)
+	}
+
+	return args
+}
+
+// contextDirs returns the parent directories of files, without duplicates,
+// in the order they first appear.
+func contextDirs(files []string) []string {
+	var dirs []string
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
@@ -270,6 +270,20 @@ func TestBuildArgs_MCPServerJSON(t *testing.T) {
 	t.Fatal("--mcp-config flag not found")
 }
 
+func TestBuildArgs_SdkMCPServerPointer(t *testing.T) {
+	mcpServers := map[string]shared.McpServerConfig{
+		"value":   shared.McpSdkServerConfig{Type: "sdk", Name: "value", Instance: struct{}{}},
+		"pointer": &shared.McpSdkServerConfig{Type: "sdk", Name: "pointer", Instance: struct{}{}},
+	}
+
+	args := BuildArgs("model", "", nil, nil, mcpServers, nil)
+
+	assert.Equal(t, []string{
+		"--output-format", "stream-json", "--input-format", "stream-json", "--model", "model",
+		"--mcp-config", `{"mcpServers":{"pointer":{"name":"pointer","type":"sdk"},"value":{"name":"value","type":"sdk"}}}`,
+	}, args)
+}
+
 func TestBuildArgs_EmptyMCPServers(t *testing.T) {
 	// Empty map should not add --mcp-config
 	args := BuildArgs("model", "", nil, nil, map[string]shared.McpServerConfig{}, nil)
@@ -281,3 +295,124 @@ func TestBuildArgs_NilMCPServers(t *testing.T) {
 	args := BuildArgs("model", "", nil, nil, nil, nil)
 	assert.NotContains(t, args, "--mcp-config", "nil MCP servers should not add --mcp-config")
 }
+
+func TestBuildArgsWithOptions_Golden(t *testing.T) {
+	base := []string{"--output-format", "stream-json", "--input-format", "stream-json", "--model", "model"}
+
+	tests := []struct {
+		name    string
+		cliOpts *CLIOptions
+		want    []string
+	}{
+		{
+			name:    "nil options",
+			cliOpts: nil,
+			want:    nil,
+		},
+		{
+			name:    "zero options",
+			cliOpts: &CLIOptions{},
+			want:    nil,
+		},
+		{
+			name:    "permission mode",
+			cliOpts: &CLIOptions{PermissionMode: "acceptEdits"},
+			want:    []string{"--permission-mode", "acceptEdits"},
+		},
+		{
+			name:    "include partial messages",
+			cliOpts: &CLIOptions{IncludePartialMessages: true},
+			want:    []string{"--include-partial-messages"},
+		},
+		{
+			name: "output format",
+			cliOpts: &CLIOptions{OutputFormat: &shared.OutputFormat{
+				Type:   "json_schema",
+				Schema: map[string]any{"type": "object", "required": []string{"answer"}},
+			}},
+			want: []string{"--json-schema", `{"required":["answer"],"type":"object"}`},
+		},
+		{
+			name:    "output format without schema",
+			cliOpts: &CLIOptions{OutputFormat: &shared.OutputFormat{Type: "json_schema"}},
+			want:    nil,
+		},
+		{
+			name: "agents",
+			cliOpts: &CLIOptions{Agents: map[string]shared.AgentDefinition{
+				"reviewer": {Description: "Reviews code", Prompt: "Review", Tools: []string{"Read"}, Model: shared.AgentModelOpus},
+				"coder":    {Description: "Writes code", Prompt: "Code"},
+			}},
+			want: []string{"--agents",
+				`{"coder":{"description":"Writes code","prompt":"Code"},` +
+					`"reviewer":{"description":"Reviews code","tools":["Read"],"prompt":"Review","model":"opus"}}`},
+		},
+		{
+			name:    "context files",
+			cliOpts: &CLIOptions{ContextFiles: []string{"/repo/main.go", "/repo/go.mod", "/docs/notes.md"}},
+			want:    []string{"--add-dir", "/repo", "--add-dir", "/docs"},
+		},
+		{
+			name:    "setting sources",
+			cliOpts: &CLIOptions{SettingSources: []shared.SettingSource{shared.SettingSourceUser, shared.SettingSourceProject}},
+			want:    []string{"--setting-sources", "user,project"},
+		},
+		{
+			name:    "sandbox",
+			cliOpts: &CLIOptions{Sandbox: &shared.SandboxSettings{Enabled: true, Type: "docker", Image: "alpine"}},
+			want:    []string{"--settings", `{"sandbox":{"enabled":true,"type":"docker","image":"alpine"}}`},
+		},
+		{
+			name:    "sdk plugin config",
+			cliOpts: &CLIOptions{SdkPluginConfig: &shared.SdkPluginConfig{Enabled: true, PluginPath: "/plugins/lint"}},
+			want:    []string{"--plugin-dir", "/plugins/lint"},
+		},
+		{
+			name:    "disabled sdk plugin config",
+			cliOpts: &CLIOptions{SdkPluginConfig: &shared.SdkPluginConfig{PluginPath: "/plugins/lint"}},
+			want:    nil,
+		},
+		{
+			name: "all options in order",
+			cliOpts: &CLIOptions{
+				PermissionMode:         "plan",
+				ContextFiles:           []string{"/repo/main.go"},
+				IncludePartialMessages: true,
+				OutputFormat:           &shared.OutputFormat{Type: "json_schema", Schema: map[string]any{"type": "string"}},
+				Agents:                 map[string]shared.AgentDefinition{"a": {Description: "A", Prompt: "P"}},
+				SettingSources:         []shared.SettingSource{shared.SettingSourceLocal},
+				Sandbox:                &shared.SandboxSettings{Enabled: true},
+				SdkPluginConfig:        &shared.SdkPluginConfig{Enabled: true, PluginPath: "/p"},
+			},
+			want: []string{
+				"--permission-mode", "plan",
+				"--add-dir", "/repo",
+				"--include-partial-messages",
+				"--json-schema", `{"type":"string"}`,
+				"--agents", `{"a":{"description":"A","prompt":"P"}}`,
+				"--setting-sources", "local",
+				"--settings", `{"sandbox":{"enabled":true}}`,
+				"--plugin-dir", "/p",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := BuildArgsWithOptions("model", "", nil, nil, nil, tt.cliOpts, nil)
+			assert.Equal(t, append(append([]string(nil), base...), tt.want...), args)
+		})
+	}
+}
+
+func TestBuildArgsWithOptions_BeforePrompt(t *testing.T) {
+	prompt := "hello"
+	args := BuildArgsWithOptions("model", "", nil, nil, nil, &CLIOptions{IncludePartialMessages: true}, &prompt)
+
+	assert.Equal(t, []string{
+		"-p", "--output-format", "stream-json", "--verbose",
+		"--model", "model",
+		"--include-partial-messages",
+		"hello",
+	}, args)
+}
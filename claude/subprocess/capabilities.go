@@ -0,0 +1,76 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file reports the capabilities of the connected CLI.
+package subprocess
+
+import (
+	"slices"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// recordInit keeps the init system message for Capabilities and passes the
+// CLI version on to the control protocol, for its UnsupportedErrors. It runs
+// on the stdout reader, like the routing of control messages.
+func (t *Transport) recordInit(msg *shared.SystemMessage) {
+	t.initMu.Lock()
+	t.initMessage = msg
+	t.initMu.Unlock()
+
+	if t.protocol != nil && msg.ClaudeCodeVersion != "" {
+		t.protocol.setCLIVersion(msg.ClaudeCodeVersion)
+	}
+}
+
+// reportedCLIVersion returns the CLI version of the last init system
+// message, or "" before one arrived.
+func (t *Transport) reportedCLIVersion() string {
+	t.initMu.Lock()
+	defer t.initMu.Unlock()
+	if t.initMessage == nil {
+		return ""
+	}
+	return t.initMessage.ClaudeCodeVersion
+}
+
+// Capabilities reports what the connected CLI supports, from the response to
+// the initialize handshake and the last init system message. The CLI sends
+// the latter with its first turn, so CLIVersion and Betas stay empty until
+// then; without a control protocol only they and the slash command names
+// are known.
+func (t *Transport) Capabilities() shared.Capabilities {
+	var caps shared.Capabilities
+	if protocol := t.Protocol(); protocol != nil {
+		if resp := protocol.InitializeResponse(); resp != nil {
+			caps.Commands = slices.Clone(resp.Commands)
+			caps.Models = slices.Clone(resp.Models)
+			caps.OutputStyle = resp.OutputStyle
+			caps.OutputStyles = slices.Clone(resp.AvailableOutputStyles)
+			if len(resp.SupportedCommands) > 0 {
+				caps.ControlSubtypes = slices.Clone(resp.SupportedCommands)
+			}
+		}
+	}
+
+	t.initMu.Lock()
+	init := t.initMessage
+	t.initMu.Unlock()
+	if init == nil {
+		return caps
+	}
+
+	caps.CLIVersion = init.ClaudeCodeVersion
+	caps.Betas = slices.Clone(init.Betas)
+	if caps.OutputStyle == "" {
+		caps.OutputStyle = getString(init.Data, "output_style")
+	}
+	if caps.Commands == nil {
+		// The init message only names the slash commands
+		names, _ := init.Data["slash_commands"].([]any)
+		for _, name := range names {
+			if s, ok := name.(string); ok {
+				caps.Commands = append(caps.Commands, shared.SlashCommand{Name: s})
+			}
+		}
+	}
+	return caps
+}
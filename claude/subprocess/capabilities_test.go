@@ -0,0 +1,111 @@
+// Package subprocess provides tests for the capabilities of the connected CLI.
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport_Capabilities(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI advertises two control subtypes in the handshake and
+	// reports its version with the first turn
+	script := writeFakeCLI(t, `read line
+id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\",\"response\":{\"supported_commands\":[\"interrupt\",\"set_model\"],\"commands\":[{\"name\":\"review\",\"description\":\"Review code\",\"argumentHint\":\"[file]\"}],\"models\":[{\"value\":\"sonnet\",\"displayName\":\"Sonnet\",\"description\":\"Fast\"}],\"output_style\":\"default\",\"available_output_styles\":[\"default\",\"explanatory\"]}}}"
+read line
+echo '{"type":"system","subtype":"init","session_id":"s1","claude_code_version":"2.1.0","betas":["context-1m"]}'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+read line
+`)
+
+	transport, err := NewTransport(&TransportConfig{CLIPath: script, EnableControlProtocol: true})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	caps := transport.Capabilities()
+	assert.Equal(t, []string{SubtypeInterrupt, SubtypeSetModel}, caps.ControlSubtypes)
+	assert.Equal(t, []shared.SlashCommand{{Name: "review", Description: "Review code", ArgumentHint: "[file]"}}, caps.Commands)
+	assert.Equal(t, []shared.ModelInfo{{Value: "sonnet", DisplayName: "Sonnet", Description: "Fast"}}, caps.Models)
+	assert.Equal(t, "default", caps.OutputStyle)
+	assert.Equal(t, []string{"default", "explanatory"}, caps.OutputStyles)
+	assert.Empty(t, caps.CLIVersion)
+	assert.True(t, caps.SupportsControl(SubtypeSetModel))
+	assert.False(t, caps.SupportsControl(SubtypeRewindFiles))
+
+	// Unadvertised requests fail without waiting for the CLI
+	err = transport.RewindFiles(context.Background(), "msg_1")
+	require.True(t, shared.IsUnsupportedError(err), "got %v", err)
+	assert.EqualError(t, err, "rewind_files unsupported by CLI")
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+	assert.Equal(t, []string{shared.MessageTypeSystem, shared.MessageTypeResult}, receiveTypes(t, msgChan, 2))
+
+	caps = transport.Capabilities()
+	assert.Equal(t, "2.1.0", caps.CLIVersion)
+	assert.Equal(t, []string{"context-1m"}, caps.Betas)
+
+	err = transport.RewindFiles(context.Background(), "msg_1")
+	unsupported, ok := shared.AsUnsupportedError(err)
+	require.True(t, ok, "got %v", err)
+	assert.Equal(t, SubtypeRewindFiles, unsupported.Subtype)
+	assert.Equal(t, "rewind_files unsupported by CLI v2.1.0", err.Error())
+}
+
+func TestProtocol_RemembersRejectedSubtype(t *testing.T) {
+	t.Parallel()
+
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport)
+	defer p.Close()
+	p.setCLIVersion("2.0.0")
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.SetMcpServers(context.Background(), map[string]any{})
+		errc <- err
+	}()
+
+	require.Eventually(t, func() bool { return transport.writeCount() == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, p.HandleIncomingMessage(context.Background(), map[string]any{
+		"type": MessageTypeControlResponse,
+		"response": map[string]any{
+			"subtype":    ResponseSubtypeError,
+			"request_id": transport.messages(t)[0]["request_id"],
+			"error":      "Unsupported control request subtype: set_mcp_servers",
+		},
+	}))
+	err := <-errc
+	require.True(t, shared.IsUnsupportedError(err), "got %v", err)
+	assert.Contains(t, err.Error(), "set_mcp_servers unsupported by CLI v2.0.0")
+
+	// The next attempt fails without asking the CLI again
+	_, err = p.SetMcpServers(context.Background(), map[string]any{})
+	assert.True(t, shared.IsUnsupportedError(err), "got %v", err)
+	assert.Equal(t, 1, transport.writeCount())
+
+	// Other errors are passed on as they are
+	go func() {
+		errc <- p.SetModel(context.Background(), nil)
+	}()
+	require.Eventually(t, func() bool { return transport.writeCount() == 2 }, time.Second, time.Millisecond)
+	require.NoError(t, p.HandleIncomingMessage(context.Background(), map[string]any{
+		"type": MessageTypeControlResponse,
+		"response": map[string]any{
+			"subtype":    ResponseSubtypeError,
+			"request_id": transport.messages(t)[1]["request_id"],
+			"error":      "model not found",
+		},
+	}))
+	err = <-errc
+	require.Error(t, err)
+	assert.False(t, shared.IsUnsupportedError(err))
+}
@@ -7,6 +7,9 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,21 +42,33 @@ type Protocol struct {
 	pendingRequests map[string]chan *ControlResponse
 	requestCounter  int64
 
+	// Control requests from the CLI, by request ID, and the dispatcher that
+	// handles those passed to Dispatch
+	inbound         map[string]*inboundRequest
+	dispatcher      *dispatcher
+	dispatchOptions shared.ControlDispatchOptions
+
 	// Message routing
 	messageStream chan map[string]any
 
 	// State
 	initialized  bool
 	initResponse *InitializeResponse
+	cliVersion   string          // reported in the init system message
+	unsupported  map[string]bool // control subtypes the CLI rejected
 	closed       bool
 	started      bool
 
 	// Configuration
 	initTimeout time.Duration
+	logger      *slog.Logger
 
 	// Permission callback
 	canUseToolCallback shared.CanUseToolCallback
 
+	// Handlers of control request subtypes the protocol does not handle itself
+	controlHandlers *ControlHandlerRegistry
+
 	// Hook callbacks
 	hooks            map[shared.HookEvent][]ProtocolHookMatcher
 	hookCallbacks    map[string]ProtocolHookCallback
@@ -79,6 +94,14 @@ func WithInitTimeout(timeout time.Duration) ProtocolOption {
 	}
 }
 
+// WithLogger sets the logger for control protocol, hook and MCP routing diagnostics.
+// Secrets are redacted (see shared.NewLogger).
+func WithLogger(logger *slog.Logger) ProtocolOption {
+	return func(p *Protocol) {
+		p.logger = logger
+	}
+}
+
 // WithCanUseToolCallback sets the permission callback for tool usage requests.
 // The callback is invoked when CLI requests permission to use a tool.
 func WithCanUseToolCallback(callback shared.CanUseToolCallback) ProtocolOption {
@@ -111,11 +134,28 @@ func WithSdkMcpServers(servers map[string]*mcp.SdkMcpServer) ProtocolOption {
 	}
 }
 
+// WithControlHandlers sets the registry of handlers for control request
+// subtypes the protocol does not handle itself.
+func WithControlHandlers(registry *ControlHandlerRegistry) ProtocolOption {
+	return func(p *Protocol) {
+		p.controlHandlers = registry
+	}
+}
+
+// WithControlDispatch sets how many control requests from the CLI are
+// handled concurrently by Dispatch.
+func WithControlDispatch(opts shared.ControlDispatchOptions) ProtocolOption {
+	return func(p *Protocol) {
+		p.dispatchOptions = opts
+	}
+}
+
 // NewProtocol creates a new control protocol handler.
 func NewProtocol(transport ControlTransport, opts ...ProtocolOption) *Protocol {
 	p := &Protocol{
 		transport:       transport,
 		pendingRequests: make(map[string]chan *ControlResponse),
+		inbound:         make(map[string]*inboundRequest),
 		messageStream:   make(chan map[string]any, 100),
 		initTimeout:     DefaultInitTimeout,
 	}
@@ -123,6 +163,8 @@ func NewProtocol(transport ControlTransport, opts ...ProtocolOption) *Protocol {
 	for _, opt := range opts {
 		opt(p)
 	}
+	p.logger = shared.NewLogger(p.logger, nil)
+	p.dispatcher = newDispatcher(p.dispatchOptions, p.serveInbound)
 
 	return p
 }
@@ -166,13 +208,13 @@ func (p *Protocol) readLoop(readChan <-chan []byte) {
 			// Parse the incoming message
 			var msg map[string]any
 			if err := json.Unmarshal(data, &msg); err != nil {
-				// Log parse error but continue
+				p.logger.Warn("invalid control message", "error", err)
 				continue
 			}
 
 			// Route the message
-			if err := p.HandleIncomingMessage(p.ctx, msg); err != nil {
-				// Log routing error but continue
+			if err := p.Dispatch(p.ctx, msg); err != nil {
+				p.logger.Warn("routing control message failed", "error", err)
 				continue
 			}
 		}
@@ -229,6 +271,14 @@ func (p *Protocol) SendControlRequest(ctx context.Context, request any, timeout
 	// Add newline for JSON lines protocol
 	data = append(data, '\n')
 
+	subtype := requestSubtype(data)
+	if err := p.checkSupported(subtype); err != nil {
+		return nil, err
+	}
+
+	log := p.logger.With("request_id", requestID, "subtype", subtype)
+	log.Debug("sending control request")
+
 	if err := p.transport.Write(ctx, data); err != nil {
 		return nil, fmt.Errorf("send control request: %w", err)
 	}
@@ -240,12 +290,24 @@ func (p *Protocol) SendControlRequest(ctx context.Context, request any, timeout
 	select {
 	case response := <-responseChan:
 		if response.Subtype == ResponseSubtypeError {
-			return nil, fmt.Errorf("control request error: %s", response.Error)
+			log.Warn("control request failed", "error", response.Error)
+			err := fmt.Errorf("control request error: %s", response.Error)
+			if isUnsupportedResponse(response.Error) {
+				return nil, p.markUnsupported(subtype, err)
+			}
+			return nil, err
 		}
+		log.Debug("control request succeeded")
 		return response.Response, nil
 
 	case <-timeoutCtx.Done():
-		return nil, fmt.Errorf("control request timeout: %w", timeoutCtx.Err())
+		// The CLI stops working on a request the SDK gave up on
+		p.sendCancelRequest(ctx, requestID)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("control request: %w", ctx.Err())
+		}
+		log.Warn("control request timed out", "timeout", timeout)
+		return nil, shared.NewTimeoutError("control request", timeout.String())
 	}
 }
 
@@ -263,34 +325,144 @@ func (p *Protocol) HandleIncomingMessage(ctx context.Context, msg map[string]any
 		return p.handleControlResponse(ctx, msg)
 	case MessageTypeControlRequest:
 		// Incoming control request from CLI (e.g., hook callback, permission check)
-		return p.handleIncomingControlRequest(ctx, msg)
+		requestID, _ := msg["request_id"].(string)
+		req := p.trackInbound(ctx, requestID, msg)
+		defer req.done()
+		return p.handleIncomingControlRequest(req)
+	case MessageTypeControlCancelRequest:
+		p.handleCancelRequest(msg)
+		return nil
 	default:
 		// Regular SDK message - forward to stream
 		return p.forwardToStream(ctx, msg)
 	}
 }
 
+// Dispatch routes msg like HandleIncomingMessage, except that control
+// requests from the CLI are queued and handled on a pool of workers, off the
+// caller's goroutine. A reader of the CLI's output thus keeps routing
+// messages, responses and cancellations while a permission prompt or tool
+// runs. Requests about the same tool use are handled in arrival order.
+func (p *Protocol) Dispatch(ctx context.Context, msg map[string]any) error {
+	if msgType, _ := msg["type"].(string); msgType != MessageTypeControlRequest {
+		return p.HandleIncomingMessage(ctx, msg)
+	}
+
+	requestID, _ := msg["request_id"].(string)
+	req := p.trackInbound(ctx, requestID, msg)
+	if request, ok := msg["request"].(map[string]any); ok {
+		req.key = getString(request, "tool_use_id")
+	}
+	if !p.dispatcher.enqueue(req) {
+		// Closed: nobody is waiting for the response any more
+		req.done()
+	}
+	return nil
+}
+
+// serveInbound handles a control request taken from the dispatcher.
+func (p *Protocol) serveInbound(req *inboundRequest) {
+	start := time.Now()
+	if err := p.handleIncomingControlRequest(req); err != nil {
+		p.logger.Warn("handling control request failed", "request_id", req.id, "error", err)
+	}
+	p.logger.Debug("control request handled", "request_id", req.id, "duration", time.Since(start))
+}
+
+// ControlStats reports the handling of the control requests passed to Dispatch.
+func (p *Protocol) ControlStats() ControlStats {
+	return p.dispatcher.snapshot()
+}
+
+// inboundRequest is a control request from the CLI. Its handler runs under
+// ctx, which ends when the CLI cancels the request, on an interrupt or on
+// Close.
+type inboundRequest struct {
+	id     string
+	msg    map[string]any
+	key    string    // the tool use the request is about, if any
+	queued time.Time // when the dispatcher queued it
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   func() // forgets the request
+}
+
+// trackInbound registers the control request msg from the CLI, so that a
+// control_cancel_request can cancel its context, derived from ctx.
+func (p *Protocol) trackInbound(ctx context.Context, requestID string, msg map[string]any) *inboundRequest {
+	req := &inboundRequest{id: requestID, msg: msg}
+	req.ctx, req.cancel = context.WithCancel(ctx)
+	req.done = func() {
+		p.mu.Lock()
+		if p.inbound[requestID] == req {
+			delete(p.inbound, requestID)
+		}
+		p.mu.Unlock()
+		req.cancel()
+	}
+
+	p.mu.Lock()
+	p.inbound[requestID] = req
+	p.mu.Unlock()
+	return req
+}
+
+// handleCancelRequest cancels the control request the CLI withdrew.
+func (p *Protocol) handleCancelRequest(msg map[string]any) {
+	requestID, _ := msg["request_id"].(string)
+
+	p.mu.Lock()
+	req := p.inbound[requestID]
+	p.mu.Unlock()
+
+	if req == nil {
+		// Already answered, or never received
+		p.logger.Debug("ignoring cancellation of unknown control request", "request_id", requestID)
+		return
+	}
+	p.logger.Debug("CLI cancelled control request", "request_id", requestID)
+	req.cancel()
+}
+
+// cancelInbound cancels every control request from the CLI being handled.
+func (p *Protocol) cancelInbound() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, req := range p.inbound {
+		req.cancel()
+	}
+}
+
 // handleIncomingControlRequest routes incoming control requests from CLI.
-func (p *Protocol) handleIncomingControlRequest(ctx context.Context, msg map[string]any) error {
-	request, ok := msg["request"].(map[string]any)
+// A request cancelled while it is handled gets no response.
+func (p *Protocol) handleIncomingControlRequest(req *inboundRequest) error {
+	request, ok := req.msg["request"].(map[string]any)
 	if !ok {
 		return fmt.Errorf("invalid control request: missing request field")
 	}
 
 	subtype, _ := request["subtype"].(string)
-	requestID, _ := msg["request_id"].(string)
+	log := p.logger.With("request_id", req.id, "subtype", subtype)
+	log.Debug("received control request")
 
+	var err error
 	switch subtype {
 	case SubtypeCanUseTool:
-		return p.handleCanUseToolRequest(ctx, requestID, request)
+		err = p.handleCanUseToolRequest(req.ctx, req.id, request)
 	case SubtypeHookCallback:
-		return p.handleHookCallbackRequest(ctx, requestID, request)
+		err = p.handleHookCallbackRequest(req.ctx, req.id, request)
 	case SubtypeMcpMessage:
-		return p.handleMcpMessageRequest(ctx, requestID, request)
+		err = p.handleMcpMessageRequest(req.ctx, req.id, request)
 	default:
-		// Unknown subtype - ignore for forward compatibility
+		err = p.handleCustomControlRequest(req.ctx, req.id, subtype, request)
+	}
+
+	if err != nil && req.ctx.Err() != nil {
+		// The response was withheld because the request was cancelled
+		log.Debug("control request cancelled", "error", err)
 		return nil
 	}
+	return err
 }
 
 // handleControlResponse routes a control response to the waiting request.
@@ -311,6 +483,7 @@ func (p *Protocol) handleControlResponse(_ context.Context, msg map[string]any)
 
 	if !exists {
 		// Response for unknown request - ignore (could be stale or from another session)
+		p.logger.Debug("ignoring control response for unknown request", "request_id", requestID)
 		return nil
 	}
 
@@ -350,6 +523,33 @@ func (p *Protocol) forwardToStream(ctx context.Context, msg map[string]any) erro
 	}
 }
 
+// writeResponse sends the response to a control request from the CLI, unless
+// ctx, the request's context, has ended: the CLI withdrew the request or the
+// session is over.
+func (p *Protocol) writeResponse(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.transport.Write(ctx, append(data, '\n'))
+}
+
+// sendCancelRequest tells the CLI that the SDK no longer waits for the
+// response to requestID.
+func (p *Protocol) sendCancelRequest(ctx context.Context, requestID string) {
+	data, err := json.Marshal(SDKControlCancelRequest{
+		Type:      MessageTypeControlCancelRequest,
+		RequestID: requestID,
+	})
+	if err != nil {
+		return
+	}
+
+	// ctx has ended, but the cancellation must still be written
+	if err := p.transport.Write(context.WithoutCancel(ctx), append(data, '\n')); err != nil {
+		p.logger.Debug("sending control cancel request failed", "request_id", requestID, "error", err)
+	}
+}
+
 // sendErrorResponse sends an error response back to CLI.
 // This is a shared utility used by hooks, MCP, and permissions handlers.
 func (p *Protocol) sendErrorResponse(ctx context.Context, requestID string, errMsg string) error {
@@ -367,7 +567,7 @@ func (p *Protocol) sendErrorResponse(ctx context.Context, requestID string, errM
 		return fmt.Errorf("marshal error response: %w", err)
 	}
 
-	return p.transport.Write(ctx, append(data, '\n'))
+	return p.writeResponse(ctx, data)
 }
 
 // Initialize performs the control protocol handshake with the CLI.
@@ -399,15 +599,11 @@ func (p *Protocol) Initialize(ctx context.Context) (*InitializeResponse, error)
 		return nil, fmt.Errorf("initialize failed: %w", err)
 	}
 
-	// Parse response
+	// Parse response. Fields of an unexpected type are left empty.
 	var initResp InitializeResponse
-	if resultMap, ok := result.(map[string]any); ok {
-		if cmds, ok := resultMap["supported_commands"].([]any); ok {
-			for _, cmd := range cmds {
-				if cmdStr, ok := cmd.(string); ok {
-					initResp.SupportedCommands = append(initResp.SupportedCommands, cmdStr)
-				}
-			}
+	if data, err := json.Marshal(result); err == nil {
+		if err := json.Unmarshal(data, &initResp); err != nil {
+			p.logger.Debug("unexpected initialize response", "error", err)
 		}
 	}
 
@@ -419,8 +615,12 @@ func (p *Protocol) Initialize(ctx context.Context) (*InitializeResponse, error)
 	return &initResp, nil
 }
 
-// Interrupt sends an interrupt control request to the CLI.
+// Interrupt sends an interrupt control request to the CLI. Permission
+// callbacks, hooks and SDK MCP tools still running for the interrupted turn
+// have their contexts cancelled.
 func (p *Protocol) Interrupt(ctx context.Context) error {
+	p.cancelInbound()
+
 	_, err := p.SendControlRequest(ctx, InterruptRequest{
 		Subtype: SubtypeInterrupt,
 	}, 5*time.Second)
@@ -581,6 +781,63 @@ func (p *Protocol) IsClosed() bool {
 	return p.closed
 }
 
+// InitializeResponse returns the CLI's response to the initialize
+// handshake, or nil before it completed.
+func (p *Protocol) InitializeResponse() *InitializeResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.initResponse
+}
+
+// setCLIVersion records the CLI version reported in the init system message,
+// for UnsupportedErrors.
+func (p *Protocol) setCLIVersion(version string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cliVersion = version
+}
+
+// checkSupported fails fast with an UnsupportedError for a control request
+// whose subtype the CLI did not advertise or has already rejected, instead
+// of waiting for the request to time out.
+func (p *Protocol) checkSupported(subtype string) error {
+	if subtype == SubtypeInitialize {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	advertised := p.initResponse == nil || len(p.initResponse.SupportedCommands) == 0 ||
+		slices.Contains(p.initResponse.SupportedCommands, subtype)
+	if !advertised || p.unsupported[subtype] {
+		return shared.NewUnsupportedError(subtype, p.cliVersion, nil)
+	}
+	return nil
+}
+
+// markUnsupported remembers that the CLI rejected control requests of
+// subtype and returns the UnsupportedError for err.
+func (p *Protocol) markUnsupported(subtype string, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.unsupported == nil {
+		p.unsupported = make(map[string]bool)
+	}
+	p.unsupported[subtype] = true
+	return shared.NewUnsupportedError(subtype, p.cliVersion, err)
+}
+
+// isUnsupportedResponse reports whether a control error from the CLI means
+// it does not know the request's subtype, as in "Unsupported control request
+// subtype: rewind_files".
+func isUnsupportedResponse(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "subtype") &&
+		(strings.Contains(message, "unsupported") || strings.Contains(message, "unknown"))
+}
+
 // IsInitialized returns whether the protocol has completed initialization.
 func (p *Protocol) IsInitialized() bool {
 	p.mu.Lock()
@@ -588,7 +845,9 @@ func (p *Protocol) IsInitialized() bool {
 	return p.initialized
 }
 
-// Close shuts down the protocol handler.
+// Close shuts down the protocol handler. Queued control requests from the
+// CLI are dropped and the contexts of those being handled are cancelled;
+// Close does not wait for their handlers to return.
 func (p *Protocol) Close() error {
 	p.mu.Lock()
 	if p.closed {
@@ -598,6 +857,9 @@ func (p *Protocol) Close() error {
 	p.closed = true
 	p.mu.Unlock()
 
+	p.dispatcher.close()
+	p.cancelInbound()
+
 	// Cancel background goroutines
 	if p.cancel != nil {
 		p.cancel()
@@ -618,3 +880,14 @@ func (p *Protocol) SetPendingRequest(requestID string, responseChan chan *Contro
 	defer p.mu.Unlock()
 	p.pendingRequests[requestID] = responseChan
 }
+
+// requestSubtype returns the subtype of an encoded control request for logging.
+func requestSubtype(data []byte) string {
+	var envelope struct {
+		Request struct {
+			Subtype string `json:"subtype"`
+		} `json:"request"`
+	}
+	_ = json.Unmarshal(data, &envelope)
+	return envelope.Request.Subtype
+}
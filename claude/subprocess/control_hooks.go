@@ -57,6 +57,11 @@ func (p *Protocol) handleHookCallbackRequest(ctx context.Context, requestID stri
 	eventName, _ := inputData["hook_event_name"].(string)
 	event := shared.HookEvent(eventName)
 
+	log := p.logger.With("request_id", requestID, "callback_id", callbackID, "hook_event", eventName)
+	if sessionID, ok := inputData["session_id"].(string); ok {
+		log = log.With("session_id", sessionID)
+	}
+
 	// Parse input based on event type
 	input := p.parseHookInput(event, inputData)
 
@@ -72,8 +77,10 @@ func (p *Protocol) handleHookCallbackRequest(ctx context.Context, requestID stri
 	p.hookCallbacksMu.RUnlock()
 
 	if !exists {
+		log.Warn("hook callback not found")
 		return p.sendErrorResponse(ctx, requestID, fmt.Sprintf("callback not found: %s", callbackID))
 	}
+	log.Debug("invoking hook callback")
 
 	// Invoke callback with panic recovery (matches permission callback pattern)
 	var result *shared.SyncHookOutput
@@ -88,6 +95,7 @@ func (p *Protocol) handleHookCallbackRequest(ctx context.Context, requestID stri
 	}()
 
 	if callbackErr != nil {
+		log.Warn("hook callback failed", "error", callbackErr)
 		return p.sendErrorResponse(ctx, requestID, fmt.Sprintf("callback error: %v", callbackErr))
 	}
 
@@ -206,7 +214,7 @@ func (p *Protocol) sendHookResponse(ctx context.Context, requestID string, resul
 		return fmt.Errorf("marshal hook response: %w", err)
 	}
 
-	return p.transport.Write(ctx, append(data, '\n'))
+	return p.writeResponse(ctx, data)
 }
 
 // buildHooksConfig creates the hooks config for the initialize request.
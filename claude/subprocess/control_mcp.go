@@ -23,15 +23,20 @@ func (p *Protocol) handleMcpMessageRequest(ctx context.Context, requestID string
 		return p.sendErrorResponse(ctx, requestID, "missing message")
 	}
 
+	method, _ := message["method"].(string)
+	log := p.logger.With("request_id", requestID, "server", serverName, "method", method)
+
 	// Thread-safe server lookup
 	p.mu.Lock()
 	server, exists := p.sdkMcpServers[serverName]
 	p.mu.Unlock()
 
 	if !exists {
+		log.Warn("MCP server not found")
 		return p.sendMcpErrorResponse(ctx, requestID, message, -32601,
 			fmt.Sprintf("server '%s' not found", serverName))
 	}
+	log.Debug("routing MCP message")
 
 	// Route JSONRPC method with panic recovery
 	var mcpResponse map[string]any
@@ -46,6 +51,7 @@ func (p *Protocol) handleMcpMessageRequest(ctx context.Context, requestID string
 	}()
 
 	if routeErr != nil {
+		log.Warn("MCP handler failed", "error", routeErr)
 		return p.sendMcpErrorResponse(ctx, requestID, message, -32603, routeErr.Error())
 	}
 
@@ -66,7 +72,7 @@ func (p *Protocol) sendMcpResponse(ctx context.Context, requestID string, mcpRes
 	if err != nil {
 		return fmt.Errorf("marshal MCP response: %w", err)
 	}
-	return p.transport.Write(ctx, append(data, '\n'))
+	return p.writeResponse(ctx, data)
 }
 
 // sendMcpErrorResponse sends an MCP JSONRPC error response.
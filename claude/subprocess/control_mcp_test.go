@@ -0,0 +1,144 @@
+// Package subprocess provides tests for SDK MCP message routing.
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/dotcommander/agent-sdk-go/claude/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingControlTransport is a ControlTransport that records every write.
+type recordingControlTransport struct {
+	mu     sync.Mutex
+	writes [][]byte
+}
+
+func (r *recordingControlTransport) Write(_ context.Context, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, append([]byte(nil), data...))
+	return nil
+}
+
+func (r *recordingControlTransport) Read(context.Context) <-chan []byte { return nil }
+
+func (r *recordingControlTransport) Close() error { return nil }
+
+// messages decodes all recorded writes as JSON objects.
+func (r *recordingControlTransport) messages(t *testing.T) []map[string]any {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msgs := make([]map[string]any, 0, len(r.writes))
+	for _, data := range r.writes {
+		var msg map[string]any
+		require.NoError(t, json.Unmarshal(data, &msg))
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// mcpMessageRequest builds an inbound mcp_message control request.
+func mcpMessageRequest(serverName string, message map[string]any) map[string]any {
+	return map[string]any{
+		"type":       MessageTypeControlRequest,
+		"request_id": "req_mcp_1",
+		"request": map[string]any{
+			"subtype":     SubtypeMcpMessage,
+			"server_name": serverName,
+			"message":     message,
+		},
+	}
+}
+
+// mcpResponse extracts the JSON-RPC response from a recorded control response.
+func mcpResponse(t *testing.T, msg map[string]any) map[string]any {
+	t.Helper()
+
+	response, ok := msg["response"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "req_mcp_1", response["request_id"])
+	inner, ok := response["response"].(map[string]any)
+	require.True(t, ok)
+	mcpResp, ok := inner["mcp_response"].(map[string]any)
+	require.True(t, ok)
+	return mcpResp
+}
+
+func TestHandleMcpMessageRequest_RoutesToServer(t *testing.T) {
+	t.Parallel()
+
+	var gotArgs map[string]any
+	server := mcp.CreateSdkMcpServer("calc", "1.0.0", []*mcp.SdkMcpTool{
+		mcp.Tool("add", "Add numbers", map[string]string{"a": "number", "b": "number"},
+			func(_ context.Context, args map[string]any) (map[string]any, error) {
+				gotArgs = args
+				return mcp.TextContent("5"), nil
+			}),
+	})
+
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport, WithSdkMcpServers(map[string]*mcp.SdkMcpServer{"calc": server}))
+
+	err := p.HandleIncomingMessage(context.Background(), mcpMessageRequest("calc", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      7.0,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name":      "add",
+			"arguments": map[string]any{"a": 2.0, "b": 3.0},
+		},
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"a": 2.0, "b": 3.0}, gotArgs)
+
+	msgs := transport.messages(t)
+	require.Len(t, msgs, 1)
+	resp := mcpResponse(t, msgs[0])
+	assert.Equal(t, 7.0, resp["id"])
+	result, ok := resp["result"].(map[string]any)
+	require.True(t, ok)
+	assert.NotEmpty(t, result["content"])
+}
+
+func TestHandleMcpMessageRequest_UnknownServer(t *testing.T) {
+	t.Parallel()
+
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport)
+
+	err := p.HandleIncomingMessage(context.Background(), mcpMessageRequest("missing", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1.0,
+		"method":  "tools/list",
+	}))
+	require.NoError(t, err)
+
+	msgs := transport.messages(t)
+	require.Len(t, msgs, 1)
+	resp := mcpResponse(t, msgs[0])
+	errObj, ok := resp["error"].(map[string]any)
+	require.True(t, ok)
+	assert.Contains(t, errObj["message"], "not found")
+}
+
+func TestTransport_NeedsProtocolHandshake_SdkMcpServers(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransport(&TransportConfig{
+		SdkMcpServers: map[string]*mcp.SdkMcpServer{
+			"calc": mcp.CreateSdkMcpServer("calc", "1.0.0", nil),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, transport.needsProtocolHandshake())
+}
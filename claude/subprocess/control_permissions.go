@@ -42,6 +42,8 @@ func (p *Protocol) handleCanUseToolRequest(ctx context.Context, requestID string
 		opts.AgentID = agentID
 	}
 
+	log := p.logger.With("request_id", requestID, "tool", toolName)
+
 	// Get callback (thread-safe read)
 	p.mu.Lock()
 	callback := p.canUseToolCallback
@@ -49,6 +51,7 @@ func (p *Protocol) handleCanUseToolRequest(ctx context.Context, requestID string
 
 	// No callback = deny (secure default)
 	if callback == nil {
+		log.Debug("denying tool use without permission callback")
 		return p.sendPermissionResponse(ctx, requestID, shared.PermissionResult{
 			Behavior: shared.PermissionBehaviorDeny,
 			Message:  "no permission callback registered",
@@ -68,8 +71,10 @@ func (p *Protocol) handleCanUseToolRequest(ctx context.Context, requestID string
 	}()
 
 	if err != nil {
+		log.Warn("permission callback failed", "error", err)
 		return p.sendErrorResponse(ctx, requestID, fmt.Sprintf("callback error: %v", err))
 	}
+	log.Debug("permission decided", "behavior", result.Behavior)
 
 	return p.sendPermissionResponse(ctx, requestID, result)
 }
@@ -109,7 +114,7 @@ func (p *Protocol) sendPermissionResponse(ctx context.Context, requestID string,
 		return fmt.Errorf("marshal permission response: %w", err)
 	}
 
-	return p.transport.Write(ctx, append(data, '\n'))
+	return p.writeResponse(ctx, data)
 }
 
 // parsePermissionSuggestions converts raw JSON to PermissionUpdate slice.
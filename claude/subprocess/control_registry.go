@@ -0,0 +1,131 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the registry of handlers for custom control requests.
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ControlHandlerFunc handles a control request from the CLI. request holds
+// the request's fields, including "subtype". The returned value is sent to
+// the CLI as the response payload; a returned error is sent as an error
+// response. ctx is cancelled when the CLI withdraws the request, on
+// interrupt and on Close, and the response is then discarded.
+type ControlHandlerFunc func(ctx context.Context, request map[string]any) (any, error)
+
+// ControlHandlerRegistry provides a registry for handlers of control request
+// subtypes that the SDK does not handle itself, such as subtypes added by a
+// newer or forked CLI. New subtypes can be handled without modifying the
+// protocol code (OCP). The built-in subtypes can_use_tool, hook_callback
+// and mcp_message are always handled by the SDK.
+type ControlHandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]ControlHandlerFunc
+}
+
+// NewControlHandlerRegistry creates a new, empty registry.
+func NewControlHandlerRegistry() *ControlHandlerRegistry {
+	return &ControlHandlerRegistry{
+		handlers: make(map[string]ControlHandlerFunc),
+	}
+}
+
+// Register registers a handler for a control request subtype.
+// If a handler for this subtype already exists, it will be replaced.
+func (r *ControlHandlerRegistry) Register(subtype string, handler ControlHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[subtype] = handler
+}
+
+// Unregister removes the handler for a control request subtype.
+func (r *ControlHandlerRegistry) Unregister(subtype string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, subtype)
+}
+
+// Handle handles request with the handler registered for subtype.
+// Returns an error if no handler is registered for the subtype.
+func (r *ControlHandlerRegistry) Handle(ctx context.Context, subtype string, request map[string]any) (any, error) {
+	r.mu.RLock()
+	handler, ok := r.handlers[subtype]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no handler for control request subtype: %s", subtype)
+	}
+
+	return handler(ctx, request)
+}
+
+// HasHandler returns true if a handler is registered for the subtype.
+func (r *ControlHandlerRegistry) HasHandler(subtype string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.handlers[subtype]
+	return ok
+}
+
+// RegisteredSubtypes returns a slice of all registered subtypes.
+func (r *ControlHandlerRegistry) RegisteredSubtypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subtypes := make([]string, 0, len(r.handlers))
+	for s := range r.handlers {
+		subtypes = append(subtypes, s)
+	}
+	return subtypes
+}
+
+// handleCustomControlRequest answers a control request of a subtype the SDK
+// does not handle itself, with the handler registered for it. Without one,
+// the CLI is told the subtype is unsupported instead of being left waiting.
+func (p *Protocol) handleCustomControlRequest(ctx context.Context, requestID, subtype string, request map[string]any) error {
+	if p.controlHandlers == nil || !p.controlHandlers.HasHandler(subtype) {
+		return p.sendErrorResponse(ctx, requestID, fmt.Sprintf("Unsupported control request subtype: %s", subtype))
+	}
+
+	// Invoke the handler with panic recovery, like the permission callback
+	var result any
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("control handler panicked: %v", r)
+			}
+		}()
+		result, err = p.controlHandlers.Handle(ctx, subtype, request)
+	}()
+
+	if err != nil {
+		p.logger.Warn("control handler failed", "request_id", requestID, "subtype", subtype, "error", err)
+		return p.sendErrorResponse(ctx, requestID, err.Error())
+	}
+
+	return p.sendSuccessResponse(ctx, requestID, result)
+}
+
+// sendSuccessResponse sends a success response with payload back to the CLI.
+func (p *Protocol) sendSuccessResponse(ctx context.Context, requestID string, payload any) error {
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	response := SDKControlResponse{
+		Type: MessageTypeControlResponse,
+		Response: ControlResponse{
+			Subtype:   ResponseSubtypeSuccess,
+			RequestID: requestID,
+			Response:  payload,
+		},
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal control response: %w", err)
+	}
+	return p.writeResponse(ctx, data)
+}
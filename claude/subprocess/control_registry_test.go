@@ -0,0 +1,176 @@
+// Package subprocess provides tests for custom control request handlers.
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// customRequest builds an inbound control request of subtype.
+func customRequest(requestID, subtype string) map[string]any {
+	return map[string]any{
+		"type":       MessageTypeControlRequest,
+		"request_id": requestID,
+		"request": map[string]any{
+			"subtype": subtype,
+			"message": "Pick a branch",
+		},
+	}
+}
+
+func TestControlHandlerRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := NewControlHandlerRegistry()
+	assert.False(t, r.HasHandler("elicitation"))
+
+	r.Register("elicitation", func(context.Context, map[string]any) (any, error) { return "first", nil })
+	r.Register("elicitation", func(context.Context, map[string]any) (any, error) { return "second", nil })
+	assert.True(t, r.HasHandler("elicitation"))
+	assert.Equal(t, []string{"elicitation"}, r.RegisteredSubtypes())
+
+	result, err := r.Handle(context.Background(), "elicitation", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", result, "a later registration replaces the handler")
+
+	r.Unregister("elicitation")
+	_, err = r.Handle(context.Background(), "elicitation", nil)
+	assert.Error(t, err)
+}
+
+func TestProtocol_CustomControlRequests(t *testing.T) {
+	t.Parallel()
+
+	handlers := NewControlHandlerRegistry()
+	handlers.Register("elicitation", func(_ context.Context, request map[string]any) (any, error) {
+		return map[string]any{"action": "accept", "echo": request["message"]}, nil
+	})
+	handlers.Register("failing", func(context.Context, map[string]any) (any, error) {
+		return nil, errors.New("not today")
+	})
+	handlers.Register("panicking", func(context.Context, map[string]any) (any, error) {
+		panic("boom")
+	})
+
+	tests := []struct {
+		name    string
+		subtype string
+		check   func(t *testing.T, response map[string]any)
+	}{
+		{
+			name:    "handled",
+			subtype: "elicitation",
+			check: func(t *testing.T, response map[string]any) {
+				assert.Equal(t, ResponseSubtypeSuccess, response["subtype"])
+				assert.Equal(t, map[string]any{"action": "accept", "echo": "Pick a branch"}, response["response"])
+			},
+		},
+		{
+			name:    "handler error",
+			subtype: "failing",
+			check: func(t *testing.T, response map[string]any) {
+				assert.Equal(t, ResponseSubtypeError, response["subtype"])
+				assert.Equal(t, "not today", response["error"])
+			},
+		},
+		{
+			name:    "handler panic",
+			subtype: "panicking",
+			check: func(t *testing.T, response map[string]any) {
+				assert.Equal(t, ResponseSubtypeError, response["subtype"])
+				assert.Contains(t, response["error"], "boom")
+			},
+		},
+		{
+			name:    "no handler",
+			subtype: "unheard_of",
+			check: func(t *testing.T, response map[string]any) {
+				assert.Equal(t, ResponseSubtypeError, response["subtype"])
+				assert.Equal(t, "Unsupported control request subtype: unheard_of", response["error"])
+				assert.True(t, isUnsupportedResponse(response["error"].(string)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := &recordingControlTransport{}
+			p := NewProtocol(transport, WithControlHandlers(handlers))
+			defer p.Close()
+
+			require.NoError(t, p.Dispatch(context.Background(), customRequest("req_custom_1", tt.subtype)))
+			require.Eventually(t, func() bool { return transport.writeCount() == 1 }, time.Second, time.Millisecond)
+
+			msg := transport.messages(t)[0]
+			assert.Equal(t, MessageTypeControlResponse, msg["type"])
+			response, ok := msg["response"].(map[string]any)
+			require.True(t, ok)
+			assert.Equal(t, "req_custom_1", response["request_id"])
+			tt.check(t, response)
+		})
+	}
+}
+
+func TestProtocol_BuiltInSubtypesIgnoreRegistry(t *testing.T) {
+	t.Parallel()
+
+	handlers := NewControlHandlerRegistry()
+	handlers.Register(SubtypeCanUseTool, func(context.Context, map[string]any) (any, error) {
+		t.Error("the registry handled a built-in subtype")
+		return nil, nil
+	})
+
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport, WithControlHandlers(handlers))
+	defer p.Close()
+
+	// Without a permission callback the tool is denied
+	require.NoError(t, p.HandleIncomingMessage(context.Background(), canUseToolRequest("req_perm_1", "Bash")))
+	response, ok := transport.messages(t)[0]["response"].(map[string]any)
+	require.True(t, ok)
+	inner, ok := response["response"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "deny", inner["behavior"])
+}
+
+func TestTransport_ControlHandlers(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI sends a custom request and reports through the session
+	// ID whether the answer came from the registered handler
+	script := writeFakeCLI(t, `read line
+id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\",\"response\":{}}}"
+echo '{"type":"control_request","request_id":"cli_1","request":{"subtype":"elicitation","message":"Pick a branch"}}'
+read line
+case "$line" in
+*'"action":"accept"'*) echo '{"type":"result","subtype":"success","session_id":"handled"}' ;;
+*) echo '{"type":"result","subtype":"success","session_id":"unhandled"}' ;;
+esac
+read line
+`)
+
+	handlers := NewControlHandlerRegistry()
+	handlers.Register("elicitation", func(context.Context, map[string]any) (any, error) {
+		return map[string]any{"action": "accept"}, nil
+	})
+
+	// The registry alone enables the control protocol
+	transport, err := NewTransport(&TransportConfig{CLIPath: script, ControlHandlers: handlers})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	result, ok := receiveMessage(t, msgChan).(*shared.ResultMessage)
+	require.True(t, ok)
+	assert.Equal(t, "handled", result.SessionID)
+}
@@ -0,0 +1,182 @@
+// Package subprocess provides tests for control request cancellation.
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCount returns the number of recorded writes.
+func (r *recordingControlTransport) writeCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.writes)
+}
+
+// canUseToolRequest builds an inbound can_use_tool control request.
+func canUseToolRequest(requestID, toolName string) map[string]any {
+	return map[string]any{
+		"type":       MessageTypeControlRequest,
+		"request_id": requestID,
+		"request": map[string]any{
+			"subtype":   SubtypeCanUseTool,
+			"tool_name": toolName,
+			"input":     map[string]any{},
+		},
+	}
+}
+
+// blockingPermission returns a permission callback that reports its start on
+// started and blocks until its context ends, which it reports on stopped.
+func blockingPermission(started chan<- struct{}, stopped chan<- error) shared.CanUseToolCallback {
+	return func(ctx context.Context, _ string, _ map[string]any, _ shared.CanUseToolOptions) (shared.PermissionResult, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return shared.PermissionResult{Behavior: shared.PermissionBehaviorAllow}, nil
+	}
+}
+
+func TestSendControlRequest_NotifiesCLIOfCancellation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name:    "context cancelled",
+			timeout: time.Minute,
+			cancel:  true,
+			check:   func(t *testing.T, err error) { assert.ErrorIs(t, err, context.Canceled) },
+		},
+		{
+			name:    "timed out",
+			timeout: 10 * time.Millisecond,
+			check:   func(t *testing.T, err error) { assert.True(t, shared.IsTimeoutError(err), "got %v", err) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := &recordingControlTransport{}
+			p := NewProtocol(transport)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() {
+				_, err := p.SendControlRequest(ctx, InterruptRequest{Subtype: SubtypeInterrupt}, tt.timeout)
+				errc <- err
+			}()
+
+			require.Eventually(t, func() bool { return transport.writeCount() == 1 }, time.Second, time.Millisecond)
+			if tt.cancel {
+				cancel()
+			}
+			tt.check(t, <-errc)
+
+			msgs := transport.messages(t)
+			require.Len(t, msgs, 2)
+			assert.Equal(t, MessageTypeControlCancelRequest, msgs[1]["type"])
+			assert.Equal(t, msgs[0]["request_id"], msgs[1]["request_id"])
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			assert.Empty(t, p.pendingRequests)
+		})
+	}
+}
+
+func TestProtocol_CLICancelsInboundRequest(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport, WithCanUseToolCallback(blockingPermission(started, stopped)))
+	defer p.Close()
+
+	ctx := context.Background()
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_perm_1", "Bash")))
+	<-started
+
+	// Other messages are routed while the permission prompt is open
+	require.NoError(t, p.Dispatch(ctx, map[string]any{"type": shared.MessageTypeAssistant}))
+	assert.Equal(t, shared.MessageTypeAssistant, (<-p.ReceiveMessages())["type"])
+
+	require.NoError(t, p.Dispatch(ctx, map[string]any{
+		"type":       MessageTypeControlCancelRequest,
+		"request_id": "req_perm_1",
+	}))
+	assert.ErrorIs(t, <-stopped, context.Canceled)
+
+	// The next request is answered; the cancelled one is not
+	require.NoError(t, p.Dispatch(ctx, mcpMessageRequest("missing", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1.0,
+		"method":  "tools/list",
+	})))
+	require.Eventually(t, func() bool { return transport.writeCount() == 1 }, time.Second, time.Millisecond)
+	mcpResponse(t, transport.messages(t)[0])
+}
+
+func TestProtocol_InterruptCancelsInboundRequests(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	p := NewProtocol(&recordingControlTransport{}, WithCanUseToolCallback(blockingPermission(started, stopped)))
+	defer p.Close()
+
+	require.NoError(t, p.Dispatch(context.Background(), canUseToolRequest("req_perm_1", "Bash")))
+	<-started
+
+	// The recording transport never answers the interrupt itself
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, p.Interrupt(ctx))
+	assert.ErrorIs(t, <-stopped, context.Canceled)
+}
+
+func TestTransport_CLICancelsPermissionPrompt(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI asks for a permission, withdraws the request once the
+	// user message arrives and ends the turn
+	script := writeFakeCLI(t, `read line
+id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\",\"response\":{}}}"
+echo '{"type":"control_request","request_id":"cli_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{}}}'
+read line
+echo '{"type":"control_cancel_request","request_id":"cli_1"}'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+read line
+`)
+
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:    script,
+		CanUseTool: blockingPermission(started, stopped),
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	<-started
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	assert.Equal(t, shared.MessageTypeResult, receiveMessage(t, msgChan).Type())
+	assert.ErrorIs(t, <-stopped, context.Canceled)
+}
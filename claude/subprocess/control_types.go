@@ -2,12 +2,17 @@
 // This file contains control protocol message types and structures.
 package subprocess
 
+import "github.com/dotcommander/agent-sdk-go/internal/shared"
+
 // Control protocol message type constants.
 const (
 	// MessageTypeControlRequest is sent TO the CLI to request an action.
 	MessageTypeControlRequest = "control_request"
 	// MessageTypeControlResponse is received FROM the CLI as a response.
 	MessageTypeControlResponse = "control_response"
+	// MessageTypeControlCancelRequest withdraws a pending control request.
+	// Both the SDK and the CLI send it.
+	MessageTypeControlCancelRequest = "control_cancel_request"
 )
 
 // Request subtype constants matching TypeScript SDK for 100% parity.
@@ -60,6 +65,15 @@ type SDKControlRequest struct {
 	Request any `json:"request"`
 }
 
+// SDKControlCancelRequest withdraws the control request with RequestID. The
+// receiver stops handling it and sends no response.
+type SDKControlCancelRequest struct {
+	// Type is always MessageTypeControlCancelRequest.
+	Type string `json:"type"`
+	// RequestID identifies the withdrawn request.
+	RequestID string `json:"request_id"`
+}
+
 // SDKControlResponse represents a control response received FROM the CLI.
 // This is the envelope that wraps all control response types.
 type SDKControlResponse struct {
@@ -101,6 +115,16 @@ type InitializeRequest struct {
 type InitializeResponse struct {
 	// SupportedCommands lists the control commands supported by this CLI version.
 	SupportedCommands []string `json:"supported_commands,omitempty"`
+	// Commands lists the slash commands available in the session.
+	Commands []shared.SlashCommand `json:"commands,omitempty"`
+	// Models lists the models the session can switch to.
+	Models []shared.ModelInfo `json:"models,omitempty"`
+	// OutputStyle is the active output style.
+	OutputStyle string `json:"output_style,omitempty"`
+	// AvailableOutputStyles lists the output styles that can be selected.
+	AvailableOutputStyles []string `json:"available_output_styles,omitempty"`
+	// Account describes the logged-in account.
+	Account *shared.AccountInfo `json:"account,omitempty"`
 }
 
 // SetPermissionModeRequest changes the permission mode at runtime.
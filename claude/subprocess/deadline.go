@@ -0,0 +1,179 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the idle, turn and session deadlines.
+package subprocess
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+const (
+	// minDeadlineCheck and maxDeadlineCheck bound how often deadlines are checked.
+	minDeadlineCheck = 10 * time.Millisecond
+	maxDeadlineCheck = time.Second
+)
+
+// deadlinesEnabled reports whether any deadline is configured.
+func (t *Transport) deadlinesEnabled() bool {
+	d := t.deadlines
+	return d.Idle > 0 || d.Turn > 0 || d.Session > 0
+}
+
+// deadlineCheckInterval returns a tenth of the shortest deadline, within
+// minDeadlineCheck and maxDeadlineCheck.
+func (t *Transport) deadlineCheckInterval() time.Duration {
+	interval := maxDeadlineCheck
+	for _, d := range []time.Duration{t.deadlines.Idle, t.deadlines.Turn, t.deadlines.Session} {
+		if d > 0 && d/10 < interval {
+			interval = d / 10
+		}
+	}
+	return max(interval, minDeadlineCheck)
+}
+
+// newDeadlineError describes an expired deadline.
+func newDeadlineError(limit shared.TimeoutLimit, timeout time.Duration) *shared.TimeoutError {
+	operation := string(limit)
+	if limit == shared.TimeoutLimitIdle {
+		operation = "waiting for CLI output"
+	}
+	err := shared.NewTimeoutError(operation, timeout.String())
+	err.Limit = limit
+	return err
+}
+
+// watchDeadlines checks the deadlines of the session that started at start
+// until ctx ends or the session deadline expires.
+func (t *Transport) watchDeadlines(ctx context.Context, start time.Time) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.deadlineCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if d := t.deadlines.Session; d > 0 && now.Sub(start) >= d {
+				t.expire(ctx, shared.TimeoutLimitSession, d)
+				return
+			}
+			if limit, d, ok := t.expiredTurn(now); ok {
+				t.expire(ctx, limit, d)
+			}
+		}
+	}
+}
+
+// expiredTurn reports whether the current turn has exceeded its turn or idle
+// deadline. An expired turn no longer counts as in progress.
+func (t *Transport) expiredTurn(now time.Time) (shared.TimeoutLimit, time.Duration, bool) {
+	t.recoveryMu.Lock()
+	defer t.recoveryMu.Unlock()
+
+	if t.turnStart.IsZero() {
+		return "", 0, false
+	}
+
+	var limit shared.TimeoutLimit
+	var d time.Duration
+	lastActive := t.turnStart
+	if output := time.Unix(0, t.lastOutput.Load()); output.After(lastActive) {
+		lastActive = output
+	}
+	switch {
+	case t.deadlines.Turn > 0 && now.Sub(t.turnStart) >= t.deadlines.Turn:
+		limit, d = shared.TimeoutLimitTurn, t.deadlines.Turn
+	case t.deadlines.Idle > 0 && now.Sub(lastActive) >= t.deadlines.Idle:
+		limit, d = shared.TimeoutLimitIdle, t.deadlines.Idle
+	default:
+		return "", 0, false
+	}
+
+	t.turnStart = time.Time{}
+	return limit, d, true
+}
+
+// expire reports an expired deadline to every subscriber and applies the
+// configured action. An expired turn is interrupted through the control
+// protocol when possible; otherwise the CLI is stopped and the session ends
+// without recovery or a ProcessError.
+func (t *Transport) expire(ctx context.Context, limit shared.TimeoutLimit, timeout time.Duration) {
+	err := newDeadlineError(limit, timeout)
+	graceful := t.deadlines.Action == shared.TimeoutActionInterrupt
+
+	t.mu.Lock()
+	if !t.connected {
+		t.mu.Unlock()
+		return
+	}
+	protocol := t.protocol
+	keepSession := graceful && limit != shared.TimeoutLimitSession && protocol != nil
+	if !keepSession {
+		t.expired = err
+	}
+	t.mu.Unlock()
+
+	t.logger.Warn("deadline expired", "limit", limit, "timeout", timeout, "action", t.deadlines.Action)
+	t.hub.publishError(ctx, err)
+
+	t.recoveryMu.Lock()
+	inTurn := limit != shared.TimeoutLimitSession || t.inFlight != nil
+	t.recoveryMu.Unlock()
+
+	if graceful && protocol != nil && inTurn {
+		ierr := protocol.Interrupt(ctx)
+		if ierr == nil && keepSession {
+			return
+		}
+		if ierr != nil {
+			t.logger.Warn("interrupt after deadline failed", "error", ierr)
+		}
+	}
+	if keepSession {
+		t.mu.Lock()
+		t.expired = err
+		t.mu.Unlock()
+	}
+
+	t.stopForDeadline(ctx, graceful)
+}
+
+// stopForDeadline ends the CLI process after an expired deadline. A graceful
+// stop closes stdin and kills the process group only if the CLI is still
+// running after StdinGrace.
+func (t *Transport) stopForDeadline(ctx context.Context, graceful bool) {
+	t.mu.Lock()
+	if t.exit == nil {
+		t.mu.Unlock()
+		return
+	}
+	proc, exit, stdin := t.proc, t.exit, t.stdin
+	if graceful && stdin != nil {
+		_ = stdin.Close()
+	}
+	t.mu.Unlock()
+
+	if graceful && stdin != nil {
+		grace := t.shutdown.StdinGrace
+		if grace <= 0 {
+			grace = shared.DefaultShutdownStdinGrace
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-exit.done:
+			return
+		case <-ctx.Done():
+			// Close takes over the shutdown
+			return
+		case <-timer.C:
+		}
+	}
+
+	_ = proc.Signal(os.Kill)
+}
@@ -0,0 +1,162 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectErrors drains both channels and returns the errors received.
+func collectErrors(t *testing.T, msgChan <-chan shared.Message, errChan <-chan error) []error {
+	t.Helper()
+
+	var errs []error
+	timeout := time.After(10 * time.Second)
+	for msgChan != nil || errChan != nil {
+		select {
+		case _, ok := <-msgChan:
+			if !ok {
+				msgChan = nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			errs = append(errs, err)
+		case <-timeout:
+			t.Fatalf("stream did not end; errors so far: %v", errs)
+		}
+	}
+	return errs
+}
+
+func TestTransport_DeadlinesStopTheCLI(t *testing.T) {
+	t.Parallel()
+
+	streamEvent := streamLine("e", true)
+
+	tests := []struct {
+		name      string
+		script    string
+		oneShot   bool
+		send      bool
+		deadlines shared.DeadlineOptions
+		wantLimit shared.TimeoutLimit
+	}{
+		{
+			name:      "idle",
+			script:    `echo '{"type":"system","subtype":"init","session_id":"s1"}'` + "\nsleep 30\n",
+			oneShot:   true,
+			deadlines: shared.DeadlineOptions{Idle: 200 * time.Millisecond, Action: shared.TimeoutActionKill},
+			wantLimit: shared.TimeoutLimitIdle,
+		},
+		{
+			name:      "turn despite output",
+			script:    "while true; do echo '" + streamEvent + "'; sleep 0.05; done\n",
+			oneShot:   true,
+			deadlines: shared.DeadlineOptions{Idle: 200 * time.Millisecond, Turn: 400 * time.Millisecond, Action: shared.TimeoutActionKill},
+			wantLimit: shared.TimeoutLimitTurn,
+		},
+		{
+			name:      "turn without control protocol",
+			script:    "read line\nsleep 30\n",
+			send:      true,
+			deadlines: shared.DeadlineOptions{Turn: 200 * time.Millisecond, Action: shared.TimeoutActionInterrupt},
+			wantLimit: shared.TimeoutLimitTurn,
+		},
+		{
+			name:      "session closes stdin",
+			script:    "while read line; do :; done\n",
+			deadlines: shared.DeadlineOptions{Session: 200 * time.Millisecond, Action: shared.TimeoutActionInterrupt},
+			wantLimit: shared.TimeoutLimitSession,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &TransportConfig{
+				CLIPath:        writeFakeCLI(t, tt.script),
+				StderrCallback: func(string) {},
+				Deadlines:      tt.deadlines,
+				Shutdown:       shared.ShutdownOptions{StdinGrace: 100 * time.Millisecond},
+			}
+			var transport *Transport
+			var err error
+			if tt.oneShot {
+				transport, err = NewTransportWithPrompt(config, "hi")
+			} else {
+				// An expired deadline must not be mistaken for a crash
+				config.Recovery = &shared.RecoveryOptions{Backoff: time.Millisecond}
+				transport, err = NewTransport(config)
+			}
+			require.NoError(t, err)
+			require.NoError(t, transport.Connect(context.Background()))
+
+			msgChan, errChan := transport.ReceiveMessages(context.Background())
+			if tt.send {
+				require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+			}
+
+			errs := collectErrors(t, msgChan, errChan)
+			require.Len(t, errs, 1, "errors: %v", errs)
+			timeoutErr, ok := shared.AsTimeoutError(errs[0])
+			require.True(t, ok, "got %v", errs[0])
+			assert.Equal(t, tt.wantLimit, timeoutErr.Limit)
+			assert.False(t, transport.IsConnected())
+
+			closeErr := transport.Close()
+			assert.True(t, shared.IsTimeoutError(closeErr), "Close returned %v", closeErr)
+		})
+	}
+}
+
+func TestTransport_TurnDeadlineInterruptsThroughProtocol(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI answers the handshake, waits for the user message and
+	// ends the turn only once it is interrupted
+	script := writeFakeCLI(t, `answer() {
+	id=$(printf '%s' "$1" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+	echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\",\"response\":{}}}"
+}
+read line
+answer "$line"
+read line
+read line
+answer "$line"
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+read line
+`)
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:               script,
+		EnableControlProtocol: true,
+		Deadlines:             shared.DeadlineOptions{Turn: 200 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	select {
+	case err := <-errChan:
+		timeoutErr, ok := shared.AsTimeoutError(err)
+		require.True(t, ok, "got %v", err)
+		assert.Equal(t, shared.TimeoutLimitTurn, timeoutErr.Limit)
+		assert.Equal(t, "turn timed out after 200ms", timeoutErr.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn deadline did not expire")
+	}
+
+	assert.Equal(t, shared.MessageTypeResult, receiveMessage(t, msgChan).Type())
+	assert.True(t, transport.IsConnected(), "an interrupted turn keeps the session")
+}
@@ -0,0 +1,194 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the concurrent dispatch of control requests from the CLI.
+package subprocess
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// ControlStats reports the handling of control requests from the CLI.
+type ControlStats struct {
+	// Queued requests wait for a worker, or for an earlier request about
+	// the same tool use.
+	Queued int
+	// MaxQueued is the highest Queued has been.
+	MaxQueued int
+	// Running requests are being handled.
+	Running int
+
+	// Handled is the number of requests whose handler returned.
+	Handled uint64
+	// Cancelled is the number of requests cancelled before their handler
+	// started or while it ran, by the CLI, an interrupt or Close.
+	Cancelled uint64
+
+	// QueueTime is the total time handled requests spent queued.
+	QueueTime time.Duration
+	// HandlerTime is the total time spent in handlers. Divided by Handled,
+	// it gives the mean handler latency.
+	HandlerTime time.Duration
+	// MaxHandlerTime is the longest a handler took.
+	MaxHandlerTime time.Duration
+}
+
+// dispatcher handles control requests from the CLI on a pool of workers.
+// Requests about the same tool use, such as its PreToolUse hook and its
+// permission check, are handled one after the other in arrival order; other
+// requests run concurrently.
+type dispatcher struct {
+	workers int
+	handle  func(*inboundRequest)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []*inboundRequest            // requests a worker may take, in order
+	waiting map[string][]*inboundRequest // by key, requests behind a running one
+	active  map[string]bool              // keys with a queued or running request
+	started bool
+	closed  bool
+	stats   ControlStats
+}
+
+// newDispatcher returns a dispatcher that handles requests with handle on
+// opts.Workers workers, started with the first request.
+func newDispatcher(opts shared.ControlDispatchOptions, handle func(*inboundRequest)) *dispatcher {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = shared.DefaultControlWorkers
+	}
+	d := &dispatcher{
+		workers: workers,
+		handle:  handle,
+		waiting: make(map[string][]*inboundRequest),
+		active:  make(map[string]bool),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// enqueue queues req. It reports false after close.
+func (d *dispatcher) enqueue(req *inboundRequest) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		for range d.workers {
+			go d.work()
+		}
+	}
+
+	req.queued = time.Now()
+	d.stats.Queued++
+	d.stats.MaxQueued = max(d.stats.MaxQueued, d.stats.Queued)
+	switch {
+	case req.key == "":
+		d.ready = append(d.ready, req)
+	case d.active[req.key]:
+		d.waiting[req.key] = append(d.waiting[req.key], req)
+		return true
+	default:
+		d.active[req.key] = true
+		d.ready = append(d.ready, req)
+	}
+	d.cond.Signal()
+	return true
+}
+
+// work handles ready requests until close.
+func (d *dispatcher) work() {
+	for {
+		d.mu.Lock()
+		for len(d.ready) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if d.closed {
+			d.mu.Unlock()
+			return
+		}
+		req := d.ready[0]
+		d.ready[0] = nil
+		d.ready = d.ready[1:]
+		d.stats.Queued--
+		d.stats.Running++
+		start := time.Now()
+		d.stats.QueueTime += start.Sub(req.queued)
+		d.mu.Unlock()
+
+		// A request cancelled while queued is dropped
+		ran := req.ctx.Err() == nil
+		if ran {
+			d.handle(req)
+		}
+		elapsed := time.Since(start)
+		cancelled := req.ctx.Err() != nil
+		req.done()
+
+		d.mu.Lock()
+		d.stats.Running--
+		if cancelled {
+			d.stats.Cancelled++
+		}
+		if ran {
+			d.stats.Handled++
+			d.stats.HandlerTime += elapsed
+			d.stats.MaxHandlerTime = max(d.stats.MaxHandlerTime, elapsed)
+		}
+		d.nextLocked(req.key)
+		d.mu.Unlock()
+	}
+}
+
+// nextLocked makes the request waiting behind a finished one with key
+// ready. The caller must hold d.mu.
+func (d *dispatcher) nextLocked(key string) {
+	if key == "" {
+		return
+	}
+	queue := d.waiting[key]
+	if len(queue) == 0 {
+		delete(d.waiting, key)
+		delete(d.active, key)
+		return
+	}
+	d.waiting[key] = queue[1:]
+	d.ready = append(d.ready, queue[0])
+	d.cond.Signal()
+}
+
+// close stops the workers once their current requests are handled and
+// drops the queued requests.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	dropped := d.ready
+	for _, queue := range d.waiting {
+		dropped = append(dropped, queue...)
+	}
+	d.ready, d.waiting = nil, nil
+	d.stats.Queued -= len(dropped)
+	d.stats.Cancelled += uint64(len(dropped))
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	for _, req := range dropped {
+		req.done()
+	}
+}
+
+// snapshot returns the current statistics.
+func (d *dispatcher) snapshot() ControlStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
@@ -0,0 +1,175 @@
+// Package subprocess provides tests for the dispatch of control requests.
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolUseRequest builds an inbound can_use_tool control request about a tool use.
+func toolUseRequest(requestID, toolName, toolUseID string) map[string]any {
+	msg := canUseToolRequest(requestID, toolName)
+	msg["request"].(map[string]any)["tool_use_id"] = toolUseID
+	return msg
+}
+
+// gatedPermission returns a permission callback that reports the tool it was
+// asked about on started and allows it once release is signalled.
+func gatedPermission(started chan<- string, release <-chan struct{}) shared.CanUseToolCallback {
+	return func(ctx context.Context, toolName string, _ map[string]any, _ shared.CanUseToolOptions) (shared.PermissionResult, error) {
+		started <- toolName
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return shared.PermissionResult{Behavior: shared.PermissionBehaviorAllow}, nil
+	}
+}
+
+// receiveTool returns the next tool reported on started.
+func receiveTool(t *testing.T, started <-chan string) string {
+	t.Helper()
+
+	select {
+	case tool := <-started:
+		return tool
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a handler")
+		return ""
+	}
+}
+
+func TestDispatch_HandlesRequestsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport,
+		WithCanUseToolCallback(gatedPermission(started, release)),
+		WithControlDispatch(shared.ControlDispatchOptions{Workers: 2}),
+	)
+	defer p.Close()
+
+	ctx := context.Background()
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_1", "Bash")))
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_2", "Edit")))
+	assert.ElementsMatch(t, []string{"Bash", "Edit"}, []string{receiveTool(t, started), receiveTool(t, started)})
+
+	// Both workers are busy: the third request waits
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_3", "Read")))
+	stats := p.ControlStats()
+	assert.Equal(t, 2, stats.Running)
+	assert.Equal(t, 1, stats.Queued)
+
+	// Other messages are routed meanwhile
+	require.NoError(t, p.Dispatch(ctx, map[string]any{"type": shared.MessageTypeAssistant}))
+	assert.Equal(t, shared.MessageTypeAssistant, (<-p.ReceiveMessages())["type"])
+
+	close(release)
+	assert.Equal(t, "Read", receiveTool(t, started))
+	require.Eventually(t, func() bool { return p.ControlStats().Handled == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 3, transport.writeCount())
+
+	stats = p.ControlStats()
+	assert.Zero(t, stats.Queued)
+	assert.Zero(t, stats.Running)
+	assert.GreaterOrEqual(t, stats.MaxQueued, 1)
+	assert.Zero(t, stats.Cancelled)
+	assert.Positive(t, stats.HandlerTime)
+	assert.GreaterOrEqual(t, stats.HandlerTime, stats.MaxHandlerTime)
+}
+
+func TestDispatch_KeepsOrderPerToolUse(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan string, 3)
+	release := make(chan struct{}, 3)
+	p := NewProtocol(&recordingControlTransport{}, WithCanUseToolCallback(gatedPermission(started, release)))
+	defer p.Close()
+
+	ctx := context.Background()
+	require.NoError(t, p.Dispatch(ctx, toolUseRequest("req_1", "first", "toolu_1")))
+	require.NoError(t, p.Dispatch(ctx, toolUseRequest("req_2", "second", "toolu_1")))
+	require.NoError(t, p.Dispatch(ctx, toolUseRequest("req_3", "other", "toolu_2")))
+
+	// The second request about toolu_1 waits for the first, although a
+	// worker is free; toolu_2 does not
+	assert.ElementsMatch(t, []string{"first", "other"}, []string{receiveTool(t, started), receiveTool(t, started)})
+	select {
+	case tool := <-started:
+		t.Fatalf("%s started before the first request about its tool use returned", tool)
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Equal(t, 1, p.ControlStats().Queued)
+
+	release <- struct{}{}
+	release <- struct{}{}
+	assert.Equal(t, "second", receiveTool(t, started))
+	release <- struct{}{}
+	require.Eventually(t, func() bool { return p.ControlStats().Handled == 3 }, 5*time.Second, time.Millisecond)
+}
+
+func TestDispatch_DropsRequestCancelledWhileQueued(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	transport := &recordingControlTransport{}
+	p := NewProtocol(transport,
+		WithCanUseToolCallback(gatedPermission(started, release)),
+		WithControlDispatch(shared.ControlDispatchOptions{Workers: 1}),
+	)
+	defer p.Close()
+
+	ctx := context.Background()
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_1", "Bash")))
+	assert.Equal(t, "Bash", receiveTool(t, started))
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_2", "Edit")))
+	require.NoError(t, p.Dispatch(ctx, map[string]any{
+		"type":       MessageTypeControlCancelRequest,
+		"request_id": "req_2",
+	}))
+
+	close(release)
+	require.Eventually(t, func() bool {
+		stats := p.ControlStats()
+		return stats.Handled == 1 && stats.Cancelled == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Empty(t, started, "the cancelled request was handled")
+	assert.Equal(t, 1, transport.writeCount())
+}
+
+func TestDispatch_CloseDropsQueuedRequests(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan string, 2)
+	p := NewProtocol(&recordingControlTransport{},
+		WithCanUseToolCallback(gatedPermission(started, make(chan struct{}))),
+		WithControlDispatch(shared.ControlDispatchOptions{Workers: 1}),
+	)
+
+	ctx := context.Background()
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_1", "Bash")))
+	receiveTool(t, started)
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_2", "Edit")))
+	require.NoError(t, p.Close())
+
+	require.Eventually(t, func() bool { return p.ControlStats().Cancelled == 2 }, 5*time.Second, time.Millisecond)
+	stats := p.ControlStats()
+	assert.Zero(t, stats.Queued)
+	assert.Zero(t, stats.Running)
+	assert.Empty(t, started)
+
+	// Requests after Close are ignored
+	require.NoError(t, p.Dispatch(ctx, canUseToolRequest("req_3", "Read")))
+	assert.Empty(t, started)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	assert.Empty(t, p.inbound)
+}
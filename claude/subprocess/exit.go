@@ -0,0 +1,99 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the reporting of CLI processes that exit on their own.
+package subprocess
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// stderrTailLines is the number of stderr lines kept for a ProcessError.
+const stderrTailLines = 20
+
+// stderrTail keeps the last stderr lines of one CLI process.
+type stderrTail struct {
+	mu    sync.Mutex
+	lines []string
+	done  chan struct{} // closed when the stderr reader exits
+}
+
+func newStderrTail() *stderrTail {
+	return &stderrTail{done: make(chan struct{})}
+}
+
+// add records a line, dropping the oldest once the tail is full.
+func (s *stderrTail) add(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.lines) == stderrTailLines {
+		copy(s.lines, s.lines[1:])
+		s.lines = s.lines[:stderrTailLines-1]
+	}
+	s.lines = append(s.lines, line)
+}
+
+// snapshot returns a copy of the kept lines.
+func (s *stderrTail) snapshot() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.lines) == 0 {
+		return nil
+	}
+	return append([]string(nil), s.lines...)
+}
+
+// drain waits up to stderrDrainTimeout for the reader to see the end of
+// stderr, so that the last lines of an exited process are kept.
+func (s *stderrTail) drain() []string {
+	select {
+	case <-s.done:
+	case <-time.After(stderrDrainTimeout):
+	}
+	return s.snapshot()
+}
+
+// processFailure describes how a CLI process ended as a ProcessError,
+// classifying its stderr into a known cause where possible.
+func processFailure(pid int, command, reason string, status ExitStatus, stderr []string) *shared.ProcessError {
+	err := shared.NewProcessError(pid, command, reason, status.Signal)
+	err.ExitCode = status.Code
+	err.Stderr = stderr
+	err.Cause = shared.ClassifyStderr(stderr)
+	return err
+}
+
+// exitFailure reaps a CLI process that ended on its own and returns the
+// ProcessError to report: when it exited abnormally, or before the result
+// of the prompt or of the last user message arrived. A failure explained by
+// a resource limit is wrapped in a ResourceLimitError. It returns nil otherwise.
+func (t *Transport) exitFailure(proc Process, command string, exit *processExit, tail *stderrTail) error {
+	stderr := tail.drain()
+	status := t.shutdownProcess(proc, exit, false)
+
+	t.recoveryMu.Lock()
+	missingResult := t.inFlight != nil || (t.promptArg != nil && !t.sawResult)
+	t.recoveryMu.Unlock()
+
+	var failure *shared.ProcessError
+	switch {
+	case !status.Success():
+		failure = processFailure(proc.Pid(), command, "exited", status, stderr)
+	case missingResult:
+		failure = processFailure(proc.Pid(), command, "exited without a result", status, stderr)
+	default:
+		t.logger.Info("CLI exited", "pid", proc.Pid())
+		return nil
+	}
+
+	t.logger.Warn("CLI exited abnormally",
+		"pid", proc.Pid(),
+		"reason", failure.Reason,
+		"exit_code", failure.ExitCode,
+		"signal", failure.Signal,
+		"cause", failure.Cause)
+	return t.limitFailure(failure, exit)
+}
@@ -0,0 +1,139 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStderrTail(t *testing.T) {
+	t.Parallel()
+
+	tail := newStderrTail()
+	assert.Nil(t, tail.snapshot())
+
+	for i := 0; i < stderrTailLines+5; i++ {
+		tail.add(fmt.Sprintf("line %d", i))
+	}
+
+	lines := tail.snapshot()
+	require.Len(t, lines, stderrTailLines)
+	assert.Equal(t, "line 5", lines[0])
+	assert.Equal(t, fmt.Sprintf("line %d", stderrTailLines+4), lines[len(lines)-1])
+}
+
+// collectProcessErrors drains both channels and returns the ProcessErrors received.
+func collectProcessErrors(msgChan <-chan shared.Message, errChan <-chan error) []*shared.ProcessError {
+	var processErrs []*shared.ProcessError
+	for msgChan != nil || errChan != nil {
+		select {
+		case _, ok := <-msgChan:
+			if !ok {
+				msgChan = nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			if processErr, isProcessErr := shared.AsProcessError(err); isProcessErr {
+				processErrs = append(processErrs, processErr)
+			}
+		}
+	}
+	return processErrs
+}
+
+func TestTransport_ReportsProcessExit(t *testing.T) {
+	t.Parallel()
+
+	result := `echo '{"type":"result","subtype":"success","session_id":"s1"}'` + "\n"
+
+	tests := []struct {
+		name       string
+		script     string
+		wantErr    bool
+		wantCode   int
+		wantCause  shared.ExitCause
+		wantStderr []string
+	}{
+		{
+			name:       "auth failure",
+			script:     "echo 'Invalid API key · Please run /login' >&2\nexit 1\n",
+			wantErr:    true,
+			wantCode:   1,
+			wantCause:  shared.ExitCauseAuth,
+			wantStderr: []string{"Invalid API key · Please run /login"},
+		},
+		{
+			name:       "bad flag",
+			script:     "echo \"error: unknown option '--bogus'\" >&2\nexit 2\n",
+			wantErr:    true,
+			wantCode:   2,
+			wantCause:  shared.ExitCauseBadFlag,
+			wantStderr: []string{"error: unknown option '--bogus'"},
+		},
+		{
+			name:    "no result",
+			script:  "exit 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "result after clean run",
+			script:  result,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := NewTransportWithPrompt(&TransportConfig{
+				CLIPath:        writeFakeCLI(t, tt.script),
+				StderrCallback: func(string) {},
+			}, "hi")
+			require.NoError(t, err)
+			require.NoError(t, transport.Connect(context.Background()))
+			defer transport.Close()
+
+			processErrs := collectProcessErrors(transport.ReceiveMessages(context.Background()))
+			if !tt.wantErr {
+				assert.Empty(t, processErrs)
+				return
+			}
+
+			require.Len(t, processErrs, 1)
+			processErr := processErrs[0]
+			assert.Equal(t, tt.wantCode, processErr.ExitCode)
+			assert.Equal(t, tt.wantCause, processErr.Cause)
+			assert.Equal(t, tt.wantStderr, processErr.Stderr)
+			assert.NotZero(t, processErr.PID)
+		})
+	}
+}
+
+func TestTransport_ReportsExitMidTurn(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:        writeFakeCLI(t, "read line\necho 'fatal: lost connection' >&2\nexit 0\n"),
+		StderrCallback: func(string) {},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	processErrs := collectProcessErrors(msgChan, errChan)
+	require.Len(t, processErrs, 1)
+	assert.Contains(t, processErrs[0].Error(), "exited without a result")
+	assert.Equal(t, []string{"fatal: lost connection"}, processErrs[0].Stderr)
+	assert.Equal(t, shared.ExitCauseUnknown, processErrs[0].Cause)
+}
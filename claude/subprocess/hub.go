@@ -0,0 +1,268 @@
+package subprocess
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// SlowSubscriberPolicy decides what happens when a subscriber's buffer is full.
+type SlowSubscriberPolicy int
+
+const (
+	// SlowSubscriberBlock waits until the subscriber has room.
+	// The CLI reader stalls meanwhile, so every other subscriber waits too.
+	SlowSubscriberBlock SlowSubscriberPolicy = iota
+
+	// SlowSubscriberDropNewest discards the message that does not fit.
+	SlowSubscriberDropNewest
+
+	// SlowSubscriberDropOldest discards the oldest buffered message to make room.
+	SlowSubscriberDropOldest
+
+	// SlowSubscriberDisconnect unsubscribes the subscriber and closes its channels.
+	SlowSubscriberDisconnect
+)
+
+// String returns the policy name.
+func (p SlowSubscriberPolicy) String() string {
+	switch p {
+	case SlowSubscriberBlock:
+		return "block"
+	case SlowSubscriberDropNewest:
+		return "drop_newest"
+	case SlowSubscriberDropOldest:
+		return "drop_oldest"
+	case SlowSubscriberDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// SubscribeOption configures a Subscription.
+type SubscribeOption func(*Subscription)
+
+// WithMessageTypes restricts a subscription to the given message types,
+// such as shared.MessageTypeStreamEvent or shared.MessageTypeResult.
+// Errors are delivered regardless of the filter.
+func WithMessageTypes(types ...string) SubscribeOption {
+	return func(s *Subscription) {
+		s.types = make(map[string]bool, len(types))
+		for _, typ := range types {
+			s.types[typ] = true
+		}
+	}
+}
+
+// WithSubscriberBuffer sets the buffer size of the subscription's channels.
+// Sizes below 1 are raised to 1.
+func WithSubscriberBuffer(size int) SubscribeOption {
+	return func(s *Subscription) {
+		s.bufferSize = size
+	}
+}
+
+// WithSlowSubscriberPolicy sets what happens when the subscription falls behind.
+func WithSlowSubscriberPolicy(policy SlowSubscriberPolicy) SubscribeOption {
+	return func(s *Subscription) {
+		s.policy = policy
+	}
+}
+
+// Subscription is one subscriber's view of the transport's message stream.
+// Both channels are closed when the subscription ends, either through
+// Unsubscribe, the disconnect policy or the end of the CLI process.
+type Subscription struct {
+	msgs chan shared.Message
+	errs chan error
+
+	types      map[string]bool // nil means all types
+	bufferSize int
+	policy     SlowSubscriberPolicy
+
+	hub     *hub
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+
+	// unread marks a subscription nobody reads yet. While other
+	// subscriptions exist, it keeps its latest messages instead of
+	// holding them up.
+	unread atomic.Bool
+}
+
+// Messages returns the subscription's message channel.
+func (s *Subscription) Messages() <-chan shared.Message {
+	return s.msgs
+}
+
+// Errors returns the subscription's error channel.
+func (s *Subscription) Errors() <-chan error {
+	return s.errs
+}
+
+// Dropped returns the number of messages and errors discarded by the drop policies.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe ends the subscription and closes its channels.
+// It is safe to call more than once and from any goroutine.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() { close(s.done) })
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.removeLocked(s)
+}
+
+// wants reports whether the subscription accepts the message type.
+func (s *Subscription) wants(msg shared.Message) bool {
+	return s.types == nil || s.types[msg.Type()]
+}
+
+// deliver sends v on ch according to the subscription's policy.
+// It returns false when the subscription must be removed. The caller must
+// hold the hub's lock.
+func deliver[T any](ctx context.Context, s *Subscription, ch chan T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+	}
+
+	policy := s.policy
+	if s.unread.Load() && len(s.hub.subs) > 1 {
+		policy = SlowSubscriberDropOldest
+	}
+
+	switch policy {
+	case SlowSubscriberDropNewest:
+		s.dropped.Add(1)
+		return true
+	case SlowSubscriberDropOldest:
+		for {
+			select {
+			case <-ch:
+				s.dropped.Add(1)
+			default:
+			}
+			select {
+			case ch <- v:
+				return true
+			default:
+			}
+		}
+	case SlowSubscriberDisconnect:
+		return false
+	default:
+		select {
+		case ch <- v:
+			return true
+		case <-s.done:
+			return false
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
+
+// hub broadcasts transport messages and errors to every subscription.
+type hub struct {
+	mu            sync.Mutex
+	subs          map[*Subscription]struct{}
+	closed        bool
+	defaultBuffer int
+	defaultPolicy SlowSubscriberPolicy
+}
+
+// newHub creates a hub whose subscriptions default to the given buffer size and policy.
+func newHub(bufferSize int, policy SlowSubscriberPolicy) *hub {
+	return &hub{
+		subs:          make(map[*Subscription]struct{}),
+		defaultBuffer: bufferSize,
+		defaultPolicy: policy,
+	}
+}
+
+// subscribe registers a new subscription. Subscribing to a closed hub
+// returns a subscription whose channels are already closed.
+func (h *hub) subscribe(opts ...SubscribeOption) *Subscription {
+	s := &Subscription{
+		bufferSize: h.defaultBuffer,
+		policy:     h.defaultPolicy,
+		hub:        h,
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.bufferSize < 1 {
+		s.bufferSize = 1
+	}
+	s.msgs = make(chan shared.Message, s.bufferSize)
+	s.errs = make(chan error, s.bufferSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(s.msgs)
+		close(s.errs)
+		return s
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// publish delivers a message to every subscription that accepts its type.
+func (h *hub) publish(ctx context.Context, msg shared.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		if s.wants(msg) && !deliver(ctx, s, s.msgs, msg) {
+			h.removeLocked(s)
+		}
+	}
+}
+
+// publishError delivers an error to every subscription.
+func (h *hub) publishError(ctx context.Context, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		if !deliver(ctx, s, s.errs, err) {
+			h.removeLocked(s)
+		}
+	}
+}
+
+// close ends every subscription. Later subscriptions are closed immediately.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for s := range h.subs {
+		h.removeLocked(s)
+	}
+}
+
+// removeLocked removes a subscription and closes its channels.
+// The caller must hold h.mu.
+func (h *hub) removeLocked(s *Subscription) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.msgs)
+	close(s.errs)
+}
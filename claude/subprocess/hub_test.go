@@ -0,0 +1,270 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hubText(text string) shared.Message {
+	return &shared.AssistantMessage{
+		MessageType: shared.MessageTypeAssistant,
+		Content:     []shared.ContentBlock{&shared.TextBlock{Text: text}},
+	}
+}
+
+func hubTexts(t *testing.T, s *Subscription) []string {
+	t.Helper()
+
+	var texts []string
+	for {
+		select {
+		case msg, ok := <-s.Messages():
+			if !ok {
+				return texts
+			}
+			texts = append(texts, shared.GetContentText(msg.(*shared.AssistantMessage)))
+		default:
+			return texts
+		}
+	}
+}
+
+func TestHub_BroadcastsToEverySubscriber(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	first := h.subscribe()
+	second := h.subscribe()
+
+	h.publish(context.Background(), hubText("a"))
+	h.publish(context.Background(), hubText("b"))
+	h.publishError(context.Background(), errors.New("boom"))
+
+	assert.Equal(t, []string{"a", "b"}, hubTexts(t, first))
+	assert.Equal(t, []string{"a", "b"}, hubTexts(t, second))
+	assert.EqualError(t, <-first.Errors(), "boom")
+	assert.EqualError(t, <-second.Errors(), "boom")
+}
+
+func TestHub_MessageTypeFilter(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	results := h.subscribe(WithMessageTypes(shared.MessageTypeResult))
+
+	h.publish(context.Background(), hubText("skipped"))
+	h.publish(context.Background(), &shared.ResultMessage{MessageType: shared.MessageTypeResult, SessionID: "s1"})
+
+	msg := <-results.Messages()
+	assert.Equal(t, "s1", msg.(*shared.ResultMessage).SessionID)
+	assert.Empty(t, results.Messages())
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	s := h.subscribe()
+	other := h.subscribe()
+
+	s.Unsubscribe()
+	s.Unsubscribe()
+	h.publish(context.Background(), hubText("after"))
+
+	_, ok := <-s.Messages()
+	assert.False(t, ok)
+	_, ok = <-s.Errors()
+	assert.False(t, ok)
+	assert.Equal(t, []string{"after"}, hubTexts(t, other))
+}
+
+func TestHub_SlowSubscriberPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy      SlowSubscriberPolicy
+		wantTexts   []string
+		wantDropped uint64
+	}{
+		{SlowSubscriberDropNewest, []string{"1", "2"}, 1},
+		{SlowSubscriberDropOldest, []string{"2", "3"}, 1},
+		{SlowSubscriberDisconnect, []string{"1", "2"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			t.Parallel()
+
+			h := newHub(10, SlowSubscriberBlock)
+			s := h.subscribe(WithSubscriberBuffer(2), WithSlowSubscriberPolicy(tt.policy))
+
+			for _, text := range []string{"1", "2", "3"} {
+				h.publish(context.Background(), hubText(text))
+			}
+
+			assert.Equal(t, tt.wantTexts, hubTexts(t, s))
+			assert.Equal(t, tt.wantDropped, s.Dropped())
+		})
+	}
+}
+
+func TestHub_DisconnectClosesSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	s := h.subscribe(WithSubscriberBuffer(1), WithSlowSubscriberPolicy(SlowSubscriberDisconnect))
+
+	h.publish(context.Background(), hubText("1"))
+	h.publish(context.Background(), hubText("2"))
+
+	<-s.Messages()
+	_, ok := <-s.Messages()
+	assert.False(t, ok, "subscription should be closed after falling behind")
+}
+
+func TestHub_BlockedPublishReleasedByUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	s := h.subscribe(WithSubscriberBuffer(1))
+	h.publish(context.Background(), hubText("1"))
+
+	published := make(chan struct{})
+	go func() {
+		h.publish(context.Background(), hubText("2"))
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish should block while the subscriber is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Unsubscribe()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish did not resume after unsubscribe")
+	}
+}
+
+func TestHub_CloseEndsSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(10, SlowSubscriberBlock)
+	s := h.subscribe()
+
+	h.close()
+	h.close()
+
+	_, ok := <-s.Messages()
+	assert.False(t, ok)
+
+	late := h.subscribe()
+	_, ok = <-late.Messages()
+	assert.False(t, ok)
+}
+
+func TestTransport_SubscribeRequiresConnection(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransport(&TransportConfig{})
+	require.NoError(t, err)
+
+	_, err = transport.Subscribe()
+	assert.Error(t, err)
+}
+
+// writeFakeCLI writes an executable shell script that stands in for the CLI.
+func writeFakeCLI(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "claude")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755))
+	return path
+}
+
+// receiveTypes reads n messages and returns their types.
+func receiveTypes(t *testing.T, ch <-chan shared.Message, n int) []string {
+	t.Helper()
+
+	var types []string
+	for len(types) < n {
+		select {
+		case msg, ok := <-ch:
+			require.True(t, ok, "stream closed after %v", types)
+			types = append(types, msg.Type())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", types)
+		}
+	}
+	return types
+}
+
+func TestTransport_SubscribersSeeEveryMessage(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI answers once it has read the first user message
+	script := writeFakeCLI(t, `read line
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"hi"}]}}'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`)
+
+	transport, err := NewTransport(&TransportConfig{CLIPath: script})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	audit, err := transport.Subscribe()
+	require.NoError(t, err)
+	results, err := transport.Subscribe(WithMessageTypes(shared.MessageTypeResult))
+	require.NoError(t, err)
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	want := []string{shared.MessageTypeAssistant, shared.MessageTypeResult}
+	assert.Equal(t, want, receiveTypes(t, msgChan, 2))
+	assert.Equal(t, want, receiveTypes(t, audit.Messages(), 2))
+	assert.Equal(t, []string{shared.MessageTypeResult}, receiveTypes(t, results.Messages(), 1))
+}
+
+func TestTransport_UnreadPrimaryStreamDoesNotStallSubscribers(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI answers with more messages than the primary stream buffers
+	script := writeFakeCLI(t, `read line
+i=0
+while [ $i -lt 50 ]; do
+	echo '{"type":"assistant","message":{"content":[{"type":"text","text":"hi"}]}}'
+	i=$((i+1))
+done
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+read line
+`)
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath: script,
+		Buffer:  shared.BufferOptions{BufferSize: 10},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	sub, err := transport.Subscribe()
+	require.NoError(t, err)
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	types := receiveTypes(t, sub.Messages(), 51)
+	assert.Equal(t, shared.MessageTypeResult, types[50])
+}
@@ -0,0 +1,308 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the launchers that start CLI processes.
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// LaunchSpec describes a CLI process for a Launcher to start.
+type LaunchSpec struct {
+	// Path is the resolved path of the CLI executable.
+	Path string
+	// Args are the CLI arguments, without the executable.
+	Args []string
+	// Env is the complete environment of the CLI, as KEY=value pairs.
+	Env []string
+	// Dir is the working directory of the CLI. Empty inherits the SDK's.
+	Dir string
+	// Stdin reports whether the CLI reads stdin. One-shot launches pass the
+	// prompt as an argument and must not get a stdin pipe.
+	Stdin bool
+	// ResourceLimits bounds the resources of the process tree, if set.
+	ResourceLimits *shared.ResourceLimits
+}
+
+// Launcher starts CLI processes for a transport. Implementations may run the
+// CLI directly, inside a wrapper such as a container or sandbox, or not at all.
+type Launcher interface {
+	// Launch starts the process described by spec. ctx bounds the launch only;
+	// the transport stops the process it returns through Process.Signal.
+	Launch(ctx context.Context, spec LaunchSpec) (Process, error)
+}
+
+// RemoteLauncher is implemented by launchers that start the CLI on another
+// host. Transports using one skip the local CLI discovery and working
+// directory checks and pass CLIPath, or else CLICommand, as LaunchSpec.Path.
+type RemoteLauncher interface {
+	Launcher
+	// Remote reports whether the CLI runs on another host.
+	Remote() bool
+}
+
+// isRemote reports whether l starts the CLI on another host.
+func isRemote(l Launcher) bool {
+	r, ok := l.(RemoteLauncher)
+	return ok && r.Remote()
+}
+
+// Process is a running CLI process started by a Launcher.
+type Process interface {
+	// Pid returns the process ID, or 0 if there is no OS process.
+	Pid() int
+	// Stdin returns the CLI's stdin, or nil if LaunchSpec.Stdin was false.
+	Stdin() io.WriteCloser
+	// Stdout returns the CLI's stdout.
+	Stdout() io.ReadCloser
+	// Stderr returns the CLI's stderr.
+	Stderr() io.ReadCloser
+	// Signal sends sig to the process and the processes it spawned. It
+	// returns os.ErrProcessDone once they are gone.
+	Signal(sig os.Signal) error
+	// Wait waits for the process to exit and describes how it ended.
+	// The transport calls it exactly once.
+	Wait() (ExitState, error)
+}
+
+// ExitState describes how a launched process ended.
+type ExitState struct {
+	// Code is the exit code, or -1 if the process was ended by a signal.
+	Code int
+	// Signal is the signal that ended the process, if any.
+	Signal os.Signal
+	// OOMKills is the number of OOM kills in the process's cgroup, if it had one.
+	OOMKills int
+}
+
+// command returns the command line of spec, for logs and errors.
+func (s LaunchSpec) command() string {
+	return strings.Join(append([]string{s.Path}, s.Args...), " ")
+}
+
+// ExecLauncher starts the CLI directly as a child process in a process group
+// of its own, applying LaunchSpec.ResourceLimits. It is the default launcher.
+type ExecLauncher struct{}
+
+// Launch starts the CLI executable of spec.
+func (ExecLauncher) Launch(ctx context.Context, spec LaunchSpec) (Process, error) {
+	return startExec(ctx, exec.Command(spec.Path, spec.Args...), spec)
+}
+
+// PrefixLauncher starts the CLI through a wrapper command, such as
+// {"bwrap", "--ro-bind", "/", "/", "--"}, {"docker", "exec", "-i", "agent"} or
+// {"nsenter", "-t", "1234", "-m", "--"}: Prefix is followed by the CLI path and
+// arguments. The wrapper gets LaunchSpec.Env and Dir; wrappers that do not
+// pass them on, such as docker exec, need the matching flags in Prefix.
+// Signals and resource limits apply to the wrapper's process tree.
+type PrefixLauncher struct {
+	// Prefix is the wrapper command and its arguments. Empty runs the CLI directly.
+	Prefix []string
+}
+
+// Launch starts the CLI of spec behind the wrapper command.
+func (l PrefixLauncher) Launch(ctx context.Context, spec LaunchSpec) (Process, error) {
+	if len(l.Prefix) == 0 {
+		return ExecLauncher{}.Launch(ctx, spec)
+	}
+
+	args := make([]string, 0, len(l.Prefix)+len(spec.Args))
+	args = append(args, l.Prefix[1:]...)
+	args = append(args, spec.Path)
+	args = append(args, spec.Args...)
+	return startExec(ctx, exec.Command(l.Prefix[0], args...), spec)
+}
+
+// execProcess is a process started by ExecLauncher or PrefixLauncher.
+type execProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	cg     *cgroup
+}
+
+// startExec starts cmd with the environment, directory, pipes and resource
+// limits of spec.
+func startExec(ctx context.Context, cmd *exec.Cmd, spec LaunchSpec) (Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cmd.Env = spec.Env
+	cmd.Dir = spec.Dir
+	setProcessGroup(cmd)
+	p := &execProcess{cmd: cmd}
+
+	// Only create stdin pipe for interactive mode - stdin pipe causes issues with one-shot mode
+	if spec.Stdin {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("create stdin pipe: %w", err)
+		}
+		p.stdin = stdin
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		p.closePipes()
+		return nil, fmt.Errorf("create stdout pipe: %w", err)
+	}
+	p.stdout = stdout
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		p.closePipes()
+		return nil, fmt.Errorf("create stderr pipe: %w", err)
+	}
+	p.stderr = stderr
+
+	p.cg, err = prepareLimits(cmd, spec.ResourceLimits)
+	if err != nil {
+		p.closePipes()
+		return nil, fmt.Errorf("prepare resource limits: %w", err)
+	}
+	gate, err := gateLimits(cmd, spec.ResourceLimits)
+	if err != nil {
+		p.cg.release()
+		p.closePipes()
+		return nil, fmt.Errorf("prepare resource limits: %w", err)
+	}
+	defer gate.close()
+
+	if err := cmd.Start(); err != nil {
+		p.cg.release()
+		p.closePipes()
+		return nil, fmt.Errorf("start CLI process: %w", err)
+	}
+	if err := applyLimits(cmd.Process.Pid, spec.ResourceLimits, gate); err != nil {
+		_ = p.Signal(os.Kill)
+		_, _ = p.Wait()
+		p.closePipes()
+		return nil, fmt.Errorf("apply resource limits: %w", err)
+	}
+	return p, nil
+}
+
+// closePipes closes the pipes created so far.
+func (p *execProcess) closePipes() {
+	for _, c := range []io.Closer{p.stdin, p.stdout, p.stderr} {
+		if c != nil {
+			_ = c.Close()
+		}
+	}
+}
+
+func (p *execProcess) Pid() int                 { return p.cmd.Process.Pid }
+func (p *execProcess) Stdin() io.WriteCloser    { return p.stdin }
+func (p *execProcess) Stdout() io.ReadCloser    { return p.stdout }
+func (p *execProcess) Stderr() io.ReadCloser    { return p.stderr }
+func (p *execProcess) Signal(s os.Signal) error { return signalProcessGroup(p.cmd.Process, s) }
+
+// Wait reaps the process and releases its cgroup, if any.
+func (p *execProcess) Wait() (ExitState, error) {
+	state, err := p.cmd.Process.Wait()
+	oomKills := p.cg.release()
+	if err != nil {
+		return ExitState{Code: -1, OOMKills: oomKills}, err
+	}
+	return ExitState{Code: state.ExitCode(), Signal: exitSignal(state), OOMKills: oomKills}, nil
+}
+
+// FuncLauncher runs a function in place of the CLI, connected to the
+// transport through in-memory pipes. It is meant for tests: the function
+// reads the CLI's stdin and writes its stdout and stderr, and its result is
+// the exit code. The first signal cancels ctx; the process then reports that
+// it was ended by the signal. Resource limits are ignored.
+type FuncLauncher func(ctx context.Context, spec LaunchSpec, stdin io.Reader, stdout, stderr io.Writer) int
+
+// Launch runs the function in a goroutine of its own.
+func (f FuncLauncher) Launch(ctx context.Context, spec LaunchSpec) (Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	runCtx, cancel := context.WithCancel(context.Background())
+	p := &funcProcess{
+		stdout: stdoutR,
+		stderr: stderrR,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if spec.Stdin {
+		p.stdin = stdinW
+	} else {
+		_ = stdinW.Close()
+	}
+
+	go func() {
+		code := f(runCtx, spec, stdinR, stdoutW, stderrW)
+		// Like a dead process, the function no longer reads or writes
+		_ = stdinR.CloseWithError(io.ErrClosedPipe)
+		_ = stdoutW.Close()
+		_ = stderrW.Close()
+
+		p.mu.Lock()
+		p.state = ExitState{Code: code}
+		if p.signal != nil {
+			p.state = ExitState{Code: -1, Signal: p.signal}
+		}
+		p.mu.Unlock()
+		cancel()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// funcProcess is a process run by FuncLauncher.
+type funcProcess struct {
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	signal os.Signal // first signal received
+	state  ExitState
+}
+
+func (p *funcProcess) Pid() int              { return 0 }
+func (p *funcProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *funcProcess) Stdout() io.ReadCloser { return p.stdout }
+func (p *funcProcess) Stderr() io.ReadCloser { return p.stderr }
+
+// Signal records the first signal and cancels the function's context.
+func (p *funcProcess) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	default:
+	}
+
+	p.mu.Lock()
+	if p.signal == nil {
+		p.signal = sig
+	}
+	p.mu.Unlock()
+	p.cancel()
+	return nil
+}
+
+// Wait waits for the function to return.
+func (p *funcProcess) Wait() (ExitState, error) {
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, nil
+}
@@ -0,0 +1,156 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixLauncher_WrapsCLI(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "wrapper")
+	// The wrapper records what it was asked to run, then runs it
+	wrapper := writeFakeCLI(t, `{ echo "$1"; pwd; echo "$SDK_TEST_VAR"; } > '`+out+`'
+shift
+exec "$@"
+`)
+	script := writeFakeCLI(t, `echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`)
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        script,
+		Cwd:            dir,
+		Env:            map[string]string{"SDK_TEST_VAR": "passed"},
+		StderrCallback: func(string) {},
+		Launcher:       PrefixLauncher{Prefix: []string{wrapper, "--flag"}},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	assert.Equal(t, []string{shared.MessageTypeResult}, receiveTypes(t, msgChan, 1))
+	assert.Equal(t, script+" "+strings.Join(transport.buildArgs(), " "), transport.GetCommand())
+	assert.Empty(t, collectProcessErrors(msgChan, errChan))
+	require.NoError(t, transport.Close())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--flag", resolved, "passed"}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+}
+
+func TestPrefixLauncher_MissingWrapper(t *testing.T) {
+	t.Parallel()
+
+	_, err := PrefixLauncher{Prefix: []string{filepath.Join(t.TempDir(), "missing")}}.
+		Launch(context.Background(), LaunchSpec{Path: "claude"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "start CLI process")
+}
+
+// echoCLI is a FuncLauncher that answers each user message with a result.
+func echoCLI(_ context.Context, _ LaunchSpec, stdin io.Reader, stdout, _ io.Writer) int {
+	scanner := bufio.NewScanner(stdin)
+	for n := 1; scanner.Scan(); n++ {
+		fmt.Fprintf(stdout, `{"type":"result","subtype":"success","session_id":"s%d"}`+"\n", n)
+	}
+	return 0
+}
+
+func TestFuncLauncher_RunsInteractiveSession(t *testing.T) {
+	t.Parallel()
+
+	var got LaunchSpec
+	launcher := FuncLauncher(func(ctx context.Context, spec LaunchSpec, stdin io.Reader, stdout, stderr io.Writer) int {
+		got = spec
+		return echoCLI(ctx, spec, stdin, stdout, stderr)
+	})
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:  "/opt/claude",
+		Env:      map[string]string{"SDK_TEST_VAR": "passed"},
+		Launcher: launcher,
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	for range 2 {
+		require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+		assert.Equal(t, []string{shared.MessageTypeResult}, receiveTypes(t, msgChan, 1))
+	}
+	require.NoError(t, transport.Close())
+
+	status, ok := transport.ExitStatus()
+	require.True(t, ok)
+	assert.Equal(t, ShutdownStdinClosed, status.Stage)
+
+	assert.Equal(t, "/opt/claude", got.Path)
+	assert.True(t, got.Stdin)
+	assert.Contains(t, got.Env, "SDK_TEST_VAR=passed")
+	assert.Equal(t, transport.buildArgs(), got.Args)
+}
+
+func TestFuncLauncher_ReportsExit(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        "/opt/claude",
+		StderrCallback: func(string) {},
+		Launcher: FuncLauncher(func(_ context.Context, spec LaunchSpec, _ io.Reader, _, stderr io.Writer) int {
+			if spec.Stdin {
+				return 3
+			}
+			fmt.Fprintln(stderr, "Invalid API key")
+			return 1
+		}),
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	errs := collectProcessErrors(transport.ReceiveMessages(context.Background()))
+	require.Len(t, errs, 1)
+	assert.Equal(t, 1, errs[0].ExitCode)
+	assert.Equal(t, shared.ExitCauseAuth, errs[0].Cause)
+	assert.Equal(t, []string{"Invalid API key"}, errs[0].Stderr)
+}
+
+func TestFuncLauncher_StopsOnSignal(t *testing.T) {
+	t.Parallel()
+
+	// The fake CLI ignores its closed stdin and runs until it is signalled
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:  "/opt/claude",
+		Shutdown: shared.ShutdownOptions{StdinGrace: 10 * time.Millisecond},
+		Launcher: FuncLauncher(func(ctx context.Context, _ LaunchSpec, _ io.Reader, _, _ io.Writer) int {
+			<-ctx.Done()
+			return 0
+		}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	err = transport.Close()
+	processErr, ok := shared.AsProcessError(err)
+	require.True(t, ok, "got %v", err)
+	assert.Equal(t, os.Interrupt.String(), processErr.Signal)
+
+	status, ok := transport.ExitStatus()
+	require.True(t, ok)
+	assert.Equal(t, ShutdownInterrupted, status.Stage)
+	assert.Equal(t, -1, status.Code)
+}
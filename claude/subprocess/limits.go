@@ -0,0 +1,105 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements the reporting of resource limits hit by the CLI.
+package subprocess
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// resourceLimitPatterns maps rlimit resources to lowercase stderr fragments
+// that show the limit was hit, in order of precedence.
+var resourceLimitPatterns = []struct {
+	resource shared.Resource
+	patterns []string
+}{
+	{shared.ResourceOpenFiles, []string{
+		"too many open files",
+		"emfile",
+	}},
+	{shared.ResourceProcesses, []string{
+		"cannot fork",
+		"fork: retry",
+		"resource temporarily unavailable",
+		"eagain",
+	}},
+	{shared.ResourceAddressSpace, []string{
+		"cannot allocate memory",
+		"out of memory",
+		"enomem",
+		"allocation failed",
+	}},
+}
+
+// limitValue returns the configured value of resource, or "" if it is not limited.
+func limitValue(limits *shared.ResourceLimits, resource shared.Resource) string {
+	switch resource {
+	case shared.ResourceCPUTime:
+		if limits.CPUTime > 0 {
+			return limits.CPUTime.String()
+		}
+	case shared.ResourceAddressSpace:
+		if limits.AddressSpace > 0 {
+			return strconv.FormatUint(limits.AddressSpace, 10)
+		}
+	case shared.ResourceOpenFiles:
+		if limits.OpenFiles > 0 {
+			return strconv.FormatUint(limits.OpenFiles, 10)
+		}
+	case shared.ResourceProcesses:
+		if limits.Processes > 0 {
+			return strconv.FormatUint(limits.Processes, 10)
+		}
+	case shared.ResourceMemory:
+		if limits.Cgroup != nil && limits.Cgroup.MemoryMax > 0 {
+			return strconv.FormatUint(limits.Cgroup.MemoryMax, 10)
+		}
+	}
+	return ""
+}
+
+// exceededLimit returns the configured limit that explains a failed exit:
+// an OOM kill in the CLI's cgroup, SIGXCPU, or an rlimit error on stderr.
+func exceededLimit(limits *shared.ResourceLimits, exit *processExit, stderr []string) (shared.Resource, string, bool) {
+	if limits == nil {
+		return "", "", false
+	}
+
+	if exit.state.OOMKills > 0 {
+		if limit := limitValue(limits, shared.ResourceMemory); limit != "" {
+			return shared.ResourceMemory, limit, true
+		}
+	}
+	if cpuLimitSignal(exit.state.Signal) {
+		if limit := limitValue(limits, shared.ResourceCPUTime); limit != "" {
+			return shared.ResourceCPUTime, limit, true
+		}
+	}
+
+	text := strings.ToLower(strings.Join(stderr, "\n"))
+	for _, r := range resourceLimitPatterns {
+		limit := limitValue(limits, r.resource)
+		if limit == "" {
+			continue
+		}
+		for _, pattern := range r.patterns {
+			if strings.Contains(text, pattern) {
+				return r.resource, limit, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// limitFailure wraps failure in a ResourceLimitError when a configured
+// resource limit explains the exit.
+func (t *Transport) limitFailure(failure *shared.ProcessError, exit *processExit) error {
+	resource, limit, ok := exceededLimit(t.limits, exit, failure.Stderr)
+	if !ok {
+		return failure
+	}
+	t.logger.Warn("CLI hit a resource limit", "pid", failure.PID, "resource", resource, "limit", limit)
+	return shared.NewResourceLimitError(resource, limit, failure)
+}
@@ -0,0 +1,234 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+const (
+	// rlimitNproc is RLIMIT_NPROC, which package syscall does not define.
+	rlimitNproc = 6
+	// cgroupCPUPeriod is the cpu.max period in microseconds.
+	cgroupCPUPeriod = 100000
+	// cgroupRemoveTimeout bounds the wait for a cgroup to empty before removal.
+	cgroupRemoveTimeout = time.Second
+	// limitShim waits for the gate on fd 3 and then replaces the shell with
+	// the CLI, keeping the PID whose rlimits the SDK has set. EOF without a
+	// line means the limits could not be set.
+	limitShim = `IFS= read -r _ <&3 || exit 1; exec 3<&-; exec "$0" "$@"`
+)
+
+// cgroupSeq numbers the cgroups created by this process.
+var cgroupSeq atomic.Uint64
+
+// cgroup is the cgroup v2 of one CLI process.
+type cgroup struct {
+	path string
+	fd   int // open until release, for SysProcAttr.CgroupFD
+}
+
+// prepareLimits creates the cgroup of the next CLI process, if one is
+// configured, and makes cmd start inside it.
+func prepareLimits(cmd *exec.Cmd, limits *shared.ResourceLimits) (*cgroup, error) {
+	if limits == nil || limits.Cgroup == nil {
+		return nil, nil
+	}
+	c := limits.Cgroup
+	if c.Parent == "" {
+		return nil, shared.NewConfigurationError("ResourceLimits.Cgroup.Parent", "", "cgroup parent directory is required")
+	}
+
+	path := filepath.Join(c.Parent, fmt.Sprintf("claude-sdk-%d-%d", os.Getpid(), cgroupSeq.Add(1)))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+	cg := &cgroup{path: path, fd: -1}
+
+	if err := cg.configure(c); err != nil {
+		cg.release()
+		return nil, err
+	}
+	fd, err := syscall.Open(path, syscall.O_DIRECTORY|syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		cg.release()
+		return nil, fmt.Errorf("open cgroup: %w", err)
+	}
+	cg.fd = fd
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return cg, nil
+}
+
+// configure writes the cgroup's limits.
+func (cg *cgroup) configure(c *shared.CgroupLimits) error {
+	if c.MemoryMax > 0 {
+		if err := cg.write("memory.max", strconv.FormatUint(c.MemoryMax, 10)); err != nil {
+			return err
+		}
+		// Without swap the limit ends in an OOM kill rather than swapping
+		_ = cg.write("memory.swap.max", "0")
+	}
+	if c.CPUs > 0 {
+		quota := int64(c.CPUs * cgroupCPUPeriod)
+		if err := cg.write("cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sets a cgroup interface file.
+func (cg *cgroup) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(cg.path, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("set cgroup %s: %w", file, err)
+	}
+	return nil
+}
+
+// oomKills returns the number of processes the kernel killed for exceeding
+// memory.max, or 0 if the memory controller is not enabled.
+func (cg *cgroup) oomKills() int {
+	data, err := os.ReadFile(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if value, ok := bytes.CutPrefix(scanner.Bytes(), []byte("oom_kill ")); ok {
+			n, _ := strconv.Atoi(string(value))
+			return n
+		}
+	}
+	return 0
+}
+
+// release kills what is left in the cgroup, removes it and returns the
+// number of OOM kills it saw. It is a no-op on a nil cgroup.
+func (cg *cgroup) release() int {
+	if cg == nil {
+		return 0
+	}
+	if cg.fd >= 0 {
+		_ = syscall.Close(cg.fd)
+		cg.fd = -1
+	}
+
+	oomKills := cg.oomKills()
+	_ = cg.write("cgroup.kill", "1")
+
+	// A cgroup can only be removed once its processes are gone
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for os.Remove(cg.path) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return oomKills
+}
+
+// limitGate holds a CLI started through limitShim until its rlimits are set.
+type limitGate struct {
+	r, w *os.File
+}
+
+// gateLimits makes cmd start as /bin/sh running limitShim, so that the
+// rlimits applyLimits sets on the started PID are in effect before the CLI
+// executes. It returns nil if no rlimits are configured.
+func gateLimits(cmd *exec.Cmd, limits *shared.ResourceLimits) (*limitGate, error) {
+	if limits == nil || (limits.CPUTime <= 0 && limits.AddressSpace == 0 && limits.OpenFiles == 0 && limits.Processes == 0) {
+		return nil, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create limit gate: %w", err)
+	}
+	cmd.Args = append([]string{"sh", "-c", limitShim, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	cmd.ExtraFiles = []*os.File{r}
+	return &limitGate{r: r, w: w}, nil
+}
+
+// open lets the shim exec the CLI.
+func (g *limitGate) open() error {
+	if _, err := g.w.Write([]byte("\n")); err != nil {
+		return fmt.Errorf("open limit gate: %w", err)
+	}
+	return nil
+}
+
+// close closes the SDK's ends of the gate; a shim still waiting exits.
+// It is a no-op on a nil gate.
+func (g *limitGate) close() {
+	if g == nil {
+		return
+	}
+	_ = g.r.Close()
+	_ = g.w.Close()
+}
+
+// rlimitSetting is one rlimit to set on the CLI process.
+type rlimitSetting struct {
+	name     string
+	resource int
+	cur, max uint64
+}
+
+// rlimit64 is the argument of prlimit64.
+type rlimit64 struct {
+	cur uint64
+	max uint64
+}
+
+// applyLimits sets the rlimits of the started process pid and then opens
+// gate, so that the CLI the shim execs and the processes it spawns inherit
+// them. A nil gate means no rlimits are configured.
+func applyLimits(pid int, limits *shared.ResourceLimits, gate *limitGate) error {
+	if gate == nil {
+		return nil
+	}
+
+	rlimits := []rlimitSetting{
+		{"address space", syscall.RLIMIT_AS, limits.AddressSpace, limits.AddressSpace},
+		{"open files", syscall.RLIMIT_NOFILE, limits.OpenFiles, limits.OpenFiles},
+		{"processes", rlimitNproc, limits.Processes, limits.Processes},
+	}
+	if limits.CPUTime > 0 {
+		// SIGXCPU at the soft limit identifies the hit; SIGKILL follows a second later
+		seconds := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+		rlimits = append(rlimits, rlimitSetting{"CPU time", syscall.RLIMIT_CPU, seconds, seconds + 1})
+	}
+
+	for _, r := range rlimits {
+		if r.cur == 0 {
+			continue
+		}
+		limit := rlimit64{cur: r.cur, max: r.max}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+			uintptr(pid), uintptr(r.resource), uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("set %s limit: %w", r.name, errno)
+		}
+	}
+	return gate.open()
+}
+
+// cpuLimitSignal reports whether sig, the signal that ended a process, is SIGXCPU.
+func cpuLimitSignal(sig os.Signal) bool {
+	return sig == syscall.SIGXCPU
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// cgroup is a placeholder on platforms without cgroups.
+type cgroup struct{}
+
+// prepareLimits rejects resource limits on platforms other than Linux.
+func prepareLimits(_ *exec.Cmd, limits *shared.ResourceLimits) (*cgroup, error) {
+	if limits != nil && *limits != (shared.ResourceLimits{}) {
+		return nil, shared.NewConfigurationError("ResourceLimits", runtime.GOOS, "resource limits are only supported on Linux")
+	}
+	return nil, nil
+}
+
+// release is a no-op on platforms without cgroups.
+func (*cgroup) release() int { return 0 }
+
+// limitGate is a placeholder on platforms without rlimits.
+type limitGate struct{}
+
+// gateLimits is a no-op; prepareLimits has rejected any limits.
+func gateLimits(*exec.Cmd, *shared.ResourceLimits) (*limitGate, error) { return nil, nil }
+
+// close is a no-op on platforms without rlimits.
+func (*limitGate) close() {}
+
+// applyLimits is a no-op; prepareLimits has rejected any limits.
+func applyLimits(int, *shared.ResourceLimits, *limitGate) error { return nil }
+
+// cpuLimitSignal reports no CPU limit signal on platforms without rlimits.
+func cpuLimitSignal(os.Signal) bool { return false }
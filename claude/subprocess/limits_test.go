@@ -0,0 +1,175 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExceededLimit(t *testing.T) {
+	t.Parallel()
+
+	openFiles := &shared.ResourceLimits{OpenFiles: 64}
+	memory := &shared.ResourceLimits{Cgroup: &shared.CgroupLimits{Parent: "/sys/fs/cgroup/x", MemoryMax: 1 << 20}}
+
+	tests := []struct {
+		name         string
+		limits       *shared.ResourceLimits
+		oomKills     int
+		stderr       []string
+		wantResource shared.Resource
+		wantLimit    string
+	}{
+		{
+			name:         "open files",
+			limits:       openFiles,
+			stderr:       []string{"Error: EMFILE: too many open files, open '/tmp/x'"},
+			wantResource: shared.ResourceOpenFiles,
+			wantLimit:    "64",
+		},
+		{
+			name:   "unconfigured limit",
+			limits: &shared.ResourceLimits{Processes: 10},
+			stderr: []string{"Error: EMFILE: too many open files, open '/tmp/x'"},
+		},
+		{
+			name:         "processes",
+			limits:       &shared.ResourceLimits{Processes: 10},
+			stderr:       []string{"bash: fork: retry: Resource temporarily unavailable"},
+			wantResource: shared.ResourceProcesses,
+			wantLimit:    "10",
+		},
+		{
+			name:         "cgroup OOM kill",
+			limits:       memory,
+			oomKills:     1,
+			wantResource: shared.ResourceMemory,
+			wantLimit:    "1048576",
+		},
+		{
+			name:   "no limits",
+			stderr: []string{"out of memory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resource, limit, ok := exceededLimit(tt.limits, &processExit{state: ExitState{OOMKills: tt.oomKills}}, tt.stderr)
+			assert.Equal(t, tt.wantResource != "", ok)
+			assert.Equal(t, tt.wantResource, resource)
+			assert.Equal(t, tt.wantLimit, limit)
+		})
+	}
+}
+
+func TestTransport_AppliesRlimits(t *testing.T) {
+	t.Parallel()
+
+	// The limits are in effect before the CLI's first instruction
+	out := filepath.Join(t.TempDir(), "limits")
+	script := writeFakeCLI(t, `{ ulimit -n; ulimit -t; ulimit -v; } > '`+out+`'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`)
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        script,
+		StderrCallback: func(string) {},
+		ResourceLimits: &shared.ResourceLimits{
+			CPUTime:      1500 * time.Millisecond,
+			AddressSpace: 4 << 30,
+			OpenFiles:    64,
+		},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	assert.Empty(t, collectProcessErrors(transport.ReceiveMessages(context.Background())))
+	require.NoError(t, transport.Close())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"64", "2", "4194304"}, strings.Fields(string(data)))
+}
+
+func TestTransport_ReportsCPULimit(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        writeFakeCLI(t, "while :; do :; done\n"),
+		StderrCallback: func(string) {},
+		ResourceLimits: &shared.ResourceLimits{CPUTime: time.Second},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, errChan := transport.ReceiveMessages(context.Background())
+	errs := collectErrors(t, msgChan, errChan)
+	require.Len(t, errs, 1, "errors: %v", errs)
+
+	limitErr, ok := shared.AsResourceLimitError(errs[0])
+	require.True(t, ok, "got %v", errs[0])
+	assert.Equal(t, shared.ResourceCPUTime, limitErr.Resource)
+	assert.Equal(t, "1s", limitErr.Limit)
+	assert.True(t, shared.IsProcessError(errs[0]), "the ProcessError stays in the chain")
+}
+
+// cgroup2Root returns the mount point of the cgroup v2 hierarchy.
+func cgroup2Root(t *testing.T) string {
+	t.Helper()
+
+	f, err := os.Open("/proc/mounts")
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 2 && fields[2] == "cgroup2" {
+			return fields[1]
+		}
+	}
+	t.Skip("no cgroup v2 hierarchy mounted")
+	return ""
+}
+
+func TestTransport_PlacesCLIInCgroup(t *testing.T) {
+	t.Parallel()
+
+	parent, err := os.MkdirTemp(cgroup2Root(t), "sdk-test-")
+	if err != nil {
+		t.Skipf("cgroup v2 hierarchy not writable: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(parent) })
+
+	out := filepath.Join(t.TempDir(), "cgroup")
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath:        writeFakeCLI(t, "cat /proc/self/cgroup > '"+out+"'\n"+`echo '{"type":"result","subtype":"success","session_id":"s1"}'`+"\n"),
+		StderrCallback: func(string) {},
+		ResourceLimits: &shared.ResourceLimits{Cgroup: &shared.CgroupLimits{Parent: parent}},
+	}, "hi")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	assert.Empty(t, collectProcessErrors(transport.ReceiveMessages(context.Background())))
+	require.NoError(t, transport.Close())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "0::/"+strings.TrimPrefix(parent, cgroup2Root(t)+"/")+"/claude-sdk-")
+
+	// The CLI's cgroup is removed once the CLI has exited
+	entries, err := filepath.Glob(filepath.Join(parent, "claude-sdk-*"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
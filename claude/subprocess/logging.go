@@ -0,0 +1,92 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file holds helpers for structured, redacted diagnostics.
+package subprocess
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// loggedEnvPrefixes selects the environment variables logged when the CLI starts.
+var loggedEnvPrefixes = []string{"ANTHROPIC_", "CLAUDE_", "SYNTHETIC_", "ZAI_"}
+
+// envAttrs returns the CLI-related variables of env as log attributes.
+// Secret values are masked by the redacting handler.
+func envAttrs(env []string) []any {
+	var attrs []any
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		for _, prefix := range loggedEnvPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				attrs = append(attrs, slog.String(name, value))
+				break
+			}
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].(slog.Attr).Key < attrs[j].(slog.Attr).Key
+	})
+	return attrs
+}
+
+// redactArgs returns a copy of args with the one-shot prompt and the values
+// of flags that may carry secrets, prompts or MCP server credentials masked.
+func redactArgs(args []string, prompt *string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 0; i < len(redacted); i++ {
+		flag := redacted[i]
+		if !strings.HasPrefix(flag, "--") {
+			continue
+		}
+		if name, _, ok := strings.Cut(flag, "="); ok {
+			if isSecretFlag(name) {
+				redacted[i] = name + "=" + shared.Redacted
+			}
+			continue
+		}
+		if isSecretFlag(flag) && i+1 < len(redacted) {
+			i++
+			redacted[i] = shared.Redacted
+		}
+	}
+
+	// The one-shot prompt is the last, positional argument
+	if prompt != nil && len(redacted) > 0 && args[len(args)-1] == *prompt {
+		redacted[len(redacted)-1] = shared.Redacted
+	}
+	return redacted
+}
+
+// RedactArgs returns a copy of the CLI arguments args with the values of
+// flags that may carry secrets, prompts or MCP server credentials masked, as
+// in the transport's debug log. The prompt of a one-shot launch, the last
+// argument after -p, is masked too.
+func RedactArgs(args []string) []string {
+	var prompt *string
+	if len(args) > 1 && args[0] == "-p" {
+		prompt = &args[len(args)-1]
+	}
+	return redactArgs(args, prompt)
+}
+
+// isSecretFlag reports whether the value of a CLI flag must not be logged.
+func isSecretFlag(flag string) bool {
+	return flag == "--mcp-config" || shared.IsSecretKey(flag)
+}
+
+// messageAttrs describes a CLI message for the log without its content.
+func messageAttrs(msgType string, rawMsg map[string]any) []any {
+	attrs := []any{"type", msgType}
+	if subtype, ok := rawMsg["subtype"].(string); ok {
+		attrs = append(attrs, "subtype", subtype)
+	}
+	if requestID, ok := rawMsg["request_id"].(string); ok {
+		attrs = append(attrs, "request_id", requestID)
+	}
+	return attrs
+}
@@ -0,0 +1,110 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactArgs(t *testing.T) {
+	t.Parallel()
+
+	prompt := "deploy with key sk-123"
+	tests := []struct {
+		name   string
+		args   []string
+		prompt *string
+		want   []string
+	}{
+		{
+			name: "flag values",
+			args: []string{"--system-prompt", "be secret", "--model", "m", "--mcp-config", `{"env":{}}`},
+			want: []string{"--system-prompt", shared.Redacted, "--model", "m", "--mcp-config", shared.Redacted},
+		},
+		{
+			name: "inline flag value",
+			args: []string{"--append-system-prompt=x", "--verbose"},
+			want: []string{"--append-system-prompt=" + shared.Redacted, "--verbose"},
+		},
+		{
+			name:   "one-shot prompt",
+			args:   []string{"-p", "--verbose", prompt},
+			prompt: &prompt,
+			want:   []string{"-p", "--verbose", shared.Redacted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, redactArgs(tt.args, tt.prompt))
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func TestRedactArgs_OneShotLaunch(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"-p", "--mcp-config", `{"env":{"TOKEN":"x"}}`, "--model", "m", "deploy"}
+	assert.Equal(t, []string{"-p", "--mcp-config", shared.Redacted, "--model", "m", shared.Redacted}, RedactArgs(args))
+	assert.Equal(t, "deploy", args[5], "the arguments must not be modified")
+
+	assert.Equal(t, []string{"--input-format", "stream-json"}, RedactArgs([]string{"--input-format", "stream-json"}))
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTransport_LogsStructuredRedactedRecords(t *testing.T) {
+	t.Parallel()
+
+	script := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+echo '{"type":"result","subtype":"success","session_id":"s1"}'
+`)
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	transport, err := NewTransportWithPrompt(&TransportConfig{
+		CLIPath: script,
+		Env:     map[string]string{"ANTHROPIC_API_KEY": "sk-test-secret"},
+		Logger:  logger,
+	}, "my confidential prompt")
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	for range msgChan {
+	}
+	require.NoError(t, transport.Close())
+
+	logs := out.String()
+	assert.NotContains(t, logs, "sk-test-secret")
+	assert.NotContains(t, logs, "my confidential prompt")
+	assert.Contains(t, logs, "env.ANTHROPIC_API_KEY="+shared.Redacted)
+	assert.Contains(t, logs, "pid="+strconv.Itoa(transport.GetPID()))
+	assert.Contains(t, logs, `msg="received message" pid=`)
+	assert.Contains(t, logs, "session_id=s1 type=result subtype=success")
+}
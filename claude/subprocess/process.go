@@ -3,16 +3,19 @@ package subprocess
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
 	"regexp"
 	"strings"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
 // ProcessManager holds the subprocess handle and its I/O streams.
 type ProcessManager struct {
-	cmd        *exec.Cmd
+	launcher   Launcher
+	proc       Process
+	spec       LaunchSpec // of proc
 	cliPath    string
 	cliCommand string
 	stdin      io.WriteCloser
@@ -20,22 +23,44 @@ type ProcessManager struct {
 	stderr     io.ReadCloser
 	cwd        string
 	env        map[string]string
+	envPolicy  shared.EnvPolicy
+	logger     *slog.Logger
 }
 
-// buildEnv builds the environment variables for the subprocess.
+// buildEnv builds the environment variables for the subprocess: the
+// variables of the SDK process that envPolicy passes on, the custom ones,
+// then the policy's overrides. Later entries replace earlier ones.
 func (p *ProcessManager) buildEnv() []string {
-	env := os.Environ()
+	env := p.envPolicy.Inherit(os.Environ())
 
 	// Add custom environment variables with validation
 	for k, v := range p.env {
 		if isValidEnvVar(k, v) {
 			env = append(env, fmt.Sprintf("%s=%s", k, v))
-		} else if debugEnabled {
-			log.Printf("claude-sdk: skipping invalid env var %q", k)
+		} else {
+			p.logger.Warn("skipping invalid env var", "name", k)
 		}
 	}
 
-	return env
+	return dedupEnv(append(env, p.envPolicy.Overrides()...))
+}
+
+// dedupEnv removes the entries of env replaced by a later one of the same name.
+func dedupEnv(env []string) []string {
+	last := make(map[string]int, len(env))
+	for i, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		last[name] = i
+	}
+
+	deduped := env[:0]
+	for i, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		if last[name] == i {
+			deduped = append(deduped, e)
+		}
+	}
+	return deduped
 }
 
 var envKeyPattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
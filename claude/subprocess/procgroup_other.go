@@ -0,0 +1,27 @@
+//go:build !unix
+
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+)
+
+// terminateSignal is sent to the CLI after SIGINT. Without SIGTERM the
+// process is killed.
+var terminateSignal = os.Kill
+
+// setProcessGroup is a no-op on platforms without process groups.
+func setProcessGroup(*exec.Cmd) {}
+
+// signalProcessGroup signals the CLI process itself on platforms without
+// process groups.
+func signalProcessGroup(p *os.Process, sig os.Signal) error {
+	if sig == os.Kill {
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
+
+// exitSignal reports no signal on platforms without wait statuses.
+func exitSignal(*os.ProcessState) os.Signal { return nil }
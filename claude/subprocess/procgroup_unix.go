@@ -0,0 +1,46 @@
+//go:build unix
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// terminateSignal is sent to the CLI's process group after SIGINT.
+var terminateSignal os.Signal = syscall.SIGTERM
+
+// setProcessGroup starts cmd in a process group of its own, so that shutdown
+// also reaches the processes the CLI spawns, such as commands run by its Bash tool.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to every process in the group led by p.
+// It returns os.ErrProcessDone if the group is empty.
+func signalProcessGroup(p *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	if err := syscall.Kill(-p.Pid, s); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+// exitSignal returns the signal that ended a process, if any.
+func exitSignal(state *os.ProcessState) os.Signal {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return nil
+}
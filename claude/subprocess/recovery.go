@@ -0,0 +1,263 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements recovery of interactive sessions after a CLI crash.
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+const (
+	// defaultRecoveryBackoff is the delay before the first recovery attempt.
+	defaultRecoveryBackoff = 500 * time.Millisecond
+	// stderrDrainTimeout bounds the wait for the last stderr lines of an exited process.
+	stderrDrainTimeout = time.Second
+)
+
+// trackSession records the session ID and init message reported by the CLI
+// and ends the in-flight turn once its result arrives.
+func (t *Transport) trackSession(msg shared.Message) {
+	switch m := msg.(type) {
+	case *shared.SystemMessage:
+		if m.Subtype != shared.SystemSubtypeInit {
+			return
+		}
+		t.recordInit(m)
+		if id, ok := m.Data["session_id"].(string); ok && id != "" {
+			t.recoveryMu.Lock()
+			t.sessionID = id
+			t.recoveryMu.Unlock()
+		}
+	case *shared.ResultMessage:
+		t.recoveryMu.Lock()
+		if m.SessionID != "" {
+			t.sessionID = m.SessionID
+		}
+		t.inFlight = nil
+		t.turnStart = time.Time{}
+		t.reconnects = 0
+		t.sawResult = true
+		t.recoveryMu.Unlock()
+	}
+}
+
+// handleProcessExit runs when the stdout reader of process generation gen ends.
+// An unexpected exit of the current process either starts recovery or, when
+// recovery is disabled, reports a failed exit as a ProcessError and ends
+// every subscription.
+func (t *Transport) handleProcessExit(ctx context.Context, gen int) {
+	t.mu.Lock()
+	if t.launchPending && gen == t.generation {
+		t.launchPending = false
+		t.breaker.Record(t.launchOutcome(ctx))
+	}
+	if !t.connected || gen != t.generation {
+		// Closed by the caller, or replaced by a newer process
+		t.mu.Unlock()
+		return
+	}
+	expired := t.expired != nil
+	if t.recovery != nil && t.promptArg == nil && ctx.Err() == nil && !expired {
+		t.mu.Unlock()
+		t.recoverSession(gen)
+		return
+	}
+	proc, command, exit, tail := t.proc, t.spec.command(), t.exit, t.stderrTail
+	t.mu.Unlock()
+
+	if expired {
+		// The expired deadline has been reported in place of the exit
+		t.shutdownProcess(proc, exit, false)
+	} else if err := t.exitFailure(proc, command, exit, tail); err != nil {
+		t.hub.publishError(ctx, err)
+	}
+
+	t.mu.Lock()
+	if t.connected && gen == t.generation {
+		t.disconnectLocked()
+	}
+	t.mu.Unlock()
+}
+
+// launchOutcome reports how a one-shot launch ended: nil once a result was
+// received, the context error if the transport was closed first, and a
+// ProcessError otherwise. The caller must hold t.mu.
+func (t *Transport) launchOutcome(ctx context.Context) error {
+	t.recoveryMu.Lock()
+	sawResult := t.sawResult
+	t.recoveryMu.Unlock()
+
+	switch {
+	case sawResult:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return shared.NewProcessError(t.proc.Pid(), t.spec.command(), "exited without a result", "")
+	}
+}
+
+// disconnectLocked marks the transport as disconnected and ends every
+// subscription. The caller must hold t.mu.
+func (t *Transport) disconnectLocked() {
+	t.connected = false
+	t.hub.close()
+}
+
+// recoverSession respawns the CLI with --resume after the process of
+// generation gen exited unexpectedly. Progress is published as ReconnectEvents;
+// if the session cannot be recovered, the transport disconnects.
+func (t *Transport) recoverSession(gen int) {
+	t.mu.Lock()
+	proc, command, exit, tail := t.proc, t.spec.command(), t.exit, t.stderrTail
+	stdin, stdout, stderr := t.stdin, t.stdout, t.stderr
+	if t.protocol != nil {
+		_ = t.protocol.Close()
+		t.protocol = nil
+	}
+	if t.protocolAdapter != nil {
+		_ = t.protocolAdapter.Close()
+		t.protocolAdapter = nil
+	}
+	t.mu.Unlock()
+
+	// Reap the crashed process and whatever it left in its process group
+	var cause error = errors.New("CLI process exited unexpectedly")
+	if err := t.exitFailure(proc, command, exit, tail); err != nil {
+		cause = err
+	}
+
+	t.mu.Lock()
+	t.procCancel()
+	t.mu.Unlock()
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	_ = stdout.Close()
+	_ = stderr.Close()
+
+	maxAttempts := t.recovery.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = shared.DefaultRecoveryAttempts
+	}
+	backoff := t.recovery.Backoff
+	if backoff <= 0 {
+		backoff = defaultRecoveryBackoff
+	}
+
+	for {
+		t.recoveryMu.Lock()
+		sessionID, inFlight := t.sessionID, t.inFlight
+		attempt := t.reconnects + 1
+		if sessionID != "" && attempt <= maxAttempts {
+			t.reconnects = attempt
+		}
+		t.recoveryMu.Unlock()
+
+		if sessionID == "" {
+			t.failRecovery(gen, 0, "", fmt.Errorf("no session ID to resume: %w", cause))
+			return
+		}
+		if attempt > maxAttempts {
+			t.failRecovery(gen, attempt-1, sessionID, fmt.Errorf("giving up after %d attempts: %w", maxAttempts, cause))
+			return
+		}
+
+		t.logger.Info("recovering session", "session_id", sessionID, "attempt", attempt, "error", cause)
+		t.hub.publish(t.ctx, &shared.ReconnectEvent{
+			MessageType: shared.MessageTypeReconnect,
+			Status:      shared.ReconnectAttempting,
+			Attempt:     attempt,
+			SessionID:   sessionID,
+			Err:         cause,
+		})
+
+		select {
+		case <-time.After(backoff * time.Duration(attempt)):
+		case <-t.ctx.Done():
+			// Close is tearing the transport down
+			return
+		}
+
+		t.mu.Lock()
+		if !t.connected || gen != t.generation {
+			t.mu.Unlock()
+			return
+		}
+		ready := make(chan struct{})
+		err := t.respawn(sessionID, inFlight, ready)
+		gen = t.generation
+		t.mu.Unlock()
+
+		if err == nil {
+			t.hub.publish(t.ctx, &shared.ReconnectEvent{
+				MessageType: shared.MessageTypeReconnect,
+				Status:      shared.ReconnectSucceeded,
+				Attempt:     attempt,
+				SessionID:   sessionID,
+			})
+			close(ready)
+			return
+		}
+		cause = err
+	}
+}
+
+// respawn starts a new CLI process that resumes sessionID and, if configured,
+// re-sends the interrupted user message. The process publishes nothing but
+// control traffic until ready is closed. The caller must hold t.mu.
+func (t *Transport) respawn(sessionID string, inFlight []byte, ready <-chan struct{}) error {
+	cliPath, args := t.spec.Path, resumeArgs(t.buildArgs(), sessionID)
+	err := t.guardLaunch(func() error {
+		return t.startProcess(cliPath, args, ready)
+	})
+	if err != nil {
+		return fmt.Errorf("respawn CLI: %w", err)
+	}
+
+	if t.recovery.ResendInFlight && inFlight != nil {
+		if err := t.writeStdin(t.ctx, inFlight); err != nil {
+			t.stopProcess()
+			return fmt.Errorf("resend in-flight message: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// failRecovery reports that recovery was abandoned and disconnects the transport.
+func (t *Transport) failRecovery(gen, attempt int, sessionID string, err error) {
+	t.logger.Warn("session recovery failed", "session_id", sessionID, "attempt", attempt, "error", err)
+	t.hub.publish(t.ctx, &shared.ReconnectEvent{
+		MessageType: shared.MessageTypeReconnect,
+		Status:      shared.ReconnectFailed,
+		Attempt:     attempt,
+		SessionID:   sessionID,
+		Err:         err,
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.connected && gen == t.generation {
+		t.disconnectLocked()
+	}
+}
+
+// resumeArgs replaces any session selection flags in args with --resume sessionID.
+func resumeArgs(args []string, sessionID string) []string {
+	resumed := make([]string, 0, len(args)+2)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--resume", "--resume-session-at", "--session-id":
+			i++ // skip the flag's value
+		case "--continue", "--fork":
+		default:
+			resumed = append(resumed, args[i])
+		}
+	}
+	return append(resumed, "--resume", sessionID)
+}
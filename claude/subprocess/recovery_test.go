@@ -0,0 +1,186 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "adds resume",
+			args: []string{"--verbose"},
+			want: []string{"--verbose", "--resume", "s1"},
+		},
+		{
+			name: "replaces session selection",
+			args: []string{"--continue", "--resume", "old", "--fork", "--resume-session-at", "m1", "--verbose"},
+			want: []string{"--verbose", "--resume", "s1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, resumeArgs(tt.args, "s1"))
+		})
+	}
+}
+
+// receiveMessage reads one message or fails after a timeout.
+func receiveMessage(t *testing.T, ch <-chan shared.Message) shared.Message {
+	t.Helper()
+
+	select {
+	case msg, ok := <-ch:
+		require.True(t, ok, "stream closed")
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func requireReconnect(t *testing.T, msg shared.Message, status shared.ReconnectStatus, attempt int) *shared.ReconnectEvent {
+	t.Helper()
+
+	event, ok := msg.(*shared.ReconnectEvent)
+	require.True(t, ok, "expected reconnect event, got %T", msg)
+	assert.Equal(t, status, event.Status)
+	assert.Equal(t, attempt, event.Attempt)
+	return event
+}
+
+func TestTransport_RecoversCrashedSession(t *testing.T) {
+	t.Parallel()
+
+	// The first run reports a session and crashes on the first message;
+	// the resumed run answers the re-sent message.
+	script := writeFakeCLI(t, `case "$*" in
+*"--resume s1"*)
+	read line
+	case "$line" in *hello*) ;; *) exit 3 ;; esac
+	echo '{"type":"assistant","message":{"content":[{"type":"text","text":"resumed"}]}}'
+	echo '{"type":"result","subtype":"success","session_id":"s1"}'
+	read line
+	;;
+*)
+	echo '{"type":"system","subtype":"init","session_id":"s1"}'
+	read line
+	exit 1
+	;;
+esac
+`)
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:  script,
+		Recovery: &shared.RecoveryOptions{Backoff: time.Millisecond, ResendInFlight: true},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	assert.Equal(t, shared.MessageTypeSystem, receiveMessage(t, msgChan).Type())
+	require.NoError(t, transport.SendMessage(context.Background(), "hello"))
+
+	event := requireReconnect(t, receiveMessage(t, msgChan), shared.ReconnectAttempting, 1)
+	assert.Equal(t, "s1", event.SessionID)
+	assert.Error(t, event.Err)
+	requireReconnect(t, receiveMessage(t, msgChan), shared.ReconnectSucceeded, 1)
+
+	assert.Equal(t, shared.MessageTypeAssistant, receiveMessage(t, msgChan).Type())
+	assert.Equal(t, shared.MessageTypeResult, receiveMessage(t, msgChan).Type())
+	assert.True(t, transport.IsConnected())
+}
+
+func TestTransport_RecoveryReinitializesControlProtocol(t *testing.T) {
+	t.Parallel()
+
+	// Every run answers the initialize handshake; only the resumed run stays up.
+	script := writeFakeCLI(t, `read line
+id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\",\"response\":{}}}"
+case "$*" in
+*"--resume s1"*)
+	echo '{"type":"assistant","message":{"content":[{"type":"text","text":"resumed"}]}}'
+	read line
+	;;
+*)
+	echo '{"type":"system","subtype":"init","session_id":"s1"}'
+	;;
+esac
+`)
+
+	transport, err := NewTransport(&TransportConfig{
+		CLIPath:               script,
+		EnableControlProtocol: true,
+		Recovery:              &shared.RecoveryOptions{Backoff: time.Millisecond},
+	})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer transport.Close()
+
+	msgChan, _ := transport.ReceiveMessages(context.Background())
+	assert.Equal(t, shared.MessageTypeSystem, receiveMessage(t, msgChan).Type())
+	requireReconnect(t, receiveMessage(t, msgChan), shared.ReconnectAttempting, 1)
+	requireReconnect(t, receiveMessage(t, msgChan), shared.ReconnectSucceeded, 1)
+	assert.Equal(t, shared.MessageTypeAssistant, receiveMessage(t, msgChan).Type())
+	assert.True(t, transport.IsProtocolInitialized())
+}
+
+func TestTransport_RecoveryGivesUp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		script      string
+		wantAttempt int
+	}{
+		{
+			name:        "no session ID",
+			script:      "exit 1\n",
+			wantAttempt: 0,
+		},
+		{
+			name:        "attempts exhausted",
+			script:      `echo '{"type":"system","subtype":"init","session_id":"s1"}'` + "\n",
+			wantAttempt: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := NewTransport(&TransportConfig{
+				CLIPath:  writeFakeCLI(t, tt.script),
+				Recovery: &shared.RecoveryOptions{MaxAttempts: 2, Backoff: time.Millisecond},
+			})
+			require.NoError(t, err)
+			require.NoError(t, transport.Connect(context.Background()))
+			defer transport.Close()
+
+			msgChan, _ := transport.ReceiveMessages(context.Background())
+			var last shared.Message
+			for msg := range msgChan {
+				last = msg
+			}
+
+			event := requireReconnect(t, last, shared.ReconnectFailed, tt.wantAttempt)
+			assert.Error(t, event.Err)
+			assert.False(t, transport.IsConnected())
+		})
+	}
+}
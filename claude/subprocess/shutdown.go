@@ -0,0 +1,170 @@
+// Package subprocess provides subprocess communication with the Claude CLI.
+// This file implements reaping and staged shutdown of CLI processes.
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+)
+
+// ShutdownStage identifies the step of a staged shutdown at which the CLI exited.
+type ShutdownStage string
+
+// Shutdown stages, in order of escalation.
+const (
+	// ShutdownExited means the CLI had already exited when Close was called.
+	ShutdownExited ShutdownStage = "exited"
+	// ShutdownStdinClosed means the CLI exited after its stdin was closed.
+	ShutdownStdinClosed ShutdownStage = "stdin_closed"
+	// ShutdownInterrupted means the CLI exited after SIGINT.
+	ShutdownInterrupted ShutdownStage = "interrupted"
+	// ShutdownTerminated means the CLI exited after SIGTERM.
+	ShutdownTerminated ShutdownStage = "terminated"
+	// ShutdownKilled means the CLI was killed with SIGKILL.
+	ShutdownKilled ShutdownStage = "killed"
+)
+
+// ExitStatus describes how a CLI process ended.
+type ExitStatus struct {
+	// Code is the exit code, or -1 if the process was ended by a signal.
+	Code int
+	// Signal names the signal that ended the process, if any.
+	Signal string
+	// Stage is the shutdown stage at which the process exited.
+	Stage ShutdownStage
+}
+
+// Success reports whether the process exited with code 0.
+func (s ExitStatus) Success() bool { return s.Code == 0 }
+
+// processExit reaps one CLI process and records how it ended.
+// state and err are set before done is closed.
+type processExit struct {
+	done  chan struct{}
+	state ExitState
+	err   error
+}
+
+// watchProcess reaps proc. If ctx ends while the process is running, it is
+// killed together with the processes it spawned.
+func watchProcess(ctx context.Context, proc Process) *processExit {
+	exit := &processExit{done: make(chan struct{})}
+
+	go func() {
+		exit.state, exit.err = proc.Wait()
+		close(exit.done)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-exit.done:
+			default:
+				_ = proc.Signal(os.Kill)
+			}
+		case <-exit.done:
+		}
+	}()
+
+	return exit
+}
+
+// wait reports whether the process exits within d.
+func (e *processExit) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-e.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// status waits for the process to exit and describes how it ended.
+func (e *processExit) status(stage ShutdownStage) ExitStatus {
+	<-e.done
+	if e.err != nil {
+		return ExitStatus{Code: -1, Stage: stage}
+	}
+	status := ExitStatus{Code: e.state.Code, Stage: stage}
+	if e.state.Signal != nil {
+		status.Signal = e.state.Signal.String()
+	}
+	return status
+}
+
+// shutdownProcess stops the CLI process p, which exit is watching, in stages.
+// The CLI first gets StdinGrace to exit on its own after stdin was closed
+// (skipped when it has no stdin), then it and the processes it spawned
+// receive SIGINT, SIGTERM and SIGKILL in turn, each signal followed by its
+// grace period. Processes the CLI leaves behind are killed once it has exited.
+func (t *Transport) shutdownProcess(p Process, exit *processExit, stdinClosed bool) ExitStatus {
+	stage := ShutdownExited
+	select {
+	case <-exit.done:
+	default:
+		stage = t.escalate(p, exit, stdinClosed)
+	}
+
+	_ = p.Signal(os.Kill)
+	return exit.status(stage)
+}
+
+// escalate signals the CLI's process group until it exits and returns the
+// stage at which it did.
+func (t *Transport) escalate(p Process, exit *processExit, stdinClosed bool) ShutdownStage {
+	opts := t.shutdown
+	if opts.StdinGrace <= 0 {
+		opts.StdinGrace = shared.DefaultShutdownStdinGrace
+	}
+	if opts.InterruptGrace <= 0 {
+		opts.InterruptGrace = shared.DefaultShutdownInterruptGrace
+	}
+	if opts.TerminateGrace <= 0 {
+		opts.TerminateGrace = shared.DefaultShutdownTerminateGrace
+	}
+
+	if stdinClosed && exit.wait(opts.StdinGrace) {
+		return ShutdownStdinClosed
+	}
+
+	stages := []struct {
+		stage  ShutdownStage
+		signal os.Signal
+		grace  time.Duration
+	}{
+		{ShutdownInterrupted, os.Interrupt, opts.InterruptGrace},
+		{ShutdownTerminated, terminateSignal, opts.TerminateGrace},
+	}
+	for _, s := range stages {
+		_ = p.Signal(s.signal)
+		if exit.wait(s.grace) {
+			return s.stage
+		}
+	}
+
+	_ = p.Signal(os.Kill)
+	<-exit.done
+	return ShutdownKilled
+}
+
+// exitError converts the exit status of a closed process into the error
+// returned by Close: nil for a clean exit, a ProcessError otherwise.
+func exitError(pid int, command string, status ExitStatus, stderr []string) error {
+	if status.Success() {
+		return nil
+	}
+
+	reason := "exited"
+	if status.Stage != ShutdownExited {
+		reason = fmt.Sprintf("exited at shutdown stage %q", status.Stage)
+	}
+	return processFailure(pid, command, reason, status, stderr)
+}
@@ -0,0 +1,176 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testShutdown keeps the staged shutdown of tests short.
+var testShutdown = shared.ShutdownOptions{
+	StdinGrace:     100 * time.Millisecond,
+	InterruptGrace: 100 * time.Millisecond,
+	TerminateGrace: 100 * time.Millisecond,
+}
+
+func TestTransport_CloseEscalates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		script     string
+		wantStage  ShutdownStage
+		wantCode   int
+		wantSignal string
+	}{
+		{
+			name:      "exits on stdin EOF",
+			script:    "cat >/dev/null\n",
+			wantStage: ShutdownStdinClosed,
+			wantCode:  0,
+		},
+		{
+			name:      "exits on SIGINT",
+			script:    "trap 'exit 130' INT\nwhile :; do sleep 0.05; done\n",
+			wantStage: ShutdownInterrupted,
+			wantCode:  130,
+		},
+		{
+			name:      "exits on SIGTERM",
+			script:    "trap '' INT\ntrap 'exit 143' TERM\nwhile :; do sleep 0.05; done\n",
+			wantStage: ShutdownTerminated,
+			wantCode:  143,
+		},
+		{
+			name:       "killed",
+			script:     "trap '' INT TERM\nwhile :; do sleep 0.05; done\n",
+			wantStage:  ShutdownKilled,
+			wantCode:   -1,
+			wantSignal: "killed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := NewTransport(&TransportConfig{
+				CLIPath:  writeFakeCLI(t, tt.script),
+				Shutdown: testShutdown,
+			})
+			require.NoError(t, err)
+			require.NoError(t, transport.Connect(context.Background()))
+
+			_, ok := transport.ExitStatus()
+			assert.False(t, ok)
+
+			err = transport.Close()
+			status, ok := transport.ExitStatus()
+			require.True(t, ok)
+			assert.Equal(t, tt.wantStage, status.Stage)
+			assert.Equal(t, tt.wantCode, status.Code)
+			assert.Equal(t, tt.wantSignal, status.Signal)
+
+			if tt.wantCode == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			processErr, ok := shared.AsProcessError(err)
+			require.True(t, ok, "expected ProcessError, got %v", err)
+			assert.Equal(t, tt.wantCode, processErr.ExitCode)
+			assert.Equal(t, tt.wantSignal, processErr.Signal)
+		})
+	}
+}
+
+func TestTransport_InterruptSendsSIGINTFirst(t *testing.T) {
+	t.Parallel()
+
+	marker := filepath.Join(t.TempDir(), "signal")
+	script := writeFakeCLI(t, "trap 'echo INT > "+marker+"; exit 130' INT\n"+
+		"trap 'echo TERM > "+marker+"; exit 143' TERM\nwhile :; do sleep 0.05; done\n")
+
+	transport, err := NewTransport(&TransportConfig{CLIPath: script, Shutdown: testShutdown})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	pid := transport.GetPID()
+
+	require.NoError(t, transport.Interrupt())
+	assert.False(t, processAlive(pid))
+
+	data, err := os.ReadFile(marker)
+	require.NoError(t, err)
+	assert.Equal(t, "INT\n", string(data))
+
+	_ = transport.Close()
+}
+
+func TestTransport_CloseKillsProcessGroup(t *testing.T) {
+	t.Parallel()
+
+	// The CLI leaves a background command behind, as its Bash tool might
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	script := writeFakeCLI(t, "sleep 60 &\necho $! > "+pidFile+"\ncat >/dev/null\n")
+
+	transport, err := NewTransport(&TransportConfig{CLIPath: script, Shutdown: testShutdown})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+
+	var pid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, transport.Close())
+	assert.Eventually(t, func() bool { return !processAlive(pid) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTransport_ContextCancelKillsProcessGroup(t *testing.T) {
+	t.Parallel()
+
+	script := writeFakeCLI(t, "trap '' INT TERM\nwhile :; do sleep 0.05; done\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	transport, err := NewTransport(&TransportConfig{CLIPath: script, Shutdown: testShutdown})
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(ctx))
+	pid := transport.GetPID()
+
+	cancel()
+	assert.Eventually(t, func() bool { return !processAlive(pid) }, 5*time.Second, 10*time.Millisecond)
+
+	_ = transport.Close()
+	status, ok := transport.ExitStatus()
+	require.True(t, ok)
+	assert.Equal(t, "killed", status.Signal)
+}
+
+// processAlive reports whether pid is running. Zombies count as exited.
+func processAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
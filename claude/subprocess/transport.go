@@ -5,15 +5,18 @@ package subprocess
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dotcommander/agent-sdk-go/claude/cli"
@@ -22,15 +25,9 @@ import (
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
-// debugEnabled gates debug logging to /tmp/sdk-debug.log.
-// Set CLAUDE_SDK_DEBUG=1 to enable.
-var debugEnabled = os.Getenv("CLAUDE_SDK_DEBUG") != ""
-
 const (
 	// defaultTimeout is the default timeout for subprocess operations.
 	defaultTimeout = 60 * time.Second
-	// channelBufferSize is the buffer size for message and error channels.
-	channelBufferSize = 100
 )
 
 // Transport represents a subprocess transport for communicating with Claude CLI.
@@ -51,8 +48,10 @@ type Transport struct {
 	customArgs     []string
 	tools          *shared.ToolsConfig
 	stderrCallback func(line string)
+	debugWriter    io.Writer
 	canUseTool     shared.CanUseToolCallback
 	mcpServers     map[string]shared.McpServerConfig
+	cliOptions     CLIOptions
 
 	// Parser registry for message type handling (OCP compliance - inject instead of switch)
 	parserRegistry *parser.MessageParserRegistry
@@ -66,15 +65,67 @@ type Transport struct {
 	sdkMcpServers         map[string]*mcp.SdkMcpServer
 	enableCheckpointing   bool
 	enableControlProtocol bool // Explicitly enable control protocol
-
-	// Channels for communication
-	msgChan chan shared.Message
-	errChan chan error
-
-	// Control and cleanup
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	controlDispatch       shared.ControlDispatchOptions
+	controlHandlers       *ControlHandlerRegistry
+
+	// Message broadcast; msgChan and errChan belong to the primary
+	// subscription returned by ReceiveMessages, which does not hold up
+	// subscribers before ReceiveMessages has been called
+	hub                  *hub
+	primary              *Subscription
+	msgChan              <-chan shared.Message
+	errChan              <-chan error
+	slowSubscriberPolicy SlowSubscriberPolicy
+
+	// Buffering of parsed messages ahead of the hub (see buffer.go)
+	buffer         shared.BufferOptions
+	bufferCounters bufferCounters
+
+	// Retry policy for Connect
+	retryPolicy *shared.RetryPolicy
+
+	// Circuit breaker guarding process launches; launchPending marks a one-shot
+	// launch whose outcome is recorded when the process exits
+	breaker       *shared.Breaker
+	launchPending bool
+
+	// The last init system message (see capabilities.go)
+	initMu      sync.Mutex
+	initMessage *shared.SystemMessage
+
+	// Crash recovery (see recovery.go)
+	recovery   *shared.RecoveryOptions
+	recoveryMu sync.Mutex // guards sessionID, inFlight, turnStart, reconnects and sawResult
+	sessionID  string
+	inFlight   []byte
+	turnStart  time.Time // zero when no turn is in progress
+	reconnects int
+	sawResult  bool
+
+	// Deadlines (see deadline.go); lastOutput is the UnixNano time of the
+	// last stdout line and expired the deadline that stopped the CLI
+	deadlines  shared.DeadlineOptions
+	lastOutput atomic.Int64
+	expired    *shared.TimeoutError
+
+	// Resource limits of each CLI process (see limits.go)
+	limits *shared.ResourceLimits
+
+	// Shutdown; exit watches the current process and exitStatus records
+	// how the last one ended
+	shutdown   shared.ShutdownOptions
+	exit       *processExit
+	exitStatus *ExitStatus
+
+	// Control and cleanup. ctx spans the whole session; each CLI process
+	// runs under its own child context and generation number.
+	connectCtx context.Context
+	ctx        context.Context
+	cancel     context.CancelFunc
+	procCancel context.CancelFunc
+	generation int
+	stderrTail *stderrTail
+	wg         sync.WaitGroup
 }
 
 // TransportConfig holds configuration for the transport.
@@ -93,14 +144,20 @@ type TransportConfig struct {
 	CustomArgs []string
 	// Env are environment variables to set for the subprocess.
 	Env map[string]string
+	// EnvPolicy selects the variables of the SDK process's environment the
+	// subprocess inherits and overrides HOME and CLAUDE_CONFIG_DIR.
+	// The zero value inherits the whole environment.
+	EnvPolicy shared.EnvPolicy
 	// Cwd is the working directory for the subprocess.
 	// If empty, inherits parent process working directory.
 	Cwd string
 	// Tools configures tool availability (preset or explicit list).
 	Tools *shared.ToolsConfig
 	// StderrCallback is invoked for each stderr line from subprocess.
-	// If nil, stderr goes to parent process stderr.
+	// If nil, stderr goes to DebugWriter or, failing that, the error channel.
 	StderrCallback func(line string)
+	// DebugWriter receives stderr lines when StderrCallback is nil.
+	DebugWriter io.Writer
 	// CanUseTool is the callback for runtime permission checks.
 	CanUseTool shared.CanUseToolCallback
 	// PromptArg is the prompt for one-shot mode. If set, transport operates in one-shot mode.
@@ -110,6 +167,8 @@ type TransportConfig struct {
 	ParserRegistry *parser.MessageParserRegistry
 	// McpServers are MCP server configurations.
 	McpServers map[string]shared.McpServerConfig
+	// CLIOptions are session options passed to the CLI as dedicated flags.
+	CLIOptions CLIOptions
 
 	// Control protocol configuration
 	// ProtocolHooks configures hook callbacks for the control protocol.
@@ -118,9 +177,60 @@ type TransportConfig struct {
 	SdkMcpServers map[string]*mcp.SdkMcpServer
 	// EnableCheckpointing enables file checkpointing for RewindFiles.
 	EnableCheckpointing bool
+	// ControlHandlers handles control request subtypes the SDK does not
+	// handle itself, such as those of a newer or forked CLI.
+	ControlHandlers *ControlHandlerRegistry
 	// EnableControlProtocol explicitly enables the control protocol.
-	// If false, control protocol is auto-enabled when hooks, permissions, or checkpointing are configured.
+	// If false, control protocol is auto-enabled when hooks, permissions, SDK MCP servers,
+	// control handlers or checkpointing are configured.
 	EnableControlProtocol bool
+
+	// SlowSubscriberPolicy is the default policy for message subscriptions,
+	// including the stream returned by ReceiveMessages. Defaults to SlowSubscriberBlock.
+	SlowSubscriberPolicy SlowSubscriberPolicy
+
+	// RetryPolicy controls how Connect retries transient start failures.
+	// If nil, shared.DefaultRetryPolicy is used.
+	RetryPolicy *shared.RetryPolicy
+
+	// CircuitBreaker guards process launches. It may be shared by many
+	// transports so that a broken CLI fails fast everywhere. Nil disables it.
+	CircuitBreaker *shared.Breaker
+
+	// Recovery enables automatic recovery when the CLI process of an
+	// interactive session exits unexpectedly. Nil disables recovery.
+	Recovery *shared.RecoveryOptions
+
+	// Shutdown sets the grace periods of the staged shutdown performed by Close.
+	Shutdown shared.ShutdownOptions
+
+	// Buffer sizes the message buffers. BufferSize is the default subscription
+	// buffer; up to MaxMessages parsed messages are queued ahead of the
+	// subscribers before Overflow applies; lines of CLI output longer than
+	// MaxLineSize are skipped. Zero sizes use shared.DefaultBufferOptions.
+	Buffer shared.BufferOptions
+
+	// Deadlines bounds idle time, turn time and session lifetime. Expired
+	// deadlines are published as TimeoutErrors. Zero durations disable them.
+	Deadlines shared.DeadlineOptions
+
+	// ResourceLimits bounds the resources of each CLI process tree through
+	// rlimits and, optionally, a cgroup v2 of its own. Limit hits are reported
+	// as ResourceLimitErrors. Linux only; nil applies no limits.
+	ResourceLimits *shared.ResourceLimits
+
+	// ControlDispatch sets how many control requests from the CLI, such as
+	// permission checks, are handled concurrently. Zero fields use defaults.
+	ControlDispatch shared.ControlDispatchOptions
+
+	// Launcher starts the CLI processes, for example inside a container or
+	// sandbox, or on another host with a RemoteLauncher. If nil, ExecLauncher
+	// runs the CLI directly.
+	Launcher Launcher
+
+	// Logger receives transport, control protocol, hook and MCP routing
+	// diagnostics; secrets are redacted. If nil, shared.NewLogger decides.
+	Logger *slog.Logger
 }
 
 // createTransport creates a new transport with common initialization logic.
@@ -140,18 +250,43 @@ func createTransport(config *TransportConfig, promptArg *string) (*Transport, er
 		config.Timeout = defaultTimeout
 	}
 
+	retryPolicy := config.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = shared.DefaultRetryPolicy()
+	}
+
+	buffer := config.Buffer
+	defaults := shared.DefaultBufferOptions()
+	if buffer.BufferSize <= 0 {
+		buffer.BufferSize = defaults.BufferSize
+	}
+	if buffer.MaxMessages <= 0 {
+		buffer.MaxMessages = defaults.MaxMessages
+	}
+	if buffer.MaxLineSize <= 0 {
+		buffer.MaxLineSize = defaults.MaxLineSize
+	}
+
 	// Use provided registry or default
 	registry := config.ParserRegistry
 	if registry == nil {
 		registry = parser.DefaultRegistry()
 	}
 
+	launcher := config.Launcher
+	if launcher == nil {
+		launcher = ExecLauncher{}
+	}
+
 	return &Transport{
 		ProcessManager: ProcessManager{
+			launcher:   launcher,
 			cliPath:    config.CLIPath,
 			cliCommand: config.CLICommand,
 			cwd:        config.Cwd,
 			env:        config.Env,
+			envPolicy:  config.EnvPolicy,
+			logger:     shared.NewLogger(config.Logger, nil),
 		},
 		model:                 config.Model,
 		timeout:               config.Timeout,
@@ -159,14 +294,26 @@ func createTransport(config *TransportConfig, promptArg *string) (*Transport, er
 		customArgs:            config.CustomArgs,
 		tools:                 config.Tools,
 		stderrCallback:        config.StderrCallback,
+		debugWriter:           config.DebugWriter,
 		canUseTool:            config.CanUseTool,
 		mcpServers:            config.McpServers,
+		cliOptions:            config.CLIOptions,
 		promptArg:             promptArg,
 		parserRegistry:        registry,
 		protocolHooks:         config.ProtocolHooks,
 		sdkMcpServers:         config.SdkMcpServers,
 		enableCheckpointing:   config.EnableCheckpointing,
 		enableControlProtocol: config.EnableControlProtocol,
+		slowSubscriberPolicy:  config.SlowSubscriberPolicy,
+		buffer:                buffer,
+		retryPolicy:           retryPolicy,
+		breaker:               config.CircuitBreaker,
+		recovery:              config.Recovery,
+		shutdown:              config.Shutdown,
+		deadlines:             config.Deadlines,
+		limits:                config.ResourceLimits,
+		controlDispatch:       config.ControlDispatch,
+		controlHandlers:       config.ControlHandlers,
 	}, nil
 }
 
@@ -196,251 +343,344 @@ func (t *Transport) Connect(ctx context.Context) error {
 		return fmt.Errorf("transport already connected")
 	}
 
-	return withRetry(ctx, "connect", func() error {
-		// Discover CLI path if not provided
-		cliPath := t.cliPath
-		if cliPath == "" {
-			result, err := cli.DiscoverCLI("", t.cliCommand)
-			if err != nil {
-				return fmt.Errorf("discover CLI: %w", err)
-			}
-			cliPath = result.Path
-		}
+	// Initialize the broadcast hub and the primary subscription
+	t.hub = newHub(t.buffer.BufferSize, t.slowSubscriberPolicy)
+	t.primary = t.hub.subscribe()
+	t.primary.unread.Store(true)
+	t.msgChan = t.primary.Messages()
+	t.errChan = t.primary.Errors()
 
-		// Validate and set working directory if specified
-		if t.cwd != "" {
-			// Ensure path is absolute
-			if !filepath.IsAbs(t.cwd) {
-				return fmt.Errorf("cwd must be an absolute path: %s", t.cwd)
-			}
-			// Verify directory exists
-			info, err := os.Stat(t.cwd)
-			if err != nil {
-				if os.IsNotExist(err) {
-					return fmt.Errorf("cwd directory does not exist: %s", t.cwd)
-				}
-				return fmt.Errorf("cwd stat error: %w", err)
-			}
-			if !info.IsDir() {
-				return fmt.Errorf("cwd is not a directory: %s", t.cwd)
-			}
-		}
+	t.expired = nil
 
-		// Build command arguments
-		args := t.buildArgs()
-		t.cmd = exec.CommandContext(ctx, cliPath, args...)
+	// Set up context for goroutine management
+	t.connectCtx = ctx
+	t.ctx, t.cancel = context.WithCancel(ctx)
 
-		// Set working directory if specified
-		if t.cwd != "" {
-			t.cmd.Dir = t.cwd
-		}
+	err := t.retryPolicy.Do(ctx, "connect", func() error {
+		return t.guardLaunch(t.launch)
+	})
+	if err != nil {
+		t.cancel()
+		t.hub.close()
+		return err
+	}
 
-		// Set environment
-		t.cmd.Env = t.buildEnv()
-
-		// Debug: log command and relevant env vars to file
-		if debugEnabled {
-			if debugFile, err := os.OpenFile("/tmp/sdk-debug.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
-				fmt.Fprintf(debugFile, "\n=== %s ===\n", time.Now().Format(time.RFC3339))
-				fmt.Fprintf(debugFile, "command: %s %v\n", cliPath, args)
-				for _, e := range t.cmd.Env {
-					if strings.HasPrefix(e, "ANTHROPIC_") || strings.HasPrefix(e, "SYNTHETIC_") || strings.HasPrefix(e, "ZAI_") {
-						fmt.Fprintf(debugFile, "env: %s\n", e)
-					}
-				}
-				debugFile.Close()
-			}
-		}
+	t.connected = true
+	if t.promptArg != nil {
+		// The prompt's turn starts with the process
+		t.recoveryMu.Lock()
+		t.turnStart = time.Now()
+		t.recoveryMu.Unlock()
+	}
+	if t.deadlinesEnabled() {
+		t.wg.Add(1)
+		go t.watchDeadlines(t.ctx, time.Now())
+	}
+	return nil
+}
 
-		// Set up I/O pipes
-		// Only create stdin pipe for interactive mode - stdin pipe causes issues with one-shot mode
-		if t.promptArg == nil {
-			stdin, err := t.cmd.StdinPipe()
-			if err != nil {
-				return fmt.Errorf("create stdin pipe: %w", err)
-			}
-			t.stdin = stdin
-		}
+// launch discovers the CLI, validates the working directory and starts the
+// first process. The caller must hold t.mu.
+func (t *Transport) launch() error {
+	if err := t.envPolicy.Validate(); err != nil {
+		return err
+	}
+	if isRemote(t.launcher) {
+		// Neither the CLI nor the working directory is on this host
+		return t.startProcess(cmp.Or(t.cliPath, t.cliCommand), t.buildArgs(), closedReady)
+	}
 
-		stdout, err := t.cmd.StdoutPipe()
+	// Discover CLI path if not provided
+	cliPath := t.cliPath
+	if cliPath == "" {
+		result, err := cli.DiscoverCLI("", t.cliCommand)
 		if err != nil {
-			if t.stdin != nil {
-				t.stdin.Close()
-			}
-			return fmt.Errorf("create stdout pipe: %w", err)
+			return fmt.Errorf("discover CLI: %w", err)
 		}
-		t.stdout = stdout
+		cliPath = result.Path
+	}
 
-		stderr, err := t.cmd.StderrPipe()
+	// Validate and set working directory if specified
+	if t.cwd != "" {
+		// Ensure path is absolute
+		if !filepath.IsAbs(t.cwd) {
+			return fmt.Errorf("cwd must be an absolute path: %s", t.cwd)
+		}
+		// Verify directory exists
+		info, err := os.Stat(t.cwd)
 		if err != nil {
-			if t.stdin != nil {
-				t.stdin.Close()
+			if os.IsNotExist(err) {
+				return fmt.Errorf("cwd directory does not exist: %s", t.cwd)
 			}
-			stdout.Close()
-			return fmt.Errorf("create stderr pipe: %w", err)
+			return fmt.Errorf("cwd stat error: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("cwd is not a directory: %s", t.cwd)
 		}
-		t.stderr = stderr
+	}
 
-		// Initialize channels
-		t.msgChan = make(chan shared.Message, channelBufferSize)
-		t.errChan = make(chan error, channelBufferSize)
+	return t.startProcess(cliPath, t.buildArgs(), closedReady)
+}
 
-		// Start the process
-		if err := t.cmd.Start(); err != nil {
-			t.cleanup()
-			return fmt.Errorf("start CLI process: %w", err)
-		}
+// guardLaunch runs a process launch through the circuit breaker, if any.
+// Interactive launches are recorded at once; a one-shot launch is recorded
+// when its process exits, depending on whether it produced a result.
+// The caller must hold t.mu.
+func (t *Transport) guardLaunch(launch func() error) error {
+	if t.breaker == nil {
+		return launch()
+	}
+	if err := t.breaker.Allow(); err != nil {
+		return err
+	}
 
-		// Set up context for goroutine management
-		t.ctx, t.cancel = context.WithCancel(ctx)
+	err := launch()
+	switch {
+	case err != nil:
+		t.breaker.Record(err)
+	case t.promptArg != nil:
+		t.launchPending = true
+	default:
+		t.breaker.Record(nil)
+	}
+	return err
+}
 
-		// Start stdout reader goroutine
-		t.wg.Add(1)
-		go t.handleStdout()
+// closedReady lets a process publish its messages immediately.
+var closedReady = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// startProcess spawns the CLI, starts its reader goroutines and, if needed,
+// initializes the control protocol. Each process runs under its own context
+// and generation so that the readers of a replaced process stand down.
+// Messages other than control traffic are held back until ready is closed.
+// The process is started by the configured Launcher and is killed, with the
+// processes it spawned, if the Connect context ends. The caller must hold t.mu.
+func (t *Transport) startProcess(cliPath string, args []string, ready <-chan struct{}) error {
+	spec := LaunchSpec{
+		Path:           cliPath,
+		Args:           args,
+		Env:            t.buildEnv(),
+		Dir:            t.cwd,
+		Stdin:          t.promptArg == nil,
+		ResourceLimits: t.limits,
+	}
+	t.stdin = nil
 
-		// Start stderr reader goroutine for error reporting
-		t.wg.Add(1)
-		go t.handleStderr()
+	t.logger.Debug("starting CLI",
+		"path", cliPath,
+		"args", redactArgs(args, t.promptArg),
+		"cwd", t.cwd,
+		slog.Group("env", envAttrs(spec.Env)...))
+	t.logger.Debug("CLI environment", "mode", t.envPolicy.Mode, "env", shared.RedactEnv(spec.Env))
 
-		// Set up control protocol if needed
-		if t.needsProtocolHandshake() {
-			if err := t.setupControlProtocol(t.ctx); err != nil {
-				t.cleanup()
-				return fmt.Errorf("setup control protocol: %w", err)
-			}
+	proc, err := t.launcher.Launch(t.connectCtx, spec)
+	if err != nil {
+		return err
+	}
+	t.proc, t.spec = proc, spec
+	t.stdin, t.stdout, t.stderr = proc.Stdin(), proc.Stdout(), proc.Stderr()
+	t.exit = watchProcess(t.connectCtx, proc)
+	log := t.logger.With("pid", proc.Pid())
+	log.Info("CLI started")
+
+	t.generation++
+	procCtx, procCancel := context.WithCancel(t.ctx)
+	t.procCancel = procCancel
+	t.stderrTail = newStderrTail()
+
+	// Start stdout reader goroutine
+	t.wg.Add(1)
+	go t.handleStdout(procCtx, log, t.stdout, t.generation, ready)
+
+	// Start stderr reader goroutine for error reporting
+	t.wg.Add(1)
+	go t.handleStderr(procCtx, log, t.stderr, t.stderrTail)
+
+	// Set up control protocol if needed
+	if t.needsProtocolHandshake() {
+		if err := t.setupControlProtocol(procCtx, log); err != nil {
+			t.stopProcess()
+			return fmt.Errorf("setup control protocol: %w", err)
 		}
+	}
 
-		t.connected = true
-		return nil
-	})
+	return nil
+}
+
+// stopProcess kills the current process after a failed start and retires its
+// generation, so its readers exit without touching the transport.
+// The caller must hold t.mu.
+func (t *Transport) stopProcess() {
+	t.generation++
+	t.procCancel()
+	t.cleanup()
+	if t.exit != nil {
+		_ = t.proc.Signal(os.Kill)
+		<-t.exit.done
+		t.exit = nil
+	}
 }
 
 // buildArgs builds the CLI arguments based on the transport mode.
 // This is a thin wrapper around BuildArgs for backwards compatibility.
 func (t *Transport) buildArgs() []string {
-	return BuildArgs(t.model, t.systemPrompt, t.customArgs, t.tools, t.mcpServers, t.promptArg)
+	return BuildArgsWithOptions(t.model, t.systemPrompt, t.customArgs, t.tools, t.mcpServers, &t.cliOptions, t.promptArg)
 }
 
-// handleStdout reads and parses messages from stdout.
-func (t *Transport) handleStdout() {
+// handleStdout reads and parses messages from the stdout of one CLI process.
+// gen is the process generation; once a newer process has replaced this one,
+// the end of its output is ignored. Parsed messages wait for ready and are
+// queued for a separate publisher, so that control requests are still
+// handled while subscribers catch up.
+func (t *Transport) handleStdout(ctx context.Context, log *slog.Logger, stdout io.Reader, gen int, ready <-chan struct{}) {
 	defer t.wg.Done()
-	defer func() {
-		// Signal completion when stdout closes (subprocess exit)
-		// This unblocks any goroutines waiting on msgChan
-		t.mu.Lock()
-		if t.connected {
-			close(t.msgChan)
-			close(t.errChan)
-			t.connected = false
+	defer t.handleProcessExit(ctx, gen)
+
+	queue := t.newMessageQueue(log)
+	defer queue.release()
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for {
+			msg, ok := queue.pop(ctx)
+			if !ok {
+				return
+			}
+			t.hub.publish(ctx, msg)
 		}
-		t.mu.Unlock()
 	}()
 
-	scanner := bufio.NewScanner(t.stdout)
-	// Increase buffer size to handle large JSON responses (default 64KB is often insufficient)
-	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024) // 1MB initial, 10MB max
-	for scanner.Scan() {
+	// Deliver everything queued before the exit is handled
+	defer func() {
+		queue.closeInput()
+		<-published
+	}()
+
+	// sessionLog tags records with the session once the CLI reports it
+	var sessionID string
+	sessionLog := log
+	reader := newLineReader(stdout, t.buffer.MaxLineSize)
+	for {
+		line, err := reader.next()
+		t.lastOutput.Store(time.Now().UnixNano())
+		if tooLong, ok := shared.AsLineTooLongError(err); ok {
+			log.Warn("CLI output line too long, skipped", "bytes", tooLong.Size, "max_line_size", tooLong.Limit)
+			t.hub.publishError(ctx, err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Warn("reading CLI stdout failed", "error", err)
+				t.hub.publishError(ctx, fmt.Errorf("read stdout: %w", err))
+			}
+			return
+		}
+
 		// Check for context cancellation
 		select {
-		case <-t.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
 
-		line := scanner.Text()
-
 		// Skip empty lines
-		if line == "" {
+		if len(line) == 0 {
 			continue
 		}
 
-		// Debug: log raw response line to file
-		if debugEnabled {
-			if debugFile, err := os.OpenFile("/tmp/sdk-debug.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
-				fmt.Fprintf(debugFile, "response: %s\n", line)
-				debugFile.Close()
-			}
-		}
-
 		// Parse the line as JSON
 		var rawMsg map[string]any
-		if err := json.Unmarshal([]byte(line), &rawMsg); err != nil {
-			select {
-			case t.errChan <- fmt.Errorf("parse JSON: %w", err):
-			case <-t.ctx.Done():
-				return
-			}
+		if err := json.Unmarshal(line, &rawMsg); err != nil {
+			log.Warn("invalid JSON from CLI", "error", err, "bytes", len(line))
+			t.hub.publishError(ctx, fmt.Errorf("parse JSON: %w", err))
 			continue
 		}
 
 		// Discriminate by message type
 		msgType, ok := rawMsg["type"].(string)
 		if !ok {
-			select {
-			case t.errChan <- fmt.Errorf("message missing type field"):
-			case <-t.ctx.Done():
-				return
-			}
+			log.Warn("CLI message without type", "bytes", len(line))
+			t.hub.publishError(ctx, fmt.Errorf("message missing type field"))
 			continue
 		}
 
-		// Route control messages to protocol if active
-		if t.protocol != nil && (msgType == MessageTypeControlRequest || msgType == MessageTypeControlResponse) {
-			if err := t.protocol.HandleIncomingMessage(t.ctx, rawMsg); err != nil {
-				select {
-				case t.errChan <- fmt.Errorf("control protocol: %w", err):
-				case <-t.ctx.Done():
-					return
-				}
+		if id, ok := rawMsg["session_id"].(string); ok && id != "" && id != sessionID {
+			sessionID = id
+			sessionLog = log.With("session_id", id)
+		}
+		sessionLog.Debug("received message", messageAttrs(msgType, rawMsg)...)
+
+		// Route control messages to protocol if active. Requests from the
+		// CLI are handled off this goroutine, so that their cancellations
+		// and the responses to the SDK's requests get through meanwhile.
+		if t.protocol != nil && (msgType == MessageTypeControlRequest || msgType == MessageTypeControlResponse ||
+			msgType == MessageTypeControlCancelRequest) {
+			if err := t.protocol.Dispatch(ctx, rawMsg); err != nil {
+				t.hub.publishError(ctx, fmt.Errorf("control protocol: %w", err))
 			}
 			continue
 		}
 
-		// Parse message using injected registry (OCP compliance)
-		msg, err := t.parserRegistry.Parse(msgType, line, 0)
+		msg, err := t.parseMessage(msgType, line, rawMsg)
 		if err != nil {
-			// Check if it's an unknown type - pass as raw
-			if !t.parserRegistry.HasParser(msgType) {
-				msg = &shared.RawControlMessage{
-					MessageType: msgType,
-					Data:        rawMsg,
-				}
-			} else {
-				select {
-				case t.errChan <- err:
-				case <-t.ctx.Done():
-					return
-				}
-				continue
-			}
+			t.hub.publishError(ctx, err)
+			continue
 		}
 
-		// Send the message
+		// A respawned process waits until its recovery has been reported
 		select {
-		case t.msgChan <- msg:
-		case <-t.ctx.Done():
+		case <-ready:
+		case <-ctx.Done():
 			return
 		}
-	}
 
-	// Check for scanner errors
-	if err := scanner.Err(); err != nil {
-		select {
-		case t.errChan <- fmt.Errorf("stdout scanner error: %w", err):
-		case <-t.ctx.Done():
+		// Remember what recovery needs before queueing
+		t.trackSession(msg)
+
+		if !queue.push(ctx, msg, line) {
+			return
 		}
 	}
 }
 
+// parseMessage parses a CLI message using the injected registry (OCP
+// compliance). Messages of unknown types are passed on raw.
+func (t *Transport) parseMessage(msgType string, line []byte, rawMsg map[string]any) (shared.Message, error) {
+	if !t.parserRegistry.HasParser(msgType) {
+		return &shared.RawControlMessage{
+			MessageType: msgType,
+			Data:        rawMsg,
+		}, nil
+	}
+	return t.parserRegistry.Parse(msgType, string(line), 0)
+}
+
+// decodeMessage parses a complete CLI message line, such as a spilled one.
+func (t *Transport) decodeMessage(line []byte) (shared.Message, error) {
+	var rawMsg map[string]any
+	if err := json.Unmarshal(line, &rawMsg); err != nil {
+		return nil, fmt.Errorf("parse JSON: %w", err)
+	}
+	msgType, _ := rawMsg["type"].(string)
+	return t.parseMessage(msgType, line, rawMsg)
+}
+
 // handleStderr reads from stderr and forwards to callback or error channel.
-func (t *Transport) handleStderr() {
+// The last lines are kept in tail, which is marked done when the reader exits.
+func (t *Transport) handleStderr(ctx context.Context, log *slog.Logger, stderr io.Reader, tail *stderrTail) {
 	defer t.wg.Done()
+	defer close(tail.done)
 
 	// Drain stderr to prevent blocking
-	scanner := bufio.NewScanner(t.stderr)
+	scanner := bufio.NewScanner(stderr)
 	for {
 		select {
-		case <-t.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 			if !scanner.Scan() {
@@ -450,35 +690,53 @@ func (t *Transport) handleStderr() {
 
 			line := scanner.Text()
 			if line != "" {
+				tail.add(line)
+				log.Debug("CLI stderr", "line", line)
+
 				// If stderr callback is set, invoke it with panic recovery
 				if t.stderrCallback != nil {
 					func() {
 						defer func() {
 							if r := recover(); r != nil {
 								// Log panic but don't crash the session
-								select {
-								case t.errChan <- fmt.Errorf("stderr callback panic: %v", r):
-								case <-t.ctx.Done():
-								}
+								t.hub.publishError(ctx, fmt.Errorf("stderr callback panic: %v", r))
 							}
 						}()
 						t.stderrCallback(line)
 					}()
+				} else if t.debugWriter != nil {
+					_, _ = fmt.Fprintln(t.debugWriter, line)
 				} else {
 					// Default behavior: forward to error channel
-					select {
-					case t.errChan <- fmt.Errorf("CLI stderr: %s", line):
-					case <-t.ctx.Done():
-						return
-					}
+					t.hub.publishError(ctx, fmt.Errorf("CLI stderr: %s", line))
 				}
 			}
 		}
 	}
 }
 
-// SendMessage sends a message to the CLI via stdin.
-// Only works in interactive mode (promptArg == nil).
+// streamUserMessage is the stream-json envelope the CLI expects on stdin
+// for each user turn in interactive mode.
+type streamUserMessage struct {
+	Type            string            `json:"type"`
+	Message         streamUserContent `json:"message"`
+	ParentToolUseID *string           `json:"parent_tool_use_id"`
+	SessionID       string            `json:"session_id"`
+}
+
+// streamUserContent is the inner message of a streamUserMessage.
+type streamUserContent struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// defaultStreamSessionID is the session_id sent with user messages.
+// The CLI assigns the real session ID and reports it in its init and result messages.
+const defaultStreamSessionID = "default"
+
+// SendMessage sends a user message to the CLI via stdin.
+// The message is wrapped in the stream-json user envelope and starts a new turn
+// on the running process, so earlier turns remain in the conversation context.
 func (t *Transport) SendMessage(ctx context.Context, message string) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -491,10 +749,13 @@ func (t *Transport) SendMessage(ctx context.Context, message string) error {
 		return fmt.Errorf("cannot send message in one-shot mode")
 	}
 
-	// Create a user message from the string
-	userMsg := &shared.UserMessage{
-		MessageType: shared.MessageTypeUser,
-		Content:     message,
+	userMsg := streamUserMessage{
+		Type: shared.MessageTypeUser,
+		Message: streamUserContent{
+			Role:    "user",
+			Content: message,
+		},
+		SessionID: defaultStreamSessionID,
 	}
 
 	// Marshal the message to JSON
@@ -502,9 +763,35 @@ func (t *Transport) SendMessage(ctx context.Context, message string) error {
 	if err != nil {
 		return fmt.Errorf("marshal message: %w", err)
 	}
+	data = append(data, '\n')
+
+	if err := t.writeStdin(ctx, data); err != nil {
+		return err
+	}
 
-	// Write to stdin with newline
-	if _, err := fmt.Fprintln(t.stdin, string(data)); err != nil {
+	// Keep the message until its result arrives: a crash mid-turn
+	// is reported, and recovery may resend it
+	t.recoveryMu.Lock()
+	t.inFlight = data
+	t.turnStart = time.Now()
+	t.recoveryMu.Unlock()
+
+	return nil
+}
+
+// writeStdin writes a framed message to the CLI's stdin.
+// The caller must hold t.mu.
+func (t *Transport) writeStdin(ctx context.Context, data []byte) error {
+	// Share the protocol adapter's lock when present so user messages
+	// never interleave with control protocol writes on stdin.
+	if t.protocolAdapter != nil {
+		if err := t.protocolAdapter.Write(ctx, data); err != nil {
+			return fmt.Errorf("write to stdin: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := t.stdin.Write(data); err != nil {
 		return fmt.Errorf("write to stdin: %w", err)
 	}
 
@@ -518,11 +805,15 @@ func (t *Transport) SendText(ctx context.Context, text string) error {
 }
 
 // ReceiveMessages returns channels for receiving messages and errors.
+// The output of a process that has already exited stays readable until Close.
+// Until the first call, the shared stream keeps only its latest messages
+// while there are subscribers, so a transport read only through Subscribe is
+// never held up by it.
 func (t *Transport) ReceiveMessages(ctx context.Context) (<-chan shared.Message, <-chan error) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	if !t.connected {
+	if !t.connected && t.exit == nil {
 		msgChan := make(chan shared.Message)
 		errChan := make(chan error, 1)
 		errChan <- fmt.Errorf("transport not connected")
@@ -531,18 +822,41 @@ func (t *Transport) ReceiveMessages(ctx context.Context) (<-chan shared.Message,
 		return msgChan, errChan
 	}
 
+	t.primary.unread.Store(false)
 	return t.msgChan, t.errChan
 }
 
+// Subscribe registers an independent subscriber for the messages and errors of
+// the connected CLI process. Unlike ReceiveMessages, which returns one shared
+// stream, every subscription receives its own copy of each message.
+// Messages emitted before Subscribe is called are not replayed.
+func (t *Transport) Subscribe(opts ...SubscribeOption) (*Subscription, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if !t.connected {
+		return nil, fmt.Errorf("transport not connected")
+	}
+
+	return t.hub.subscribe(opts...), nil
+}
+
 // Close closes the transport and cleans up resources.
+// The CLI is stopped with a staged shutdown (see shared.ShutdownOptions).
+// Close returns a ProcessError carrying the exit code or signal if the CLI
+// did not exit cleanly; ExitStatus reports the details.
 func (t *Transport) Close() error {
 	t.mu.Lock()
-	defer t.mu.Unlock()
 
-	if !t.connected {
+	// exit is set from a successful Connect until the first Close,
+	// even if the process has ended on its own in between
+	exit := t.exit
+	if exit == nil {
+		t.mu.Unlock()
 		return nil
 	}
 
+	t.exit = nil
 	t.connected = false
 
 	// Close control protocol first
@@ -562,6 +876,12 @@ func (t *Transport) Close() error {
 	if t.stdin != nil {
 		_ = t.stdin.Close()
 	}
+	proc, command, hasStdin, tail := t.proc, t.spec.command(), t.stdin != nil, t.stderrTail
+
+	// Release the lock while waiting: the reader goroutines take it on exit
+	t.mu.Unlock()
+
+	status := t.shutdownProcess(proc, exit, hasStdin)
 
 	// Wait for goroutines to finish
 	done := make(chan struct{})
@@ -582,6 +902,9 @@ func (t *Transport) Close() error {
 		time.Sleep(1 * time.Second)
 	}
 
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	// Close stdout and stderr
 	if t.stdout != nil {
 		_ = t.stdout.Close()
@@ -590,16 +913,52 @@ func (t *Transport) Close() error {
 		_ = t.stderr.Close()
 	}
 
-	// Terminate the process
-	if t.cmd != nil && t.cmd.Process != nil {
-		_ = t.cmd.Process.Kill()
-		_ = t.cmd.Wait()
+	// End all subscriptions; closing an already closed hub is a no-op
+	if t.hub != nil {
+		t.hub.close()
 	}
 
-	// Note: channels are closed by handleStdout when it exits
-	// to avoid double-close panic
+	t.exitStatus = &status
+	t.logger.Info("CLI stopped", "pid", proc.Pid(), "stage", status.Stage, "exit_code", status.Code, "signal", status.Signal)
+	if t.expired != nil {
+		// The deadline explains how the process ended
+		return t.expired
+	}
+	return exitError(proc.Pid(), command, status, tail.snapshot())
+}
 
-	return nil
+// ExitStatus reports how the CLI process ended. It returns false until
+// Close has stopped the process.
+func (t *Transport) ExitStatus() (ExitStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.exitStatus == nil {
+		return ExitStatus{}, false
+	}
+	return *t.exitStatus, true
+}
+
+// BufferStats reports how many messages the overflow policy has dropped or
+// spilled to disk since the transport was created.
+func (t *Transport) BufferStats() BufferStats {
+	return BufferStats{
+		Dropped: t.bufferCounters.dropped.Load(),
+		Spilled: t.bufferCounters.spilled.Load(),
+	}
+}
+
+// ControlStats reports the handling of control requests from the CLI by the
+// current control protocol, or zero stats without one.
+func (t *Transport) ControlStats() ControlStats {
+	t.mu.RLock()
+	protocol := t.protocol
+	t.mu.RUnlock()
+
+	if protocol == nil {
+		return ControlStats{}
+	}
+	return protocol.ControlStats()
 }
 
 // IsConnected returns whether the transport is connected.
@@ -614,8 +973,8 @@ func (t *Transport) GetPID() int {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	if t.cmd != nil && t.cmd.Process != nil {
-		return t.cmd.Process.Pid
+	if t.proc != nil {
+		return t.proc.Pid()
 	}
 	return 0
 }
@@ -625,8 +984,8 @@ func (t *Transport) GetCommand() string {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	if t.cmd != nil {
-		return t.cmd.String()
+	if t.proc != nil {
+		return t.spec.command()
 	}
 
 	if t.cliPath != "" {
@@ -636,22 +995,36 @@ func (t *Transport) GetCommand() string {
 	return t.cliCommand
 }
 
-// Interrupt forcibly interrupts the transport.
+// EnvDump returns the environment the CLI is started with, as sorted
+// NAME=[REDACTED] pairs, for checking what the env policy passes on.
+func (t *Transport) EnvDump() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return shared.RedactEnv(t.buildEnv())
+}
+
+// Interrupt stops the CLI with the staged shutdown of Close: stdin is closed,
+// then the CLI and every process in its process group receive SIGINT, SIGTERM
+// and SIGKILL in turn until it exits. The transport is not closed; Close
+// still releases it and reports the exit status.
 func (t *Transport) Interrupt() error {
 	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	if !t.connected || t.cmd == nil || t.cmd.Process == nil {
+	if !t.connected || t.proc == nil || t.exit == nil {
+		t.mu.Unlock()
 		return fmt.Errorf("process not running")
 	}
 
 	// Close stdin to signal EOF
-	if t.stdin != nil {
+	proc, exit, hasStdin := t.proc, t.exit, t.stdin != nil
+	if hasStdin {
 		_ = t.stdin.Close()
 	}
 
-	// Try to terminate the process gracefully
-	return t.cmd.Process.Kill()
+	// Release the lock while waiting: the reader goroutines take it on exit
+	t.mu.Unlock()
+
+	t.shutdownProcess(proc, exit, hasStdin)
+	return nil
 }
 
 // cleanup closes all resources without acquiring the lock.
@@ -672,12 +1045,6 @@ func (t *Transport) cleanup() {
 	if t.stderr != nil {
 		_ = t.stderr.Close()
 	}
-	if t.msgChan != nil {
-		close(t.msgChan)
-	}
-	if t.errChan != nil {
-		close(t.errChan)
-	}
 }
 
 // needsProtocolHandshake returns true if the transport needs to set up the control protocol.
@@ -685,6 +1052,8 @@ func (t *Transport) cleanup() {
 // - Hooks are configured
 // - Permission callback is configured
 // - File checkpointing is enabled
+// - SDK MCP servers are configured
+// - Control handlers are configured
 // - Control protocol is explicitly enabled
 func (t *Transport) needsProtocolHandshake() bool {
 	// Only interactive mode supports control protocol
@@ -695,18 +1064,26 @@ func (t *Transport) needsProtocolHandshake() bool {
 	needed := t.enableControlProtocol ||
 		t.canUseTool != nil ||
 		len(t.protocolHooks) > 0 ||
+		len(t.sdkMcpServers) > 0 ||
+		t.controlHandlers != nil ||
 		t.enableCheckpointing
 
-	if needed && debugEnabled {
-		log.Printf("claude-sdk: control protocol enabled (explicit=%v, canUseTool=%v, hooks=%d, checkpointing=%v)",
-			t.enableControlProtocol, t.canUseTool != nil, len(t.protocolHooks), t.enableCheckpointing)
+	if needed {
+		t.logger.Debug("control protocol enabled",
+			"explicit", t.enableControlProtocol,
+			"can_use_tool", t.canUseTool != nil,
+			"hooks", len(t.protocolHooks),
+			"sdk_mcp_servers", len(t.sdkMcpServers),
+			"control_handlers", t.controlHandlers != nil,
+			"checkpointing", t.enableCheckpointing)
 	}
 
 	return needed
 }
 
 // setupControlProtocol creates and initializes the control protocol.
-func (t *Transport) setupControlProtocol(ctx context.Context) error {
+// The protocol logs through log.
+func (t *Transport) setupControlProtocol(ctx context.Context, log *slog.Logger) error {
 	if t.stdin == nil {
 		return fmt.Errorf("stdin not available for control protocol")
 	}
@@ -715,7 +1092,7 @@ func (t *Transport) setupControlProtocol(ctx context.Context) error {
 	t.protocolAdapter = NewProtocolAdapter(t.stdin)
 
 	// Build protocol options
-	var opts []ProtocolOption
+	opts := []ProtocolOption{WithLogger(log), WithControlDispatch(t.controlDispatch)}
 
 	if t.canUseTool != nil {
 		opts = append(opts, WithCanUseToolCallback(t.canUseTool))
@@ -729,8 +1106,15 @@ func (t *Transport) setupControlProtocol(ctx context.Context) error {
 		opts = append(opts, WithSdkMcpServers(t.sdkMcpServers))
 	}
 
-	// Create protocol handler
+	if t.controlHandlers != nil {
+		opts = append(opts, WithControlHandlers(t.controlHandlers))
+	}
+
+	// Create protocol handler. A respawned CLI reported its version before.
 	t.protocol = NewProtocol(t.protocolAdapter, opts...)
+	if version := t.reportedCLIVersion(); version != "" {
+		t.protocol.setCLIVersion(version)
+	}
 
 	// Start protocol (this starts the message routing)
 	if err := t.protocol.Start(ctx); err != nil {
@@ -206,3 +206,37 @@ func TestTransportInvalidConfig(t *testing.T) {
 		t.Error("Default timeout should be set")
 	}
 }
+
+func TestTransportEnvPolicy(t *testing.T) {
+	t.Setenv("SDK_TEST_SECRET", "leaked")
+	t.Setenv("HOME", "/home/svc")
+
+	transport, err := NewTransport(&TransportConfig{
+		Env: map[string]string{"SDK_TEST_EXPLICIT": "set", "HOME": "/home/explicit"},
+		EnvPolicy: shared.EnvPolicy{
+			Mode:      shared.EnvAllowlist,
+			Home:      "/srv/tenant",
+			ConfigDir: "/srv/tenant/.claude",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	env := transport.buildEnv()
+	for _, want := range []string{"SDK_TEST_EXPLICIT=set", "HOME=/srv/tenant", "CLAUDE_CONFIG_DIR=/srv/tenant/.claude"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("%s not found in %v", want, env)
+		}
+	}
+	for _, unwanted := range []string{"SDK_TEST_SECRET=leaked", "HOME=/home/svc", "HOME=/home/explicit"} {
+		if slices.Contains(env, unwanted) {
+			t.Errorf("%s was included", unwanted)
+		}
+	}
+
+	dump := transport.EnvDump()
+	if !slices.Contains(dump, "HOME="+shared.Redacted) || slices.Contains(dump, "HOME=/srv/tenant") {
+		t.Errorf("EnvDump() = %v, want redacted values", dump)
+	}
+}
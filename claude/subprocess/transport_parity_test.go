@@ -1,6 +1,7 @@
 package subprocess
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
@@ -70,6 +71,21 @@ func TestTransportConfig_StderrCallback(t *testing.T) {
 	assert.True(t, called)
 }
 
+// TestTransportConfig_DebugWriterAndCLIOptions tests that stderr and flag settings are stored.
+func TestTransportConfig_DebugWriterAndCLIOptions(t *testing.T) {
+	var debug bytes.Buffer
+	config := &TransportConfig{
+		Model:       "claude-sonnet-4-5-20250929",
+		DebugWriter: &debug,
+		CLIOptions:  CLIOptions{IncludePartialMessages: true},
+	}
+
+	transport, err := NewTransport(config)
+	require.NoError(t, err)
+	assert.Equal(t, &debug, transport.debugWriter)
+	assert.Contains(t, transport.buildArgs(), "--include-partial-messages")
+}
+
 // TestTransport_buildArgs_ToolsPreset tests CLI args generation for tools preset.
 func TestTransport_buildArgs_ToolsPreset(t *testing.T) {
 	transport := &Transport{
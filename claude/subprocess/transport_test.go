@@ -2,8 +2,11 @@
 package subprocess
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -307,6 +310,37 @@ func TestTransport_SendMessage_OneShotMode(t *testing.T) {
 	assert.Contains(t, err.Error(), "cannot send message in one-shot mode")
 }
 
+// TestTransport_SendMessage_Envelope tests the stream-json user envelope written to stdin.
+func TestTransport_SendMessage_Envelope(t *testing.T) {
+	var buf bytes.Buffer
+	transport := &Transport{
+		ProcessManager: ProcessManager{stdin: nopWriteCloser{&buf}},
+		connected:      true,
+	}
+
+	ctx := context.Background()
+	require.NoError(t, transport.SendMessage(ctx, "Hello"))
+	require.NoError(t, transport.SendMessage(ctx, "Again"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	var envelope map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &envelope))
+	assert.Equal(t, "user", envelope["type"])
+	assert.Equal(t, map[string]any{"role": "user", "content": "Hello"}, envelope["message"])
+	assert.Contains(t, envelope, "parent_tool_use_id")
+	assert.Nil(t, envelope["parent_tool_use_id"])
+	assert.Equal(t, "default", envelope["session_id"])
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
 // strPtr returns a pointer to a string.
 func strPtr(s string) *string {
 	return &s
@@ -0,0 +1,278 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Turn is the outcome of one prompt sent on a connected client.
+// It holds every message the CLI emitted for the prompt, up to and including
+// the ResultMessage that ends the turn.
+type Turn struct {
+	// Messages are all messages of the turn in arrival order.
+	Messages []Message
+
+	// Assistant are the assistant messages of the turn.
+	Assistant []*AssistantMessage
+
+	// ToolCalls pair each tool use with its result, in request order.
+	ToolCalls []ToolCall
+
+	// Result is the ResultMessage that ended the turn.
+	Result *ResultMessage
+
+	// Usage is the token usage reported by the result, if any.
+	Usage map[string]any
+
+	// CostUSD is the total cost reported by the result, if any.
+	CostUSD float64
+
+	// Errors are the stream errors reported during the turn that did not
+	// end it, such as CLI stderr lines without a StderrCallback.
+	Errors []error
+
+	// pending maps tool use IDs to their index in ToolCalls.
+	pending map[string]int
+}
+
+// ToolCall pairs a tool use request with the tool result that answered it.
+type ToolCall struct {
+	// Use is the tool use requested by the assistant.
+	Use *ToolUseBlock
+
+	// Result is the matching tool result, or nil if none arrived in the turn.
+	Result *ToolResultBlock
+}
+
+// Text returns the concatenated text of all assistant messages in the turn.
+func (t *Turn) Text() string {
+	var sb strings.Builder
+	for _, msg := range t.Assistant {
+		for _, block := range msg.Content {
+			if text, ok := block.(*TextBlock); ok {
+				sb.WriteString(text.Text)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// SessionID returns the session ID reported by the result, or "" if none.
+func (t *Turn) SessionID() string {
+	if t.Result == nil {
+		return ""
+	}
+	return t.Result.SessionID
+}
+
+// IsError reports whether the turn ended with an error result.
+func (t *Turn) IsError() bool {
+	return t.Result != nil && t.Result.IsError
+}
+
+// add records a message of the turn.
+func (t *Turn) add(msg Message) {
+	t.Messages = append(t.Messages, msg)
+
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		t.Assistant = append(t.Assistant, m)
+		for _, block := range m.Content {
+			if use, ok := block.(*ToolUseBlock); ok {
+				if t.pending == nil {
+					t.pending = make(map[string]int)
+				}
+				t.pending[use.ToolUseID] = len(t.ToolCalls)
+				t.ToolCalls = append(t.ToolCalls, ToolCall{Use: use})
+			}
+		}
+	case *UserMessage:
+		blocks, ok := m.Content.([]ContentBlock)
+		if !ok {
+			return
+		}
+		for _, block := range blocks {
+			if result, ok := block.(*ToolResultBlock); ok {
+				if i, found := t.pending[result.ToolUseID]; found {
+					t.ToolCalls[i].Result = result
+					delete(t.pending, result.ToolUseID)
+				}
+			}
+		}
+	case *ResultMessage:
+		t.Result = m
+		if m.Usage != nil {
+			t.Usage = *m.Usage
+		}
+		if m.TotalCostUSD != nil {
+			t.CostUSD = *m.TotalCostUSD
+		}
+	}
+}
+
+// streamTurn forwards messages from src until a ResultMessage has been forwarded.
+// Errors from srcErr do not end the turn: CLI stderr lines and unparsable
+// output are reported on the error channel while the turn goes on. The
+// returned channels are closed when the turn ends; a premature end of the
+// stream is reported wrapping the last stream error, and context cancellation with
+// the context error. Non-fatal errors still unread when the turn ends are
+// dropped once the error buffer is full.
+//
+// A turn cancelled through ctx is interrupted with interrupt, if non-nil,
+// and drained in the background up to its ResultMessage, so that its
+// messages do not leak into the next turn. track, if non-nil, observes each
+// message of the turn, drained ones included; done is called once the whole
+// turn has been read.
+func streamTurn(ctx context.Context, bufferSize int, src <-chan Message, srcErr <-chan error, track func(Message), interrupt func(), done func()) (<-chan Message, <-chan error) {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	msgChan := make(chan Message, bufferSize)
+	// One slot is kept free for the error that ends the turn
+	errChan := make(chan error, bufferSize+1)
+
+	go func() {
+		var (
+			next    Message // read from src, not yet forwarded
+			pending []error // stream errors not yet forwarded
+			last    error   // the latest stream error
+		)
+
+		// finish reports the error that ends the turn, if any, and closes the channels
+		finish := func(err error) {
+			close(msgChan)
+			for _, e := range pending {
+				if len(errChan) >= cap(errChan)-1 {
+					break
+				}
+				errChan <- e
+			}
+			if err != nil {
+				errChan <- err
+			}
+			close(errChan)
+		}
+
+		for {
+			var (
+				in     <-chan Message
+				out    chan<- Message
+				errOut chan<- error
+				first  error
+			)
+			if next == nil {
+				in = src
+			} else {
+				out = msgChan
+			}
+			if len(pending) > 0 && len(errChan) < cap(errChan)-1 {
+				errOut, first = errChan, pending[0]
+			}
+
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					err := fmt.Errorf("stream ended before result")
+					if last != nil {
+						err = fmt.Errorf("stream ended before result: %w", last)
+					}
+					finish(err)
+					done()
+					return
+				}
+				if track != nil {
+					track(msg)
+				}
+				next = msg
+			case out <- next:
+				if _, isResult := next.(*ResultMessage); isResult {
+					finish(nil)
+					done()
+					return
+				}
+				next = nil
+			case errOut <- first:
+				pending = pending[1:]
+			case err, ok := <-srcErr:
+				if !ok {
+					srcErr = nil
+					continue
+				}
+				pending = append(pending, err)
+				last = err
+			case <-ctx.Done():
+				finish(ctx.Err())
+				if _, isResult := next.(*ResultMessage); !isResult {
+					// The interrupt runs alongside the drain, which keeps the
+					// stream moving while the CLI answers it
+					if interrupt != nil {
+						go interrupt()
+					}
+					drainTurn(src, srcErr, track)
+				}
+				done()
+				return
+			}
+		}
+	}()
+
+	return msgChan, errChan
+}
+
+// drainTurn discards the rest of an abandoned turn, up to and including its
+// ResultMessage or the end of the stream.
+func drainTurn(src <-chan Message, srcErr <-chan error, track func(Message)) {
+	for {
+		select {
+		case msg, ok := <-src:
+			if !ok {
+				return
+			}
+			if track != nil {
+				track(msg)
+			}
+			if _, isResult := msg.(*ResultMessage); isResult {
+				return
+			}
+		case _, ok := <-srcErr:
+			if !ok {
+				srcErr = nil
+			}
+		}
+	}
+}
+
+// collectTurn drains a turn stream into a Turn.
+func collectTurn(ctx context.Context, msgChan <-chan Message, errChan <-chan error) (*Turn, error) {
+	turn := &Turn{}
+	for msgChan != nil || errChan != nil {
+		select {
+		case msg, ok := <-msgChan:
+			if !ok {
+				msgChan = nil
+				continue
+			}
+			turn.add(msg)
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			turn.Errors = append(turn.Errors, err)
+		case <-ctx.Done():
+			return turn, ctx.Err()
+		}
+	}
+
+	if turn.Result == nil {
+		// The last error is the one that ended the turn
+		if n := len(turn.Errors); n > 0 {
+			err := turn.Errors[n-1]
+			turn.Errors = turn.Errors[:n-1]
+			return turn, err
+		}
+		return turn, fmt.Errorf("stream ended before result")
+	}
+	return turn, nil
+}
@@ -0,0 +1,330 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func turnResult(sessionID string, cost float64) *ResultMessage {
+	return &ResultMessage{
+		MessageType:  shared.MessageTypeResult,
+		Subtype:      "success",
+		SessionID:    sessionID,
+		TotalCostUSD: &cost,
+		Usage:        &map[string]any{"input_tokens": 10.0, "output_tokens": 5.0},
+	}
+}
+
+// TestTurnPairsToolCalls tests that tool uses are paired with their results.
+func TestTurnPairsToolCalls(t *testing.T) {
+	t.Parallel()
+
+	turn := &Turn{}
+	turn.add(&AssistantMessage{Content: []ContentBlock{
+		&TextBlock{Text: "Reading. "},
+		&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read"},
+		&ToolUseBlock{ToolUseID: "toolu_2", Name: "Grep"},
+	}})
+	turn.add(&UserMessage{Content: []ContentBlock{
+		&ToolResultBlock{ToolUseID: "toolu_2", Content: "match"},
+	}})
+	turn.add(&UserMessage{Content: []ContentBlock{
+		&ToolResultBlock{ToolUseID: "toolu_1", Content: "file"},
+	}})
+	turn.add(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Done."}}})
+	turn.add(turnResult("sess-1", 0.25))
+
+	require.Len(t, turn.ToolCalls, 2)
+	assert.Equal(t, "Read", turn.ToolCalls[0].Use.Name)
+	assert.Equal(t, "file", turn.ToolCalls[0].Result.Content)
+	assert.Equal(t, "Grep", turn.ToolCalls[1].Use.Name)
+	assert.Equal(t, "match", turn.ToolCalls[1].Result.Content)
+
+	assert.Len(t, turn.Messages, 5)
+	assert.Len(t, turn.Assistant, 2)
+	assert.Equal(t, "Reading. Done.", turn.Text())
+	assert.Equal(t, "sess-1", turn.SessionID())
+	assert.Equal(t, 0.25, turn.CostUSD)
+	assert.Equal(t, 10.0, turn.Usage["input_tokens"])
+	assert.False(t, turn.IsError())
+}
+
+// TestTurnUnansweredToolCall tests that a tool use without a result keeps a nil Result.
+func TestTurnUnansweredToolCall(t *testing.T) {
+	t.Parallel()
+
+	turn := &Turn{}
+	turn.add(&AssistantMessage{Content: []ContentBlock{&ToolUseBlock{ToolUseID: "toolu_1", Name: "Bash"}}})
+	turn.add(&UserMessage{Content: "plain text"})
+
+	require.Len(t, turn.ToolCalls, 1)
+	assert.Nil(t, turn.ToolCalls[0].Result)
+}
+
+// TestStreamTurnStopsAtResult tests that a turn ends after its ResultMessage.
+func TestStreamTurnStopsAtResult(t *testing.T) {
+	t.Parallel()
+
+	src := make(chan Message, 4)
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "first"}}}
+	src <- turnResult("sess-1", 0.1)
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "next turn"}}}
+
+	var tracked []Message
+	done := make(chan struct{})
+	msgChan, errChan := streamTurn(context.Background(), 10, src, nil,
+		func(msg Message) { tracked = append(tracked, msg) }, nil,
+		func() { close(done) })
+
+	turn, err := collectTurn(context.Background(), msgChan, errChan)
+	require.NoError(t, err)
+	<-done
+
+	assert.Equal(t, "first", turn.Text())
+	assert.Len(t, tracked, 2)
+	assert.Len(t, src, 1, "the next turn's message must stay on the stream")
+}
+
+// TestStreamTurnPrematureEnd tests that a stream closing before the result is an error.
+func TestStreamTurnPrematureEnd(t *testing.T) {
+	t.Parallel()
+
+	src := make(chan Message, 1)
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "partial"}}}
+	close(src)
+
+	msgChan, errChan := streamTurn(context.Background(), 10, src, nil, nil, nil, func() {})
+	turn, err := collectTurn(context.Background(), msgChan, errChan)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream ended before result")
+	assert.Nil(t, turn.Result)
+}
+
+// TestStreamTurnTransportError tests that a stream ending after a transport
+// error reports the error.
+func TestStreamTurnTransportError(t *testing.T) {
+	t.Parallel()
+
+	srcErr := make(chan error, 1)
+	srcErr <- errors.New("broken pipe")
+	src := make(chan Message)
+
+	msgChan, errChan := streamTurn(context.Background(), 10, src, srcErr, nil, nil, func() {})
+	// The error alone does not end the turn
+	assert.EqualError(t, <-errChan, "broken pipe")
+	close(src)
+	_, err := collectTurn(context.Background(), msgChan, errChan)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream ended before result")
+	assert.Contains(t, err.Error(), "broken pipe")
+}
+
+// TestStreamTurnNonFatalError tests that stream errors before the result are
+// recorded on the turn without ending it.
+func TestStreamTurnNonFatalError(t *testing.T) {
+	t.Parallel()
+
+	src := make(chan Message, 2)
+	srcErr := make(chan error, 1)
+	srcErr <- errors.New("CLI stderr: warming up")
+	msgChan, errChan := streamTurn(context.Background(), 10, src, srcErr, nil, nil, func() {})
+	// Let the error be read first so the result cannot overtake it
+	require.Eventually(t, func() bool { return len(srcErr) == 0 }, time.Second, time.Millisecond)
+
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "still here"}}}
+	src <- turnResult("sess-1", 0.1)
+	turn, err := collectTurn(context.Background(), msgChan, errChan)
+
+	require.NoError(t, err)
+	assert.Equal(t, "still here", turn.Text())
+	require.NotNil(t, turn.Result)
+	assert.Len(t, turn.Errors, 1)
+}
+
+// TestStreamTurnContextCancel tests that cancellation ends a pending turn.
+func TestStreamTurnContextCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	msgChan, errChan := streamTurn(ctx, 10, make(chan Message), nil, nil, nil, func() {})
+	_, err := collectTurn(context.Background(), msgChan, errChan)
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestStreamTurnDrainsCancelledTurn tests that a cancelled turn is read up to
+// its result before the next turn may start.
+func TestStreamTurnDrainsCancelledTurn(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src := make(chan Message, 4)
+	done := make(chan struct{})
+	msgChan, errChan := streamTurn(ctx, 10, src, nil, nil, nil, func() { close(done) })
+
+	cancel()
+	_, err := collectTurn(context.Background(), msgChan, errChan)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case <-done:
+		t.Fatal("turn released before its result")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "late"}}}
+	src <- turnResult("sess-1", 0.1)
+	src <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "next turn"}}}
+	<-done
+	assert.Len(t, src, 1, "the next turn's message must stay on the stream")
+}
+
+// TestSendNotConnected tests that Send requires a connected client.
+func TestSendNotConnected(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient()
+	require.NoError(t, err)
+
+	_, err = client.Send(context.Background(), "hello")
+	assert.EqualError(t, err, "not connected")
+
+	// The turn lock must be released after a failed send
+	_, err = client.Send(context.Background(), "again")
+	assert.EqualError(t, err, "not connected")
+}
+
+// stderrCLI is a FuncLauncher that writes a line to stderr and then answers
+// each user message with "answer N".
+func stderrCLI(_ context.Context, _ subprocess.LaunchSpec, stdin io.Reader, stdout, stderr io.Writer) int {
+	scanner := bufio.NewScanner(stdin)
+	n := 0
+	for scanner.Scan() {
+		var msg map[string]any
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		switch msg["type"] {
+		case subprocess.MessageTypeControlRequest:
+			fmt.Fprintf(stdout, `{"type":"control_response","response":{"subtype":"success","request_id":%q,"response":{}}}`+"\n", msg["request_id"])
+		case shared.MessageTypeUser:
+			n++
+			fmt.Fprintf(stderr, "working on turn %d\n", n)
+			fmt.Fprintf(stdout, `{"type":"assistant","message":{"content":[{"type":"text","text":"answer %d"}]}}`+"\n", n)
+			fmt.Fprintf(stdout, `{"type":"result","subtype":"success","session_id":"s1"}`+"\n")
+		}
+	}
+	return 0
+}
+
+// TestSendSurvivesCLIStderr tests that CLI stderr output, reported as stream
+// errors without a StderrCallback, neither fails a turn nor shifts later
+// turns.
+func TestSendSurvivesCLIStderr(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(WithCLIPath("claude"), WithLauncher(subprocess.FuncLauncher(stderrCLI)))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Disconnect()
+
+	for n := 1; n <= 3; n++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		turn, err := client.Send(ctx, "next")
+		cancel()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("answer %d", n), turn.Text())
+	}
+}
+
+// hangingCLI is a FuncLauncher that never ends its first turn on its own. With
+// interruptible set, an interrupt ends the turn with an error result; later
+// turns are answered with "answer N".
+func hangingCLI(interruptible bool) subprocess.FuncLauncher {
+	return func(_ context.Context, _ subprocess.LaunchSpec, stdin io.Reader, stdout, _ io.Writer) int {
+		scanner := bufio.NewScanner(stdin)
+		n := 0
+		for scanner.Scan() {
+			var msg map[string]any
+			if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+				continue
+			}
+			switch msg["type"] {
+			case subprocess.MessageTypeControlRequest:
+				fmt.Fprintf(stdout, `{"type":"control_response","response":{"subtype":"success","request_id":%q,"response":{}}}`+"\n", msg["request_id"])
+				request, _ := msg["request"].(map[string]any)
+				if interruptible && request["subtype"] == subprocess.SubtypeInterrupt {
+					fmt.Fprintln(stdout, `{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}`)
+				}
+			case shared.MessageTypeUser:
+				n++
+				if n > 1 {
+					fmt.Fprintf(stdout, `{"type":"assistant","message":{"content":[{"type":"text","text":"answer %d"}]}}`+"\n", n)
+					fmt.Fprintln(stdout, `{"type":"result","subtype":"success","session_id":"s1"}`)
+				}
+			}
+		}
+		return 0
+	}
+}
+
+// TestSendInterruptsCancelledTurn tests that a cancelled turn is interrupted
+// so that the next turn can run.
+func TestSendInterruptsCancelledTurn(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(WithCLIPath("claude"), WithLauncher(hangingCLI(true)), WithCanUseTool(
+		func(context.Context, string, map[string]any, CanUseToolOptions) (PermissionResult, error) {
+			return NewPermissionResultAllow(), nil
+		}))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = client.Send(ctx, "hang")
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	turn, err := client.Send(ctx, "next")
+	require.NoError(t, err)
+	assert.Equal(t, "answer 2", turn.Text())
+}
+
+// TestSendHonorsContextBehindHungTurn tests that a turn waiting behind one
+// the CLI never ends gives up when its context is done.
+func TestSendHonorsContextBehindHungTurn(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(WithCLIPath("claude"), WithLauncher(hangingCLI(false)))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = client.Send(ctx, "hang")
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.Send(ctx, "next")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
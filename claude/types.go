@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/dotcommander/agent-sdk-go/claude/parser"
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 )
 
@@ -69,6 +70,46 @@ type ClientOptions struct {
 	// Provides complete control over plugin behavior including
 	// timeouts, concurrency limits, and custom configuration.
 	SdkPluginConfig *shared.SdkPluginConfig
+
+	// Cwd is the working directory for the CLI subprocess.
+	// If empty, inherits the parent process working directory.
+	Cwd string
+
+	// EnvPolicy controls which variables of the SDK process's environment
+	// the CLI inherits. The zero value inherits them all.
+	EnvPolicy shared.EnvPolicy
+
+	// RetryPolicy controls retries of CLI launches and of queries that fail
+	// with rate-limit or overloaded errors. Nil uses shared.DefaultRetryPolicy.
+	RetryPolicy *shared.RetryPolicy
+
+	// CircuitBreaker guards every CLI launch of the client. Share one
+	// breaker between clients to fail fast when the CLI is broken.
+	CircuitBreaker *shared.Breaker
+
+	// Recovery enables automatic respawn of a crashed interactive session.
+	// Nil disables recovery.
+	Recovery *shared.RecoveryOptions
+
+	// Shutdown sets the grace periods used when the CLI process is stopped.
+	Shutdown shared.ShutdownOptions
+
+	// Deadlines bounds idle time, turn time and session lifetime.
+	Deadlines shared.DeadlineOptions
+
+	// ResourceLimits bounds the resources of the CLI process tree (Linux only).
+	ResourceLimits *shared.ResourceLimits
+
+	// Launcher starts the CLI processes. Nil runs the CLI directly.
+	Launcher subprocess.Launcher
+
+	// ControlDispatch sets how many control requests from the CLI are
+	// handled concurrently in interactive sessions.
+	ControlDispatch shared.ControlDispatchOptions
+
+	// ControlHandlers handles control request subtypes the SDK does not
+	// handle itself in interactive sessions.
+	ControlHandlers *subprocess.ControlHandlerRegistry
 }
 
 // BasicTransport provides core transport functionality.
@@ -131,6 +172,19 @@ type Querier interface {
 	QueryStream(ctx context.Context, prompt string) (<-chan Message, <-chan error)
 }
 
+// Sender handles turn-oriented prompts on the connected interactive transport.
+// Each prompt is delivered to the same CLI process, so conversation context
+// carries over between turns.
+type Sender interface {
+	// Send sends a prompt and waits for the turn to complete.
+	Send(ctx context.Context, prompt string) (*Turn, error)
+
+	// SendStream sends a prompt and streams the messages of the turn.
+	// Both channels are closed after the ResultMessage has been delivered;
+	// errors reported before it do not end the turn.
+	SendStream(ctx context.Context, prompt string) (<-chan Message, <-chan error)
+}
+
 // Receiver handles message reception.
 type Receiver interface {
 	// ReceiveMessages receives messages from Claude CLI.
@@ -167,6 +221,13 @@ type StreamInspector interface {
 
 	// IsProtocolActive returns whether the control protocol is active.
 	IsProtocolActive() bool
+
+	// ControlStats reports the queue depth and handler latency of control
+	// requests from the CLI, such as permission checks.
+	ControlStats() subprocess.ControlStats
+
+	// Capabilities reports what the connected CLI supports.
+	Capabilities() (Capabilities, error)
 }
 
 // ProtocolClient provides runtime mutation and query operations over the
@@ -220,6 +281,7 @@ type ContextManager interface {
 type Client interface {
 	Connector
 	Querier
+	Sender
 	Receiver
 	Controller
 	ContextManager
@@ -255,6 +317,9 @@ type ToolUseBlock = shared.ToolUseBlock
 // ToolResultBlock represents the result of a tool use.
 type ToolResultBlock = shared.ToolResultBlock
 
+// RawBlock holds a content block of a type the SDK does not model, such as an image block.
+type RawBlock = shared.RawBlock
+
 // StreamEvent represents a partial message update during streaming.
 type StreamEvent = shared.StreamEvent
 
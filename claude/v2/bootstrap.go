@@ -11,7 +11,8 @@ import (
 
 // buildClient performs the common bootstrap sequence shared by session and prompt creation:
 // CLI availability check, factory resolution, and client construction.
-func buildClient(model string, timeout time.Duration, cliChecker shared.CLIChecker, factory ClientFactory) (claude.Client, error) {
+// Every BaseOptions field is translated into client options; extra options are applied last.
+func buildClient(base *shared.BaseOptions, timeout time.Duration, cliChecker shared.CLIChecker, factory ClientFactory, extra ...claude.ClientOption) (claude.Client, error) {
 	if cliChecker == nil {
 		cliChecker = shared.CLICheckerFunc(cli.IsCLIAvailable)
 	}
@@ -23,13 +24,180 @@ func buildClient(model string, timeout time.Duration, cliChecker shared.CLICheck
 		factory = DefaultClientFactory()
 	}
 
-	client, err := factory.NewClient(
-		claude.WithModel(model),
-		claude.WithTimeout(timeout.String()),
-	)
+	clientOpts := append([]claude.ClientOption{claude.WithTimeout(timeout.String())}, clientOptionsFromBase(base)...)
+	clientOpts = append(clientOpts, extra...)
+
+	client, err := factory.NewClient(clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("create client: %w", err)
 	}
 
 	return client, nil
 }
+
+// clientOptionsFromBase translates shared.BaseOptions into claude.ClientOptions.
+// Fields left at their zero value produce no option, so client defaults apply.
+func clientOptionsFromBase(base *shared.BaseOptions) []claude.ClientOption {
+	opts := []claude.ClientOption{claude.WithModel(base.Model)}
+
+	// Prompt
+	if base.SystemPrompt != "" {
+		opts = append(opts, claude.WithSystemPrompt(base.SystemPrompt))
+	}
+	if base.AppendSystemPrompt != "" {
+		opts = append(opts, claude.WithAppendSystemPrompt(base.AppendSystemPrompt))
+	}
+
+	// Tools and permissions
+	if len(base.AllowedTools) > 0 {
+		opts = append(opts, claude.WithAllowedTools(base.AllowedTools...))
+	}
+	if len(base.DisallowedTools) > 0 {
+		opts = append(opts, claude.WithDisallowedTools(base.DisallowedTools...))
+	}
+	if base.Tools != nil {
+		switch base.Tools.Type {
+		case "preset":
+			opts = append(opts, claude.WithToolsPreset(base.Tools.Preset))
+		case "explicit":
+			opts = append(opts, claude.WithAllowedTools(base.Tools.Tools...))
+		}
+	}
+	if base.PermissionMode != "" {
+		opts = append(opts, claude.WithPermissionMode(base.PermissionMode))
+	}
+	if base.AllowDangerouslySkipPermissions {
+		opts = append(opts, claude.WithAllowDangerouslySkipPermissions())
+	}
+	if base.PermissionPromptToolName != "" {
+		opts = append(opts, claude.WithPermissionPromptToolName(base.PermissionPromptToolName))
+	}
+	if base.CanUseTool != nil {
+		opts = append(opts, claude.WithCanUseTool(base.CanUseTool))
+	}
+
+	// Session continuity
+	if base.Continue {
+		opts = append(opts, claude.WithContinue())
+	}
+	if base.Resume != "" {
+		if base.ForkSession {
+			opts = append(opts, claude.WithForkSession(base.Resume))
+		} else {
+			opts = append(opts, claude.WithResume(base.Resume))
+		}
+	}
+	if base.ResumeSessionAt != "" {
+		opts = append(opts, claude.WithResumeSessionAt(base.ResumeSessionAt))
+	}
+	if base.PersistSession != nil {
+		opts = append(opts, claude.WithPersistSession(*base.PersistSession))
+	}
+
+	// Limits
+	if base.MaxThinkingTokens != nil {
+		opts = append(opts, claude.WithMaxThinkingTokens(*base.MaxThinkingTokens))
+	}
+	if base.MaxTurns != nil {
+		opts = append(opts, claude.WithMaxTurns(*base.MaxTurns))
+	}
+	if base.MaxBudgetUSD != nil {
+		opts = append(opts, claude.WithMaxBudgetUSD(*base.MaxBudgetUSD))
+	}
+	if base.FallbackModel != "" {
+		opts = append(opts, claude.WithFallbackModel(base.FallbackModel))
+	}
+
+	// Environment
+	if len(base.ContextFiles) > 0 {
+		opts = append(opts, claude.WithContextFiles(base.ContextFiles...))
+	}
+	if len(base.Env) > 0 {
+		opts = append(opts, claude.WithEnv(base.Env))
+	}
+	if base.Cwd != "" {
+		opts = append(opts, claude.WithProcessCwd(base.Cwd))
+	}
+	if len(base.AdditionalDirectories) > 0 {
+		opts = append(opts, claude.WithAdditionalDirectories(base.AdditionalDirectories...))
+	}
+
+	// Agents and features
+	if base.Agent != "" {
+		opts = append(opts, claude.WithAgent(base.Agent))
+	}
+	if len(base.Agents) > 0 {
+		opts = append(opts, claude.WithAgents(base.Agents))
+	}
+	if len(base.Betas) > 0 {
+		opts = append(opts, claude.WithBetas(base.Betas...))
+	}
+	if base.EnableFileCheckpointing {
+		opts = append(opts, claude.WithFileCheckpointing())
+	}
+	if base.OutputFormat != nil {
+		opts = append(opts, claude.WithOutputFormat(base.OutputFormat))
+	}
+	if len(base.Plugins) > 0 {
+		opts = append(opts, claude.WithPlugins(base.Plugins...))
+	}
+	if base.SdkPluginConfig != nil {
+		opts = append(opts, claude.WithPluginConfig(base.SdkPluginConfig))
+	}
+	if len(base.SettingSources) > 0 {
+		opts = append(opts, claude.WithSettingSources(base.SettingSources...))
+	}
+	if base.Sandbox != nil {
+		opts = append(opts, claude.WithSandboxSettings(base.Sandbox))
+	}
+
+	// MCP
+	if len(base.McpServers) > 0 {
+		opts = append(opts, claude.WithMcpServers(base.McpServers))
+	}
+	if base.StrictMcpConfig {
+		opts = append(opts, claude.WithStrictMcpConfig())
+	}
+
+	// Output handling
+	if base.Stderr != nil {
+		opts = append(opts, claude.WithStderrCallback(base.Stderr))
+	}
+	if base.DebugWriter != nil {
+		opts = append(opts, claude.WithDebugWriter(base.DebugWriter))
+	}
+
+	// Raw arguments go last so they can extend anything above
+	if len(base.CustomArgs) > 0 {
+		opts = append(opts, claude.WithCustomArgs(base.CustomArgs...))
+	}
+	if len(base.ExtraArgs) > 0 {
+		opts = append(opts, claude.WithExtraArgs(base.ExtraArgs))
+	}
+
+	return opts
+}
+
+// sessionClientOptions translates the session-only fields of V2SessionOptions.
+func sessionClientOptions(options *V2SessionOptions) []claude.ClientOption {
+	opts := hookClientOptions(options.Hooks)
+	if options.EnablePartialMessages {
+		opts = append(opts, claude.WithIncludePartialMessages(true))
+	}
+
+	return opts
+}
+
+// promptClientOptions translates the prompt-only fields of PromptOptions.
+func promptClientOptions(options *PromptOptions) []claude.ClientOption {
+	return hookClientOptions(options.Hooks)
+}
+
+// hookClientOptions registers each hook with the client.
+func hookClientOptions(hooks []shared.HookConfig) []claude.ClientOption {
+	var opts []claude.ClientOption
+	for _, hook := range hooks {
+		opts = append(opts, claude.WithHook(hook.Event, hook))
+	}
+	return opts
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/dotcommander/agent-sdk-go/claude"
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,6 +43,18 @@ func (m *MockClient) QueryStream(ctx context.Context, prompt string) (<-chan cla
 	return msgChan, errChan
 }
 
+func (m *MockClient) Send(ctx context.Context, prompt string) (*claude.Turn, error) {
+	return &claude.Turn{}, nil
+}
+
+func (m *MockClient) SendStream(ctx context.Context, prompt string) (<-chan claude.Message, <-chan error) {
+	msgChan := make(chan claude.Message)
+	errChan := make(chan error)
+	close(msgChan)
+	close(errChan)
+	return msgChan, errChan
+}
+
 func (m *MockClient) ReceiveMessages(ctx context.Context) (<-chan claude.Message, <-chan error) {
 	msgChan := make(chan claude.Message)
 	errChan := make(chan error)
@@ -119,6 +132,14 @@ func (m *MockClient) IsProtocolActive() bool {
 	return false
 }
 
+func (m *MockClient) ControlStats() subprocess.ControlStats {
+	return subprocess.ControlStats{}
+}
+
+func (m *MockClient) Capabilities() (claude.Capabilities, error) {
+	return claude.Capabilities{}, nil
+}
+
 func (m *MockClient) AddContextFiles(ctx context.Context, files []string) error {
 	return nil
 }
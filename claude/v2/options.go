@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"slices"
 	"time"
 
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
@@ -38,6 +37,9 @@ type PromptOptions struct {
 	// Timeout specifies how long to wait for the response.
 	Timeout time.Duration
 
+	// Hooks contains registered hook handlers for the prompt's events.
+	Hooks []shared.HookConfig
+
 	// clientFactory provides a factory for creating clients (DIP compliance).
 	// If nil, the default factory is used.
 	clientFactory ClientFactory
@@ -68,6 +70,10 @@ func (o *PromptOptions) Validate() error {
 		return fmt.Errorf("timeout must be positive")
 	}
 
+	if _, err := shared.CLIPermissionMode(o.PermissionMode); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -155,7 +161,8 @@ func WithPromptPermissionMode(mode string) PromptOption {
 	return p
 }
 
-// WithContextFiles adds files to the session context.
+// WithContextFiles adds files to the session context. The CLI is granted
+// each file's directory with --add-dir; the files are not preloaded.
 func WithContextFiles(files ...string) SessionOption {
 	s, _ := sessionAndPromptOption(shared.WithBaseContextFiles(files...))
 	return s
@@ -269,12 +276,8 @@ func (o *V2SessionOptions) Validate() error {
 		return fmt.Errorf("timeout must be positive")
 	}
 
-	// Validate permission mode if specified
-	if o.PermissionMode != "" {
-		validModes := []string{"default", "auto", "grant", "accept_edits", "plan", "bypass_permissions"}
-		if !slices.Contains(validModes, o.PermissionMode) {
-			return fmt.Errorf("invalid permission mode: %s", o.PermissionMode)
-		}
+	if _, err := shared.CLIPermissionMode(o.PermissionMode); err != nil {
+		return err
 	}
 
 	return nil
@@ -534,6 +537,13 @@ func WithHooks(hooks ...shared.HookConfig) SessionOption {
 	}
 }
 
+// WithPromptHooks registers hook handlers for a one-shot prompt.
+func WithPromptHooks(hooks ...shared.HookConfig) PromptOption {
+	return func(opts *PromptOptions) {
+		opts.Hooks = append(opts.Hooks, hooks...)
+	}
+}
+
 // WithCwd sets the working directory for the Claude CLI subprocess.
 // File operations will resolve relative to this directory.
 //
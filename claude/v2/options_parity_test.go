@@ -1,11 +1,22 @@
 package v2
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dotcommander/agent-sdk-go/claude"
+	"github.com/dotcommander/agent-sdk-go/claude/subprocess"
 	"github.com/dotcommander/agent-sdk-go/internal/shared"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestWithCwd tests the working directory option.
@@ -255,3 +266,296 @@ func TestOptionsChaining(t *testing.T) {
 	assert.NotNil(t, opts.Stderr)
 	assert.Equal(t, "claude-sonnet-4-20250514", opts.Model)
 }
+
+// TestUnknownPermissionModeIsRejected verifies that a typo'd permission mode
+// fails validation instead of falling back to the CLI default.
+func TestUnknownPermissionModeIsRejected(t *testing.T) {
+	_, err := CreateSession(context.Background(),
+		WithPermissionMode("acceptedits"),
+		WithCLIChecker(shared.AlwaysAvailableCLIChecker{}))
+	assert.True(t, shared.IsConfigurationError(err), "session: %v", err)
+
+	_, err = Prompt(context.Background(), "hi",
+		WithPromptPermissionMode("acceptedits"),
+		WithPromptCLIChecker(shared.AlwaysAvailableCLIChecker{}))
+	assert.True(t, shared.IsConfigurationError(err), "prompt: %v", err)
+}
+
+// captureClientOptions creates a session with the given options and returns
+// the ClientOptions the factory received.
+func captureClientOptions(t *testing.T, opts ...SessionOption) *claude.ClientOptions {
+	t.Helper()
+
+	var got *claude.ClientOptions
+	factory := ClientFactoryFunc(func(clientOpts ...claude.ClientOption) (claude.Client, error) {
+		got = claude.DefaultClientOptions()
+		for _, opt := range clientOpts {
+			opt(got)
+		}
+		require.NoError(t, got.Validate())
+		return &MockClient{}, nil
+	})
+
+	opts = append(opts, WithCLIChecker(shared.AlwaysAvailableCLIChecker{}), WithClientFactory(factory))
+	session, err := CreateSession(context.Background(), opts...)
+	require.NoError(t, err)
+	require.NoError(t, session.Close())
+	require.NotNil(t, got)
+
+	return got
+}
+
+// argsCLI is a fake CLI that records the arguments of its launch and the
+// SDK's control requests, answers the requests and ends each turn with a
+// result.
+type argsCLI struct {
+	mu       sync.Mutex
+	args     []string
+	requests []map[string]any
+}
+
+// factory returns a factory of real clients that launch the fake CLI.
+func (c *argsCLI) factory() ClientFactory {
+	launcher := subprocess.FuncLauncher(c.run)
+	return ClientFactoryFunc(func(clientOpts ...claude.ClientOption) (claude.Client, error) {
+		return claude.NewClient(append(clientOpts, claude.WithCLIPath("claude"), claude.WithLauncher(launcher))...)
+	})
+}
+
+func (c *argsCLI) run(_ context.Context, spec subprocess.LaunchSpec, stdin io.Reader, stdout, _ io.Writer) int {
+	c.mu.Lock()
+	c.args = spec.Args
+	c.mu.Unlock()
+
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		var msg map[string]any
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		switch msg["type"] {
+		case subprocess.MessageTypeControlRequest:
+			request, _ := msg["request"].(map[string]any)
+			c.mu.Lock()
+			c.requests = append(c.requests, request)
+			c.mu.Unlock()
+			fmt.Fprintf(stdout, `{"type":"control_response","response":{"subtype":"success","request_id":%q,"response":{}}}`+"\n", msg["request_id"])
+		case shared.MessageTypeUser:
+			fmt.Fprintln(stdout, `{"type":"result","subtype":"success","result":"ok","session_id":"s1"}`)
+		}
+	}
+	return 0
+}
+
+// launched returns the CLI arguments of the last launch.
+func (c *argsCLI) launched(t *testing.T) []string {
+	t.Helper()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.NotNil(t, c.args, "the CLI was not launched")
+	return c.args
+}
+
+// initialize returns the payload of the SDK's initialize request, or nil.
+func (c *argsCLI) initialize() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, request := range c.requests {
+		if request["subtype"] == subprocess.SubtypeInitialize {
+			return request
+		}
+	}
+	return nil
+}
+
+// launchArgs creates a session with the given options on a real client and
+// returns the CLI arguments of its launch.
+func launchArgs(t *testing.T, opts ...SessionOption) []string {
+	t.Helper()
+
+	cli := &argsCLI{}
+	opts = append(opts, WithCLIChecker(shared.AlwaysAvailableCLIChecker{}), WithClientFactory(cli.factory()))
+	session, err := CreateSession(context.Background(), opts...)
+	require.NoError(t, err)
+	require.NoError(t, session.Close())
+	return cli.launched(t)
+}
+
+// containsSequence reports whether want appears as a contiguous run in args.
+func containsSequence(args, want []string) bool {
+	for i := 0; i+len(want) <= len(args); i++ {
+		if slices.Equal(args[i:i+len(want)], want) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestSessionOptionsReachCLIArgs verifies each V2 option is translated into CLI arguments.
+func TestSessionOptionsReachCLIArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opt  SessionOption
+		want []string
+	}{
+		{"model", WithModel("claude-opus-4-20250514"), []string{"--model", "claude-opus-4-20250514"}},
+		{"system prompt", WithSystemPrompt("Be terse"), []string{"--system-prompt", "Be terse"}},
+		{"append system prompt", WithAppendSystemPrompt("Use Go"), []string{"--append-system-prompt", "Use Go"}},
+		{"allowed tools", WithAllowedTools("Read", "Grep"), []string{"--allowed-tools", "Read,Grep"}},
+		{"disallowed tools", WithDisallowedTools("Bash"), []string{"--disallowed-tools", "Bash"}},
+		{"tools preset", WithTools(shared.ToolsPreset("claude_code")), []string{"--tools", "preset:claude_code"}},
+		{"tools explicit", WithTools(shared.ToolsExplicit("Read", "Write")), []string{"--allowed-tools", "Read,Write"}},
+		{"permission mode plan", WithPermissionMode("plan"), []string{"--permission-mode", "plan"}},
+		{"permission mode accept edits", WithPermissionMode("accept_edits"), []string{"--permission-mode", "acceptEdits"}},
+		{"permission mode bypass", WithPermissionMode("bypass_permissions"), []string{"--permission-mode", "bypassPermissions"}},
+		{"skip permissions", WithAllowDangerouslySkipPermissions(true), []string{"--allow-dangerously-skip-permissions"}},
+		{"permission prompt tool", WithPermissionPromptToolName("mcp__auth__ok"), []string{"--permission-prompt-tool", "mcp__auth__ok"}},
+		{"can use tool", WithCanUseTool(func(context.Context, string, map[string]any, shared.CanUseToolOptions) (shared.PermissionResult, error) {
+			return shared.PermissionResult{Behavior: shared.PermissionBehaviorAllow}, nil
+		}), []string{"--permission-prompt-tool", "stdio"}},
+		{"continue", WithContinue(true), []string{"--continue"}},
+		{"resume", WithResume("sess-1"), []string{"--resume", "sess-1"}},
+		{"resume at", WithResumeSessionAt("msg-1"), []string{"--resume-session-at", "msg-1"}},
+		{"no persist", WithPersistSession(false), []string{"--no-session-persistence"}},
+		{"max thinking tokens", WithMaxThinkingTokens(2048), []string{"--max-thinking-tokens", "2048"}},
+		{"max turns", WithMaxTurns(3), []string{"--max-turns", "3"}},
+		{"max budget", WithMaxBudgetUSD(1.5), []string{"--max-budget-usd", "1.50"}},
+		{"fallback model", WithFallbackModel("claude-haiku-4-5"), []string{"--fallback-model", "claude-haiku-4-5"}},
+		{"additional directories", WithAdditionalDirectories("/data"), []string{"--add-dir", "/data"}},
+		{"agent", WithAgent("reviewer"), []string{"--agent", "reviewer"}},
+		{"betas", WithBetas("context-1m-2025-08-07"), []string{"--beta", "context-1m-2025-08-07"}},
+		{"file checkpointing", WithEnableFileCheckpointing(true), []string{"--enable-file-checkpointing"}},
+		{"plugins", WithPlugins(shared.PluginConfig{Type: "local", Path: "/plugins/x"}), []string{"--plugin-dir", "/plugins/x"}},
+		{"strict mcp", WithStrictMcpConfig(true), []string{"--strict-mcp-config"}},
+		{"mcp servers", WithMcpServers(map[string]shared.McpServerConfig{
+			"fs": &shared.McpStdioServerConfig{Command: "mcp-fs"},
+		}), []string{"--mcp-config"}},
+		{"agents", WithAgents(map[string]shared.AgentDefinition{"coder": {Description: "Writes code", Prompt: "Code"}}),
+			[]string{"--agents", `{"coder":{"description":"Writes code","prompt":"Code"}}`}},
+		{"sandbox", WithSandbox(&shared.SandboxSettings{Enabled: true}), []string{"--settings", `{"sandbox":{"enabled":true}}`}},
+		{"output format", WithOutputFormat(&shared.OutputFormat{Type: "json_schema", Schema: map[string]any{"type": "object"}}),
+			[]string{"--json-schema", `{"type":"object"}`}},
+		{"setting sources", WithSettingSources(shared.SettingSourceProject, shared.SettingSourceLocal), []string{"--setting-sources", "project,local"}},
+		{"partial messages", WithEnablePartialMessages(true), []string{"--include-partial-messages"}},
+		{"sdk plugin config", func(o *V2SessionOptions) {
+			o.SdkPluginConfig = &shared.SdkPluginConfig{Enabled: true, PluginPath: "/plugins/sdk"}
+		}, []string{"--plugin-dir", "/plugins/sdk"}},
+		{"custom args", WithCustomArgs("--verbose"), []string{"--verbose"}},
+		{"extra args", WithExtraArgs(map[string]string{"output-style": "concise"}), []string{"--output-style", "concise"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := launchArgs(t, tt.opt)
+			assert.True(t, containsSequence(args, tt.want), "args %v should contain %v", args, tt.want)
+		})
+	}
+}
+
+// TestResumeSessionForkReachesCLIArgs verifies fork-on-resume is forwarded.
+func TestResumeSessionForkReachesCLIArgs(t *testing.T) {
+	t.Parallel()
+
+	args := launchArgs(t, WithResume("sess-1"), WithForkSession(true))
+	assert.True(t, containsSequence(args, []string{"--resume", "sess-1", "--fork"}), "args: %v", args)
+}
+
+// TestSessionOptionsReachClientOptions verifies options carried as transport
+// settings rather than CLI arguments.
+func TestSessionOptionsReachClientOptions(t *testing.T) {
+	t.Parallel()
+
+	var debug bytes.Buffer
+	hook := shared.HookConfig{
+		Event: shared.HookEventPreToolUse,
+		Handler: func(ctx context.Context, input any) (*shared.SyncHookOutput, error) {
+			return &shared.SyncHookOutput{Continue: true}, nil
+		},
+	}
+	canUseTool := func(context.Context, string, map[string]any, shared.CanUseToolOptions) (shared.PermissionResult, error) {
+		return shared.PermissionResult{Behavior: shared.PermissionBehaviorAllow}, nil
+	}
+
+	got := captureClientOptions(t,
+		WithHooks(hook),
+		WithCanUseTool(canUseTool),
+		WithStderr(func(string) {}),
+		WithDebugWriter(&debug),
+		WithCwd("/project"),
+		WithEnv(map[string]string{"FOO": "bar"}),
+		WithTimeout(90*time.Second),
+	)
+
+	assert.Len(t, got.Hooks[shared.HookEventPreToolUse], 1)
+	assert.NotNil(t, got.CanUseTool)
+	assert.NotNil(t, got.StderrCallback)
+	assert.Equal(t, &debug, got.DebugWriter)
+	assert.Equal(t, "/project", got.Cwd)
+	assert.Equal(t, map[string]string{"FOO": "bar"}, got.Env)
+	assert.Equal(t, "1m30s", got.Timeout)
+}
+
+// TestPromptOptionsReachCLIArgs verifies prompt options share the same translation.
+func TestPromptOptionsReachCLIArgs(t *testing.T) {
+	t.Parallel()
+
+	canUseTool := func(context.Context, string, map[string]any, shared.CanUseToolOptions) (shared.PermissionResult, error) {
+		return shared.PermissionResult{Behavior: shared.PermissionBehaviorAllow}, nil
+	}
+
+	tests := []struct {
+		name string
+		opt  PromptOption
+		want []string
+	}{
+		{"system prompt", WithPromptSystemPrompt("Be terse"), []string{"--system-prompt", "Be terse"}},
+		{"max turns", WithPromptMaxTurns(2), []string{"--max-turns", "2"}},
+		{"mcp servers", WithPromptMcpServers(map[string]shared.McpServerConfig{
+			"fs": &shared.McpStdioServerConfig{Command: "mcp-fs"},
+		}), []string{"--mcp-config"}},
+		{"can use tool", WithPromptCanUseTool(canUseTool), []string{"--permission-prompt-tool", "stdio"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := &argsCLI{}
+			_, err := Prompt(context.Background(), "hi", tt.opt,
+				WithPromptCLIChecker(shared.AlwaysAvailableCLIChecker{}),
+				WithPromptClientFactory(cli.factory()))
+			require.NoError(t, err)
+
+			args := cli.launched(t)
+			assert.True(t, containsSequence(args, tt.want), "args %v should contain %v", args, tt.want)
+		})
+	}
+}
+
+// TestPromptHooksReachCLI verifies prompt hooks are registered with the CLI.
+func TestPromptHooksReachCLI(t *testing.T) {
+	t.Parallel()
+
+	hook := shared.HookConfig{
+		Event: shared.HookEventPreToolUse,
+		Handler: func(ctx context.Context, input any) (*shared.SyncHookOutput, error) {
+			return &shared.SyncHookOutput{Continue: true}, nil
+		},
+	}
+
+	cli := &argsCLI{}
+	_, err := Prompt(context.Background(), "hi", WithPromptHooks(hook),
+		WithPromptCLIChecker(shared.AlwaysAvailableCLIChecker{}),
+		WithPromptClientFactory(cli.factory()))
+	require.NoError(t, err)
+
+	initialize := cli.initialize()
+	require.NotNil(t, initialize, "hooks should be registered through initialize")
+	hooks, _ := initialize["hooks"].(map[string]any)
+	assert.Contains(t, hooks, string(shared.HookEventPreToolUse))
+}
@@ -35,7 +35,8 @@ func Prompt(ctx context.Context, prompt string, opts ...PromptOption) (*V2Result
 		return nil, fmt.Errorf("invalid options: %w", err)
 	}
 
-	client, err := buildClient(options.Model, options.Timeout, options.cliChecker, options.clientFactory)
+	client, err := buildClient(&options.BaseOptions, options.Timeout, options.cliChecker, options.clientFactory,
+		promptClientOptions(options)...)
 	if err != nil {
 		return nil, err
 	}
@@ -49,40 +50,23 @@ func Prompt(ctx context.Context, prompt string, opts ...PromptOption) (*V2Result
 	// Generate a session ID for this one-shot query
 	sessionID := fmt.Sprintf("prompt-%d", time.Now().UnixNano())
 
-	// Send the prompt
+	// Run the prompt as a turn of the connected session, so it gets the
+	// session's MCP servers, permission callback and hooks. Stream errors
+	// that do not end the turn are not failures.
 	startTime := time.Now()
 
-	msgChan, errChan := client.QueryStream(ctx, prompt)
+	turn, err := client.Send(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("receive error: %w", err)
+	}
 
 	// Collect the response
 	var resultText strings.Builder
-
-	for {
-		select {
-		case msg, ok := <-msgChan:
-			if !ok {
-				// Channel closed - response complete
-				goto Done
-			}
-
-			// Extract text from the message
-			if text := ExtractText(msg); text != "" {
-				resultText.WriteString(text)
-			}
-
-		case err, ok := <-errChan:
-			if !ok {
-				goto Done
-			}
-			// Return error on first error
-			return nil, fmt.Errorf("receive error: %w", err)
-
-		case <-ctx.Done():
-			return nil, ctx.Err()
+	for _, msg := range turn.Messages {
+		if text := ExtractText(msg); text != "" {
+			resultText.WriteString(text)
 		}
 	}
-
-Done:
 	endTime := time.Now()
 
 	// Return the result
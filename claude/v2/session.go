@@ -30,7 +30,13 @@ func newSession(ctx context.Context, cfg sessionConfig, opts ...SessionOption) (
 		return nil, fmt.Errorf("invalid options: %w", err)
 	}
 
-	client, err := buildClient(options.Model, options.Timeout, options.cliChecker, options.clientFactory)
+	// Resumed sessions continue the CLI's stored conversation
+	if cfg.resumed {
+		options.Resume = cfg.sessionID
+	}
+
+	client, err := buildClient(&options.BaseOptions, options.Timeout, options.cliChecker, options.clientFactory,
+		sessionClientOptions(options)...)
 	if err != nil {
 		return nil, err
 	}
@@ -48,16 +54,16 @@ func newSession(ctx context.Context, cfg sessionConfig, opts ...SessionOption) (
 
 	// Create session
 	session := &v2SessionImpl{
-		client:      client,
-		options:     options,
-		sessionID:   sessionID,
-		mu:          sync.RWMutex{},
-		closed:      false,
-		pendingSend: nil,
-		resumed:     cfg.resumed,
+		client:    client,
+		options:   options,
+		sessionID: sessionID,
+		mu:        sync.RWMutex{},
+		closed:    false,
+		resumed:   cfg.resumed,
 	}
 
-	// Connect to Claude CLI
+	// Connect to Claude CLI. The interactive process stays alive for the
+	// whole session so every turn shares the same conversation context.
 	if err := session.client.Connect(ctx); err != nil {
 		return nil, fmt.Errorf("connect: %w", err)
 	}
@@ -113,80 +119,57 @@ func ResumeSession(ctx context.Context, sessionID string, opts ...SessionOption)
 
 // v2SessionImpl implements the V2FullSession interface.
 type v2SessionImpl struct {
-	client      claude.Client
-	options     *V2SessionOptions
-	sessionID   string
-	mu          sync.RWMutex
-	closed      bool
-	pendingSend *pendingSendData
-	resumed     bool
+	client    claude.Client
+	options   *V2SessionOptions
+	sessionID string
+	mu        sync.RWMutex
+	closed    bool
+	resumed   bool
 }
 
 var _ V2FullSession = (*v2SessionImpl)(nil)
 
-// pendingSendData holds data from a Send operation that will be consumed by Receive.
-type pendingSendData struct {
-	message  string
-	sentAt   time.Time
-	consumed bool
-}
-
 // Send sends a message to Claude in this session.
-// The message is queued and will be sent when Receive is called.
+// The message is written to the session's CLI process immediately;
+// use Receive to read the turn's response.
 func (s *v2SessionImpl) Send(ctx context.Context, message string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
 
-	if s.closed {
+	if closed {
 		return fmt.Errorf("session is closed")
 	}
 
-	// Store the pending message
-	s.pendingSend = &pendingSendData{
-		message:  message,
-		sentAt:   time.Now(),
-		consumed: false,
+	// Forward to underlying client
+	client, ok := s.client.(interface {
+		SendMessage(context.Context, string) error
+	})
+	if !ok {
+		return fmt.Errorf("SendMessage not implemented")
+	}
+
+	if err := client.SendMessage(ctx, message); err != nil {
+		return fmt.Errorf("send message: %w", err)
 	}
 
 	return nil
 }
 
-// Receive returns a channel of V2Message responses.
-// The channel closes when the response is complete.
-// If Send was called, the message is sent first.
+// Receive returns a channel of V2Message responses for the current turn.
+// The channel closes after the turn's result message, leaving any later
+// output on the session for the next call to Receive.
 func (s *v2SessionImpl) Receive(ctx context.Context) <-chan V2Message {
-	s.mu.Lock()
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
 
-	if s.closed {
-		s.mu.Unlock()
+	if closed {
 		ch := make(chan V2Message)
 		close(ch)
 		return ch
 	}
 
-	// Check if there's a pending send and take a copy while holding the lock
-	pendingData := s.pendingSend
-	pendingDataCopy := pendingData
-
-	s.mu.Unlock()
-
-	// If there's a pending send, send it first
-	if pendingDataCopy != nil && !pendingDataCopy.consumed {
-		// Send the message
-		msgChan, errChan := s.client.QueryStream(ctx, pendingDataCopy.message)
-
-		// Mark as consumed (acquire lock again)
-		s.mu.Lock()
-		if s.pendingSend == pendingDataCopy {
-			s.pendingSend.consumed = true
-		}
-		s.mu.Unlock()
-
-		// Wrap the messages as V2 messages
-		return s.wrapMessageChannel(ctx, msgChan, errChan)
-	}
-
-	// Otherwise, just receive messages from the client
 	msgChan, errChan := s.client.ReceiveMessages(ctx)
 	return s.wrapMessageChannel(ctx, msgChan, errChan)
 }
@@ -226,6 +209,9 @@ func (s *v2SessionImpl) SessionID() string {
 }
 
 // wrapMessageChannel wraps the client's message channel and converts messages to V2 format.
+// It stops after forwarding a result message so that only one turn is consumed.
+// Stream errors, such as CLI stderr lines, are forwarded as V2Errors without
+// ending the turn; the stream closing before the result does.
 func (s *v2SessionImpl) wrapMessageChannel(ctx context.Context, msgChan <-chan claude.Message, errChan <-chan error) <-chan V2Message {
 	out := make(chan V2Message, 100)
 
@@ -240,8 +226,10 @@ func (s *v2SessionImpl) wrapMessageChannel(ctx context.Context, msgChan <-chan c
 				if !ok {
 					return
 				}
+				s.trackSessionID(msg)
+
 				// Convert to V2 message
-				v2Msg := convertToV2Message(msg, s.sessionID)
+				v2Msg := convertToV2Message(msg, s.SessionID())
 				if v2Msg != nil {
 					select {
 					case out <- v2Msg:
@@ -249,22 +237,28 @@ func (s *v2SessionImpl) wrapMessageChannel(ctx context.Context, msgChan <-chan c
 						return
 					}
 				}
+
+				// The result message ends the turn
+				if _, ok := msg.(*shared.ResultMessage); ok {
+					return
+				}
 			case err, ok := <-errChan:
 				if !ok {
-					return
+					// The message channel reports the end of the stream
+					errChan = nil
+					continue
 				}
 				// Convert error to V2 error message
 				v2Err := &V2Error{
 					TypeField:  V2EventTypeError,
 					ErrorField: err.Error(),
-					SessionID:  s.sessionID,
+					SessionID:  s.SessionID(),
 				}
 				select {
 				case out <- v2Err:
 				case <-ctx.Done():
 					return
 				}
-				return
 			}
 		}
 	}()
@@ -272,6 +266,30 @@ func (s *v2SessionImpl) wrapMessageChannel(ctx context.Context, msgChan <-chan c
 	return out
 }
 
+// trackSessionID adopts the session ID reported by the CLI.
+// The init system message and every result message carry it; it is the ID
+// that ResumeSession needs to continue this conversation later.
+func (s *v2SessionImpl) trackSessionID(msg claude.Message) {
+	var id string
+	switch m := msg.(type) {
+	case *shared.SystemMessage:
+		id, _ = m.Data["session_id"].(string)
+	case *shared.ResultMessage:
+		id = m.SessionID
+	}
+	if id == "" {
+		return
+	}
+
+	s.mu.Lock()
+	s.sessionID = id
+	s.mu.Unlock()
+
+	if clientImpl, ok := s.client.(*claude.ClientImpl); ok {
+		clientImpl.SetSessionID(id)
+	}
+}
+
 // convertToV2Message converts a client Message to a V2Message.
 func convertToV2Message(msg claude.Message, sessionID string) V2Message {
 	switch m := msg.(type) {
@@ -0,0 +1,218 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude"
+	"github.com/dotcommander/agent-sdk-go/internal/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamingMockClient is a MockClient backed by one persistent message stream,
+// like a connected interactive transport.
+type streamingMockClient struct {
+	MockClient
+	msgChan chan claude.Message
+	errChan chan error
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func newStreamingMockClient() *streamingMockClient {
+	return &streamingMockClient{
+		msgChan: make(chan claude.Message, 10),
+		errChan: make(chan error, 1),
+	}
+}
+
+func (m *streamingMockClient) SendMessage(ctx context.Context, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+func (m *streamingMockClient) ReceiveMessages(ctx context.Context) (<-chan claude.Message, <-chan error) {
+	return m.msgChan, m.errChan
+}
+
+func (m *streamingMockClient) QueryStream(ctx context.Context, prompt string) (<-chan claude.Message, <-chan error) {
+	panic("sessions must not spawn one-shot queries")
+}
+
+func (m *streamingMockClient) sentMessages() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sent...)
+}
+
+// newTestSession creates a session on the given client without a real CLI.
+func newTestSession(t *testing.T, client claude.Client, opts ...SessionOption) V2Session {
+	t.Helper()
+
+	opts = append(opts,
+		WithCLIChecker(shared.AlwaysAvailableCLIChecker{}),
+		WithClientFactory(ClientFactoryFunc(func(...claude.ClientOption) (claude.Client, error) {
+			return client, nil
+		})),
+	)
+
+	session, err := CreateSession(context.Background(), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func resultMessage(sessionID, result string) *shared.ResultMessage {
+	return &shared.ResultMessage{
+		MessageType: shared.MessageTypeResult,
+		Subtype:     "success",
+		SessionID:   sessionID,
+		Result:      &result,
+	}
+}
+
+func assistantMessage(text string) *shared.AssistantMessage {
+	return &shared.AssistantMessage{
+		MessageType: shared.MessageTypeAssistant,
+		Content:     []shared.ContentBlock{&shared.TextBlock{MessageType: shared.ContentBlockTypeText, Text: text}},
+	}
+}
+
+func collect(t *testing.T, ch <-chan V2Message) []V2Message {
+	t.Helper()
+
+	var msgs []V2Message
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		case <-timeout:
+			t.Fatal("timed out waiting for turn to complete")
+		}
+	}
+}
+
+func TestSessionSendWritesToPersistentClient(t *testing.T) {
+	t.Parallel()
+
+	client := newStreamingMockClient()
+	session := newTestSession(t, client)
+
+	ctx := context.Background()
+	require.NoError(t, session.Send(ctx, "Remember 42"))
+	require.NoError(t, session.Send(ctx, "What number?"))
+
+	assert.Equal(t, []string{"Remember 42", "What number?"}, client.sentMessages())
+}
+
+func TestSessionReceiveStopsAtResult(t *testing.T) {
+	t.Parallel()
+
+	client := newStreamingMockClient()
+	session := newTestSession(t, client)
+	ctx := context.Background()
+
+	// Queue two complete turns on the shared stream
+	client.msgChan <- &shared.SystemMessage{
+		MessageType: shared.MessageTypeSystem,
+		Subtype:     "init",
+		Data:        map[string]any{"session_id": "cli-session"},
+	}
+	client.msgChan <- assistantMessage("first")
+	client.msgChan <- resultMessage("cli-session", "first")
+	client.msgChan <- assistantMessage("second")
+	client.msgChan <- resultMessage("cli-session", "second")
+
+	first := collect(t, session.Receive(ctx))
+	require.Len(t, first, 2)
+	assert.Equal(t, "first", ExtractText(first[0]))
+	assert.Equal(t, V2EventTypeResult, first[1].Type())
+	assert.Equal(t, "cli-session", session.SessionID())
+
+	second := collect(t, session.Receive(ctx))
+	require.Len(t, second, 2)
+	assert.Equal(t, "second", ExtractText(second[0]))
+	assert.Equal(t, "second", second[1].(*V2ResultMessage).Result)
+}
+
+func TestSessionReceiveContinuesAfterStreamError(t *testing.T) {
+	t.Parallel()
+
+	client := newStreamingMockClient()
+	session := newTestSession(t, client)
+
+	ch := session.Receive(context.Background())
+	client.errChan <- errors.New("CLI stderr: warming up")
+	select {
+	case msg := <-ch:
+		assert.Equal(t, V2EventTypeError, msg.Type())
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the error")
+	}
+
+	client.msgChan <- assistantMessage("first")
+	client.msgChan <- resultMessage("cli-session", "first")
+	client.msgChan <- assistantMessage("second")
+
+	rest := collect(t, ch)
+	require.Len(t, rest, 2)
+	assert.Equal(t, "first", ExtractText(rest[0]))
+	assert.Equal(t, V2EventTypeResult, rest[1].Type())
+	assert.Len(t, client.msgChan, 1, "the next turn's message must stay on the stream")
+}
+
+func TestSessionSendAfterClose(t *testing.T) {
+	t.Parallel()
+
+	client := newStreamingMockClient()
+	session := newTestSession(t, client)
+	require.NoError(t, session.Close())
+
+	err := session.Send(context.Background(), "hello")
+	assert.Error(t, err)
+	assert.Empty(t, client.sentMessages())
+}
+
+func TestSessionSendUnsupportedClient(t *testing.T) {
+	t.Parallel()
+
+	session := newTestSession(t, &MockClient{})
+
+	err := session.Send(context.Background(), "hello")
+	assert.Error(t, err)
+}
+
+func TestResumeSessionPassesResumeFlag(t *testing.T) {
+	t.Parallel()
+
+	var got *claude.ClientOptions
+	factory := ClientFactoryFunc(func(opts ...claude.ClientOption) (claude.Client, error) {
+		got = claude.DefaultClientOptions()
+		for _, opt := range opts {
+			opt(got)
+		}
+		return newStreamingMockClient(), nil
+	})
+
+	session, err := ResumeSession(context.Background(), "abc-123",
+		WithCLIChecker(shared.AlwaysAvailableCLIChecker{}),
+		WithClientFactory(factory))
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NotNil(t, got)
+	assert.Contains(t, got.CustomArgs, "--resume")
+	assert.Contains(t, got.CustomArgs, "abc-123")
+	assert.Equal(t, "abc-123", session.SessionID())
+}
@@ -0,0 +1,145 @@
+// Command claude-relay runs the Claude CLI for remote clients. It listens for
+// remote.Launcher connections over TCP, WebSocket or both, spawns the CLI for
+// each of them and bridges its stdio over the connection.
+//
+// Usage:
+//
+//	CLAUDE_RELAY_TOKEN=secret claude-relay -listen :7877 -http :7878
+//
+// Clients connect with tcp://host:7877 or ws://host:7878/relay and the same
+// token. Dropped connections can resume their session within -grace.
+//
+// With -tls-cert and -tls-key, both listeners serve TLS, and clients connect
+// with tls://host:7877 or wss://host:7878/relay instead.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dotcommander/agent-sdk-go/claude/cli"
+	"github.com/dotcommander/agent-sdk-go/claude/remote"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "claude-relay:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	listen := flag.String("listen", "", "TCP address to accept newline-delimited connections on")
+	httpAddr := flag.String("http", "", "HTTP address to accept WebSocket connections on, at /relay")
+	cliPath := flag.String("cli", "", "path to the Claude CLI (default: discovered)")
+	token := flag.String("token", os.Getenv("CLAUDE_RELAY_TOKEN"), "token clients must present (default: $CLAUDE_RELAY_TOKEN)")
+	dir := flag.String("dir", "", "working directory of the CLI (default: the current directory)")
+	grace := flag.Duration("grace", remote.DefaultReconnectGrace, "how long a disconnected session waits for its client")
+	insecure := flag.Bool("insecure", false, "accept clients without a token")
+	certFile := flag.String("tls-cert", "", "TLS certificate file; serves TLS on both listeners with -tls-key")
+	keyFile := flag.String("tls-key", "", "TLS private key file for -tls-cert")
+	verbose := flag.Bool("v", false, "log debug messages")
+	flag.Parse()
+
+	if *listen == "" && *httpAddr == "" {
+		return errors.New("set -listen, -http or both")
+	}
+	if *token == "" && !*insecure {
+		return errors.New("no token: set -token or CLAUDE_RELAY_TOKEN, or pass -insecure")
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		return errors.New("set both -tls-cert and -tls-key")
+	}
+	var tlsConfig *tls.Config
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if *cliPath == "" {
+		result, err := cli.DiscoverCLI("", "claude")
+		if err != nil {
+			return fmt.Errorf("discover CLI: %w", err)
+		}
+		*cliPath = result.Path
+	}
+
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	relay := &remote.Relay{
+		CLIPath:        *cliPath,
+		Dir:            *dir,
+		Token:          *token,
+		ReconnectGrace: *grace,
+		Logger:         logger,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 2)
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		scheme := "tcp"
+		if tlsConfig != nil {
+			ln = tls.NewListener(ln, tlsConfig)
+			scheme = "tls"
+		}
+		logger.Info("relay listening", scheme, ln.Addr().String())
+		go func() { errs <- relay.Serve(ln) }()
+	}
+
+	var server *http.Server
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/relay", relay)
+		server = &http.Server{Addr: *httpAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		ln, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			_ = relay.Close()
+			return err
+		}
+		scheme := "ws"
+		if tlsConfig != nil {
+			// Without HTTP/2, whose connections cannot be hijacked for WebSockets
+			server.TLSConfig = tlsConfig.Clone()
+			server.TLSConfig.NextProtos = []string{"http/1.1"}
+			ln = tls.NewListener(ln, server.TLSConfig)
+			scheme = "wss"
+		}
+		logger.Info("relay listening", "websocket", scheme+"://"+ln.Addr().String()+"/relay")
+		go func() { errs <- server.Serve(ln) }()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		logger.Info("relay shutting down")
+	case err = <-errs:
+	}
+	if server != nil {
+		// Hijacked WebSocket connections are left to the relay
+		_ = server.Close()
+	}
+	_ = relay.Close()
+	return err
+}
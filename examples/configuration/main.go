@@ -238,7 +238,7 @@ func demonstrateContextOptions() {
 	fmt.Println()
 
 	// Context files
-	fmt.Println("ContextFiles - Include files in context:")
+	fmt.Println("ContextFiles - Grant access to the files' directories:")
 	fmt.Println("  Single file:    []string{\"main.go\"}")
 	fmt.Println("  Multiple files: []string{\"main.go\", \"go.mod\", \"README.md\"}")
 	fmt.Println("  Config:         []string{\".env\", \"config.yaml\"}")
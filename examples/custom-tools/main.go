@@ -256,7 +256,7 @@ func main() {
 
 	fmt.Println("--- Registered Tools ---")
 	fmt.Printf("Server: %s v%s\n", toolServer.Name, toolServer.Version)
-	for _, tool := range toolServer.Tools {
+	for _, tool := range toolServer.Tools() {
 		fmt.Printf("  - %s: %s\n", tool.Name, tool.Description)
 	}
 	fmt.Println()
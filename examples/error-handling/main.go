@@ -213,11 +213,16 @@ func demonstrateErrorWrapping() {
 func demonstrateCircuitBreaker() {
 	fmt.Println("--- Circuit Breaker Pattern ---")
 
-	// Create circuit breaker with custom config
-	cb := claude.NewStubCircuitBreaker(claude.CircuitBreakerConfig{
+	// Create circuit breaker with custom config. Pass the same breaker to
+	// claude.WithCircuitBreaker on every client to guard real CLI launches.
+	cb := claude.NewCircuitBreaker(claude.CircuitBreakerConfig{
 		FailureThreshold:    3,
 		RecoveryTimeout:     100 * time.Millisecond,
 		HalfOpenMaxRequests: 1,
+		IsFailure:           func(error) bool { return true },
+		OnStateChange: func(from, to claude.CircuitState) {
+			fmt.Printf("    Circuit %s -> %s\n", from, to)
+		},
 	})
 
 	ctx := context.Background()
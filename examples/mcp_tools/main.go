@@ -98,7 +98,7 @@ func main() {
 	// Demonstrate MCP server configuration
 	fmt.Println("\n--- MCP Server Configuration ---")
 	fmt.Printf("Created MCP server: %s v%s\n", calculatorServer.Name, calculatorServer.Version)
-	fmt.Printf("Tools: %d math tools\n", len(calculatorServer.Tools))
+	fmt.Printf("Tools: %d math tools\n", len(calculatorServer.Tools()))
 
 	// Server config already created earlier
 	fmt.Printf("Server config type: %s\n", serverConfig.Type)
@@ -0,0 +1,80 @@
+package shared
+
+import (
+	"slices"
+	"strings"
+)
+
+// Capabilities describes what the connected CLI supports. It is assembled
+// from the response to the initialize handshake and the init system message;
+// fields the CLI has not reported yet are empty.
+type Capabilities struct {
+	// CLIVersion is the version of the CLI, from the init system message.
+	CLIVersion string
+
+	// Commands lists the slash commands available in the session.
+	Commands []SlashCommand
+
+	// Models lists the models the session can switch to.
+	Models []ModelInfo
+
+	// OutputStyle is the active output style and OutputStyles those available.
+	OutputStyle  string
+	OutputStyles []string
+
+	// Betas lists the beta features enabled for the session.
+	Betas []string
+
+	// ControlSubtypes lists the control request subtypes the CLI accepts,
+	// such as "rewind_files". Nil when the CLI did not advertise them.
+	ControlSubtypes []string
+}
+
+// SupportsControl reports whether the CLI accepts control requests of
+// subtype. A CLI that did not advertise its subtypes is assumed to accept
+// all of them.
+func (c *Capabilities) SupportsControl(subtype string) bool {
+	return c.ControlSubtypes == nil || slices.Contains(c.ControlSubtypes, subtype)
+}
+
+// UnsupportedError reports that the connected CLI does not support a
+// control request, because it did not advertise its subtype or rejected it.
+// Upgrading the CLI usually resolves it.
+type UnsupportedError struct {
+	BaseError
+	Subtype    string
+	CLIVersion string // empty when the CLI has not reported its version
+}
+
+// Error returns a descriptive error message for UnsupportedError.
+func (e *UnsupportedError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Subtype)
+	b.WriteString(" unsupported by CLI")
+	if e.CLIVersion != "" {
+		b.WriteString(" v")
+		b.WriteString(e.CLIVersion)
+	}
+	e.FormatInner(&b)
+	return b.String()
+}
+
+// Type returns the error type for SDKError compliance.
+func (e *UnsupportedError) Type() string { return "unsupported" }
+
+// NewUnsupportedError creates a new UnsupportedError.
+func NewUnsupportedError(subtype, cliVersion string, inner error) *UnsupportedError {
+	return &UnsupportedError{
+		BaseError:  BaseError{Inner: inner},
+		Subtype:    subtype,
+		CLIVersion: cliVersion,
+	}
+}
+
+// IsUnsupportedError checks if an error is an UnsupportedError.
+func IsUnsupportedError(err error) bool { return IsErrorType[*UnsupportedError](err) }
+
+// AsUnsupportedError extracts an UnsupportedError from the error chain.
+func AsUnsupportedError(err error) (*UnsupportedError, bool) {
+	return AsErrorType[*UnsupportedError](err)
+}
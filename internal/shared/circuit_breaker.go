@@ -0,0 +1,208 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a Breaker rejects a call.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Breaker is a circuit breaker for CLI process launches. It opens after
+// FailureThreshold consecutive failures, rejects calls until RecoveryTimeout
+// has passed, then lets up to HalfOpenMaxRequests probes through. It is safe
+// for concurrent use, so one Breaker can guard every client of a process.
+type Breaker struct {
+	config CircuitBreakerConfig
+
+	mu        sync.Mutex
+	state     State
+	failures  int // consecutive failures while closed
+	openedAt  time.Time
+	probes    int // probes in flight while half-open
+	successes int // successful probes while half-open
+}
+
+// NewCircuitBreaker creates a Breaker. Zero config fields use the values of
+// DefaultCircuitBreakerConfig.
+func NewCircuitBreaker(config CircuitBreakerConfig) *Breaker {
+	defaults := DefaultCircuitBreakerConfig()
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaults.FailureThreshold
+	}
+	if config.RecoveryTimeout <= 0 {
+		config.RecoveryTimeout = defaults.RecoveryTimeout
+	}
+	if config.HalfOpenMaxRequests <= 0 {
+		config.HalfOpenMaxRequests = defaults.HalfOpenMaxRequests
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = IsLaunchFailure
+	}
+
+	return &Breaker{config: config}
+}
+
+// Allow reserves a call. It returns an error wrapping ErrCircuitOpen while the
+// circuit is open or all half-open probes are taken. Every allowed call must be
+// followed by exactly one Record.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	from := b.state
+	b.expireLocked()
+
+	var err error
+	switch b.state {
+	case Open:
+		remaining := (b.config.RecoveryTimeout - time.Since(b.openedAt)).Round(time.Millisecond)
+		err = fmt.Errorf("%w: retry after %s", ErrCircuitOpen, remaining)
+	case HalfOpen:
+		if b.probes >= b.config.HalfOpenMaxRequests {
+			err = fmt.Errorf("%w: waiting for half-open probes", ErrCircuitOpen)
+		} else {
+			b.probes++
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return err
+}
+
+// Record reports the outcome of an allowed call. A nil error counts as a
+// success, an error accepted by IsFailure as a failure; other errors only
+// release the call.
+func (b *Breaker) Record(err error) {
+	switch {
+	case err == nil:
+		b.RecordSuccess()
+	case b.config.IsFailure(err):
+		b.RecordFailure()
+	default:
+		b.mu.Lock()
+		if b.state == HalfOpen && b.probes > 0 {
+			b.probes--
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Execute runs fn if the breaker allows it and records its outcome.
+func (b *Breaker) Execute(_ context.Context, fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	from := b.state
+	b.expireLocked()
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return to
+}
+
+// Reset closes the circuit and clears all counters.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	from := b.state
+	b.state = Closed
+	b.failures, b.probes, b.successes = 0, 0, 0
+	b.mu.Unlock()
+
+	b.notify(from, Closed)
+}
+
+// RecordFailure records a failed call. It opens the circuit after
+// FailureThreshold consecutive failures, or at once for a half-open probe.
+func (b *Breaker) RecordFailure() {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case Closed:
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.openLocked()
+		}
+	case HalfOpen:
+		b.openLocked()
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// RecordSuccess records a successful call. A half-open circuit closes once
+// HalfOpenMaxRequests probes have succeeded.
+func (b *Breaker) RecordSuccess() {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case Closed:
+		b.failures = 0
+	case HalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenMaxRequests {
+			b.state = Closed
+			b.failures, b.probes, b.successes = 0, 0, 0
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// expireLocked moves an open circuit to half-open once RecoveryTimeout has passed.
+// The caller must hold b.mu.
+func (b *Breaker) expireLocked() {
+	if b.state == Open && time.Since(b.openedAt) >= b.config.RecoveryTimeout {
+		b.state = HalfOpen
+		b.probes, b.successes = 0, 0
+	}
+}
+
+// openLocked trips the circuit. The caller must hold b.mu.
+func (b *Breaker) openLocked() {
+	b.state = Open
+	b.openedAt = time.Now()
+	b.failures, b.probes, b.successes = 0, 0, 0
+}
+
+// notify calls OnStateChange if the state changed. It must be called without b.mu held.
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.config.OnStateChange != nil {
+		b.config.OnStateChange(from, to)
+	}
+}
+
+// IsLaunchFailure is the default failure classifier of a Breaker. It accepts
+// process and connection errors, a missing CLI and failures to execute it.
+func IsLaunchFailure(err error) bool {
+	var execErr *exec.Error
+	var exitErr *exec.ExitError
+	var pathErr *fs.PathError
+	return IsProcessError(err) ||
+		IsConnectionError(err) ||
+		IsCLINotFound(err) ||
+		errors.As(err, &execErr) ||
+		errors.As(err, &exitErr) ||
+		errors.As(err, &pathErr)
+}
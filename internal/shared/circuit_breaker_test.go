@@ -0,0 +1,147 @@
+package shared
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, RecoveryTimeout: time.Hour})
+	launchErr := NewProcessError(1, "claude", "exited", "")
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		b.Record(launchErr)
+	}
+
+	// A success resets the streak
+	_ = b.Allow()
+	b.Record(nil)
+	for i := 0; i < 2; i++ {
+		_ = b.Allow()
+		b.Record(launchErr)
+	}
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %v, want CLOSED", got)
+	}
+
+	_ = b.Allow()
+	b.Record(launchErr)
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v, want OPEN", got)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow() error = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerIgnoresOtherErrors(t *testing.T) {
+	t.Parallel()
+
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1})
+	_ = b.Allow()
+	b.Record(errors.New("invalid prompt"))
+
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v, want CLOSED", got)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var transitions []string
+	b := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold:    1,
+		RecoveryTimeout:     10 * time.Millisecond,
+		HalfOpenMaxRequests: 2,
+		OnStateChange: func(from, to State) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	launchErr := NewConnectionError("start", nil)
+
+	_ = b.Allow()
+	b.Record(launchErr)
+	time.Sleep(20 * time.Millisecond)
+
+	// Two probes are allowed, a third waits
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("third probe error = %v, want ErrCircuitOpen", err)
+	}
+
+	b.Record(nil)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() after one success = %v, want HALF_OPEN", got)
+	}
+	b.Record(nil)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() after two successes = %v, want CLOSED", got)
+	}
+
+	// A failed probe reopens the circuit at once
+	_ = b.Allow()
+	b.Record(launchErr)
+	time.Sleep(20 * time.Millisecond)
+	_ = b.Allow()
+	b.Record(launchErr)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"CLOSED->OPEN", "OPEN->HALF_OPEN", "HALF_OPEN->CLOSED", "CLOSED->OPEN", "OPEN->HALF_OPEN", "HALF_OPEN->OPEN"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transitions = %v, want %v", transitions, want)
+			break
+		}
+	}
+}
+
+func TestBreakerReleasesProbeOnNeutralError(t *testing.T) {
+	t.Parallel()
+
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, RecoveryTimeout: time.Millisecond, HalfOpenMaxRequests: 1})
+	_ = b.Allow()
+	b.Record(NewProcessError(1, "claude", "exited", ""))
+	time.Sleep(5 * time.Millisecond)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	b.Record(errors.New("canceled by caller"))
+	if err := b.Allow(); err != nil {
+		t.Errorf("probe after neutral outcome: %v", err)
+	}
+}
+
+func TestIsLaunchFailure(t *testing.T) {
+	t.Parallel()
+
+	if !IsLaunchFailure(NewProcessError(1, "claude", "exited", "")) {
+		t.Error("ProcessError should be a launch failure")
+	}
+	if !IsLaunchFailure(NewCLINotFoundError("/missing", "")) {
+		t.Error("CLINotFoundError should be a launch failure")
+	}
+	if IsLaunchFailure(NewAPIError(AssistantMessageErrorRateLimit)) {
+		t.Error("API errors should not be launch failures")
+	}
+}
@@ -0,0 +1,138 @@
+package shared
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// EnvMode selects which variables of the SDK process's environment the CLI inherits.
+type EnvMode int
+
+const (
+	// EnvInheritAll passes the whole environment of the SDK process. It is the default.
+	EnvInheritAll EnvMode = iota
+	// EnvAllowlist passes only the variables of DefaultEnvAllowlist and EnvPolicy.Allow.
+	EnvAllowlist
+	// EnvExplicit passes none of them; the CLI gets only the variables set
+	// explicitly through Env and the EnvPolicy overrides.
+	EnvExplicit
+)
+
+// String returns the name of the mode.
+func (m EnvMode) String() string {
+	switch m {
+	case EnvInheritAll:
+		return "inherit_all"
+	case EnvAllowlist:
+		return "allowlist"
+	case EnvExplicit:
+		return "explicit"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultEnvAllowlist returns the variables EnvAllowlist always passes.
+func DefaultEnvAllowlist() []string {
+	return []string{"PATH", "HOME", "ANTHROPIC_*"}
+}
+
+// EnvPolicy controls the environment of the CLI process, which the tools it
+// runs inherit. Variables set explicitly through Env are always passed.
+type EnvPolicy struct {
+	// Mode selects the inherited variables. Defaults to EnvInheritAll.
+	Mode EnvMode
+
+	// Allow names further variables EnvAllowlist passes. A trailing * matches
+	// a prefix, as in "AWS_*".
+	Allow []string
+
+	// Home overrides HOME, giving the client a home directory of its own.
+	// It must be an absolute path. Empty leaves HOME alone.
+	Home string
+
+	// ConfigDir overrides CLAUDE_CONFIG_DIR, where the CLI keeps its settings,
+	// credentials and sessions. It must be an absolute path. Empty leaves it alone.
+	ConfigDir string
+}
+
+// Validate checks that the overrides are absolute paths.
+func (p EnvPolicy) Validate() error {
+	if p.Mode < EnvInheritAll || p.Mode > EnvExplicit {
+		return NewConfigurationError("EnvPolicy.Mode", p.Mode.String(), "unknown environment mode")
+	}
+	if p.Home != "" && !filepath.IsAbs(p.Home) {
+		return NewConfigurationError("EnvPolicy.Home", p.Home, "must be an absolute path")
+	}
+	if p.ConfigDir != "" && !filepath.IsAbs(p.ConfigDir) {
+		return NewConfigurationError("EnvPolicy.ConfigDir", p.ConfigDir, "must be an absolute path")
+	}
+	return nil
+}
+
+// Inherit returns the KEY=value pairs of environ that the policy passes to the CLI.
+func (p EnvPolicy) Inherit(environ []string) []string {
+	switch p.Mode {
+	case EnvInheritAll:
+		return append([]string(nil), environ...)
+	case EnvAllowlist:
+		allow := append(DefaultEnvAllowlist(), p.Allow...)
+		var env []string
+		for _, e := range environ {
+			name, _, _ := strings.Cut(e, "=")
+			if envAllowed(name, allow) {
+				env = append(env, e)
+			}
+		}
+		return env
+	default:
+		return nil
+	}
+}
+
+// Overrides returns the KEY=value pairs set by Home and ConfigDir.
+func (p EnvPolicy) Overrides() []string {
+	var env []string
+	if p.Home != "" {
+		env = append(env, "HOME="+p.Home)
+	}
+	if p.ConfigDir != "" {
+		env = append(env, "CLAUDE_CONFIG_DIR="+p.ConfigDir)
+	}
+	return env
+}
+
+// envAllowed reports whether name matches one of the allowlist patterns.
+// Names are case-insensitive on Windows.
+func envAllowed(name string, allow []string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range allow {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactEnv returns the names of env, a list of KEY=value pairs, sorted and
+// with every value replaced by Redacted, for debugging what the CLI receives.
+func RedactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		redacted = append(redacted, name+"="+Redacted)
+	}
+	sort.Strings(redacted)
+	return redacted
+}
@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvPolicyInherit(t *testing.T) {
+	t.Parallel()
+
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/svc",
+		"ANTHROPIC_API_KEY=sk-ant",
+		"AWS_SECRET_ACCESS_KEY=aws",
+		"DATABASE_URL=postgres://",
+		"LANG=C.UTF-8",
+	}
+
+	tests := []struct {
+		name   string
+		policy EnvPolicy
+		want   []string
+	}{
+		{"inherit all", EnvPolicy{}, environ},
+		{
+			"allowlist",
+			EnvPolicy{Mode: EnvAllowlist},
+			[]string{"PATH=/usr/bin", "HOME=/home/svc", "ANTHROPIC_API_KEY=sk-ant"},
+		},
+		{
+			"allowlist with extra names",
+			EnvPolicy{Mode: EnvAllowlist, Allow: []string{"LANG", "AWS_*"}},
+			[]string{"PATH=/usr/bin", "HOME=/home/svc", "ANTHROPIC_API_KEY=sk-ant", "AWS_SECRET_ACCESS_KEY=aws", "LANG=C.UTF-8"},
+		},
+		{"explicit", EnvPolicy{Mode: EnvExplicit, Allow: []string{"PATH"}}, nil},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Inherit(environ); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Inherit() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvPolicyOverrides(t *testing.T) {
+	t.Parallel()
+
+	policy := EnvPolicy{Home: "/srv/tenant", ConfigDir: "/srv/tenant/.claude"}
+	want := []string{"HOME=/srv/tenant", "CLAUDE_CONFIG_DIR=/srv/tenant/.claude"}
+	if got := policy.Overrides(); !slices.Equal(got, want) {
+		t.Errorf("Overrides() = %v, want %v", got, want)
+	}
+	if err := policy.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	for _, invalid := range []EnvPolicy{
+		{Home: "tenant"},
+		{ConfigDir: "./.claude"},
+		{Mode: EnvMode(7)},
+	} {
+		if err := invalid.Validate(); !IsConfigurationError(err) {
+			t.Errorf("Validate(%+v) = %v, want a ConfigurationError", invalid, err)
+		}
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	t.Parallel()
+
+	got := RedactEnv([]string{"PATH=/usr/bin", "ANTHROPIC_API_KEY=sk-ant", "EMPTY="})
+	want := []string{"ANTHROPIC_API_KEY=" + Redacted, "EMPTY=" + Redacted, "PATH=" + Redacted}
+	if !slices.Equal(got, want) {
+		t.Errorf("RedactEnv() = %v, want %v", got, want)
+	}
+}
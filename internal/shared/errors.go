@@ -203,11 +203,24 @@ func NewConnectionError(reason string, inner error) *ConnectionError {
 	}
 }
 
+// TimeoutLimit names the transport deadline reported by a TimeoutError.
+type TimeoutLimit string
+
+const (
+	// TimeoutLimitIdle is the longest silence of the CLI during a turn.
+	TimeoutLimitIdle TimeoutLimit = "idle"
+	// TimeoutLimitTurn is the longest time from a prompt to its result.
+	TimeoutLimitTurn TimeoutLimit = "turn"
+	// TimeoutLimitSession is the longest lifetime of a session.
+	TimeoutLimitSession TimeoutLimit = "session"
+)
+
 // TimeoutError indicates an operation timed out.
 type TimeoutError struct {
 	BaseError
 	Operation string
 	Timeout   string
+	Limit     TimeoutLimit // set when a transport deadline expired
 }
 
 // Error returns a descriptive error message for TimeoutError.
@@ -339,9 +352,12 @@ func NewConfigurationError(field, value, reason string) *ConfigurationError {
 // ProcessError indicates a subprocess-related error.
 type ProcessError struct {
 	BaseError
-	PID     int
-	Command string
-	Signal  string // Signal that caused the process to exit (if applicable)
+	PID      int
+	Command  string
+	Signal   string    // Signal that caused the process to exit (if applicable)
+	ExitCode int       // Exit code of the process (if it exited on its own)
+	Stderr   []string  // Last lines the process wrote to stderr
+	Cause    ExitCause // Failure cause recognized in Stderr (if any)
 }
 
 // Error returns a descriptive error message for ProcessError.
@@ -354,6 +370,14 @@ func (e *ProcessError) Error() string {
 	}
 	if e.Signal != "" {
 		fmt.Fprintf(&b, " (signal=%s)", e.Signal)
+	} else if e.ExitCode != 0 {
+		fmt.Fprintf(&b, " (exit_code=%d)", e.ExitCode)
+	}
+	if e.Cause != ExitCauseUnknown {
+		fmt.Fprintf(&b, " (cause=%s)", e.Cause)
+	}
+	if len(e.Stderr) > 0 {
+		fmt.Fprintf(&b, " (stderr=%q)", e.Stderr[len(e.Stderr)-1])
 	}
 	return b.String()
 }
@@ -440,6 +464,30 @@ func NewMessageParseError(data any, messageType, reason string) *MessageParseErr
 	}
 }
 
+// LineTooLongError indicates a line of CLI output exceeded
+// BufferOptions.MaxLineSize. The line is skipped and reading continues.
+type LineTooLongError struct {
+	BaseError
+	Size  int // Bytes of the line, including its line ending
+	Limit int // The maximum line size
+}
+
+// Error returns a descriptive error message for LineTooLongError.
+func (e *LineTooLongError) Error() string {
+	return NewErrorBuilder("line too long").
+		IntField("size", e.Size).
+		IntField("limit", e.Limit).
+		String()
+}
+
+// Type returns the error type for SDKError compliance.
+func (e *LineTooLongError) Type() string { return "line_too_long" }
+
+// NewLineTooLongError creates a new LineTooLongError.
+func NewLineTooLongError(size, limit int) *LineTooLongError {
+	return &LineTooLongError{Size: size, Limit: limit}
+}
+
 // PermissionError indicates a tool or file access was denied.
 type PermissionError struct {
 	BaseError
@@ -598,6 +646,14 @@ func IsJSONDecodeError(err error) bool { return IsErrorType[*JSONDecodeError](er
 // AsJSONDecodeError extracts a JSONDecodeError from the error chain.
 func AsJSONDecodeError(err error) (*JSONDecodeError, bool) { return AsErrorType[*JSONDecodeError](err) }
 
+// IsLineTooLongError checks if an error is a LineTooLongError.
+func IsLineTooLongError(err error) bool { return IsErrorType[*LineTooLongError](err) }
+
+// AsLineTooLongError extracts a LineTooLongError from the error chain.
+func AsLineTooLongError(err error) (*LineTooLongError, bool) {
+	return AsErrorType[*LineTooLongError](err)
+}
+
 // IsMessageParseError checks if an error is a MessageParseError.
 func IsMessageParseError(err error) bool { return IsErrorType[*MessageParseError](err) }
 
@@ -654,7 +710,13 @@ type CircuitBreakerConfig struct {
 	// RecoveryTimeout is the time to wait before transitioning to half-open state.
 	RecoveryTimeout time.Duration
 	// HalfOpenMaxRequests is the maximum requests allowed in half-open state.
+	// A Breaker closes again once this many probes have succeeded.
 	HalfOpenMaxRequests int
+	// IsFailure decides which errors count towards tripping a Breaker.
+	// Defaults to IsLaunchFailure.
+	IsFailure func(err error) bool
+	// OnStateChange is called after a Breaker changes state.
+	OnStateChange func(from, to State)
 }
 
 // DefaultCircuitBreakerConfig returns sensible defaults for the circuit breaker.
@@ -668,6 +730,9 @@ func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
 
 // StubCircuitBreaker is a basic circuit breaker implementation.
 // This is a stub and can be enhanced with more sophisticated logic.
+//
+// Deprecated: Use NewCircuitBreaker, which is safe for concurrent use and
+// can be shared by clients and transports.
 type StubCircuitBreaker struct {
 	config CircuitBreakerConfig
 	state  State
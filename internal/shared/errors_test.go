@@ -179,6 +179,24 @@ func TestProcessError(t *testing.T) {
 	}
 }
 
+func TestProcessErrorExitDetails(t *testing.T) {
+	err := NewProcessError(12345, "claude", "exited", "")
+	err.ExitCode = 1
+	err.Stderr = []string{"starting", "Invalid API key"}
+	err.Cause = ExitCauseAuth
+
+	msg := err.Error()
+	if !strings.Contains(msg, "exit_code=1") {
+		t.Error("Error message should contain exit code")
+	}
+	if !strings.Contains(msg, "cause=auth_failure") {
+		t.Error("Error message should contain cause")
+	}
+	if !strings.Contains(msg, `stderr="Invalid API key"`) {
+		t.Error("Error message should contain last stderr line")
+	}
+}
+
 func TestErrorTypeCheckers(t *testing.T) {
 	tests := []struct {
 		name    string
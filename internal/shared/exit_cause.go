@@ -0,0 +1,76 @@
+package shared
+
+import "strings"
+
+// ExitCause classifies why the CLI process failed, as recognized in its stderr.
+type ExitCause string
+
+// Exit causes recognized by ClassifyStderr.
+const (
+	// ExitCauseUnknown means stderr matched no known failure.
+	ExitCauseUnknown ExitCause = ""
+	// ExitCauseAuth means the CLI could not authenticate, e.g. a missing or invalid API key.
+	ExitCauseAuth ExitCause = "auth_failure"
+	// ExitCauseInvalidModel means the requested model does not exist or is not available.
+	ExitCauseInvalidModel ExitCause = "invalid_model"
+	// ExitCauseBadFlag means the CLI rejected a command-line flag.
+	ExitCauseBadFlag ExitCause = "bad_flag"
+	// ExitCauseUnsupportedVersion means the installed CLI is too old or too new for the request.
+	ExitCauseUnsupportedVersion ExitCause = "unsupported_version"
+)
+
+// exitCausePatterns maps each cause to lowercase stderr fragments that
+// identify it, in order of precedence.
+var exitCausePatterns = []struct {
+	cause    ExitCause
+	patterns []string
+}{
+	{ExitCauseAuth, []string{
+		"invalid api key",
+		"invalid x-api-key",
+		"authentication_error",
+		"authentication failed",
+		"unauthorized",
+		"not logged in",
+		"please run /login",
+		"oauth token has expired",
+	}},
+	{ExitCauseInvalidModel, []string{
+		"invalid model",
+		"unknown model",
+		"model not found",
+		"model_not_found",
+		"not_found_error: model",
+	}},
+	{ExitCauseUnsupportedVersion, []string{
+		"unsupported version",
+		"version is not supported",
+		"requires claude code version",
+		"requires version",
+		"minimum version",
+		"please upgrade",
+		"please update",
+	}},
+	{ExitCauseBadFlag, []string{
+		"unknown option",
+		"unknown argument",
+		"unrecognized option",
+		"invalid option",
+		"missing required argument",
+		"argument missing",
+	}},
+}
+
+// ClassifyStderr recognizes the cause of a CLI failure in its stderr lines.
+// It returns ExitCauseUnknown if no line matches.
+func ClassifyStderr(lines []string) ExitCause {
+	text := strings.ToLower(strings.Join(lines, "\n"))
+	for _, c := range exitCausePatterns {
+		for _, pattern := range c.patterns {
+			if strings.Contains(text, pattern) {
+				return c.cause
+			}
+		}
+	}
+	return ExitCauseUnknown
+}
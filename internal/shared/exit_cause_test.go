@@ -0,0 +1,28 @@
+package shared
+
+import "testing"
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  ExitCause
+	}{
+		{"empty", nil, ExitCauseUnknown},
+		{"unrelated", []string{"warming up", "done"}, ExitCauseUnknown},
+		{"invalid api key", []string{"Invalid API key · Please run /login"}, ExitCauseAuth},
+		{"authentication error", []string{`API Error: 401 {"type":"authentication_error"}`}, ExitCauseAuth},
+		{"invalid model", []string{"Error: Invalid model name: claude-nope"}, ExitCauseInvalidModel},
+		{"unknown option", []string{"error: unknown option '--bogus'"}, ExitCauseBadFlag},
+		{"old CLI", []string{"This feature requires Claude Code version 2.0 or later"}, ExitCauseUnsupportedVersion},
+		{"auth wins over flag", []string{"error: unknown option '--x'", "Invalid API key"}, ExitCauseAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyStderr(tt.lines); got != tt.want {
+				t.Errorf("ClassifyStderr(%q) = %q, want %q", tt.lines, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// DebugEnvVar names the environment variable that sends SDK debug logs to
+// stderr when no logger is configured.
+const DebugEnvVar = "CLAUDE_SDK_DEBUG"
+
+// Redacted replaces the values of log attributes that may hold secrets.
+const Redacted = "[REDACTED]"
+
+// NewLogger returns the logger the SDK writes its diagnostics to. It uses
+// slogger if set and otherwise adapts logger. Without either, debug records go
+// to stderr when CLAUDE_SDK_DEBUG is set and are discarded otherwise.
+// Attributes that may hold secrets or prompts are redacted in every case.
+func NewLogger(slogger *slog.Logger, logger Logger) *slog.Logger {
+	var h slog.Handler
+	switch {
+	case slogger != nil:
+		if _, ok := slogger.Handler().(*redactingHandler); ok {
+			return slogger
+		}
+		h = slogger.Handler()
+	case logger != nil:
+		h = NewLoggerHandler(logger)
+	case os.Getenv(DebugEnvVar) != "":
+		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	default:
+		h = discardHandler{}
+	}
+	return slog.New(NewRedactingHandler(h))
+}
+
+// IsSecretKey reports whether a log attribute or environment variable name
+// suggests that its value is a credential or a prompt.
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range []string{"key", "token", "secret", "password", "passwd", "auth", "credential", "cookie", "prompt"} {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRedactingHandler wraps h so that the values of attributes whose key
+// satisfies IsSecretKey are replaced with Redacted, including inside groups.
+func NewRedactingHandler(h slog.Handler) slog.Handler {
+	return &redactingHandler{next: h}
+}
+
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr masks a secret attribute and the secret members of a group.
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		members := a.Value.Group()
+		redacted := make([]slog.Attr, len(members))
+		for i, m := range members {
+			redacted[i] = redactAttr(m)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if IsSecretKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// NewLoggerHandler adapts a printf-style Logger to slog. Each record is
+// formatted as its message followed by key=value pairs and passed to the
+// Logger method matching its level.
+func NewLoggerHandler(logger Logger) slog.Handler {
+	return &loggerHandler{logger: logger}
+}
+
+type loggerHandler struct {
+	logger Logger
+	prefix string // key prefix of the open groups
+	attrs  string // preformatted attributes added with WithAttrs
+}
+
+func (h *loggerHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *loggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.prefix, a)
+		return true
+	})
+
+	switch {
+	case r.Level < slog.LevelInfo:
+		h.logger.Debugf("%s", b.String())
+	case r.Level < slog.LevelWarn:
+		h.logger.Infof("%s", b.String())
+	case r.Level < slog.LevelError:
+		h.logger.Warnf("%s", b.String())
+	default:
+		h.logger.Errorf("%s", b.String())
+	}
+	return nil
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&b, h.prefix, a)
+	}
+	return &loggerHandler{logger: h.logger, prefix: h.prefix, attrs: b.String()}
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &loggerHandler{logger: h.logger, prefix: h.prefix + name + ".", attrs: h.attrs}
+}
+
+// appendAttr writes a as " key=value", flattening groups into dotted keys.
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, m := range a.Value.Group() {
+			appendAttr(b, prefix, m)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fmt.Fprintf(b, " %s%s=%v", prefix, a.Key, a.Value.Any())
+}
+
+// discardHandler drops every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
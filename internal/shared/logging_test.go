@@ -0,0 +1,92 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestIsSecretKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"ANTHROPIC_API_KEY", true},
+		{"CLAUDE_CODE_OAUTH_TOKEN", true},
+		{"db_password", true},
+		{"prompt", true},
+		{"--system-prompt", true},
+		{"ANTHROPIC_BASE_URL", false},
+		{"session_id", false},
+		{"pid", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSecretKey(tt.key); got != tt.want {
+			t.Errorf("IsSecretKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestNewLoggerRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), nil)
+
+	logger.With("api_key", "sk-with").Debug("starting",
+		"prompt", "tell me a secret",
+		"pid", 42,
+		slog.Group("env", slog.String("ANTHROPIC_API_KEY", "sk-group"), slog.String("ANTHROPIC_BASE_URL", "https://api")))
+
+	out := buf.String()
+	for _, secret := range []string{"sk-with", "tell me a secret", "sk-group"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q: %s", secret, out)
+		}
+	}
+	for _, want := range []string{"pid=42", "env.ANTHROPIC_BASE_URL=https://api", "prompt=" + Redacted} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output missing %q: %s", want, out)
+		}
+	}
+
+	if NewLogger(logger, nil) != logger {
+		t.Error("NewLogger should not wrap an already redacting logger again")
+	}
+}
+
+// recordingLogger collects the lines passed to a printf-style Logger.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) { l.add("DEBUG", format, args) }
+func (l *recordingLogger) Infof(format string, args ...any)  { l.add("INFO", format, args) }
+func (l *recordingLogger) Warnf(format string, args ...any)  { l.add("WARN", format, args) }
+func (l *recordingLogger) Errorf(format string, args ...any) { l.add("ERROR", format, args) }
+
+func (l *recordingLogger) add(level, format string, args []any) {
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func TestNewLoggerAdaptsLogger(t *testing.T) {
+	rec := &recordingLogger{}
+	logger := NewLogger(nil, rec)
+
+	logger.With("pid", 7).WithGroup("req").Warn("control request failed", "id", "req_1", "token", "abc")
+	logger.Debug("received message", "type", "result")
+
+	want := []string{
+		"WARN control request failed pid=7 req.id=req_1 req.token=" + Redacted,
+		"DEBUG received message type=result",
+	}
+	if len(rec.lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %q", len(rec.lines), len(want), rec.lines)
+	}
+	for i := range want {
+		if rec.lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, rec.lines[i], want[i])
+		}
+	}
+}
@@ -55,6 +55,9 @@ const (
 	// SDK message types (from TypeScript SDK)
 	MessageTypeToolProgress = "tool_progress"
 	MessageTypeAuthStatus   = "auth_status"
+
+	// SDK-synthesized message types (never sent by the CLI)
+	MessageTypeReconnect = "reconnect"
 )
 
 // System message subtype constants
@@ -130,6 +133,45 @@ func (m *UserMessage) MarshalJSON() ([]byte, error) {
 	return MarshalWithType(m, MessageTypeUser)
 }
 
+// UnmarshalJSON implements custom JSON unmarshaling for UserMessage.
+// String content is kept as a string; array content is decoded into []ContentBlock.
+func (m *UserMessage) UnmarshalJSON(data []byte) error {
+	type Alias UserMessage
+	aux := &struct {
+		Content json.RawMessage `json:"content"`
+		*Alias
+	}{
+		Alias: (*Alias)(m),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.Content = nil
+	if len(aux.Content) == 0 || string(aux.Content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(aux.Content, &text); err == nil {
+		m.Content = text
+		return nil
+	}
+
+	var rawBlocks []json.RawMessage
+	if err := json.Unmarshal(aux.Content, &rawBlocks); err != nil {
+		return fmt.Errorf("parse user content: %w", err)
+	}
+	content, err := unmarshalContentBlocks(rawBlocks)
+	if err != nil {
+		return err
+	}
+	m.Content = content
+
+	return nil
+}
+
 // AssistantMessage represents a message from the assistant.
 type AssistantMessage struct {
 	MessageType string                 `json:"type"`
@@ -181,15 +223,25 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	// Parse each content block based on its type
-	m.Content = make([]ContentBlock, 0, len(aux.Content))
-	for _, rawBlock := range aux.Content {
+	content, err := unmarshalContentBlocks(aux.Content)
+	if err != nil {
+		return err
+	}
+	m.Content = content
+
+	return nil
+}
+
+// unmarshalContentBlocks decodes raw content blocks into their concrete types.
+func unmarshalContentBlocks(rawBlocks []json.RawMessage) ([]ContentBlock, error) {
+	blocks := make([]ContentBlock, 0, len(rawBlocks))
+	for _, rawBlock := range rawBlocks {
 		// First parse to get the type field
 		var typeHolder struct {
 			Type string `json:"type"`
 		}
 		if err := json.Unmarshal(rawBlock, &typeHolder); err != nil {
-			return fmt.Errorf("parse content block type: %w", err)
+			return nil, fmt.Errorf("parse content block type: %w", err)
 		}
 
 		// Create the appropriate concrete type based on the type field
@@ -198,35 +250,36 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 		case ContentBlockTypeText:
 			var tb TextBlock
 			if err := json.Unmarshal(rawBlock, &tb); err != nil {
-				return fmt.Errorf("parse text block: %w", err)
+				return nil, fmt.Errorf("parse text block: %w", err)
 			}
 			block = &tb
 		case ContentBlockTypeThinking:
 			var tb ThinkingBlock
 			if err := json.Unmarshal(rawBlock, &tb); err != nil {
-				return fmt.Errorf("parse thinking block: %w", err)
+				return nil, fmt.Errorf("parse thinking block: %w", err)
 			}
 			block = &tb
 		case ContentBlockTypeToolUse:
 			var tb ToolUseBlock
 			if err := json.Unmarshal(rawBlock, &tb); err != nil {
-				return fmt.Errorf("parse tool use block: %w", err)
+				return nil, fmt.Errorf("parse tool use block: %w", err)
 			}
 			block = &tb
 		case ContentBlockTypeToolResult:
 			var tb ToolResultBlock
 			if err := json.Unmarshal(rawBlock, &tb); err != nil {
-				return fmt.Errorf("parse tool result block: %w", err)
+				return nil, fmt.Errorf("parse tool result block: %w", err)
 			}
 			block = &tb
 		default:
-			return fmt.Errorf("unknown content block type: %s", typeHolder.Type)
+			// Image, document and future block types are kept as received
+			block = &RawBlock{MessageType: typeHolder.Type, Raw: append(json.RawMessage(nil), rawBlock...)}
 		}
 
-		m.Content = append(m.Content, block)
+		blocks = append(blocks, block)
 	}
 
-	return nil
+	return blocks, nil
 }
 
 // PluginInfo contains information about an active plugin.
@@ -352,6 +405,27 @@ func (b *ToolUseBlock) MarshalJSON() ([]byte, error) {
 	return MarshalWithType(b, ContentBlockTypeToolUse)
 }
 
+// UnmarshalJSON implements custom JSON unmarshaling for ToolUseBlock.
+// The CLI identifies tool uses with "id"; it is used when "tool_use_id" is absent.
+func (b *ToolUseBlock) UnmarshalJSON(data []byte) error {
+	type Alias ToolUseBlock
+	aux := &struct {
+		ID string `json:"id"`
+		*Alias
+	}{
+		Alias: (*Alias)(b),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if b.ToolUseID == "" {
+		b.ToolUseID = aux.ID
+	}
+
+	return nil
+}
+
 // ToolResultBlock represents the result of a tool use.
 type ToolResultBlock struct {
 	MessageType string `json:"type"`
@@ -370,6 +444,23 @@ func (b *ToolResultBlock) MarshalJSON() ([]byte, error) {
 	return MarshalWithType(b, ContentBlockTypeToolResult)
 }
 
+// RawBlock holds a content block of a type the SDK does not model, such as
+// an image or document block, as received from the CLI.
+type RawBlock struct {
+	MessageType string
+	Raw         json.RawMessage
+}
+
+// BlockType returns the type field of the block.
+func (b *RawBlock) BlockType() string {
+	return b.MessageType
+}
+
+// MarshalJSON returns the block as received.
+func (b *RawBlock) MarshalJSON() ([]byte, error) {
+	return b.Raw, nil
+}
+
 // RawControlMessage wraps raw control protocol messages for passthrough to the control handler.
 // Control messages are not parsed into typed structs by the parser - they are routed directly
 // to the control protocol handler which performs its own parsing.
@@ -517,6 +608,40 @@ func (m *AuthStatusMessage) MarshalJSON() ([]byte, error) {
 	return MarshalWithType(m, MessageTypeAuthStatus)
 }
 
+// ReconnectStatus is the stage of a session recovery reported by a ReconnectEvent.
+type ReconnectStatus string
+
+// Reconnect status constants
+const (
+	// ReconnectAttempting reports that the CLI is about to be respawned.
+	ReconnectAttempting ReconnectStatus = "attempting"
+	// ReconnectSucceeded reports that the respawned CLI resumed the session.
+	ReconnectSucceeded ReconnectStatus = "succeeded"
+	// ReconnectFailed reports that recovery was abandoned and the stream ends.
+	ReconnectFailed ReconnectStatus = "failed"
+)
+
+// ReconnectEvent reports a recovery attempt after the CLI process exited unexpectedly.
+// It is emitted by the SDK on the message stream when recovery is enabled.
+type ReconnectEvent struct {
+	MessageType string          `json:"type"` // always "reconnect"
+	Status      ReconnectStatus `json:"status"`
+	Attempt     int             `json:"attempt"`
+	SessionID   string          `json:"session_id,omitempty"`
+	// Err is the process exit or failed attempt that led to this event.
+	Err error `json:"-"`
+}
+
+// Type returns the message type for ReconnectEvent.
+func (m *ReconnectEvent) Type() string {
+	return MessageTypeReconnect
+}
+
+// MarshalJSON implements custom JSON marshaling for ReconnectEvent
+func (m *ReconnectEvent) MarshalJSON() ([]byte, error) {
+	return MarshalWithType(m, MessageTypeReconnect)
+}
+
 // HookResponseMessage represents hook execution response.
 // This is a system message with subtype "hook_response".
 type HookResponseMessage struct {
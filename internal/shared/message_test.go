@@ -234,6 +234,62 @@ func TestToolUseBlock(t *testing.T) {
 	}
 }
 
+func TestToolUseBlockUnmarshalCLIID(t *testing.T) {
+	var block ToolUseBlock
+	if err := json.Unmarshal([]byte(`{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}`), &block); err != nil {
+		t.Fatalf("Failed to unmarshal ToolUseBlock: %v", err)
+	}
+
+	if block.ToolUseID != "toolu_1" {
+		t.Errorf("ToolUseID: expected toolu_1, got %q", block.ToolUseID)
+	}
+}
+
+func TestUserMessageUnmarshalContentBlocks(t *testing.T) {
+	var msg UserMessage
+	data := `{"type":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"done"}]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal UserMessage: %v", err)
+	}
+
+	blocks, ok := msg.Content.([]ContentBlock)
+	if !ok || len(blocks) != 1 {
+		t.Fatalf("Expected one content block, got %#v", msg.Content)
+	}
+	if result, ok := blocks[0].(*ToolResultBlock); !ok || result.ToolUseID != "toolu_1" {
+		t.Errorf("Expected ToolResultBlock for toolu_1, got %#v", blocks[0])
+	}
+}
+
+func TestUserMessageUnmarshalImageBlock(t *testing.T) {
+	var msg UserMessage
+	image := `{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}}`
+	data := `{"type":"user","content":[{"type":"text","text":"what is this?"},` + image + `]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal UserMessage: %v", err)
+	}
+
+	blocks, ok := msg.Content.([]ContentBlock)
+	if !ok || len(blocks) != 2 {
+		t.Fatalf("Expected two content blocks, got %#v", msg.Content)
+	}
+	raw, ok := blocks[1].(*RawBlock)
+	if !ok {
+		t.Fatalf("Expected RawBlock, got %#v", blocks[1])
+	}
+	if raw.BlockType() != "image" {
+		t.Errorf("BlockType: expected image, got %q", raw.BlockType())
+	}
+
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatalf("Failed to marshal RawBlock: %v", err)
+	}
+	if string(encoded) != image {
+		t.Errorf("Expected the block as received, got %s", encoded)
+	}
+}
+
 func TestToolResultBlock(t *testing.T) {
 	toolResultBlock := &ToolResultBlock{
 		ToolUseID: "tool-use-123",
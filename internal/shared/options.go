@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"log/slog"
 	"maps"
 	"time"
 )
@@ -43,15 +44,61 @@ type BufferOptions struct {
 	// BufferSize is the buffer size for message channels.
 	BufferSize int
 
-	// MaxMessages is the maximum number of messages to process.
+	// MaxMessages is the number of messages the transport queues ahead of
+	// its subscribers before Overflow applies.
 	MaxMessages int
+
+	// Overflow decides what happens when MaxMessages messages are queued.
+	Overflow OverflowPolicy
+
+	// SpillDir is the directory of the OverflowSpill file.
+	// If empty, os.TempDir is used.
+	SpillDir string
+
+	// MaxLineSize is the longest line of CLI output, in bytes, the transport
+	// reads. A longer line is skipped and reported as a LineTooLongError.
+	MaxLineSize int
 }
 
+// DefaultMaxLineSize is the MaxLineSize used when BufferOptions.MaxLineSize is zero.
+const DefaultMaxLineSize = 64 * 1024 * 1024
+
 // DefaultBufferOptions returns default buffer options.
 func DefaultBufferOptions() BufferOptions {
 	return BufferOptions{
 		BufferSize:  100,
 		MaxMessages: 1000,
+		MaxLineSize: DefaultMaxLineSize,
+	}
+}
+
+// OverflowPolicy decides what the transport does when its message queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading CLI output until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropDeltas discards partial StreamEvent deltas, oldest first,
+	// to make room. It blocks when no delta is queued.
+	OverflowDropDeltas
+
+	// OverflowSpill writes the messages that do not fit to a temporary file
+	// and delivers them, in order, once the queue drains.
+	OverflowSpill
+)
+
+// String returns the policy name.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropDeltas:
+		return "drop_deltas"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return "unknown"
 	}
 }
 
@@ -91,9 +138,13 @@ type DebugOptions struct {
 	// CacheTTL sets the cache expiration time.
 	CacheTTL string
 
-	// Logger interface for logging operations.
+	// Logger receives SDK diagnostics through a printf-style interface.
 	Logger Logger
 
+	// Slog receives SDK diagnostics as structured records. It takes
+	// precedence over Logger.
+	Slog *slog.Logger
+
 	// EnableMetrics enables performance metrics collection.
 	EnableMetrics bool
 }
@@ -155,6 +206,21 @@ func WithBufMaxMessages(max int) BufferOptionFunc {
 	return func(o *BufferOptions) { o.MaxMessages = max }
 }
 
+// WithBufOverflow sets Overflow on BufferOptions.
+func WithBufOverflow(policy OverflowPolicy) BufferOptionFunc {
+	return func(o *BufferOptions) { o.Overflow = policy }
+}
+
+// WithBufSpillDir sets SpillDir on BufferOptions.
+func WithBufSpillDir(dir string) BufferOptionFunc {
+	return func(o *BufferOptions) { o.SpillDir = dir }
+}
+
+// WithBufMaxLineSize sets MaxLineSize on BufferOptions.
+func WithBufMaxLineSize(size int) BufferOptionFunc {
+	return func(o *BufferOptions) { o.MaxLineSize = size }
+}
+
 // ModelOptionFunc is a function that configures ModelOptions.
 type ModelOptionFunc func(*ModelOptions)
 
@@ -201,6 +267,11 @@ func WithDebugLogger(logger Logger) DebugOptionFunc {
 	return func(o *DebugOptions) { o.Logger = logger }
 }
 
+// WithDebugSlog sets Slog on DebugOptions.
+func WithDebugSlog(logger *slog.Logger) DebugOptionFunc {
+	return func(o *DebugOptions) { o.Slog = logger }
+}
+
 // WithDebugEnableMetrics sets EnableMetrics on DebugOptions.
 func WithDebugEnableMetrics(enable bool) DebugOptionFunc {
 	return func(o *DebugOptions) { o.EnableMetrics = enable }
@@ -280,6 +351,105 @@ type SandboxSettings struct {
 	WorkingDir string            `json:"workingDir,omitempty"`
 }
 
+// DefaultRecoveryAttempts is the number of respawn attempts used when
+// RecoveryOptions.MaxAttempts is zero.
+const DefaultRecoveryAttempts = 3
+
+// RecoveryOptions configures automatic recovery of interactive sessions whose
+// CLI process exits unexpectedly. The CLI is respawned with --resume and the
+// control protocol is initialized again.
+type RecoveryOptions struct {
+	// MaxAttempts is the number of respawns allowed between completed turns.
+	// Zero means DefaultRecoveryAttempts.
+	MaxAttempts int
+
+	// Backoff is the delay before the first attempt. Later attempts wait
+	// Backoff multiplied by the attempt number.
+	Backoff time.Duration
+
+	// ResendInFlight re-sends the user message whose turn was cut short by the crash.
+	ResendInFlight bool
+}
+
+// Shutdown grace period defaults, used for fields left at their zero value.
+const (
+	DefaultShutdownStdinGrace     = 5 * time.Second
+	DefaultShutdownInterruptGrace = 2 * time.Second
+	DefaultShutdownTerminateGrace = 2 * time.Second
+)
+
+// ShutdownOptions configures how the CLI process is stopped on Close.
+// Shutdown escalates in stages: stdin is closed, then SIGINT, SIGTERM and
+// finally SIGKILL are sent to the CLI's process group, each stage waiting
+// its grace period for the CLI to exit. Zero fields use the Default* constants.
+type ShutdownOptions struct {
+	// StdinGrace is how long the CLI may take to exit after stdin is closed.
+	StdinGrace time.Duration
+
+	// InterruptGrace is how long the CLI may take to exit after SIGINT.
+	InterruptGrace time.Duration
+
+	// TerminateGrace is how long the CLI may take to exit after SIGTERM.
+	TerminateGrace time.Duration
+}
+
+// TimeoutAction decides how the transport ends work whose deadline expired.
+type TimeoutAction int
+
+const (
+	// TimeoutActionInterrupt interrupts an expired turn through the control
+	// protocol, keeping the session, and ends an expired session by closing
+	// stdin. The process group is killed when the CLI does not comply.
+	TimeoutActionInterrupt TimeoutAction = iota
+
+	// TimeoutActionKill kills the CLI's process group, ending the session.
+	TimeoutActionKill
+)
+
+// String returns the action name.
+func (a TimeoutAction) String() string {
+	switch a {
+	case TimeoutActionInterrupt:
+		return "interrupt"
+	case TimeoutActionKill:
+		return "kill"
+	default:
+		return "unknown"
+	}
+}
+
+// DeadlineOptions bounds how long the transport waits on the CLI. An expired
+// deadline is reported as a TimeoutError naming its limit, after which Action
+// is applied. Zero durations disable the corresponding deadline.
+type DeadlineOptions struct {
+	// Idle is the longest the CLI may go without output during a turn.
+	Idle time.Duration
+
+	// Turn is the longest a turn may take, from the prompt to its result.
+	Turn time.Duration
+
+	// Session is the longest the session may last after Connect.
+	Session time.Duration
+
+	// Action decides how an expired turn or session is ended.
+	Action TimeoutAction
+}
+
+// DefaultControlWorkers is the default number of control requests from the
+// CLI handled concurrently.
+const DefaultControlWorkers = 4
+
+// ControlDispatchOptions configures how control requests from the CLI, such
+// as permission checks, hook callbacks and SDK MCP tool calls, are handled.
+// They are handled off the goroutine that reads the CLI's output, so that a
+// slow callback does not hold up other messages. Requests about the same
+// tool use are handled one after the other, in the order they arrived.
+type ControlDispatchOptions struct {
+	// Workers is the number of requests handled concurrently.
+	// Defaults to DefaultControlWorkers.
+	Workers int
+}
+
 // =============================================================================
 // Logger Interface
 // =============================================================================
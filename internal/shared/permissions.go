@@ -1,6 +1,9 @@
 package shared
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // PermissionMode controls how tool executions are handled.
 type PermissionMode string
@@ -14,6 +17,42 @@ const (
 	PermissionModeDontAsk           PermissionMode = "dontAsk"
 )
 
+// cliPermissionModes maps every accepted permission mode to the CLI's
+// --permission-mode value. The SDK modes ("auto", "read", "write",
+// "restricted") and the V2 names ("accept_edits", "grant",
+// "bypass_permissions") are translated; the CLI's own modes pass through.
+// An empty value keeps the CLI default.
+var cliPermissionModes = map[string]string{
+	"":                                      "",
+	"auto":                                  "",
+	"read":                                  string(PermissionModePlan),
+	"write":                                 string(PermissionModeAcceptEdits),
+	"restricted":                            string(PermissionModeDefault),
+	"accept_edits":                          string(PermissionModeAcceptEdits),
+	"grant":                                 string(PermissionModeAcceptEdits),
+	"bypass_permissions":                    string(PermissionModeBypassPermissions),
+	string(PermissionModeDefault):           string(PermissionModeDefault),
+	string(PermissionModeAcceptEdits):       string(PermissionModeAcceptEdits),
+	string(PermissionModeBypassPermissions): string(PermissionModeBypassPermissions),
+	string(PermissionModePlan):              string(PermissionModePlan),
+	string(PermissionModeDelegate):          string(PermissionModeDelegate),
+	string(PermissionModeDontAsk):           string(PermissionModeDontAsk),
+}
+
+// CLIPermissionMode maps a permission mode to the CLI's --permission-mode value.
+// An empty result means the flag is omitted. Unknown modes return a
+// ConfigurationError instead of silently falling back to the CLI default.
+func CLIPermissionMode(mode string) (string, error) {
+	cliMode, ok := cliPermissionModes[mode]
+	if !ok {
+		return "", NewConfigurationError("PermissionMode", mode,
+			fmt.Sprintf("invalid permission mode, must be one of: auto, read, write, restricted, accept_edits, grant, bypass_permissions, %s, %s, %s, %s, %s, %s",
+				PermissionModeDefault, PermissionModeAcceptEdits, PermissionModeBypassPermissions,
+				PermissionModePlan, PermissionModeDelegate, PermissionModeDontAsk))
+	}
+	return cliMode, nil
+}
+
 // PermissionBehavior determines how a permission request is handled.
 type PermissionBehavior string
 
@@ -80,7 +119,8 @@ type CanUseToolOptions struct {
 //   - Modify input: Set UpdatedInput field
 //   - Suggest permission updates: Set UpdatedPermissions field
 //
-// Context may be cancelled if session times out.
+// Context is cancelled if the session times out, the turn is interrupted or
+// the CLI withdraws the request; the decision is then discarded.
 type CanUseToolCallback func(
 	ctx context.Context,
 	toolName string,
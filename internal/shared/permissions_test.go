@@ -15,6 +15,36 @@ func TestPermissionModeConstants(t *testing.T) {
 	assert.Equal(t, PermissionMode("dontAsk"), PermissionModeDontAsk)
 }
 
+func TestCLIPermissionMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", ""},
+		{"auto", ""},
+		{"read", "plan"},
+		{"write", "acceptEdits"},
+		{"restricted", "default"},
+		{"accept_edits", "acceptEdits"},
+		{"grant", "acceptEdits"},
+		{"bypass_permissions", "bypassPermissions"},
+		{"default", "default"},
+		{"acceptEdits", "acceptEdits"},
+		{"bypassPermissions", "bypassPermissions"},
+		{"plan", "plan"},
+		{"delegate", "delegate"},
+		{"dontAsk", "dontAsk"},
+	}
+	for _, tt := range tests {
+		got, err := CLIPermissionMode(tt.mode)
+		assert.NoError(t, err, tt.mode)
+		assert.Equal(t, tt.want, got, tt.mode)
+	}
+
+	_, err := CLIPermissionMode("acceptedits")
+	assert.True(t, IsConfigurationError(err))
+}
+
 func TestPermissionBehaviorConstants(t *testing.T) {
 	assert.Equal(t, PermissionBehavior("allow"), PermissionBehaviorAllow)
 	assert.Equal(t, PermissionBehavior("deny"), PermissionBehaviorDeny)
@@ -0,0 +1,100 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResourceLimits bounds the resources of the CLI process and the processes it
+// spawns, such as commands run by its Bash tool. Zero fields leave the
+// corresponding limit unchanged. Resource limits are supported on Linux only.
+// The rlimits are in effect before the CLI executes: it is started through
+// /bin/sh, which execs it in place once they are set.
+type ResourceLimits struct {
+	// CPUTime is the CPU time each process may use (RLIMIT_CPU).
+	CPUTime time.Duration
+
+	// AddressSpace is the virtual memory, in bytes, each process may map (RLIMIT_AS).
+	AddressSpace uint64
+
+	// OpenFiles is the number of file descriptors each process may open (RLIMIT_NOFILE).
+	OpenFiles uint64
+
+	// Processes is the number of processes the user may run (RLIMIT_NPROC).
+	// Like RLIMIT_NPROC it counts every process of the user, not just the CLI's.
+	Processes uint64
+
+	// Cgroup places the CLI process tree into a cgroup v2 of its own.
+	// Nil leaves the CLI in the cgroup of the SDK process.
+	Cgroup *CgroupLimits
+}
+
+// CgroupLimits configures the cgroup v2 created for each CLI process.
+type CgroupLimits struct {
+	// Parent is the cgroup v2 directory under which the CLI's cgroup is
+	// created, such as /sys/fs/cgroup/agents. It must be writable and enable
+	// the memory and cpu controllers for its children when the limits below
+	// are set.
+	Parent string
+
+	// MemoryMax is the memory, in bytes, the process tree may use (memory.max).
+	// Zero means no limit.
+	MemoryMax uint64
+
+	// CPUs is the CPU bandwidth of the process tree, in CPUs (cpu.max).
+	// Zero means no limit.
+	CPUs float64
+}
+
+// Resource names a limit reported by a ResourceLimitError.
+type Resource string
+
+// Resources that can be limited.
+const (
+	ResourceCPUTime      Resource = "cpu_time"
+	ResourceAddressSpace Resource = "address_space"
+	ResourceOpenFiles    Resource = "open_files"
+	ResourceProcesses    Resource = "processes"
+	ResourceMemory       Resource = "memory"
+)
+
+// ResourceLimitError reports that the CLI process tree hit a resource limit.
+// It wraps the ProcessError describing how the CLI exited.
+type ResourceLimitError struct {
+	BaseError
+	Resource Resource
+	Limit    string
+}
+
+// Error returns a descriptive error message for ResourceLimitError.
+func (e *ResourceLimitError) Error() string {
+	var b strings.Builder
+	b.WriteString("resource limit exceeded")
+	fmt.Fprintf(&b, " (resource=%s)", e.Resource)
+	if e.Limit != "" {
+		fmt.Fprintf(&b, " (limit=%s)", e.Limit)
+	}
+	e.FormatInner(&b)
+	return b.String()
+}
+
+// Type returns the error type for SDKError compliance.
+func (e *ResourceLimitError) Type() string { return "resource_limit" }
+
+// NewResourceLimitError creates a new ResourceLimitError.
+func NewResourceLimitError(resource Resource, limit string, inner error) *ResourceLimitError {
+	return &ResourceLimitError{
+		BaseError: BaseError{Inner: inner},
+		Resource:  resource,
+		Limit:     limit,
+	}
+}
+
+// IsResourceLimitError checks if an error is a ResourceLimitError.
+func IsResourceLimitError(err error) bool { return IsErrorType[*ResourceLimitError](err) }
+
+// AsResourceLimitError extracts a ResourceLimitError from the error chain.
+func AsResourceLimitError(err error) (*ResourceLimitError, bool) {
+	return AsErrorType[*ResourceLimitError](err)
+}
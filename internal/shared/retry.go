@@ -0,0 +1,240 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Retry policy defaults, used for fields left at their zero value.
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff     = 5 * time.Second
+	DefaultRetryMultiplier     = 2.0
+)
+
+// RetryPolicy controls how transient failures are retried.
+// Zero fields fall back to the Default* constants, except Jitter,
+// where zero disables jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Set to 1 to disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the delay after each retry. 1 gives a constant backoff.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction in either direction.
+	// 0.5 spreads delays between 0.5x and 1.5x of the computed backoff.
+	Jitter float64
+
+	// RateLimitBackoff is the minimum delay after a rate-limit error.
+	// Defaults to MaxBackoff.
+	RateLimitBackoff time.Duration
+
+	// Retryable classifies errors. Defaults to IsRetryableError.
+	Retryable func(err error) bool
+
+	// OnRetry is called before each retry with the attempt that failed,
+	// its error and the delay before the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured:
+// three attempts with exponential backoff from 100ms and 50% jitter.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{Jitter: 0.5}
+}
+
+// Attempts returns the total number of attempts allowed.
+func (p *RetryPolicy) Attempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultRetryMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// ShouldRetry reports whether err is worth another attempt.
+func (p *RetryPolicy) ShouldRetry(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// Delay returns the delay before the next attempt after attempt failed with err.
+// Attempts are numbered from 1.
+func (p *RetryPolicy) Delay(attempt int, err error) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		delay *= 1 - p.Jitter + rand.Float64()*2*p.Jitter
+	}
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+
+	if IsRateLimitError(err) {
+		floor := p.RateLimitBackoff
+		if floor <= 0 {
+			floor = maxBackoff
+		}
+		if delay < float64(floor) {
+			delay = float64(floor)
+		}
+	}
+
+	return time.Duration(delay)
+}
+
+// Do runs fn until it succeeds, fails with an error the policy does not retry,
+// or runs out of attempts. operation names the action in returned errors.
+func (p *RetryPolicy) Do(ctx context.Context, operation string, fn func() error) error {
+	attempts := p.Attempts()
+	var lastErr error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if !p.ShouldRetry(err) {
+			return fmt.Errorf("%s: non-retryable error: %w", operation, err)
+		}
+
+		lastErr = fmt.Errorf("%s (attempt %d/%d): %w", operation, attempt, attempts, err)
+
+		if attempt < attempts {
+			if err := p.Wait(ctx, attempt, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fmt.Errorf("%s failed after %d attempts: %w", operation, attempts, lastErr)
+}
+
+// Wait reports the retry to OnRetry and sleeps for the delay after attempt
+// failed with err. It returns the context error if ctx ends first.
+func (p *RetryPolicy) Wait(ctx context.Context, attempt int, err error) error {
+	delay := p.Delay(attempt, err)
+	if p.OnRetry != nil {
+		p.OnRetry(attempt, err, delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsRetryableError is the default retry classifier. It accepts connection,
+// timeout and process errors, retryable API errors and transient system errors.
+// Resource limit errors and process errors with a recognized exit cause, such
+// as an authentication failure or a rejected flag, are never retried.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Running into a resource limit again gains nothing
+	if IsResourceLimitError(err) {
+		return false
+	}
+
+	// A CLI that failed for a known cause fails the same way again
+	if procErr, ok := AsProcessError(err); ok {
+		return procErr.Cause == ExitCauseUnknown
+	}
+
+	if IsConnectionError(err) || IsTimeoutError(err) {
+		return true
+	}
+
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.Retryable()
+	}
+
+	return errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// APIError is an error the CLI reported in an assistant message,
+// such as a rate limit or an overloaded API.
+type APIError struct {
+	Kind AssistantMessageError
+}
+
+// Error returns a descriptive error message for APIError.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %s", e.Kind)
+}
+
+// Type returns the error type for SDKError compliance.
+func (e *APIError) Type() string { return "api" }
+
+// Retryable reports whether the error is transient: a rate limit or a server error.
+func (e *APIError) Retryable() bool {
+	return e.Kind == AssistantMessageErrorRateLimit || e.Kind == AssistantMessageErrorServer
+}
+
+// NewAPIError creates an APIError for an assistant message error kind.
+func NewAPIError(kind AssistantMessageError) *APIError {
+	return &APIError{Kind: kind}
+}
+
+// IsAPIError checks if an error is an APIError.
+func IsAPIError(err error) bool { return IsErrorType[*APIError](err) }
+
+// AsAPIError extracts an APIError from an error chain.
+func AsAPIError(err error) (*APIError, bool) { return AsErrorType[*APIError](err) }
+
+// IsRateLimitError checks if an error is a rate-limit APIError.
+func IsRateLimitError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.Kind == AssistantMessageErrorRateLimit
+}
@@ -0,0 +1,166 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+	transient := NewConnectionError("refused", nil)
+
+	tests := []struct {
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{1, transient, 10 * time.Millisecond},
+		{2, transient, 20 * time.Millisecond},
+		{3, transient, 40 * time.Millisecond},
+		{4, transient, 50 * time.Millisecond},
+		{1, NewAPIError(AssistantMessageErrorRateLimit), 50 * time.Millisecond},
+		{1, NewAPIError(AssistantMessageErrorServer), 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt, tt.err); got != tt.want {
+			t.Errorf("Delay(%d, %v) = %v, want %v", tt.attempt, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+	for range 100 {
+		delay := policy.Delay(1, nil)
+		if delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("delay %v outside jitter range", delay)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	t.Parallel()
+
+	var retries []int
+	policy := &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		OnRetry: func(attempt int, _ error, _ time.Duration) {
+			retries = append(retries, attempt)
+		},
+	}
+
+	calls := 0
+	err := policy.Do(context.Background(), "connect", func() error {
+		calls++
+		if calls < 3 {
+			return NewConnectionError("refused", nil)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if calls != 3 || len(retries) != 2 || retries[1] != 2 {
+		t.Errorf("calls = %d, retries = %v", calls, retries)
+	}
+}
+
+func TestRetryPolicyDoStops(t *testing.T) {
+	t.Parallel()
+
+	t.Run("non-retryable", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		err := (&RetryPolicy{}).Do(context.Background(), "connect", func() error {
+			calls++
+			return errors.New("bad flag")
+		})
+		if calls != 1 || err == nil || err.Error() != "connect: non-retryable error: bad flag" {
+			t.Errorf("calls = %d, err = %v", calls, err)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		policy := &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+		err := policy.Do(context.Background(), "connect", func() error {
+			calls++
+			return NewTimeoutError("initialize", "1s")
+		})
+		if calls != 2 || !IsTimeoutError(err) {
+			t.Errorf("calls = %d, err = %v", calls, err)
+		}
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		policy := &RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			Retryable:      func(error) bool { return false },
+		}
+		_ = policy.Do(context.Background(), "connect", func() error {
+			calls++
+			return NewConnectionError("refused", nil)
+		})
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+}
+
+// processErrorWithCause returns a ProcessError of a CLI that failed for cause.
+func processErrorWithCause(cause ExitCause) *ProcessError {
+	err := NewProcessError(1, "claude", "exited", "")
+	err.Cause = cause
+	return err
+}
+
+func TestIsRetryableError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection", NewConnectionError("refused", nil), true},
+		{"timeout", NewTimeoutError("initialize", "1s"), true},
+		{"process", NewProcessError(1, "claude", "killed", "SIGKILL"), true},
+		{"rate limit", NewAPIError(AssistantMessageErrorRateLimit), true},
+		{"server error", NewAPIError(AssistantMessageErrorServer), true},
+		{"auth failed", NewAPIError(AssistantMessageErrorAuthFailed), false},
+		{"wrapped errno", fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"message mentioning timeout", errors.New("invalid timeout flag"), false},
+		{"configuration", NewConfigurationError("model", "x", "unknown"), false},
+		{"resource limit", NewResourceLimitError(ResourceMemory, "1024", NewProcessError(1, "claude", "exited", "killed")), false},
+		{"auth failure", processErrorWithCause(ExitCauseAuth), false},
+		{"invalid model", processErrorWithCause(ExitCauseInvalidModel), false},
+		{"bad flag", processErrorWithCause(ExitCauseBadFlag), false},
+		{"unsupported version", processErrorWithCause(ExitCauseUnsupportedVersion), false},
+		{"wrapped auth failure", fmt.Errorf("connect: %w", processErrorWithCause(ExitCauseAuth)), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableError(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryableError() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -307,12 +306,10 @@ func ValidateModel(model string) error {
 }
 
 // ValidatePermissionMode validates a permission mode.
+// Accepts every mode CLIPermissionMode can map.
 func ValidatePermissionMode(mode string) error {
-	validModes := []string{"auto", "read", "write", "restricted"}
-	if slices.Contains(validModes, mode) {
-		return nil
-	}
-	return fmt.Errorf("invalid permission mode: %s (must be one of: %v)", mode, validModes)
+	_, err := CLIPermissionMode(mode)
+	return err
 }
 
 // ValidateTimeout validates a timeout string.
@@ -510,6 +507,8 @@ func sanitizeContentBlock(block ContentBlock) any {
 			"tool_use_id": b.ToolUseID,
 			"is_error":    b.IsError,
 		}
+	case *RawBlock:
+		return map[string]any{"type": b.MessageType}
 	default:
 		return fmt.Sprintf("unknown content block type: %T", block)
 	}
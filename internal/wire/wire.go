@@ -0,0 +1,82 @@
+// Package wire carries newline-delimited lines over byte streams, such as
+// the TCP connections of remote relays and of the fake CLI of claudetest.
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrLineTooLong is returned by ReadLine for a line over the read limit.
+var ErrLineTooLong = errors.New("line exceeds the read limit")
+
+// LineConn carries newline-delimited lines over a byte stream.
+type LineConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	limit int
+	wmu   sync.Mutex
+}
+
+// NewLineConn returns a LineConn over conn.
+func NewLineConn(conn net.Conn) *LineConn {
+	return &LineConn{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// ReadLine reads up to the next newline and returns the line without it.
+// Without a read limit the line may be of any length. A final line without
+// a newline is reported as io.ErrUnexpectedEOF.
+func (c *LineConn) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if c.limit > 0 && len(bytes.TrimSuffix(line, []byte("\n"))) > c.limit {
+			return nil, ErrLineTooLong
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(line) > 0:
+			return nil, io.ErrUnexpectedEOF
+		case err != nil:
+			return nil, err
+		}
+		return bytes.TrimSuffix(line[:len(line)-1], []byte("\r")), nil
+	}
+}
+
+// SetReadLimit caps the size of the lines ReadLine returns; 0 lifts the cap.
+func (c *LineConn) SetReadLimit(n int) { c.limit = n }
+
+// SetReadDeadline sets the deadline of ReadLine; the zero time clears it.
+func (c *LineConn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// WriteLine sends line, which must not contain a newline. It is safe to
+// call from several goroutines.
+func (c *LineConn) WriteLine(line []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	buf := make([]byte, 0, len(line)+1)
+	buf = append(append(buf, line...), '\n')
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// CloseWrite half-closes the connection, so that the peer reads EOF while
+// lines can still be read. It is a no-op on connections without half close.
+func (c *LineConn) CloseWrite() error {
+	if cw, ok := c.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (c *LineConn) Close() error { return c.conn.Close() }
@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipe returns a LineConn that reads input.
+func pipe(t *testing.T, input string) *LineConn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	go func() {
+		_, _ = io.WriteString(client, input)
+		_ = client.Close()
+	}()
+	conn := NewLineConn(server)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestLineConn_ReadLine(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 5000)
+	conn := pipe(t, "first\r\n"+long+"\npartial")
+
+	for _, want := range []string{"first", long} {
+		line, err := conn.ReadLine()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(line))
+	}
+
+	_, err := conn.ReadLine()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestLineConn_ReadLimit(t *testing.T) {
+	t.Parallel()
+
+	conn := pipe(t, strings.Repeat("x", 5000)+"\n")
+	conn.SetReadLimit(4096)
+
+	_, err := conn.ReadLine()
+	assert.ErrorIs(t, err, ErrLineTooLong)
+}
+
+func TestLineConn_WriteLine(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	conn, peer := NewLineConn(server), NewLineConn(client)
+	defer conn.Close()
+	defer peer.Close()
+
+	go func() { _ = conn.WriteLine([]byte("hello")) }()
+
+	line, err := peer.ReadLine()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(line))
+}